@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Thresholds of report analyze
+const (
+	// analyzeKneeGain is the speedup per doubling of workers below which the
+	// scaling curve is considered flat
+	analyzeKneeGain = 1.1
+	// analyzeCPUBound and analyzeIOBound bound the share of the usable cores
+	// that were busy, above which a scan counts as CPU-bound and below which
+	// it counts as waiting for I/O
+	analyzeCPUBound = 0.7
+	analyzeIOBound  = 0.4
+	// analyzeKernelShare is the share of system time above which the CPU time
+	// is mostly spent in system calls
+	analyzeKernelShare = 0.6
+)
+
+// runReportAnalyze writes a short analysis of every fixture of a results file
+func runReportAnalyze(args []string) error {
+	fs := flag.NewFlagSet("report analyze", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("results file is required")
+	}
+	results, err := loadResultsCSV(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("%s: no results", fs.Arg(0))
+	}
+	analyzeResults(os.Stdout, results)
+	return nil
+}
+
+// analyzeResults writes the analysis of every group of results that share a
+// fixture, in the order the groups ran
+func analyzeResults(w io.Writer, results []BenchmarkResult) {
+	groups := map[string][]BenchmarkResult{}
+	order := []string{}
+	for _, r := range results {
+		key := summaryGroup(r)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	for i, key := range order {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		analyzeFixture(w, groups[key])
+	}
+}
+
+// analyzeFixture writes the best strategy, the knee of its scaling curve, the
+// estimated serial fraction and whether the scan looks CPU- or I/O-bound
+func analyzeFixture(w io.Writer, results []BenchmarkResult) {
+	name := results[0].Structure
+	if results[0].Target != "" {
+		name += " @" + results[0].Target
+	}
+	fmt.Fprintf(w, "===== %s =====\n", name)
+
+	measured := []BenchmarkResult{}
+	for _, r := range results {
+		if !r.TimedOut {
+			measured = append(measured, r)
+		}
+	}
+	if len(measured) == 0 {
+		fmt.Fprintln(w, "すべてのセルがタイムアウトしたため分析できません")
+		return
+	}
+	sort.SliceStable(measured, func(i, j int) bool { return measured[i].Duration < measured[j].Duration })
+
+	best := measured[0]
+	fmt.Fprintf(w, "最速: %s（ワーカー数 %d、%v）\n", best.Label(), best.Workers, best.Duration.Round(time.Microsecond))
+	for _, r := range measured[1:] {
+		if r.Label() != best.Label() {
+			fmt.Fprintf(w, "  次点の %s（ワーカー数 %d）より %.0f%% 速い\n", r.Label(), r.Workers,
+				(1-best.Duration.Seconds()/r.Duration.Seconds())*100)
+			break
+		}
+	}
+
+	// The scaling curve of the fastest strategy that has a worker count
+	label := ""
+	for _, r := range measured {
+		if r.Workers > 0 {
+			label = r.Label()
+			break
+		}
+	}
+	curve := []BenchmarkResult{}
+	for _, r := range measured {
+		if r.Label() == label {
+			curve = append(curve, r)
+		}
+	}
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Workers < curve[j].Workers })
+	if len(curve) < 2 || curve[0].Workers != 1 {
+		fmt.Fprintln(w, "スケーリング: 1ワーカーを含む複数のワーカー数の結果がないため分析できません")
+	} else {
+		analyzeScaling(w, label, curve)
+	}
+
+	analyzeBoundness(w, best)
+}
+
+// analyzeScaling describes the knee of a scaling curve starting at 1 worker
+// and the serial fraction estimated from it
+func analyzeScaling(w io.Writer, label string, curve []BenchmarkResult) {
+	serial := curve[0].Duration.Seconds()
+	knee := -1
+	for i := 0; i+1 < len(curve); i++ {
+		doublings := math.Log2(float64(curve[i+1].Workers) / float64(curve[i].Workers))
+		gain := math.Pow(curve[i].Duration.Seconds()/curve[i+1].Duration.Seconds(), 1/doublings)
+		if gain < analyzeKneeGain {
+			knee = i
+			break
+		}
+	}
+	last := curve[len(curve)-1]
+	switch {
+	case knee == 0:
+		fmt.Fprintf(w, "スケーリング: %s はワーカーを増やしても速くなりません（1→%d ワーカーで %.2fx）\n",
+			label, curve[1].Workers, serial/curve[1].Duration.Seconds())
+	case knee > 0:
+		fmt.Fprintf(w, "スケーリング: %s はワーカー数 %d で頭打ち（曲線の膝）。それ以上はワーカー数を倍にしても速度向上が%.0f%%未満です\n",
+			label, curve[knee].Workers, (analyzeKneeGain-1)*100)
+	default:
+		fmt.Fprintf(w, "スケーリング: %s は計測した最大のワーカー数 %d まで伸び続けています（%.2fx）。さらに多いワーカー数も試す価値があります\n",
+			label, last.Workers, serial/last.Duration.Seconds())
+	}
+
+	// Karp-Flatt metric: the serial fraction that explains the speedup at p
+	// workers under Amdahl's law, taken as the median over the curve. Workers
+	// beyond the CPU count do not add processors, so those points are left
+	// out when the CPU count is known and other points remain.
+	points := curve[1:]
+	oversubscribed := false
+	if last.WorkersPerCPU > 0 {
+		cpus := int(math.Round(float64(last.Workers) / last.WorkersPerCPU))
+		within := []BenchmarkResult{}
+		for _, r := range points {
+			if r.Workers <= cpus {
+				within = append(within, r)
+			}
+		}
+		if len(within) > 0 {
+			points = within
+		} else {
+			oversubscribed = true
+		}
+	}
+	fractions := []float64{}
+	for _, r := range points {
+		p := float64(r.Workers)
+		speedup := serial / r.Duration.Seconds()
+		fractions = append(fractions, (1/speedup-1/p)/(1-1/p))
+	}
+	f := math.Min(math.Max(medianOf(fractions), 0), 1)
+	switch {
+	case f > 0 && oversubscribed:
+		fmt.Fprintf(w, "  逐次部分の推定割合: %.0f%%（Karp-Flattの指標。すべてのワーカー数がCPU数を超えるため過大に見積もられています）\n", f*100)
+	case f > 0:
+		fmt.Fprintf(w, "  逐次部分の推定割合: %.0f%%（Karp-Flattの指標。アムダールの法則による速度向上の上限は約 %.1fx）\n", f*100, 1/f)
+	default:
+		fmt.Fprintln(w, "  逐次部分の推定割合: 0%（理想的なスケーリング、またはキャッシュなどによる超線形の効果）")
+	}
+}
+
+// analyzeBoundness classifies a cell as CPU- or I/O-bound from its busy cores
+// relative to the cores its workers could use
+func analyzeBoundness(w io.Writer, r BenchmarkResult) {
+	busy := r.CPUUtilization()
+	if busy < 0 {
+		fmt.Fprintln(w, "負荷の性質: CPU時間が記録されていないため判定できません")
+		return
+	}
+	usable := float64(max(r.Workers, 1))
+	cpus := ""
+	if r.WorkersPerCPU > 0 {
+		n := math.Round(float64(r.Workers) / r.WorkersPerCPU)
+		usable = math.Min(usable, n)
+		cpus = fmt.Sprintf("、CPU %.0f", n)
+	}
+	share := busy / usable
+	detail := fmt.Sprintf("平均 %.2f コア使用 / ワーカー数 %d%s", busy, r.Workers, cpus)
+	switch {
+	case share >= analyzeCPUBound:
+		fmt.Fprintf(w, "負荷の性質: CPU律速（%s）。ワーカー数をCPU数より増やしても効果は小さいでしょう\n", detail)
+	case share <= analyzeIOBound:
+		fmt.Fprintf(w, "負荷の性質: I/O待ちが中心（%s）。CPU数より多いワーカーで待ち時間を重ねられる可能性があります\n", detail)
+	default:
+		fmt.Fprintf(w, "負荷の性質: CPUとI/Oの混在（%s）\n", detail)
+	}
+	if total := r.UserCPU + r.SystemCPU; total > 0 {
+		if system := float64(r.SystemCPU) / float64(total); system >= analyzeKernelShare {
+			fmt.Fprintf(w, "  CPU時間の %.0f%% がカーネル内（システムコール）です。ReadDirの呼び出し回数やバッファの大きさが効きます\n", system*100)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// autotuneTolerance is the relative throughput drop that still counts as no
+// worse, so that noise alone does not turn the search around
+const autotuneTolerance = 0.02
+
+// adaptiveScanner is a recursive task scanner whose number of active workers
+// can be changed while it runs. It starts maxWorkers goroutines; those with
+// an ID at or above the target wait until the target grows again.
+type adaptiveScanner struct {
+	options    ScanOptions
+	maxWorkers int
+	result     *ScanResult
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []string
+	// pending counts queued and running directories; the scan ends at zero
+	pending int
+	target  int
+	idle    int
+	done    bool
+}
+
+// newAdaptiveScanner returns a scanner running target of maxWorkers workers
+func newAdaptiveScanner(options ScanOptions, maxWorkers, target int) *adaptiveScanner {
+	s := &adaptiveScanner{options: options, maxWorkers: maxWorkers, target: target, result: &ScanResult{}}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Scan scans rootPath and returns when every directory has been listed
+func (s *adaptiveScanner) Scan(rootPath string) (*ScanResult, error) {
+	s.queue = append(s.queue, rootPath)
+	s.pending = 1
+	var wg sync.WaitGroup
+	wg.Add(s.maxWorkers)
+	for i := 0; i < s.maxWorkers; i++ {
+		id := i
+		go func() {
+			defer wg.Done()
+			s.work(id)
+		}()
+	}
+	wg.Wait()
+	return s.result, s.result.Err()
+}
+
+// entries returns the number of files and directories counted so far
+func (s *adaptiveScanner) entries() int64 {
+	return atomic.LoadInt64(&s.result.Files) + atomic.LoadInt64(&s.result.Dirs)
+}
+
+// setWorkers changes the number of active workers
+func (s *adaptiveScanner) setWorkers(n int) {
+	s.mu.Lock()
+	s.target = n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// work takes directories from the queue while the worker is active
+func (s *adaptiveScanner) work(id int) {
+	s.mu.Lock()
+	for {
+		for !s.done && (id >= s.target || len(s.queue) == 0) {
+			s.idle++
+			s.cond.Wait()
+			s.idle--
+		}
+		if s.done {
+			s.mu.Unlock()
+			return
+		}
+		path := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.mu.Unlock()
+
+		subdirs := s.list(path)
+
+		s.mu.Lock()
+		s.queue = append(s.queue, subdirs...)
+		s.pending += len(subdirs) - 1
+		if s.pending == 0 {
+			s.done = true
+			s.cond.Broadcast()
+		} else if len(subdirs) > 0 && s.idle > 0 {
+			s.cond.Broadcast()
+		}
+	}
+}
+
+// list counts the entries of a directory and returns its subdirectories
+func (s *adaptiveScanner) list(path string) []string {
+	subdirs := []string{}
+	var files int64
+	err := eachDirEntry(path, s.options, func(entry fs.DirEntry) {
+		if entry.IsDir() {
+			subdirs = append(subdirs, filepath.Join(path, entry.Name()))
+		} else {
+			files++
+		}
+	})
+	if err != nil {
+		s.result.addError(err)
+		return nil
+	}
+	atomic.AddInt64(&s.result.Files, files)
+	atomic.AddInt64(&s.result.Dirs, 1)
+	return subdirs
+}
+
+// autotuneSample is the throughput measured during one interval
+type autotuneSample struct {
+	elapsed    time.Duration
+	workers    int
+	throughput float64
+}
+
+// hillClimber searches the worker count on a log2 scale: it keeps moving
+// while throughput does not drop and turns around with half the step when it
+// does
+type hillClimber struct {
+	x, step, maxX float64
+	direction     float64
+	last          float64
+}
+
+// newHillClimber starts the search at start workers, moving up first
+func newHillClimber(start, maxWorkers int) *hillClimber {
+	return &hillClimber{
+		x:         math.Log2(float64(start)),
+		step:      1,
+		maxX:      math.Log2(float64(maxWorkers)),
+		direction: 1,
+		last:      -1,
+	}
+}
+
+// workers returns the current worker count
+func (h *hillClimber) workers() int {
+	return int(math.Round(math.Exp2(h.x)))
+}
+
+// next takes the throughput of the current worker count and returns the
+// worker count to try next
+func (h *hillClimber) next(throughput float64) int {
+	if h.last >= 0 && throughput < h.last*(1-autotuneTolerance) {
+		h.direction = -h.direction
+		h.step = math.Max(h.step/2, 0.25)
+	}
+	h.last = throughput
+	x := h.x + h.direction*h.step
+	if x < 0 || x > h.maxX {
+		// Bounce off the ends of the range
+		h.direction = -h.direction
+		x = h.x + h.direction*h.step
+	}
+	h.x = math.Min(math.Max(x, 0), h.maxX)
+	return h.workers()
+}
+
+// runOnlineTune scans root once while a hill climber adjusts the number of
+// workers every interval, and recommends the count with the best throughput
+func runOnlineTune(root string, start, maxWorkers int, interval time.Duration) int {
+	scanner := newAdaptiveScanner(defaultScanOptions(), maxWorkers, start)
+	climber := newHillClimber(start, maxWorkers)
+	fmt.Printf("オンライン調整: %s (開始 %d ワーカー, 最大 %d, 間隔 %v)\n", root, start, maxWorkers, interval)
+
+	samples := []autotuneSample{}
+	finished := make(chan struct{})
+	var result *ScanResult
+	var scanErr error
+	begin := time.Now()
+	go func() {
+		result, scanErr = scanner.Scan(root)
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last, lastTime := int64(0), begin
+	workers := start
+	for running := true; running; {
+		select {
+		case <-finished:
+			running = false
+		case now := <-ticker.C:
+			entries := scanner.entries()
+			throughput := float64(entries-last) / now.Sub(lastTime).Seconds()
+			samples = append(samples, autotuneSample{now.Sub(begin), workers, throughput})
+			fmt.Printf("  %6.1fs  ワーカー数 %3d  %10.0f エントリ/s\n", now.Sub(begin).Seconds(), workers, throughput)
+			last, lastTime = entries, now
+			workers = climber.next(throughput)
+			scanner.setWorkers(workers)
+		}
+	}
+	elapsed := time.Since(begin)
+	if scanErr != nil && result.Errors == 0 {
+		fmt.Printf("エラー: %v\n", scanErr)
+		return 1
+	}
+	fmt.Printf("\nスキャン完了: %v (ファイル: %d, ディレクトリ: %d", elapsed.Round(time.Millisecond), result.Files, result.Dirs)
+	if result.Errors > 0 {
+		fmt.Printf(", 読み取りエラー: %d", result.Errors)
+	}
+	fmt.Println(")")
+
+	if len(samples) < 3 {
+		fmt.Printf("警告: スキャンが短すぎて調整できませんでした（%d 区間）。-interval を短くするか、より大きなツリーを指定してください\n", len(samples))
+		return 1
+	}
+	printAutotuneSummary(samples)
+	return 0
+}
+
+// printAutotuneSummary prints the mean throughput of every worker count that
+// was tried and recommends the best one
+func printAutotuneSummary(samples []autotuneSample) {
+	sums := map[int]float64{}
+	counts := map[int]int{}
+	for _, s := range samples {
+		sums[s.workers] += s.throughput
+		counts[s.workers]++
+	}
+	workerCounts := []int{}
+	for w := range sums {
+		workerCounts = append(workerCounts, w)
+	}
+	sort.Ints(workerCounts)
+
+	fmt.Println("\n===== ワーカー数ごとのスループット =====")
+	table := &textTable{
+		header: []string{"Workers", "Intervals", "Entries/s"},
+		right:  []bool{true, true, true},
+	}
+	best, bestThroughput := 0, -1.0
+	for _, w := range workerCounts {
+		mean := sums[w] / float64(counts[w])
+		if mean > bestThroughput {
+			best, bestThroughput = w, mean
+		}
+		table.add(fmt.Sprintf("%d", w), fmt.Sprintf("%d", counts[w]), fmt.Sprintf("%.0f", mean))
+	}
+	table.render(os.Stdout, false)
+	fmt.Printf("\n推奨ワーカー数: %d (平均 %.0f エントリ/s)\n", best, bestThroughput)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// StrategyBulkAttr lists every directory with getattrlistbulk, which returns
+// the names and types (and the sizes under -workload stat) of many entries
+// per call (macOS)
+const StrategyBulkAttr = "getattrlistbulk"
+
+// Attribute bits of <sys/attr.h> requested from getattrlistbulk
+const (
+	attrCmnName          = 0x00000001
+	attrCmnObjType       = 0x00000008
+	attrCmnError         = 0x20000000
+	attrCmnReturnedAttrs = 0x80000000
+	attrFileDataLength   = 0x00000200
+)
+
+// Object types of ATTR_CMN_OBJTYPE (enum vtype of <sys/vnode.h>)
+const (
+	vtypeReg = 1
+	vtypeDir = 2
+	vtypeLnk = 5
+)
+
+// bulkAttrHeaderSize is the length field and the returned attribute_set_t
+// that start every entry
+const bulkAttrHeaderSize = 4 + 5*4
+
+// bulkAttrEntry is an entry decoded from a getattrlistbulk buffer
+type bulkAttrEntry struct {
+	name string
+	// typ is the vtype of the entry
+	typ uint32
+	// size is the logical size of regular files when requested, else 0
+	size int64
+	// errno is the error of reading the attributes of the entry, 0 if none
+	errno uint32
+}
+
+// parseBulkAttrs decodes count entries packed by getattrlistbulk into buf
+// and calls fn for each. Attributes are packed in the order of their bits,
+// ATTR_CMN_ERROR first, and only when returned, so every entry is decoded
+// from its own returned set.
+func parseBulkAttrs(buf []byte, count int, fn func(bulkAttrEntry)) error {
+	ne := binary.NativeEndian
+	for i := 0; i < count; i++ {
+		if len(buf) < 4 {
+			return fmt.Errorf("getattrlistbulk: %d of %d entries decoded, buffer exhausted", i, count)
+		}
+		length := int(ne.Uint32(buf))
+		if length < bulkAttrHeaderSize || length > len(buf) {
+			return fmt.Errorf("getattrlistbulk: malformed entry of %d bytes", length)
+		}
+		entry := buf[:length]
+		buf = buf[length:]
+		common, file := ne.Uint32(entry[4:]), ne.Uint32(entry[16:])
+		pos := bulkAttrHeaderSize
+		field := func(size int) ([]byte, error) {
+			if pos+size > length {
+				return nil, fmt.Errorf("getattrlistbulk: entry of %d bytes too short for its attributes", length)
+			}
+			b := entry[pos : pos+size]
+			pos += size
+			return b, nil
+		}
+
+		var e bulkAttrEntry
+		if common&attrCmnError != 0 {
+			b, err := field(4)
+			if err != nil {
+				return err
+			}
+			e.errno = ne.Uint32(b)
+		}
+		if common&attrCmnName != 0 {
+			// An attrreference_t: the offset of the name from the reference
+			// itself and its length with the terminating NUL
+			ref := pos
+			b, err := field(8)
+			if err != nil {
+				return err
+			}
+			start, n := ref+int(int32(ne.Uint32(b))), int(ne.Uint32(b[4:]))
+			if start < bulkAttrHeaderSize || n < 1 || start+n > length {
+				return fmt.Errorf("getattrlistbulk: name out of its entry")
+			}
+			e.name = string(entry[start : start+n-1])
+		}
+		if common&attrCmnObjType != 0 {
+			b, err := field(4)
+			if err != nil {
+				return err
+			}
+			e.typ = ne.Uint32(b)
+		}
+		if file&attrFileDataLength != 0 {
+			b, err := field(8)
+			if err != nil {
+				return err
+			}
+			e.size = int64(ne.Uint64(b))
+		}
+		fn(e)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// bulkAttrSupported reports whether the getattrlistbulk strategy is available
+const bulkAttrSupported = true
+
+// sysGetattrlistbulk is the number of getattrlistbulk, which the syscall
+// package does not define
+const sysGetattrlistbulk = 461
+
+// bulkAttrBufferSize is the buffer each call fills, room for several hundred
+// entries with typical names
+const bulkAttrBufferSize = 64 * 1024
+
+// attrList is struct attrlist of <sys/attr.h>
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32
+}
+
+// newBulkAttrScanner returns the getattrlistbulk strategy: the task channel
+// scan of nativeScanner reading each directory with getattrlistbulk
+func newBulkAttrScanner(numWorkers int, options ScanOptions) strategyScanner {
+	list := func(path string, buf []byte, sizes bool, fn func(nativeEntry)) error {
+		return listBulkAttrs(path, buf, sizes, options.visits, fn)
+	}
+	return &nativeScanner{numWorkers: numWorkers, options: options, list: list, bufSize: bulkAttrBufferSize}
+}
+
+// listBulkAttrs opens a directory and calls fn for every entry, reading as
+// many entries per call as fit in buf. The directory is closed before its
+// subdirectories are processed, so that inline processing holds no
+// descriptors of ancestors.
+func listBulkAttrs(path string, buf []byte, sizes bool, visits *visitSet, fn func(nativeEntry)) error {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.Close(fd)
+	if visits != nil {
+		var st syscall.Stat_t
+		if syscall.Fstat(fd, &st) == nil {
+			visits.add(fileKey{dev: uint64(st.Dev), ino: st.Ino}, path)
+		}
+	}
+
+	attrs := attrList{bitmapCount: 5, commonAttr: attrCmnReturnedAttrs | attrCmnName | attrCmnObjType | attrCmnError}
+	if sizes {
+		attrs.fileAttr = attrFileDataLength
+	}
+	decode := func(e bulkAttrEntry) {
+		entry := nativeEntry{name: e.name, dir: e.typ == vtypeDir, symlink: e.typ == vtypeLnk, regular: e.typ == vtypeReg, size: e.size}
+		if e.errno != 0 {
+			entry.err = syscall.Errno(e.errno)
+		}
+		fn(entry)
+	}
+	for {
+		n, _, errno := syscall.Syscall6(sysGetattrlistbulk, uintptr(fd), uintptr(unsafe.Pointer(&attrs)),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return &os.PathError{Op: "getattrlistbulk", Path: path, Err: errno}
+		}
+		if n == 0 {
+			return nil
+		}
+		if err := parseBulkAttrs(buf, int(n), decode); err != nil {
+			return &os.PathError{Op: "getattrlistbulk", Path: path, Err: err}
+		}
+	}
+}
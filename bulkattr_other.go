@@ -0,0 +1,14 @@
+//go:build !darwin
+
+package main
+
+import "errors"
+
+// bulkAttrSupported reports whether the getattrlistbulk strategy is available
+const bulkAttrSupported = false
+
+// newBulkAttrScanner returns the getattrlistbulk strategy, only implemented
+// on macOS
+func newBulkAttrScanner(numWorkers int, options ScanOptions) strategyScanner {
+	return unsupportedScanner{errors.New("the getattrlistbulk strategy is only supported on macOS")}
+}
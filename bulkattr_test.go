@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// packBulkAttrEntry packs an entry the way getattrlistbulk does: the length,
+// the returned attribute set, the attributes in the order of their bits and
+// the name, NUL terminated and padded to four bytes
+func packBulkAttrEntry(e bulkAttrEntry, withSize bool) []byte {
+	ne := binary.NativeEndian
+	common, file := uint32(attrCmnReturnedAttrs|attrCmnName|attrCmnObjType), uint32(0)
+	if e.errno != 0 {
+		common |= attrCmnError
+	}
+	if withSize {
+		file = attrFileDataLength
+	}
+	b := ne.AppendUint32(nil, 0)
+	b = ne.AppendUint32(b, common)
+	b = ne.AppendUint32(b, 0)
+	b = ne.AppendUint32(b, 0)
+	b = ne.AppendUint32(b, file)
+	b = ne.AppendUint32(b, 0)
+	if e.errno != 0 {
+		b = ne.AppendUint32(b, e.errno)
+	}
+	ref := len(b)
+	b = ne.AppendUint32(b, 0)
+	b = ne.AppendUint32(b, uint32(len(e.name)+1))
+	b = ne.AppendUint32(b, e.typ)
+	if withSize {
+		b = ne.AppendUint64(b, uint64(e.size))
+	}
+	ne.PutUint32(b[ref:], uint32(len(b)-ref))
+	b = append(b, e.name...)
+	b = append(b, 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	ne.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func TestParseBulkAttrs(t *testing.T) {
+	want := []bulkAttrEntry{
+		{name: "file.txt", typ: vtypeReg, size: 1234},
+		{name: "dir", typ: vtypeDir},
+		{name: "リンク", typ: vtypeLnk},
+		{name: "unreadable", typ: vtypeReg, errno: 13},
+	}
+	buf := []byte{}
+	for i, e := range want {
+		// Directories come without the file attributes
+		buf = append(buf, packBulkAttrEntry(e, i != 1)...)
+	}
+	// Room left in the buffer after the entries is ignored
+	buf = append(buf, make([]byte, 64)...)
+
+	var got []bulkAttrEntry
+	if err := parseBulkAttrs(buf, len(want), func(e bulkAttrEntry) { got = append(got, e) }); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBulkAttrs = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseBulkAttrsMalformed(t *testing.T) {
+	entry := packBulkAttrEntry(bulkAttrEntry{name: "a", typ: vtypeReg}, false)
+	ne := binary.NativeEndian
+	outOfEntry := append([]byte(nil), entry...)
+	// The name reference points past the entry
+	ne.PutUint32(outOfEntry[bulkAttrHeaderSize:], uint32(len(entry)))
+	tooShort := append([]byte(nil), entry...)
+	ne.PutUint32(tooShort, bulkAttrHeaderSize+4)
+
+	tests := []struct {
+		name  string
+		buf   []byte
+		count int
+	}{
+		{"more entries than the buffer holds", entry, 2},
+		{"length past the buffer", entry[:len(entry)-4], 1},
+		{"length shorter than the header", make([]byte, bulkAttrHeaderSize), 1},
+		{"name out of the entry", outOfEntry, 1},
+		{"attributes past the length", tooShort, 1},
+	}
+	for _, tt := range tests {
+		if err := parseBulkAttrs(tt.buf, tt.count, func(bulkAttrEntry) {}); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheEntry holds the counts of one directory, valid while its mtime is unchanged
+type cacheEntry struct {
+	MTime int64
+	Files int64
+	// Subdirs are the full paths of the subdirectories
+	Subdirs []string
+}
+
+// scanCache maps directory paths to their last listing. A directory's mtime
+// changes when entries are added, removed or renamed in it, so an entry with
+// the current mtime can replace reading the directory. Subdirectories have
+// their own mtimes and are always checked.
+type scanCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// newScanCache returns an empty cache
+func newScanCache() *scanCache {
+	return &scanCache{entries: map[string]cacheEntry{}}
+}
+
+func (c *scanCache) get(path string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	return entry, ok
+}
+
+func (c *scanCache) put(path string, entry cacheEntry) {
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.mu.Unlock()
+}
+
+// Len returns the number of cached directories
+func (c *scanCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// invalidate marks a random fraction of the entries as stale, the same as if
+// their directories had been modified, and returns the number of entries
+func (c *scanCache) invalidate(fraction float64, rng *rand.Rand) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	// Sorted first so that a seed selects the same directories every time
+	sort.Strings(paths)
+	rng.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+	n := int(float64(len(paths)) * fraction)
+	for _, path := range paths[:n] {
+		entry := c.entries[path]
+		entry.MTime = -1
+		c.entries[path] = entry
+	}
+	return n
+}
+
+// save writes the cache to filename with encoding/gob
+func (c *scanCache) save(filename string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c.entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadScanCache reads a cache written by save
+func loadScanCache(filename string) (*scanCache, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := newScanCache()
+	if err := gob.NewDecoder(f).Decode(&c.entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// cachedScanResult is the outcome of a scan through the cache
+type cachedScanResult struct {
+	Files, Dirs  int64
+	Hits, Misses int64
+	Duration     time.Duration
+}
+
+// cachedScan counts the tree below root with numWorkers workers. Directories
+// whose mtime matches their cache entry are not read; the others are read
+// and their entries refreshed.
+func cachedScan(root string, cache *scanCache, numWorkers int) (*cachedScanResult, error) {
+	result := &cachedScanResult{}
+	tasks := make(chan string, defaultChannelCapacity)
+	var pending sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+
+	var visit func(path string)
+	visit = func(path string) {
+		subdirs, err := cachedListing(path, cache, result)
+		if err != nil {
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+			return
+		}
+		for _, subdir := range subdirs {
+			pending.Add(1)
+			select {
+			case tasks <- subdir:
+			default:
+				// Channel full, process inline
+				visit(subdir)
+				pending.Done()
+			}
+		}
+	}
+
+	start := time.Now()
+	var workers sync.WaitGroup
+	workers.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer workers.Done()
+			for path := range tasks {
+				visit(path)
+				pending.Done()
+			}
+		}()
+	}
+	pending.Add(1)
+	tasks <- root
+	pending.Wait()
+	close(tasks)
+	workers.Wait()
+	result.Duration = time.Since(start)
+	return result, firstErr
+}
+
+// cachedListing returns the subdirectories of path from the cache when its
+// mtime is unchanged, or by reading it
+func cachedListing(path string, cache *scanCache, result *cachedScanResult) ([]string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	mtime := info.ModTime().UnixNano()
+	atomic.AddInt64(&result.Dirs, 1)
+	if entry, ok := cache.get(path); ok && entry.MTime == mtime {
+		atomic.AddInt64(&result.Hits, 1)
+		atomic.AddInt64(&result.Files, entry.Files)
+		return entry.Subdirs, nil
+	}
+
+	atomic.AddInt64(&result.Misses, 1)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := cacheEntry{MTime: mtime}
+	for _, e := range entries {
+		if e.IsDir() {
+			entry.Subdirs = append(entry.Subdirs, filepath.Join(path, e.Name()))
+		} else {
+			entry.Files++
+		}
+	}
+	cache.put(path, entry)
+	atomic.AddInt64(&result.Files, entry.Files)
+	return entry.Subdirs, nil
+}
+
+// runCache benchmarks a cold scan against re-scans through the cache: fully
+// cached, and with a fraction of the directories invalidated. The tree is
+// only read; invalidation is simulated in the cache.
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan workers")
+	runs := fs.Int("runs", 3, "runs per phase; durations are averaged")
+	invalidate := fs.Float64("invalidate", 10, "percentage of cached directories invalidated before the partial re-scan")
+	cacheFile := fs.String("file", "benchmark/scan_cache.gob", "file the cache is persisted to between the cold scan and the re-scans")
+	seed := fs.Int64("seed", 1, "seed selecting the invalidated directories")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *workers < 1 || *runs < 1 || *invalidate < 0 || *invalidate > 100 {
+		fmt.Println("使い方: cache [-workers N] [-runs N] [-invalidate 0-100] [-file path] <ディレクトリ>")
+		return 2
+	}
+	root := fs.Arg(0)
+	if err := os.MkdirAll(filepath.Dir(*cacheFile), 0755); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+
+	type phase struct {
+		name   string
+		result cachedScanResult
+	}
+	phases := []phase{}
+	// measure runs a phase; prepare returns the cache to scan with
+	measure := func(name string, prepare func() (*scanCache, error)) error {
+		total := cachedScanResult{}
+		for i := 0; i < *runs; i++ {
+			cache, err := prepare()
+			if err != nil {
+				return err
+			}
+			r, err := cachedScan(root, cache, *workers)
+			if err != nil {
+				return err
+			}
+			total.Duration += r.Duration
+			total.Files, total.Dirs, total.Hits, total.Misses = r.Files, r.Dirs, r.Hits, r.Misses
+			if name == "cold" {
+				if err := cache.save(*cacheFile); err != nil {
+					return err
+				}
+			}
+		}
+		total.Duration /= time.Duration(*runs)
+		phases = append(phases, phase{name, total})
+		return nil
+	}
+
+	fmt.Printf("キャッシュのベンチマーク: %s (ワーカー数 %d, 各 %d 回)\n", root, *workers, *runs)
+	var loadTime time.Duration
+	entries := 0
+	err := measure("cold", func() (*scanCache, error) { return newScanCache(), nil })
+	if err == nil {
+		err = measure("cached", func() (*scanCache, error) {
+			start := time.Now()
+			cache, err := loadScanCache(*cacheFile)
+			loadTime = time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+			entries = cache.Len()
+			return cache, nil
+		})
+	}
+	if err == nil {
+		err = measure(fmt.Sprintf("invalidated %g%%", *invalidate), func() (*scanCache, error) {
+			cache, err := loadScanCache(*cacheFile)
+			if err != nil {
+				return nil, err
+			}
+			cache.invalidate(*invalidate/100, rand.New(rand.NewSource(*seed)))
+			return cache, nil
+		})
+	}
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+
+	table := &textTable{
+		header: []string{"Phase", "Duration", "Files", "Dirs", "Hits", "Misses", "Speedup"},
+		right:  []bool{false, true, true, true, true, true, true},
+	}
+	cold := phases[0].result
+	for _, p := range phases {
+		table.add(p.name,
+			p.result.Duration.Round(time.Microsecond).String(),
+			fmt.Sprintf("%d", p.result.Files),
+			fmt.Sprintf("%d", p.result.Dirs),
+			fmt.Sprintf("%d", p.result.Hits),
+			fmt.Sprintf("%d", p.result.Misses),
+			fmt.Sprintf("%.2fx", float64(cold.Duration)/float64(p.result.Duration)))
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+	for _, p := range phases[1:] {
+		if p.result.Files != cold.Files || p.result.Dirs != cold.Dirs {
+			fmt.Printf("警告: %s のファイル数・ディレクトリ数がコールドスキャンと一致しません\n", p.name)
+		}
+	}
+	if info, err := os.Stat(*cacheFile); err == nil {
+		fmt.Printf("\nキャッシュファイル: %s (%d ディレクトリ, %s, 読み込み %v)\n",
+			*cacheFile, entries, formatBytes(info.Size()), loadTime.Round(time.Microsecond))
+	}
+	return 0
+}
@@ -0,0 +1,14 @@
+package main
+
+// Page cache modes of -cache-mode
+const (
+	// CacheModeWarm scans with whatever the caches hold: the fixtures just
+	// created and the trees read by earlier runs
+	CacheModeWarm = "warm"
+	// CacheModeCold drops the page, dentry and inode caches before every
+	// run, so that every scan reads the metadata from the device
+	CacheModeCold = "cold"
+)
+
+// cacheModeNames lists the cache modes in the order of the help text
+var cacheModeNames = []string{CacheModeWarm, CacheModeCold}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// dropCachesPath is the file the kernel drops its clean caches on writing
+const dropCachesPath = "/proc/sys/vm/drop_caches"
+
+// checkDropCaches reports whether the caches can be dropped, which needs root
+func checkDropCaches() error {
+	f, err := os.OpenFile(dropCachesPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// dropCaches writes back dirty pages and drops the page cache and the dentry
+// and inode caches. Only clean entries are dropped, hence the sync first.
+func dropCaches() error {
+	syscall.Sync()
+	return os.WriteFile(dropCachesPath, []byte("3"), 0)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// checkDropCaches is not supported on this platform
+func checkDropCaches() error {
+	return errors.New("dropping the caches is only supported on Linux")
+}
+
+// dropCaches is not supported on this platform
+func dropCaches() error {
+	return errors.New("dropping the caches is only supported on Linux")
+}
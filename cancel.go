@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cancelPollInterval is how often the goroutines and descriptors of a
+// cancelled scan are counted while waiting for them to be released
+const cancelPollInterval = 100 * time.Microsecond
+
+// cancelReferenceRuns is the number of uncancelled scans before the trials
+const cancelReferenceRuns = 3
+
+// cancelTrial is one scan cancelled at a random point
+type cancelTrial struct {
+	// completed reports that the scan finished before it was cancelled
+	completed bool
+	// stop is the time from the cancellation until the scan returned
+	stop time.Duration
+	// release is the time from the cancellation until the goroutines and
+	// file descriptors of the scan were gone, -1 when they outlived
+	// scanAbandonGrace
+	release time.Duration
+	// abandoned reports that the scan did not return within scanAbandonGrace
+	abandoned bool
+}
+
+// cancelStrategies returns the strategies whose cancellation can be measured
+func cancelStrategies() []string {
+	strategies := []string{StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled, StrategyUnbounded}
+	if openatSupported {
+		strategies = append(strategies, StrategyOpenat)
+	}
+	if uringSupported {
+		strategies = append(strategies, StrategyUring)
+	}
+	if bulkAttrSupported {
+		strategies = append(strategies, StrategyBulkAttr)
+	}
+	if findFileSupported {
+		strategies = append(strategies, StrategyFindFile)
+	}
+	return strategies
+}
+
+// runCancel cancels scans of every strategy at random points and reports how
+// long they take to stop and to release their goroutines and descriptors
+func runCancel(args []string) int {
+	fs := flag.NewFlagSet("cancel", flag.ContinueOnError)
+	strategyList := fs.String("strategies", strings.Join(cancelStrategies(), ","), "comma separated strategies to cancel: "+strings.Join(cancelStrategies(), ", "))
+	workerList := fs.String("workers", strconv.Itoa(runtime.NumCPU()), "comma separated worker counts")
+	trials := fs.Int("trials", 20, "cancelled scans per strategy and worker count")
+	seed := fs.Int64("seed", 0, "seed of the cancellation points (0 = random, printed for reproduction)")
+	structure := fs.String("structure", StructureDeep, "structure of the generated fixture when no directory is given")
+	size := fs.String("size", SizeMedium, "size preset of the generated fixture: "+strings.Join(sizeNames, ", "))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 || *trials < 1 {
+		fmt.Println("使い方: cancel [-strategies recursive-task,...] [-workers 4,...] [-trials 20] [-seed N] [-structure deep] [-size medium] [ディレクトリ]")
+		return 2
+	}
+	strategies, err := filterStrategies(*strategyList, cancelStrategies())
+	if err != nil {
+		fmt.Printf("エラー: -strategies: %v\n", err)
+		return 2
+	}
+	workerCounts, err := parseIntList(*workerList)
+	if err != nil {
+		fmt.Printf("エラー: -workers: %v\n", err)
+		return 2
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		if _, err := parseStructures(*structure); err != nil || strings.Contains(*structure, ",") {
+			fmt.Printf("エラー: -structure: %s\n", *structure)
+			return 2
+		}
+		config, err := sizeConfig(*size)
+		if err != nil {
+			fmt.Printf("エラー: -size: %v\n", err)
+			return 2
+		}
+		root = fixturePrefix + "cancel"
+		fmt.Printf("%s構造のテストデータを作成中 (%s, %s)...\n", *structure, root, *size)
+		err = generateFixture(root, *structure, config)
+		defer os.RemoveAll(root)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	} else if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	fmt.Printf("キャンセル計測: %s (%d 回, シード %d)\n", root, *trials, *seed)
+
+	table := &textTable{
+		header: []string{"Strategy", "Workers", "Full", "Cancelled", "Stop p50", "Stop max", "Release p50", "Release max", "Leaked"},
+		right:  []bool{false, true, true, true, true, true, true, true, true},
+	}
+	for _, strategy := range strategies {
+		for _, workers := range strategyWorkerCounts(strategy, workerCounts) {
+			fmt.Printf("  %s ワーカー数 %d ...", strategy, workers)
+			// Uncancelled scans warm the cache; the fastest sets the range
+			// of the cancellation points
+			var full cancelTrial
+			var err error
+			for i := 0; i < cancelReferenceRuns && err == nil; i++ {
+				var run cancelTrial
+				run, err = cancelScan(root, strategy, workers, -1)
+				if i == 0 || run.stop < full.stop {
+					full = run
+				}
+			}
+			if err != nil {
+				fmt.Printf(" エラー: %v\n", err)
+				continue
+			}
+			results := []cancelTrial{}
+			for i := 0; i < *trials; i++ {
+				trial, err := cancelScan(root, strategy, workers, time.Duration(rng.Int63n(int64(full.stop)+1)))
+				if err != nil {
+					fmt.Printf(" エラー: %v", err)
+					break
+				}
+				results = append(results, trial)
+			}
+			fmt.Println(" 完了")
+			table.add(append([]string{strategy, strconv.Itoa(workers), formatDuration(full.stop)}, summarizeCancelTrials(results)...)...)
+		}
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+	fmt.Println("\nStop: キャンセルからスキャンが戻るまで / Release: キャンセルからゴルーチンとファイルディスクリプタが元の数に戻るまで")
+	return 0
+}
+
+// cancelScan scans root and cancels the scan after the given delay; with a
+// negative delay the scan runs to the end and its duration is returned as
+// stop
+func cancelScan(root, strategy string, workers int, delay time.Duration) (cancelTrial, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	options := defaultScanOptions()
+	options.ctx = ctx
+	scanner, err := newScanner(strategy, workers, options)
+	if err != nil {
+		return cancelTrial{}, err
+	}
+
+	goroutines, fds := runtime.NumGoroutine(), openFDCount()
+	start := time.Now()
+	cancelled := make(chan time.Time, 1)
+	if delay >= 0 {
+		timer := time.AfterFunc(delay, func() {
+			cancelled <- time.Now()
+			cancel()
+		})
+		defer timer.Stop()
+	}
+	_, abandoned, scanErr := runScan(ctx, scanner.Scan, root)
+	returned := time.Now()
+	if delay < 0 {
+		return cancelTrial{stop: returned.Sub(start)}, scanErr
+	}
+
+	var at time.Time
+	select {
+	case at = <-cancelled:
+	default:
+	}
+	if at.IsZero() || (scanErr == nil && !abandoned) {
+		return cancelTrial{completed: true}, nil
+	}
+	trial := cancelTrial{stop: returned.Sub(at), release: -1, abandoned: abandoned}
+	for deadline := returned.Add(scanAbandonGrace); time.Now().Before(deadline); time.Sleep(cancelPollInterval) {
+		if runtime.NumGoroutine() <= goroutines && openFDCount() <= fds {
+			trial.release = time.Since(at)
+			break
+		}
+	}
+	return trial, nil
+}
+
+// summarizeCancelTrials returns the cancelled count, the median and largest
+// stop and release times and the number of scans that leaked resources
+func summarizeCancelTrials(trials []cancelTrial) []string {
+	stops, releases := []float64{}, []float64{}
+	leaked := 0
+	for _, t := range trials {
+		if t.completed {
+			continue
+		}
+		stops = append(stops, t.stop.Seconds())
+		if t.release >= 0 {
+			releases = append(releases, t.release.Seconds())
+		} else {
+			leaked++
+		}
+	}
+	stat := func(xs []float64) (string, string) {
+		if len(xs) == 0 {
+			return "-", "-"
+		}
+		largest := xs[0]
+		for _, x := range xs {
+			largest = max(largest, x)
+		}
+		return formatDuration(time.Duration(medianOf(xs) * float64(time.Second))), formatDuration(time.Duration(largest * float64(time.Second)))
+	}
+	stopP50, stopMax := stat(stops)
+	releaseP50, releaseMax := stat(releases)
+	return []string{fmt.Sprintf("%d/%d", len(stops), len(trials)), stopP50, stopMax, releaseP50, releaseMax, strconv.Itoa(leaked)}
+}
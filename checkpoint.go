@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// checkpointVersion is the format version of checkpoint files
+const checkpointVersion = 1
+
+// scanCheckpoint is the state of an interrupted scan. Every directory of the
+// tree is either counted or below a pending directory, so that resuming from
+// the pending directories counts each directory exactly once.
+type scanCheckpoint struct {
+	Version int    `json:"version"`
+	Root    string `json:"root"`
+	Files   int64  `json:"files"`
+	Dirs    int64  `json:"dirs"`
+	Errors  int64  `json:"errors"`
+	// Elapsed is the scan time of all earlier sessions
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// Sessions is the number of sessions the scan has run in so far
+	Sessions int `json:"sessions"`
+	// Pending holds the directories still to be read, relative to Root
+	Pending []string `json:"pending"`
+}
+
+// loadCheckpoint reads a checkpoint written by save
+func loadCheckpoint(filename string) (*scanCheckpoint, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := &scanCheckpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("%s: unsupported checkpoint version %d", filename, c.Version)
+	}
+	return c, nil
+}
+
+// save writes the checkpoint through a temporary file, so that a crash while
+// writing keeps the previous checkpoint
+func (c *scanCheckpoint) save(filename string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// resumableScan walks a tree with an explicit work list instead of the call
+// stack, so that its whole state can be written to a checkpoint at any time.
+// A directory is read outside the lock and then counted and replaced by its
+// subdirectories in one step under the lock.
+type resumableScan struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	root    string
+	pending []string
+	// reading holds the directory each worker is reading
+	reading             map[int]string
+	files, dirs, errors int64
+	active              int
+	stopped             bool
+	// elapsed and sessions are those of earlier sessions
+	elapsed      time.Duration
+	sessions     int
+	sessionStart time.Time
+}
+
+// newResumableScan starts a scan of root, or continues the scan of a
+// checkpoint when c is not nil
+func newResumableScan(root string, c *scanCheckpoint) *resumableScan {
+	s := &resumableScan{root: root, pending: []string{root}, reading: map[int]string{}}
+	if c != nil {
+		s.root = c.Root
+		s.pending = make([]string, len(c.Pending))
+		for i, rel := range c.Pending {
+			s.pending[i] = filepath.Join(c.Root, filepath.FromSlash(rel))
+		}
+		s.files, s.dirs, s.errors = c.Files, c.Dirs, c.Errors
+		s.elapsed, s.sessions = c.Elapsed, c.Sessions
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// run scans with numWorkers workers until the tree is done or stop is called
+func (s *resumableScan) run(numWorkers int) {
+	s.sessionStart = time.Now()
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func(id int) {
+			defer wg.Done()
+			s.work(id)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// work takes pending directories, newest first to keep the list short
+func (s *resumableScan) work(id int) {
+	for {
+		s.mu.Lock()
+		for len(s.pending) == 0 && s.active > 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped || len(s.pending) == 0 {
+			s.mu.Unlock()
+			s.cond.Broadcast()
+			return
+		}
+		dir := s.pending[len(s.pending)-1]
+		s.pending = s.pending[:len(s.pending)-1]
+		s.reading[id] = dir
+		s.active++
+		s.mu.Unlock()
+
+		entries, err := readDirUnsorted(dir)
+		var files int64
+		subdirs := []string{}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				subdirs = append(subdirs, filepath.Join(dir, entry.Name()))
+			} else {
+				files++
+			}
+		}
+
+		s.mu.Lock()
+		delete(s.reading, id)
+		s.active--
+		if err != nil {
+			s.errors++
+		} else {
+			s.files += files
+			s.dirs++
+			s.pending = append(s.pending, subdirs...)
+		}
+		s.mu.Unlock()
+		s.cond.Broadcast()
+	}
+}
+
+// stop lets every worker finish the directory it is reading and then return
+func (s *resumableScan) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// checkpoint returns the current state; directories being read count as
+// pending
+func (s *resumableScan) checkpoint() *scanCheckpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &scanCheckpoint{
+		Version:  checkpointVersion,
+		Root:     s.root,
+		Files:    s.files,
+		Dirs:     s.dirs,
+		Errors:   s.errors,
+		Elapsed:  s.elapsed + time.Since(s.sessionStart),
+		Sessions: s.sessions + 1,
+		Pending:  []string{},
+	}
+	for _, dirs := range [][]string{s.pending, mapValues(s.reading)} {
+		for _, dir := range dirs {
+			rel, err := filepath.Rel(s.root, dir)
+			if err != nil {
+				rel = dir
+			}
+			c.Pending = append(c.Pending, filepath.ToSlash(rel))
+		}
+	}
+	return c
+}
+
+// snapshot returns the counts so far, over all sessions
+func (s *resumableScan) snapshot() ScanSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ScanSnapshot{Elapsed: s.elapsed + time.Since(s.sessionStart), Files: s.files, Dirs: s.dirs}
+}
+
+// mapValues returns the values of m in no particular order
+func mapValues(m map[int]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// runScanCommand counts a tree with a scan that can be interrupted by SIGINT
+// or SIGTERM and resumed later from its checkpoint
+func runScanCommand(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan workers")
+	checkpointFile := fs.String("checkpoint", "benchmark/scan_checkpoint.json", "file the state of an interrupted scan is written to")
+	interval := fs.Duration("checkpoint-interval", 0, "also write the checkpoint periodically, so that a crash loses at most this much work (0 = only on SIGINT/SIGTERM)")
+	resume := fs.Bool("resume", false, "continue the scan saved in -checkpoint instead of starting a new one")
+	progress := fs.Duration("progress", 0, "print the files and directories counted so far at this interval (0 = disabled)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*resume && fs.NArg() != 0) || (!*resume && fs.NArg() != 1) || *workers < 1 || *interval < 0 || *progress < 0 {
+		fmt.Println("使い方: scan [-workers N] [-checkpoint file] [-checkpoint-interval 1m] [-progress 10s] <ディレクトリ>\n" +
+			"        scan -resume [-workers N] [-checkpoint file] [-checkpoint-interval 1m] [-progress 10s]")
+		return 2
+	}
+
+	var scan *resumableScan
+	if *resume {
+		c, err := loadCheckpoint(*checkpointFile)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+		scan = newResumableScan("", c)
+		fmt.Printf("スキャンを再開: %s (ファイル: %d, ディレクトリ: %d, 残り %d ディレクトリから, これまで %v)\n",
+			c.Root, c.Files, c.Dirs, len(c.Pending), c.Elapsed.Round(time.Millisecond))
+	} else {
+		root := fs.Arg(0)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+			return 1
+		}
+		// The checkpoint keeps the absolute root so that -resume works from
+		// any directory
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		scan = newResumableScan(root, nil)
+		fmt.Printf("スキャン開始: %s (ワーカー数 %d, 中断すると %s に状態を保存します)\n", root, *workers, *checkpointFile)
+	}
+	if err := os.MkdirAll(filepath.Dir(*checkpointFile), 0755); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		var tick <-chan time.Time
+		if *interval > 0 {
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		var progressTick <-chan time.Time
+		if *progress > 0 {
+			ticker := time.NewTicker(*progress)
+			defer ticker.Stop()
+			progressTick = ticker.C
+		}
+		for {
+			select {
+			case sig := <-signals:
+				interrupted <- sig
+				scan.stop()
+				return
+			case <-tick:
+				if err := scan.checkpoint().save(*checkpointFile); err != nil {
+					fmt.Printf("警告: チェックポイントを保存できません: %v\n", err)
+				}
+			case <-progressTick:
+				printSnapshot(scan.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+	scan.run(*workers)
+	close(done)
+
+	c := scan.checkpoint()
+	select {
+	case sig := <-interrupted:
+		if err := c.save(*checkpointFile); err != nil {
+			fmt.Printf("エラー: チェックポイントを保存できません: %v\n", err)
+			return 1
+		}
+		fmt.Printf("\n%v を受信したため中断しました (ファイル: %d, ディレクトリ: %d, 残り %d ディレクトリ)\n",
+			sig, c.Files, c.Dirs, len(c.Pending))
+		fmt.Printf("状態を保存しました: %s (scan -resume で再開できます)\n", *checkpointFile)
+		return ExitInterrupted
+	default:
+	}
+	fmt.Printf("スキャン完了: %v (ファイル: %d, ディレクトリ: %d, 読み取りエラー: %d", c.Elapsed.Round(time.Millisecond), c.Files, c.Dirs, c.Errors)
+	if c.Sessions > 1 {
+		fmt.Printf(", %d 回に分けて実行", c.Sessions)
+	}
+	fmt.Println(")")
+	// A finished scan leaves no checkpoint to resume
+	if err := os.Remove(*checkpointFile); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("警告: %v\n", err)
+	}
+	return ExitOK
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// churnTick is the interval at which due churn operations are applied
+const churnTick = time.Millisecond
+
+// churnSeq makes churn entry names unique across concurrent churners
+var churnSeq int64
+
+// churner creates, deletes and renames files and creates and removes empty
+// directories in a tree while it is scanned. Only entries it created itself
+// are deleted or renamed, and all of them are removed by Stop, so the
+// fixture is unchanged for the following runs.
+type churner struct {
+	rate        int
+	dirs        []string
+	rng         *rand.Rand
+	files       []string
+	createdDirs []string
+	ops         int64
+	errors      int64
+	stop        chan struct{}
+	finished    chan struct{}
+}
+
+// startChurner collects the directories of root and starts applying rate
+// operations per second in the background
+func startChurner(root string, rate int) (*churner, error) {
+	c, err := newChurner(root, rate)
+	if err != nil {
+		return nil, err
+	}
+	c.start()
+	return c, nil
+}
+
+// newChurner collects the directories of root without changing anything
+func newChurner(root string, rate int) (*churner, error) {
+	c := &churner{
+		rate:     rate,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			c.dirs = append(c.dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// start starts applying the operations in the background
+func (c *churner) start() {
+	go func() {
+		defer close(c.finished)
+		start := time.Now()
+		ticker := time.NewTicker(churnTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				due := int64(time.Since(start).Seconds() * float64(c.rate))
+				for c.ops < due {
+					c.step()
+					c.ops++
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *churner) name(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, atomic.AddInt64(&churnSeq, 1))
+}
+
+func (c *churner) randomDir() string {
+	return c.dirs[c.rng.Intn(len(c.dirs))]
+}
+
+// step applies one randomly chosen operation
+func (c *churner) step() {
+	var err error
+	op := c.rng.Intn(5)
+	if len(c.files) == 0 {
+		op = 0
+	}
+	switch op {
+	case 0:
+		path := filepath.Join(c.randomDir(), c.name("churn"))
+		if err = os.WriteFile(path, []byte("churn"), 0644); err == nil {
+			c.files = append(c.files, path)
+		}
+	case 1:
+		i := c.rng.Intn(len(c.files))
+		if err = os.Remove(c.files[i]); err == nil {
+			c.files = append(c.files[:i], c.files[i+1:]...)
+		}
+	case 2:
+		i := c.rng.Intn(len(c.files))
+		path := filepath.Join(c.randomDir(), c.name("churn"))
+		if err = os.Rename(c.files[i], path); err == nil {
+			c.files[i] = path
+		}
+	case 3:
+		path := filepath.Join(c.randomDir(), c.name("churn_dir"))
+		if err = os.Mkdir(path, 0755); err == nil {
+			c.createdDirs = append(c.createdDirs, path)
+		}
+	case 4:
+		if len(c.createdDirs) == 0 {
+			return
+		}
+		i := c.rng.Intn(len(c.createdDirs))
+		if err = os.Remove(c.createdDirs[i]); err == nil {
+			c.createdDirs = append(c.createdDirs[:i], c.createdDirs[i+1:]...)
+		}
+	}
+	if err != nil {
+		c.errors++
+	}
+}
+
+// Stop stops churning, removes the remaining churn entries and returns the
+// number of operations applied
+func (c *churner) Stop() int64 {
+	close(c.stop)
+	<-c.finished
+	for _, path := range c.files {
+		os.Remove(path)
+	}
+	for _, path := range c.createdDirs {
+		os.Remove(path)
+	}
+	return c.ops
+}
+
+// parseChurnRates parses a comma separated list of churn rates; 0 disables churn
+func parseChurnRates(value string) ([]int, error) {
+	rates := []int{}
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("churn rate must not be negative: %d", n)
+		}
+		rates = append(rates, n)
+	}
+	return rates, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fixtureMarkerName is the ownership marker written into every fixture root
+const fixtureMarkerName = ".benchmark_owner"
+
+// fixturePrefix is the name prefix of generated fixture roots
+const fixturePrefix = "benchmark_"
+
+// fixtureMarker records which process generated a fixture
+type fixtureMarker struct {
+	PID        int
+	Host       string
+	Created    time.Time
+	ConfigHash string
+}
+
+// configHash returns a short hash identifying a fixture configuration
+func configHash(config Config) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%+v", config)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// writeFixtureMarker writes the ownership marker of the current process into root
+func writeFixtureMarker(root string, config Config) error {
+	host, _ := os.Hostname()
+	content := fmt.Sprintf("pid=%d\nhost=%s\ncreated=%s\nconfig=%s\n",
+		os.Getpid(), host, time.Now().Format(time.RFC3339), configHash(config))
+	return os.WriteFile(filepath.Join(root, fixtureMarkerName), []byte(content), 0644)
+}
+
+// readFixtureMarker reads the ownership marker of a fixture root
+func readFixtureMarker(root string) (*fixtureMarker, error) {
+	f, err := os.Open(filepath.Join(root, fixtureMarkerName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	marker := &fixtureMarker{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "pid":
+			marker.PID, _ = strconv.Atoi(value)
+		case "host":
+			marker.Host = value
+		case "created":
+			marker.Created, _ = time.Parse(time.RFC3339, value)
+		case "config":
+			marker.ConfigHash = value
+		}
+	}
+	return marker, scanner.Err()
+}
+
+// ownerAlive reports whether the process that wrote the marker is still
+// running. Markers from other hosts are assumed to be alive because their
+// processes cannot be checked.
+func (m *fixtureMarker) ownerAlive() bool {
+	host, _ := os.Hostname()
+	if m.Host != host {
+		return true
+	}
+	return m.PID == os.Getpid() || processAlive(m.PID)
+}
+
+// checkFixtureOwner returns an error when root belongs to another running benchmark
+func checkFixtureOwner(root string) error {
+	marker, err := readFixtureMarker(root)
+	if err != nil {
+		return nil
+	}
+	if marker.PID != os.Getpid() && marker.ownerAlive() {
+		return fmt.Errorf("%s is in use by another benchmark (pid %d on %s)", root, marker.PID, marker.Host)
+	}
+	return nil
+}
+
+// runClean handles the clean subcommand and returns the exit code
+func runClean(args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	orphans := fs.Bool("orphans", false, "remove fixtures left behind by crashed or interrupted runs")
+	dryRun := fs.Bool("dry-run", false, "only list the fixtures that would be removed")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !*orphans {
+		fmt.Println("使い方: clean -orphans [-dry-run] [ディレクトリ...]")
+		return 2
+	}
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	removed := 0
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, fixturePrefix+"*"))
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+		for _, root := range matches {
+			marker, err := readFixtureMarker(root)
+			if err != nil {
+				fmt.Printf("スキップ (所有マーカーなし): %s\n", root)
+				continue
+			}
+			if marker.ownerAlive() {
+				fmt.Printf("スキップ (pid %d が実行中): %s\n", marker.PID, root)
+				continue
+			}
+
+			if *dryRun {
+				fmt.Printf("削除対象: %s (pid %d, 作成 %s)\n", root, marker.PID, marker.Created.Format(time.RFC3339))
+				removed++
+				continue
+			}
+			if err := os.RemoveAll(root); err != nil {
+				fmt.Printf("削除エラー: %s: %v\n", root, err)
+				continue
+			}
+			fmt.Printf("削除しました: %s (pid %d, 作成 %s)\n", root, marker.PID, marker.Created.Format(time.RFC3339))
+			removed++
+		}
+	}
+	if *dryRun {
+		fmt.Printf("%d 個の残存テストデータが削除対象です\n", removed)
+	} else {
+		fmt.Printf("%d 個の残存テストデータを削除しました\n", removed)
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Concurrent scan root selection modes
+const (
+	ConcurrentRootsSame  = "same"
+	ConcurrentRootsMixed = "mixed"
+)
+
+// concurrentRoots returns the roots scanned simultaneously for a benchmark cell.
+// The first root is always the cell's own fixture; the remaining roots either
+// repeat it (same) or rotate through the other fixtures (mixed).
+func concurrentRoots(primary string, testDirs []testDir, numScans int, mode string) ([]string, error) {
+	if numScans < 1 {
+		return nil, fmt.Errorf("concurrent scans must be at least 1: %d", numScans)
+	}
+
+	roots := []string{primary}
+	switch mode {
+	case ConcurrentRootsSame:
+		for len(roots) < numScans {
+			roots = append(roots, primary)
+		}
+	case ConcurrentRootsMixed:
+		others := []string{}
+		for _, d := range testDirs {
+			if d.Path != primary {
+				others = append(others, d.Path)
+			}
+		}
+		sort.Strings(others)
+		if len(others) == 0 {
+			others = append(others, primary)
+		}
+		for i := 0; len(roots) < numScans; i++ {
+			roots = append(roots, others[i%len(others)])
+		}
+	default:
+		return nil, fmt.Errorf("unknown concurrent roots mode: %s", mode)
+	}
+	return roots, nil
+}
+
+// runConcurrentBenchmark starts one scan per root at the same moment and waits
+// for all of them. The returned result carries the counts and the other
+// measurements of the first root's scan with the mean duration of all scans,
+// so it is directly comparable to a single-tenant run of the same cell. The
+// memory and CPU time statistics of the process cover all scans at once, so
+// they are measured around the whole group and divided by the scan count.
+func runConcurrentBenchmark(roots []string, structure, strategy string, numWorkers int, options ScanOptions) (*BenchmarkResult, error) {
+	results := make([]*BenchmarkResult, len(roots))
+	errs := make([]error, len(roots))
+
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	usageBefore := readProcessUsage()
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(len(roots))
+	for i, root := range roots {
+		go func(i int, root string) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = runBenchmark(root, structure, strategy, numWorkers, options)
+		}(i, root)
+	}
+
+	close(start)
+	wg.Wait()
+
+	usageAfter := readProcessUsage()
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+
+	var totalDuration time.Duration
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("concurrent scan %d (%s): %w", i, roots[i], err)
+		}
+		totalDuration += results[i].Duration
+	}
+
+	result := *results[0]
+	if result.Visits != nil {
+		visits := *result.Visits
+		result.Visits = &visits
+	}
+	for _, r := range results[1:] {
+		result.TimedOut = result.TimedOut || r.TimedOut
+		result.Abandoned = result.Abandoned || r.Abandoned
+		if r.Stalled && !result.Stalled {
+			result.Stalled, result.StallDump = true, r.StallDump
+		}
+		result.Visits.add(r.Visits)
+	}
+	n := len(roots)
+	result.Duration = totalDuration / time.Duration(n)
+	result.Allocs = (memAfter.Mallocs - memBefore.Mallocs) / uint64(n)
+	result.BytesAllocated = (memAfter.TotalAlloc - memBefore.TotalAlloc) / uint64(n)
+	result.NumGC = (memAfter.NumGC - memBefore.NumGC) / uint32(n)
+	result.GCPause = time.Duration(memAfter.PauseTotalNs-memBefore.PauseTotalNs) / time.Duration(n)
+	if userCPU, systemCPU := usageAfter.cpuSince(usageBefore); userCPU >= 0 {
+		result.UserCPU, result.SystemCPU = userCPU/time.Duration(n), systemCPU/time.Duration(n)
+	}
+	result.ConcurrentScans = n
+	return &result, nil
+}
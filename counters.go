@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Ways the directory-based and recursive-task strategies accumulate their
+// counts
+const (
+	// CountersShared adds to one result shared by all workers with atomic
+	// operations, the original implementation; the workers contend for the
+	// cache line of the counters
+	CountersShared = "shared"
+	// CountersPerWorker lets every worker count into its own result, merged
+	// after the workers are done
+	CountersPerWorker = "per-worker"
+)
+
+// parseCounterModes parses a comma separated list of counter modes
+func parseCounterModes(value string) ([]string, error) {
+	modes := []string{}
+	for _, mode := range strings.Split(value, ",") {
+		mode = strings.TrimSpace(mode)
+		if mode != CountersShared && mode != CountersPerWorker {
+			return nil, fmt.Errorf("unknown counter mode: %s (%s, %s)", mode, CountersShared, CountersPerWorker)
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// usesCounters reports whether the strategy has both counter modes
+func usesCounters(strategy string) bool {
+	return strategy == StrategyDirectoryBased || strategy == StrategyRecursiveTask
+}
+
+// count adds n to a counter of a result: atomically when the result is
+// shared by the workers, plainly when it belongs to one worker
+func (o ScanOptions) count(counter *int64, n int64) {
+	if o.Counters == CountersPerWorker {
+		*counter += n
+		return
+	}
+	atomic.AddInt64(counter, n)
+}
+
+// newWorkerResults returns one result per worker for CountersPerWorker, nil
+// for shared counters
+func (o ScanOptions) newWorkerResults(numWorkers int) []*ScanResult {
+	if o.Counters != CountersPerWorker {
+		return nil
+	}
+	results := make([]*ScanResult, numWorkers)
+	for i := range results {
+		results[i] = &ScanResult{}
+	}
+	return results
+}
+
+// workerResult returns the result a worker counts into: its own with
+// per-worker counters, the shared one otherwise
+func workerResult(shared *ScanResult, perWorker []*ScanResult, worker int) *ScanResult {
+	if perWorker == nil {
+		return shared
+	}
+	return perWorker[worker]
+}
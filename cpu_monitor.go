@@ -1,159 +1,171 @@
 package main
 
 import (
-	"fmt"
 	"runtime"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
-// CPUMonitor はCPU使用率を監視
+// defaultCPUSampleInterval は間隔を指定しない場合のCPU使用率のサンプリング間隔
+const defaultCPUSampleInterval = 100 * time.Millisecond
+
+// CPUMonitor はプロセスのCPU使用率を一定間隔でサンプリングする。
+// サンプルはミューテックスで保護され、Stop はサンプリングの終了を待ってから戻るため、
+// Stop 後の GetStats は最後の区間まで含む
 type CPUMonitor struct {
-	startTime    time.Time
-	startCPUTime time.Duration
-	samples      []float64
-	done         int32
+	interval time.Duration
+	// cpuTime はプロセスのCPU時間の取得元（テストで置き換える）
+	cpuTime func() (time.Duration, bool)
+
+	mu       sync.Mutex
+	samples  []float64
+	stop     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+
+	// ワーカー別のCPU時間（BeginWorker / EndWorker で集計）
+	workerMu  sync.Mutex
+	workerCPU []time.Duration
 }
 
-// NewCPUMonitor は新しいCPUモニターを作成
-func NewCPUMonitor() *CPUMonitor {
+// NewCPUMonitor は interval ごとにサンプリングするCPUモニターを作成する。
+// 0以下の場合は defaultCPUSampleInterval
+func NewCPUMonitor(interval time.Duration) *CPUMonitor {
+	if interval <= 0 {
+		interval = defaultCPUSampleInterval
+	}
 	return &CPUMonitor{
-		startTime:    time.Now(),
-		startCPUTime: getCPUTime(),
-		samples:      make([]float64, 0),
+		interval: interval,
+		cpuTime:  processCPUTime,
 	}
 }
 
-// Start はバックグラウンドでCPU使用率の監視を開始
+// Start はバックグラウンドでCPU使用率の監視を開始する。2回目以降の呼び出しは無視する
 func (m *CPUMonitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.finished = make(chan struct{})
+
+	lastTime := time.Now()
+	lastCPUTime, ok := m.cpuTime()
 	go func() {
-		ticker := time.NewTicker(100 * time.Millisecond)
+		defer close(m.finished)
+		ticker := time.NewTicker(m.interval)
 		defer ticker.Stop()
 
-		lastTime := m.startTime
-		lastCPUTime := m.startCPUTime
+		sample := func() {
+			currentTime := time.Now()
+			currentCPUTime, currentOK := m.cpuTime()
+			elapsed := currentTime.Sub(lastTime)
+			if ok && currentOK && elapsed > 0 {
+				usage := float64(currentCPUTime-lastCPUTime) / float64(elapsed) * 100
+				m.mu.Lock()
+				m.samples = append(m.samples, usage)
+				m.mu.Unlock()
+			}
+			lastTime, lastCPUTime, ok = currentTime, currentCPUTime, currentOK
+		}
 
 		for {
 			select {
 			case <-ticker.C:
-				if atomic.LoadInt32(&m.done) == 1 {
-					return
-				}
-
-				currentTime := time.Now()
-				currentCPUTime := getCPUTime()
-
-				elapsed := currentTime.Sub(lastTime)
-				cpuElapsed := currentCPUTime - lastCPUTime
-
-				usage := float64(cpuElapsed) / float64(elapsed) * 100
-				m.samples = append(m.samples, usage)
-
-				lastTime = currentTime
-				lastCPUTime = currentCPUTime
+				sample()
+			case <-m.stop:
+				// 最後の区間（間隔より短い）も含める
+				sample()
+				return
 			}
 		}
 	}()
 }
 
-// Stop は監視を停止
+// Stop は監視を停止し、最後のサンプルが記録されるまで待つ。何度呼んでもよい
 func (m *CPUMonitor) Stop() {
-	atomic.StoreInt32(&m.done, 1)
-	time.Sleep(200 * time.Millisecond) // 最後のサンプルを待つ
+	m.mu.Lock()
+	started := m.stop != nil
+	m.mu.Unlock()
+	if !started {
+		return
+	}
+	m.stopOnce.Do(func() { close(m.stop) })
+	<-m.finished
 }
 
-// GetAverageCPUUsage は平均CPU使用率を返す
-func (m *CPUMonitor) GetAverageCPUUsage() float64 {
-	if len(m.samples) == 0 {
+// BeginWorker は呼び出し元のgoroutineを現在のOSスレッドに固定し、そのスレッドの
+// CPU時間を返す。固定中のスレッドは他のgoroutineを実行しないため、EndWorker までの
+// 差分がそのワーカーのCPU時間になる。nilのモニターでは何もしない
+func (m *CPUMonitor) BeginWorker() time.Duration {
+	if m == nil {
 		return 0
 	}
-
-	var sum float64
-	for _, sample := range m.samples {
-		sum += sample
-	}
-	return sum / float64(len(m.samples))
+	runtime.LockOSThread()
+	return threadCPUTime()
 }
 
-// GetMaxCPUUsage は最大CPU使用率を返す
-func (m *CPUMonitor) GetMaxCPUUsage() float64 {
-	if len(m.samples) == 0 {
-		return 0
+// EndWorker は BeginWorker からのスレッドのCPU時間をワーカー worker に加算し、固定を解除する
+func (m *CPUMonitor) EndWorker(worker int, start time.Duration) {
+	if m == nil {
+		return
 	}
+	elapsed := threadCPUTime() - start
+	runtime.UnlockOSThread()
 
-	max := m.samples[0]
-	for _, sample := range m.samples[1:] {
-		if sample > max {
-			max = sample
-		}
+	m.workerMu.Lock()
+	defer m.workerMu.Unlock()
+	for len(m.workerCPU) <= worker {
+		m.workerCPU = append(m.workerCPU, 0)
 	}
-	return max
+	m.workerCPU[worker] += elapsed
+}
+
+// WorkerCPU は numWorkers 個のワーカー別のCPU時間を返す
+func (m *CPUMonitor) WorkerCPU(numWorkers int) []time.Duration {
+	m.workerMu.Lock()
+	defer m.workerMu.Unlock()
+	times := make([]time.Duration, numWorkers)
+	copy(times, m.workerCPU)
+	return times
 }
 
-// GetStats は統計情報を返す
+// GetStats はその時点までのサンプルの統計情報を返す。監視中に呼んでもよい
 func (m *CPUMonitor) GetStats() CPUStats {
-	return CPUStats{
-		Average:     m.GetAverageCPUUsage(),
-		Max:         m.GetMaxCPUUsage(),
-		SampleCount: len(m.samples),
+	m.mu.Lock()
+	stats := CPUStats{SampleCount: len(m.samples)}
+	var sum float64
+	for i, sample := range m.samples {
+		sum += sample
+		if i == 0 || sample > stats.Max {
+			stats.Max = sample
+		}
+	}
+	if len(m.samples) > 0 {
+		stats.Average = sum / float64(len(m.samples))
 	}
+	m.mu.Unlock()
+
+	m.workerMu.Lock()
+	numWorkers := len(m.workerCPU)
+	m.workerMu.Unlock()
+	stats.WorkerCPU = m.WorkerCPU(numWorkers)
+	return stats
 }
 
-// CPUStats はCPU使用率の統計情報
+// CPUStats はCPU使用率の統計情報。使用率は1コアで100%
 type CPUStats struct {
 	Average     float64
 	Max         float64
 	SampleCount int
+	// WorkerCPU はワーカー別のCPU時間
+	WorkerCPU []time.Duration
 }
 
-// getCPUTime は現在のプロセスのCPU時間を取得（簡易版）
-func getCPUTime() time.Duration {
-	// 実際の実装では/proc/self/statやWindows APIを使用
-	// ここでは簡易的にruntime.NumGoroutine()を使用
-	return time.Duration(runtime.NumGoroutine()) * time.Millisecond
-}
-
-// ExtendedBenchmarkResult は拡張されたベンチマーク結果
-type ExtendedBenchmarkResult struct {
-	BenchmarkResult
-	CPUStats CPUStats
-}
-
-// runBenchmarkWithCPUMonitoring はCPU監視付きでベンチマークを実行
-func runBenchmarkWithCPUMonitoring(rootPath, structure, strategy string, numWorkers int) (*ExtendedBenchmarkResult, error) {
-	monitor := NewCPUMonitor()
-	monitor.Start()
-
-	result, err := runBenchmark(rootPath, structure, strategy, numWorkers)
-	if err != nil {
-		return nil, err
-	}
-
-	monitor.Stop()
-
-	return &ExtendedBenchmarkResult{
-		BenchmarkResult: *result,
-		CPUStats:        monitor.GetStats(),
-	}, nil
-}
-
-// 使用例
-func demonstrateCPUMonitoring() {
-	fmt.Println("CPU監視デモンストレーション")
-	fmt.Println("============================")
-
-	monitor := NewCPUMonitor()
-	monitor.Start()
-
-	// ベンチマークシミュレーション
-	fmt.Println("処理を実行中...")
-	time.Sleep(2 * time.Second)
-
-	monitor.Stop()
-
-	stats := monitor.GetStats()
-	fmt.Printf("\n統計情報:\n")
-	fmt.Printf("平均CPU使用率: %.2f%%\n", stats.Average)
-	fmt.Printf("最大CPU使用率: %.2f%%\n", stats.Max)
-	fmt.Printf("サンプル数: %d\n", stats.SampleCount)
+// processCPUTime はプロセスのユーザー時間とシステム時間の合計を返す。
+// 取得できないプラットフォームでは false
+func processCPUTime() (time.Duration, bool) {
+	usage := readProcessUsage()
+	return usage.User + usage.System, usage.ok
 }
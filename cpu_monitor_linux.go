@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// threadCPUSupported はスレッド単位のCPU時間を取得できるかどうか
+const threadCPUSupported = true
+
+// clockThreadCPUTimeID は CLOCK_THREAD_CPUTIME_ID
+const clockThreadCPUTimeID = 3
+
+// threadCPUTime は呼び出し元のOSスレッドのCPU時間を返す
+func threadCPUTime() time.Duration {
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockThreadCPUTimeID, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return 0
+	}
+	return time.Duration(ts.Nano())
+}
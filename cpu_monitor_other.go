@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// threadCPUSupported はスレッド単位のCPU時間を取得できるかどうか
+const threadCPUSupported = false
+
+// threadCPUTime はこのプラットフォームでは未対応
+func threadCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCPUClock reports a CPU time growing at a fixed number of cores
+func fakeCPUClock(cores float64) func() (time.Duration, bool) {
+	start := time.Now()
+	return func() (time.Duration, bool) {
+		return time.Duration(float64(time.Since(start)) * cores), true
+	}
+}
+
+func TestCPUMonitorSamplesAtInterval(t *testing.T) {
+	m := NewCPUMonitor(5 * time.Millisecond)
+	m.cpuTime = fakeCPUClock(2)
+	m.Start()
+	time.Sleep(60 * time.Millisecond)
+	m.Stop()
+
+	stats := m.GetStats()
+	if stats.SampleCount < 2 {
+		t.Fatalf("SampleCount = %d, want at least 2", stats.SampleCount)
+	}
+	if stats.Average < 150 || stats.Average > 250 {
+		t.Errorf("Average = %.1f%%, want about 200%%", stats.Average)
+	}
+	if stats.Max < stats.Average {
+		t.Errorf("Max = %.1f%% is below Average = %.1f%%", stats.Max, stats.Average)
+	}
+}
+
+func TestCPUMonitorStopRecordsFinalInterval(t *testing.T) {
+	m := NewCPUMonitor(time.Hour)
+	m.cpuTime = fakeCPUClock(1)
+	m.Start()
+	time.Sleep(5 * time.Millisecond)
+	m.Stop()
+
+	if n := m.GetStats().SampleCount; n != 1 {
+		t.Fatalf("SampleCount = %d, want 1 sample for the interval cut short by Stop", n)
+	}
+}
+
+func TestCPUMonitorStopIsIdempotent(t *testing.T) {
+	m := NewCPUMonitor(time.Millisecond)
+	m.cpuTime = fakeCPUClock(1)
+	m.Stop() // not started
+	m.Start()
+	m.Start()
+	m.Stop()
+	m.Stop()
+	before := m.GetStats().SampleCount
+	time.Sleep(5 * time.Millisecond)
+	if after := m.GetStats().SampleCount; after != before {
+		t.Errorf("SampleCount changed from %d to %d after Stop", before, after)
+	}
+}
+
+func TestCPUMonitorStatsWhileSampling(t *testing.T) {
+	m := NewCPUMonitor(time.Millisecond)
+	m.cpuTime = fakeCPUClock(1)
+	m.Start()
+	defer m.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m.GetStats()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCPUMonitorUnavailableCPUTime(t *testing.T) {
+	m := NewCPUMonitor(time.Millisecond)
+	m.cpuTime = func() (time.Duration, bool) { return 0, false }
+	m.Start()
+	time.Sleep(5 * time.Millisecond)
+	m.Stop()
+
+	if stats := m.GetStats(); stats.SampleCount != 0 || stats.Average != 0 || stats.Max != 0 {
+		t.Errorf("GetStats() = %+v, want no samples", stats)
+	}
+}
+
+func TestCPUMonitorDefaultInterval(t *testing.T) {
+	if m := NewCPUMonitor(0); m.interval != defaultCPUSampleInterval {
+		t.Errorf("interval = %v, want %v", m.interval, defaultCPUSampleInterval)
+	}
+}
+
+func TestCPUMonitorWorkerCPU(t *testing.T) {
+	var nilMonitor *CPUMonitor
+	nilMonitor.EndWorker(0, nilMonitor.BeginWorker())
+
+	m := NewCPUMonitor(0)
+	start := m.BeginWorker()
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	m.EndWorker(2, start)
+
+	times := m.WorkerCPU(4)
+	if len(times) != 4 {
+		t.Fatalf("len(WorkerCPU(4)) = %d, want 4", len(times))
+	}
+	if times[0] != 0 || times[1] != 0 || times[3] != 0 {
+		t.Errorf("WorkerCPU = %v, want time only for worker 2", times)
+	}
+	if threadCPUSupported && times[2] < 5*time.Millisecond {
+		t.Errorf("worker 2 CPU = %v after a 20ms busy loop", times[2])
+	}
+}
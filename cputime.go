@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// processUsage is a snapshot of the CPU time and memory used by the process
+type processUsage struct {
+	User   time.Duration
+	System time.Duration
+	// MaxRSS is the peak resident set size in bytes, -1 when unknown
+	MaxRSS int64
+	// ok reports whether the CPU times could be read
+	ok bool
+}
+
+// cpuSince returns the user and system CPU time spent since before, or -1
+// for both when the platform does not report them. The times cover the whole
+// process, so concurrent scans and churn goroutines are included.
+func (u processUsage) cpuSince(before processUsage) (user, system time.Duration) {
+	if !u.ok || !before.ok {
+		return -1, -1
+	}
+	return u.User - before.User, u.System - before.System
+}
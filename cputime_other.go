@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+// readProcessUsage reports no usage on platforms without a process accounting API
+func readProcessUsage() processUsage {
+	return processUsage{MaxRSS: -1}
+}
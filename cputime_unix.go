@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// readProcessUsage returns the CPU time and peak resident set size of the process
+func readProcessUsage() processUsage {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return processUsage{MaxRSS: -1}
+	}
+	maxRSS := int64(ru.Maxrss)
+	// ru_maxrss is in bytes on macOS and in kilobytes elsewhere
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		maxRSS *= 1024
+	}
+	return processUsage{
+		User:   time.Duration(ru.Utime.Nano()),
+		System: time.Duration(ru.Stime.Nano()),
+		MaxRSS: maxRSS,
+		ok:     true,
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dirTimer accumulates the time spent listing each directory of a scan.
+// All methods are no-ops on a nil receiver.
+type dirTimer struct {
+	root string
+	mu   sync.Mutex
+	self map[string]time.Duration
+}
+
+// subtreeTime is the listing time of a directory and everything below it
+type subtreeTime struct {
+	// Path is relative to the scanned root, with forward slashes
+	Path  string
+	Total time.Duration
+	Self  time.Duration
+	Dirs  int
+}
+
+func newDirTimer(root string) *dirTimer {
+	return &dirTimer{root: root, self: map[string]time.Duration{}}
+}
+
+// Add records time spent listing a directory
+func (t *dirTimer) Add(dir string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.self[dir] += d
+	t.mu.Unlock()
+}
+
+// Merge adds the times of another scan of the same root
+func (t *dirTimer) Merge(other *dirTimer) {
+	if t == nil || other == nil {
+		return
+	}
+	for dir, d := range other.self {
+		t.self[dir] += d
+	}
+}
+
+// subtrees returns the time of every subtree below the root, slowest first
+func (t *dirTimer) subtrees() []subtreeTime {
+	totals := map[string]*subtreeTime{}
+	for dir, d := range t.self {
+		rel, err := filepath.Rel(t.root, dir)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for cur := rel; ; cur = path.Dir(cur) {
+			st, ok := totals[cur]
+			if !ok {
+				st = &subtreeTime{Path: cur}
+				totals[cur] = st
+			}
+			st.Total += d
+			st.Dirs++
+			if cur == rel {
+				st.Self += d
+			}
+			if cur == "." {
+				break
+			}
+		}
+	}
+
+	subtrees := make([]subtreeTime, 0, len(totals))
+	for p, st := range totals {
+		if p != "." {
+			subtrees = append(subtrees, *st)
+		}
+	}
+	sort.Slice(subtrees, func(i, j int) bool {
+		if subtrees[i].Total != subtrees[j].Total {
+			return subtrees[i].Total > subtrees[j].Total
+		}
+		return subtrees[i].Path < subtrees[j].Path
+	})
+	return subtrees
+}
+
+// exportDirTimesToCSV exports the topN slowest subtrees of every result
+func exportDirTimesToCSV(results []BenchmarkResult, topN int, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"Structure", "Strategy", "Workers", "Listing", "Rank", "Path", "Subtree_ms", "Self_ms", "Dirs"})
+	for _, r := range results {
+		if r.dirTimes == nil {
+			continue
+		}
+		subtrees := r.dirTimes.subtrees()
+		if len(subtrees) > topN {
+			subtrees = subtrees[:topN]
+		}
+		for i, st := range subtrees {
+			writer.Write([]string{
+				r.Structure,
+				r.Label(),
+				fmt.Sprintf("%d", r.Workers),
+				r.Listing,
+				fmt.Sprintf("%d", i+1),
+				st.Path,
+				fmt.Sprintf("%.3f", st.Total.Seconds()*1000),
+				fmt.Sprintf("%.3f", st.Self.Seconds()*1000),
+				fmt.Sprintf("%d", st.Dirs),
+			})
+		}
+	}
+	return nil
+}
+
+// exportDirTimesFolded writes the directory hierarchy of every result in the
+// folded stack format of flamegraph tools, weighted by listing time in
+// microseconds. The structure and strategy label are the outermost frames.
+func exportDirTimesFolded(results []BenchmarkResult, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	frame := func(name string) string {
+		return strings.ReplaceAll(name, ";", "_")
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, r := range results {
+		if r.dirTimes == nil {
+			continue
+		}
+		prefix := []string{frame(r.Structure), frame(fmt.Sprintf("%s/%d", r.Label(), r.Workers))}
+		dirs := make([]string, 0, len(r.dirTimes.self))
+		for dir := range r.dirTimes.self {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			micros := r.dirTimes.self[dir].Microseconds()
+			rel, err := filepath.Rel(r.dirTimes.root, dir)
+			if micros == 0 || err != nil {
+				continue
+			}
+			frames := append([]string{}, prefix...)
+			frames = append(frames, frame(filepath.Base(r.dirTimes.root)))
+			if rel != "." {
+				for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+					frames = append(frames, frame(name))
+				}
+			}
+			fmt.Fprintf(writer, "%s %d\n", strings.Join(frames, ";"), micros)
+		}
+	}
+	return writer.Flush()
+}
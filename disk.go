@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// fixtureContentSize is an upper bound of the content size of generated files
+const fixtureContentSize = 32
+
+// inodeOverhead is the estimated metadata cost per file or directory
+const inodeOverhead = 256
+
+// diskSpaceMargin is the fraction of extra free space required beyond the estimate
+const diskSpaceMargin = 0.1
+
+// estimateFixtureBytes estimates the disk usage of a fixture: file contents
+// rounded up to whole blocks, one block per directory and an inode overhead
+// for every entry
+func estimateFixtureBytes(files, dirs int) int64 {
+	fileBlocks := int64((fixtureContentSize + fsBlockSize - 1) / fsBlockSize)
+	return int64(files)*fileBlocks*fsBlockSize +
+		int64(dirs)*fsBlockSize +
+		int64(files+dirs)*inodeOverhead
+}
+
+// checkDiskSpace returns an error when the filesystem containing path does
+// not have room for the requested number of bytes plus a safety margin
+func checkDiskSpace(path string, required int64) error {
+	available, err := availableBytes(path)
+	if err != nil {
+		return fmt.Errorf("空き容量を取得できません (%s): %v", path, err)
+	}
+	needed := required + int64(float64(required)*diskSpaceMargin)
+	if uint64(needed) > available {
+		return fmt.Errorf("ディスク容量が不足しています (%s): 必要 %s, 空き %s",
+			path, formatBytes(needed), formatBytes(int64(available)))
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// availableBytes is not supported on this platform
+func availableBytes(path string) (uint64, error) {
+	return 0, errors.New("free space query is not supported on this platform")
+}
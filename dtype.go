@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// dtypeCounter counts the entries listed in dtype mode and the entries whose
+// type had to be read with lstat. A nil *dtypeCounter counts nothing.
+type dtypeCounter struct {
+	entries   int64
+	fallbacks int64
+}
+
+func (c *dtypeCounter) entry() {
+	if c != nil {
+		atomic.AddInt64(&c.entries, 1)
+	}
+}
+
+func (c *dtypeCounter) fallback() {
+	if c != nil {
+		atomic.AddInt64(&c.fallbacks, 1)
+	}
+}
+
+// counts returns the listed entries and fallbacks, or -1 for both when not counted
+func (c *dtypeCounter) counts() (entries, fallbacks int64) {
+	if c == nil {
+		return -1, -1
+	}
+	return atomic.LoadInt64(&c.entries), atomic.LoadInt64(&c.fallbacks)
+}
+
+// printDTypeSummary prints how many entries of each tree had no d_type and
+// needed an lstat, from the first dtype cell of every target and structure.
+// The share depends on the filesystem, not on the strategy.
+func printDTypeSummary(results []BenchmarkResult) {
+	table := &textTable{
+		header: []string{"Target", "Structure", "Entries", "Fallbacks", "Ratio"},
+		right:  []bool{false, false, true, true, true},
+	}
+	seen := map[string]bool{}
+	for _, r := range results {
+		key := r.Target + "|" + r.Structure
+		if r.DTypeEntries < 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		ratio := 0.0
+		if r.DTypeEntries > 0 {
+			ratio = float64(r.DTypeFallbacks) / float64(r.DTypeEntries) * 100
+		}
+		table.add(r.Target, r.Structure, fmt.Sprintf("%d", r.DTypeEntries), fmt.Sprintf("%d", r.DTypeFallbacks), fmt.Sprintf("%.1f%%", ratio))
+	}
+	if len(seen) == 0 {
+		return
+	}
+	fmt.Println("\n===== d_type の利用状況 (DT_UNKNOWN による lstat) =====")
+	table.render(os.Stdout, false)
+}
+
+// dtypeEntry is a directory entry whose type came from d_type; Info is
+// only read on demand
+type dtypeEntry struct {
+	dir  string
+	name string
+	typ  fs.FileMode
+}
+
+func (e *dtypeEntry) Name() string      { return e.name }
+func (e *dtypeEntry) IsDir() bool       { return e.typ.IsDir() }
+func (e *dtypeEntry) Type() fs.FileMode { return e.typ }
+func (e *dtypeEntry) Info() (fs.FileInfo, error) {
+	return os.Lstat(filepath.Join(e.dir, e.name))
+}
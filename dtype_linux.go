@@ -0,0 +1,156 @@
+//go:build linux
+
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"unsafe"
+)
+
+// dtypeSupported reports whether the dtype listing mode can read raw directory entries
+const dtypeSupported = true
+
+// dtypeBufferSize is the buffer passed to each getdents call
+const dtypeBufferSize = 32 * 1024
+
+// Offsets of the fields of a linux_dirent64 record
+var (
+	direntInoOffset    = int(unsafe.Offsetof(syscall.Dirent{}.Ino))
+	direntReclenOffset = int(unsafe.Offsetof(syscall.Dirent{}.Reclen))
+	direntTypeOffset   = int(unsafe.Offsetof(syscall.Dirent{}.Type))
+	direntNameOffset   = int(unsafe.Offsetof(syscall.Dirent{}.Name))
+)
+
+// readDirents reads all raw entries of the open directory fd with getdents
+// and calls fn with the name, inode number and d_type of each, except "."
+// and "..". The name is only valid during the call.
+func readDirents(fd int, buf []byte, fn func(name []byte, ino uint64, typ uint8)) error {
+	for {
+		n, err := syscall.ReadDirent(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return nil
+		}
+		for offset := 0; offset < n; {
+			// Records are shorter than syscall.Dirent, so the fields are
+			// decoded from the buffer rather than through a pointer cast
+			reclen := int(binary.NativeEndian.Uint16(buf[offset+direntReclenOffset:]))
+			record := buf[offset : offset+reclen]
+			offset += reclen
+
+			name := record[direntNameOffset:]
+			for i, c := range name {
+				if c == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			if string(name) == "." || string(name) == ".." {
+				continue
+			}
+			fn(name, binary.NativeEndian.Uint64(record[direntInoOffset:]), record[direntTypeOffset])
+		}
+	}
+}
+
+// direntMode returns the type bits of a d_type value, and false for DT_UNKNOWN
+func direntMode(typ uint8) (fs.FileMode, bool) {
+	switch typ {
+	case syscall.DT_DIR:
+		return fs.ModeDir, true
+	case syscall.DT_REG:
+		return 0, true
+	case syscall.DT_LNK:
+		return fs.ModeSymlink, true
+	case syscall.DT_FIFO:
+		return fs.ModeNamedPipe, true
+	case syscall.DT_SOCK:
+		return fs.ModeSocket, true
+	case syscall.DT_CHR:
+		return fs.ModeDevice | fs.ModeCharDevice, true
+	case syscall.DT_BLK:
+		return fs.ModeDevice, true
+	}
+	return 0, false
+}
+
+// readDirDType lists a directory with getdents and takes the entry types
+// from d_type. Only entries reported as DT_UNKNOWN, e.g. by some network and
+// older filesystems, are lstat'ed; they are counted in counter.
+func readDirDType(path string, counter *dtypeCounter) ([]fs.DirEntry, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.Close(fd)
+
+	entries := []fs.DirEntry{}
+	err = readDirents(fd, make([]byte, dtypeBufferSize), func(name []byte, _ uint64, typ uint8) {
+		entry := &dtypeEntry{dir: path, name: string(name)}
+		mode, known := direntMode(typ)
+		if known {
+			entry.typ = mode
+			entries = append(entries, entry)
+			counter.entry()
+			return
+		}
+		counter.fallback()
+		info, err := os.Lstat(filepath.Join(path, entry.name))
+		if err != nil {
+			// Removed since it was listed
+			return
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+		counter.entry()
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "getdents", Path: path, Err: err}
+	}
+	return entries, nil
+}
+
+// readDirInodeOrder lists a directory with getdents, sorts the entries by
+// inode number and lstats them in that order, as rsync and find do to read
+// the inode table of ext4 and XFS sequentially instead of in hash order.
+// Entries removed since they were listed are skipped.
+func readDirInodeOrder(path string) ([]fs.DirEntry, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.Close(fd)
+
+	type inodeName struct {
+		ino  uint64
+		name string
+	}
+	names := []inodeName{}
+	err = readDirents(fd, make([]byte, dtypeBufferSize), func(name []byte, ino uint64, _ uint8) {
+		names = append(names, inodeName{ino, string(name)})
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "getdents", Path: path, Err: err}
+	}
+	slices.SortFunc(names, func(a, b inodeName) int { return cmp.Compare(a.ino, b.ino) })
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, n := range names {
+		info, err := os.Lstat(filepath.Join(path, n.name))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
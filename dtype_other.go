@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// dtypeSupported reports whether the dtype listing mode can read raw directory entries
+const dtypeSupported = false
+
+// readDirDType is only implemented with getdents on Linux
+func readDirDType(path string, counter *dtypeCounter) ([]fs.DirEntry, error) {
+	return nil, errors.New("the dtype listing mode is only supported on Linux")
+}
+
+// readDirInodeOrder is only implemented with getdents on Linux
+func readDirInodeOrder(path string) ([]fs.DirEntry, error) {
+	return nil, errors.New("the inode listing mode is only supported on Linux")
+}
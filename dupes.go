@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hashes of the dupes subcommand
+const (
+	DupesHashMD5    = "md5"
+	DupesHashXXHash = "xxhash"
+)
+
+// dupesReportRows is the number of duplicate groups printed by dupes
+const dupesReportRows = 10
+
+// fileHookStrategies returns the strategies that pass every file to the
+// files hook of the scan options, which dupes and top build on
+func fileHookStrategies() []string {
+	return []string{StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled, StrategyUnbounded}
+}
+
+// newDupesHash returns the constructor of a -hash value
+func newDupesHash(name string) (func() hash.Hash, error) {
+	switch name {
+	case DupesHashMD5:
+		return md5.New, nil
+	case DupesHashXXHash:
+		return func() hash.Hash { return newXXHash64() }, nil
+	}
+	return nil, fmt.Errorf("unknown hash: %s (%s, %s)", name, DupesHashMD5, DupesHashXXHash)
+}
+
+// dupeFinder groups the regular files found by a scan by size. Further links
+// to a file already seen are not candidates, as they take no extra space.
+type dupeFinder struct {
+	minSize int64
+	mu      sync.Mutex
+	bySize  map[int64][]string
+	seen    map[fileKey]bool
+	files   int64
+	links   int64
+	errors  int64
+}
+
+func newDupeFinder(minSize int64) *dupeFinder {
+	return &dupeFinder{minSize: minSize, bySize: map[int64][]string{}, seen: map[fileKey]bool{}}
+}
+
+// add records a file found by a scan worker; the size is read on that worker
+func (f *dupeFinder) add(dir string, entry fs.DirEntry) {
+	if !entry.Type().IsRegular() {
+		return
+	}
+	info, err := entry.Info()
+	if err != nil {
+		atomic.AddInt64(&f.errors, 1)
+		return
+	}
+	key, linked := fileIdentity(info)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files++
+	if linked {
+		if f.seen[key] {
+			f.links++
+			return
+		}
+		f.seen[key] = true
+	}
+	if info.Size() >= f.minSize {
+		f.bySize[info.Size()] = append(f.bySize[info.Size()], filepath.Join(dir, entry.Name()))
+	}
+}
+
+// dupeFile is a candidate file with the hash of the stage it is in
+type dupeFile struct {
+	path string
+	size int64
+	hash string
+}
+
+// dupeGroup is a set of files with equal size and content hash
+type dupeGroup struct {
+	size  int64
+	hash  string
+	paths []string
+}
+
+// wasted returns the bytes held by the copies beyond the first
+func (g dupeGroup) wasted() int64 { return g.size * int64(len(g.paths)-1) }
+
+// dupesPhase is the cost of one phase of the search
+type dupesPhase struct {
+	name     string
+	duration time.Duration
+	files    int64
+	bytes    int64
+}
+
+// hashFiles hashes the first limit bytes of every file (all of it when limit
+// is negative) with numWorkers workers. Files that cannot be read are dropped
+// and counted.
+func hashFiles(files []dupeFile, limit int64, numWorkers int, newHash func() hash.Hash) (hashed []dupeFile, bytes, errors int64) {
+	jobs := make(chan int, numWorkers)
+	ok := make([]bool, len(files))
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 1<<16)
+			h := newHash()
+			for i := range jobs {
+				f, err := os.Open(files[i].path)
+				if err != nil {
+					atomic.AddInt64(&errors, 1)
+					continue
+				}
+				var r io.Reader = f
+				if limit >= 0 {
+					r = io.LimitReader(f, limit)
+				}
+				h.Reset()
+				n, err := io.CopyBuffer(h, r, buf)
+				f.Close()
+				atomic.AddInt64(&bytes, n)
+				if err != nil {
+					atomic.AddInt64(&errors, 1)
+					continue
+				}
+				files[i].hash = hex.EncodeToString(h.Sum(nil))
+				ok[i] = true
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for i, f := range files {
+		if ok[i] {
+			hashed = append(hashed, f)
+		}
+	}
+	return hashed, bytes, errors
+}
+
+// groupByHash returns the groups of more than one file with equal size and
+// hash
+func groupByHash(files []dupeFile) []dupeGroup {
+	type groupKey struct {
+		size int64
+		hash string
+	}
+	groups := map[groupKey]*dupeGroup{}
+	for _, f := range files {
+		key := groupKey{f.size, f.hash}
+		g := groups[key]
+		if g == nil {
+			g = &dupeGroup{size: f.size, hash: f.hash}
+			groups[key] = g
+		}
+		g.paths = append(g.paths, f.path)
+	}
+	result := []dupeGroup{}
+	for _, g := range groups {
+		if len(g.paths) > 1 {
+			sort.Strings(g.paths)
+			result = append(result, *g)
+		}
+	}
+	return result
+}
+
+// sortDupeGroups orders groups by their waste, largest first
+func sortDupeGroups(groups []dupeGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].wasted() != groups[j].wasted() {
+			return groups[i].wasted() > groups[j].wasted()
+		}
+		return groups[i].paths[0] < groups[j].paths[0]
+	})
+}
+
+// findDupes scans root with a strategy and narrows the files down to
+// duplicates: by size during the scan, then by a hash of the first partial
+// bytes and finally by a hash of the whole content, both in a worker pool
+func findDupes(root, strategy string, numWorkers int, newHash func() hash.Hash, partial, minSize int64) ([]dupeGroup, []dupesPhase, *dupeFinder, error) {
+	finder := newDupeFinder(minSize)
+	options := defaultScanOptions()
+	options.files = finder.add
+	scanner, err := newScanner(strategy, numWorkers, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	phases := []dupesPhase{}
+	start := time.Now()
+	result, err := scanner.Scan(root)
+	if result == nil {
+		return nil, nil, nil, err
+	}
+	finder.errors += result.Errors
+	phases = append(phases, dupesPhase{name: "scan", duration: time.Since(start), files: result.Files})
+
+	candidates := []dupeFile{}
+	for size, paths := range finder.bySize {
+		if len(paths) > 1 {
+			for _, path := range paths {
+				candidates = append(candidates, dupeFile{path: path, size: size})
+			}
+		}
+	}
+
+	// Groups of files no larger than the partial hash are already final
+	groups := []dupeGroup{}
+	rest := candidates
+	if partial > 0 {
+		start = time.Now()
+		hashed, bytes, errors := hashFiles(candidates, partial, numWorkers, newHash)
+		finder.errors += errors
+		phases = append(phases, dupesPhase{name: "partial", duration: time.Since(start), files: int64(len(candidates)), bytes: bytes})
+		rest = []dupeFile{}
+		for _, g := range groupByHash(hashed) {
+			if g.size <= partial {
+				groups = append(groups, g)
+				continue
+			}
+			for _, path := range g.paths {
+				rest = append(rest, dupeFile{path: path, size: g.size})
+			}
+		}
+	}
+
+	start = time.Now()
+	hashed, bytes, errors := hashFiles(rest, -1, numWorkers, newHash)
+	finder.errors += errors
+	phases = append(phases, dupesPhase{name: "full", duration: time.Since(start), files: int64(len(rest)), bytes: bytes})
+	groups = append(groups, groupByHash(hashed)...)
+	sortDupeGroups(groups)
+	return groups, phases, finder, nil
+}
+
+// exportDupesToCSV writes every duplicate group, one row per file
+func exportDupesToCSV(groups []dupeGroup, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"Group", "Size", "Hash", "Path"})
+	for i, g := range groups {
+		for _, path := range g.paths {
+			writer.Write([]string{strconv.Itoa(i + 1), strconv.FormatInt(g.size, 10), g.hash, path})
+		}
+	}
+	return nil
+}
+
+// runDupes finds duplicate files in a tree with a parallel scanner and
+// reports the throughput of each phase
+func runDupes(args []string) int {
+	fs := flag.NewFlagSet("dupes", flag.ContinueOnError)
+	strategy := fs.String("strategy", StrategyRecursiveTask, "scan strategy: "+strings.Join(fileHookStrategies(), ", "))
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan and hashing workers")
+	hashName := fs.String("hash", DupesHashXXHash, "content hash: md5 or xxhash")
+	partial := fs.Int64("partial", 4096, "bytes hashed first to rule out files of equal size cheaply (0 = hash whole files only)")
+	minSize := fs.Int64("min-size", 1, "smallest file size considered, in bytes")
+	out := fs.String("output", "", "CSV file listing every duplicate (default benchmark/dupes_<timestamp>.csv)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	newHash, err := newDupesHash(*hashName)
+	if fs.NArg() != 1 || *workers < 1 || *partial < 0 || *minSize < 0 || err != nil || !slices.Contains(fileHookStrategies(), *strategy) {
+		fmt.Println("使い方: dupes [-strategy recursive-task] [-workers N] [-hash md5|xxhash] [-partial 4096] [-min-size 1] [-output dupes.csv] <ディレクトリ>")
+		return 2
+	}
+	root := fs.Arg(0)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	}
+	filename := *out
+	if filename == "" {
+		if err := os.MkdirAll("benchmark", 0755); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+		filename = fmt.Sprintf("benchmark/dupes_%s.csv", time.Now().Format("20060102_150405"))
+	}
+
+	fmt.Printf("重複ファイルの検索: %s (%s, ワーカー数 %d, %s)\n", root, *strategy, *workers, *hashName)
+	groups, phases, finder, err := findDupes(root, *strategy, *workers, newHash, *partial, *minSize)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+
+	table := &textTable{
+		header: []string{"Phase", "Duration", "Files", "Files/s", "Bytes", "MB/s"},
+		right:  []bool{false, true, true, true, true, true},
+	}
+	var total time.Duration
+	for _, p := range phases {
+		total += p.duration
+		mbps := "-"
+		if p.bytes > 0 {
+			mbps = fmt.Sprintf("%.1f", float64(p.bytes)/1e6/p.duration.Seconds())
+		}
+		table.add(p.name, formatDuration(p.duration), strconv.FormatInt(p.files, 10),
+			fmt.Sprintf("%.0f", float64(p.files)/p.duration.Seconds()), formatBytes(p.bytes), mbps)
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+
+	var dupes, wasted int64
+	for _, g := range groups {
+		dupes += int64(len(g.paths) - 1)
+		wasted += g.wasted()
+	}
+	fmt.Printf("\nファイル: %d (同じファイルへの追加のリンク: %d, 読み取りエラー: %d), 合計時間: %s\n", finder.files, finder.links, finder.errors, formatDuration(total))
+	fmt.Printf("重複: %d グループ, 余分なコピー %d 個, %s\n", len(groups), dupes, formatBytes(wasted))
+
+	if len(groups) > 0 {
+		top := &textTable{
+			header: []string{"Size", "Copies", "Wasted", "Hash", "Path"},
+			right:  []bool{true, true, true, false, false},
+		}
+		for i, g := range groups {
+			if i == dupesReportRows {
+				top.add(fmt.Sprintf("... 他 %d", len(groups)-i), "", "", "", "")
+				break
+			}
+			top.add(formatBytes(g.size), strconv.Itoa(len(g.paths)), formatBytes(g.wasted()), g.hash[:min(len(g.hash), 16)], g.paths[0])
+		}
+		fmt.Println()
+		top.render(os.Stdout, false)
+	}
+
+	if err := exportDupesToCSV(groups, filename); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	fmt.Printf("\n重複の一覧を出力しました: %s\n", filename)
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// energySample is a reading of the cumulative energy counters of the CPU
+// packages in microjoules
+type energySample struct {
+	uj []uint64
+	// wrap is the value at which each counter wraps around to 0
+	wrap []uint64
+	ok   bool
+}
+
+// joulesSince returns the energy used since before, or -1 when either
+// sample is unavailable
+func (s energySample) joulesSince(before energySample) float64 {
+	if !s.ok || !before.ok || len(s.uj) != len(before.uj) {
+		return -1
+	}
+	var total uint64
+	for i, uj := range s.uj {
+		if uj >= before.uj[i] {
+			total += uj - before.uj[i]
+		} else {
+			total += s.wrap[i] - before.uj[i] + uj
+		}
+	}
+	return float64(total) / 1e6
+}
+
+// FilesPerJoule returns the files scanned per joule, or -1 when the energy
+// was not measured
+func (r *BenchmarkResult) FilesPerJoule() float64 {
+	if r.EnergyJoules <= 0 {
+		return -1
+	}
+	return float64(r.FilesScanned) / r.EnergyJoules
+}
+
+// averageEnergy returns the mean energy of runs, -1 when any run lacks it
+func averageEnergy(runs []BenchmarkResult) float64 {
+	if len(runs) == 0 {
+		return -1
+	}
+	var sum float64
+	for _, r := range runs {
+		if r.EnergyJoules < 0 {
+			return -1
+		}
+		sum += r.EnergyJoules
+	}
+	return sum / float64(len(runs))
+}
+
+// printEnergySummary lists the energy used by each measured cell
+func printEnergySummary(results []BenchmarkResult) {
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "Duration", "Energy_J", "Watts", "Files/J"},
+		right:  []bool{false, false, true, true, true, true, true},
+	}
+	for _, r := range results {
+		if r.EnergyJoules < 0 {
+			continue
+		}
+		watts := 0.0
+		if r.Duration > 0 {
+			watts = r.EnergyJoules / r.Duration.Seconds()
+		}
+		perJoule := "-"
+		if v := r.FilesPerJoule(); v >= 0 {
+			perJoule = fmt.Sprintf("%.0f", v)
+		}
+		table.add(r.Structure, r.Label(), fmt.Sprintf("%d", r.Workers), r.Duration.Round(time.Millisecond).String(),
+			fmt.Sprintf("%.3f", r.EnergyJoules), fmt.Sprintf("%.1f", watts), perJoule)
+	}
+	if len(table.rows) == 0 {
+		return
+	}
+	fmt.Println("\n===== エネルギー消費 (RAPL) =====")
+	table.render(os.Stdout, false)
+}
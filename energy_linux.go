@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// raplRoot holds the powercap zones; package zones are named intel-rapl:N
+// (also on AMD), their subzones intel-rapl:N:M
+const raplRoot = "/sys/class/powercap"
+
+// readEnergy reads the energy counters of all CPU packages. The counters are
+// usually readable by root only.
+func readEnergy() energySample {
+	dirs, _ := filepath.Glob(filepath.Join(raplRoot, "intel-rapl:*"))
+	sample := energySample{}
+	for _, dir := range dirs {
+		if strings.Count(filepath.Base(dir), ":") != 1 {
+			continue
+		}
+		// psys zones cover the whole platform including the packages
+		name, err := os.ReadFile(filepath.Join(dir, "name"))
+		if err != nil || !strings.HasPrefix(string(name), "package") {
+			continue
+		}
+		uj, err := readUintFile(filepath.Join(dir, "energy_uj"))
+		if err != nil {
+			return energySample{}
+		}
+		wrap, err := readUintFile(filepath.Join(dir, "max_energy_range_uj"))
+		if err != nil {
+			return energySample{}
+		}
+		sample.uj = append(sample.uj, uj)
+		sample.wrap = append(sample.wrap, wrap)
+	}
+	sample.ok = len(sample.uj) > 0
+	return sample
+}
+
+// readUintFile parses a sysfs file holding a single unsigned number
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
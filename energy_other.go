@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// readEnergy is not supported on this platform
+func readEnergy() energySample {
+	return energySample{}
+}
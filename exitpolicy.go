@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes of a benchmark run. A run violating several policies exits
+// with the code of the first one in this order.
+const (
+	ExitOK = 0
+	// ExitError is used when the benchmark could not run
+	ExitError = 1
+	// ExitVerification reports counts that differ from the expected values (-fail-on-mismatch)
+	ExitVerification = 3
+	// ExitScanErrors reports a cell with more read errors than -max-scan-errors
+	ExitScanErrors = 4
+	// ExitRegression reports a cell slower than -baseline by more than -max-regression
+	ExitRegression = 5
+	// ExitInterrupted reports a scan subcommand stopped by a signal whose
+	// state was saved to its checkpoint
+	ExitInterrupted = 6
+	// ExitQuotaExceeded reports a quota subcommand scan that exceeded one
+	// of its budgets
+	ExitQuotaExceeded = 7
+)
+
+// exitPolicy decides the exit code from the outcome of the benchmark
+type exitPolicy struct {
+	// FailOnMismatch fails when a count does not match its expected value
+	FailOnMismatch bool
+	// MaxScanErrors is the number of read errors a cell may have (-1 = no limit)
+	MaxScanErrors int64
+	// MaxRegression is the allowed slowdown against the baseline in percent (0 = not checked)
+	MaxRegression float64
+	// baseline holds the durations of a previous results file by regressionKey
+	baseline map[string]time.Duration
+}
+
+// regressionKey identifies a cell across results files
+func regressionKey(r BenchmarkResult) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%s", r.Target, r.Structure, r.Label(), r.Workers, r.ConcurrentScans, r.Workload)
+}
+
+// loadBaseline reads the durations of a results file; .json files are read
+// as JSON results, any other file as a results CSV. When a cell appears in
+// several sessions the last one is used.
+func loadBaseline(filename string) (map[string]time.Duration, error) {
+	results := []BenchmarkResult{}
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		file, err := loadResultsJSON(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range file.Sessions {
+			results = append(results, session.results()...)
+		}
+	} else {
+		var err error
+		if results, err = loadResultsCSV(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	baseline := map[string]time.Duration{}
+	for _, r := range results {
+		if !r.TimedOut && r.Duration > 0 {
+			baseline[regressionKey(r)] = r.Duration
+		}
+	}
+	if len(baseline) == 0 {
+		return nil, fmt.Errorf("%s: no comparable results", filename)
+	}
+	return baseline, nil
+}
+
+// evaluate prints every violation and returns the exit code; mismatches is
+// the number of verification warnings printed during the run
+func (p exitPolicy) evaluate(results []BenchmarkResult, mismatches int) int {
+	code := ExitOK
+	fail := func(exitCode int, format string, args ...interface{}) {
+		fmt.Printf("エラー: "+format+"\n", args...)
+		if code == ExitOK || exitCode < code {
+			code = exitCode
+		}
+	}
+
+	if p.FailOnMismatch && mismatches > 0 {
+		fail(ExitVerification, "期待値と一致しない結果が %d 件あります", mismatches)
+	}
+
+	if p.MaxScanErrors >= 0 {
+		for _, r := range results {
+			if r.ScanErrors > p.MaxScanErrors {
+				fail(ExitScanErrors, "%s / %s / %d workers: 読み取りエラー %d 件が上限 %d を超えました",
+					r.Structure, r.Label(), r.Workers, r.ScanErrors, p.MaxScanErrors)
+			}
+		}
+	}
+
+	if p.MaxRegression > 0 && p.baseline != nil {
+		compared := 0
+		for _, r := range results {
+			base, ok := p.baseline[regressionKey(r)]
+			if !ok || r.TimedOut {
+				continue
+			}
+			compared++
+			change := (float64(r.Duration)/float64(base) - 1) * 100
+			if change > p.MaxRegression {
+				fail(ExitRegression, "%s / %s / %d workers: 基準より %.1f%% 遅くなりました (基準: %v, 今回: %v, 上限: %g%%)",
+					r.Structure, r.Label(), r.Workers, change, base, r.Duration, p.MaxRegression)
+			}
+		}
+		if compared == 0 {
+			fmt.Println("警告: -baseline に今回と一致するセルがないため、性能低下を確認できませんでした")
+		}
+	}
+	return code
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpectedCounts holds the expected totals of a tree. Nil fields are not checked.
+type ExpectedCounts struct {
+	// Files counts every entry that is not a directory
+	Files *int64 `json:"files"`
+	// Dirs counts directories including the root
+	Dirs *int64 `json:"dirs"`
+	// Bytes is the total size of the regular files
+	Bytes *int64 `json:"bytes"`
+}
+
+// expectAnyTree is the expectation key applying to every scanned tree
+const expectAnyTree = "*"
+
+// expectations maps scanned paths or structure names to their expected counts
+type expectations map[string]ExpectedCounts
+
+// loadExpectations reads an expected-counts file. The file holds either a
+// single object with files, dirs and bytes applying to every tree, or an
+// object keyed by path (or fixture structure name) holding one such object
+// per tree:
+//
+//	{"files": 1200, "dirs": 35, "bytes": 10485760}
+//	{"/srv/mail": {"files": 1200}, "/srv/logs": {"files": 90, "dirs": 4}}
+func loadExpectations(filename string) (expectations, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	single := true
+	for key := range raw {
+		if key != "files" && key != "dirs" && key != "bytes" {
+			single = false
+			break
+		}
+	}
+	if single {
+		var counts ExpectedCounts
+		if err := json.Unmarshal(data, &counts); err != nil {
+			return nil, err
+		}
+		return expectations{expectAnyTree: counts}, nil
+	}
+
+	expects := expectations{}
+	for key, value := range raw {
+		var counts ExpectedCounts
+		if err := json.Unmarshal(value, &counts); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if key != expectAnyTree && strings.ContainsRune(key, filepath.Separator) {
+			key = filepath.Clean(key)
+		}
+		expects[key] = counts
+	}
+	return expects, nil
+}
+
+// lookup returns the expectation of a tree by its path, its absolute path,
+// its structure name or the catch-all entry, in that order
+func (e expectations) lookup(dirPath, structure string) (ExpectedCounts, bool) {
+	keys := []string{filepath.Clean(dirPath)}
+	if abs, err := filepath.Abs(dirPath); err == nil {
+		keys = append(keys, abs)
+	}
+	keys = append(keys, structure, expectAnyTree)
+	for _, key := range keys {
+		if counts, ok := e[key]; ok {
+			return counts, true
+		}
+	}
+	return ExpectedCounts{}, false
+}
+
+// mismatch describes how scanned counts differ from the expectation, or
+// returns an empty string when they match
+func (c ExpectedCounts) mismatch(files, dirs int) string {
+	parts := []string{}
+	if c.Files != nil && int64(files) != *c.Files {
+		parts = append(parts, fmt.Sprintf("ファイル数が一致しません (期待: %d, 実際: %d)", *c.Files, files))
+	}
+	if c.Dirs != nil && int64(dirs) != *c.Dirs {
+		parts = append(parts, fmt.Sprintf("ディレクトリ数が一致しません (期待: %d, 実際: %d)", *c.Dirs, dirs))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// treeBytes returns the total size of the regular files below root.
+// Entries that cannot be read are skipped.
+func treeBytes(root string) int64 {
+	var total int64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// parseUserPaths parses a comma separated list of existing directories to
+// scan instead of generated fixtures
+func parseUserPaths(value string) ([]string, error) {
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("not a directory: %s", path)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("duplicate path: %s", path)
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// External baseline tools
+const (
+	ExternalFind = "find"
+	ExternalFd   = "fd"
+	ExternalDu   = "du"
+)
+
+// externalStrategyPrefix marks result rows produced by external tools
+const externalStrategyPrefix = "external:"
+
+// ExternalBaseline describes how to run an external tool against a root
+type ExternalBaseline struct {
+	Name string
+	// Workers is the parallelism reported for the tool
+	Workers int
+	// command builds the command line for the resolved binary
+	command func(bin, rootPath string) *exec.Cmd
+	// count extracts file and directory counts from the tool's output, -1
+	// for a count the tool does not report
+	count func(output []byte) (files, dirs int)
+	// binaries are candidate executable names, tried in order
+	binaries []string
+}
+
+var externalBaselines = map[string]ExternalBaseline{
+	ExternalFind: {
+		Name:    ExternalFind,
+		Workers: 1,
+		command: func(bin, rootPath string) *exec.Cmd {
+			// Directories end in NUL and everything else, symlinks included,
+			// in a newline; -printf is GNU only
+			return exec.Command(bin, rootPath, "-mindepth", "1", "-type", "d", "-print0", "-o", "-print")
+		},
+		count: func(output []byte) (int, int) {
+			// The scanners count the root as a directory
+			return bytes.Count(output, []byte("\n")), bytes.Count(output, []byte{0}) + 1
+		},
+		binaries: []string{"find"},
+	},
+	ExternalFd: {
+		Name:    ExternalFd,
+		Workers: runtime.NumCPU(),
+		command: func(bin, rootPath string) *exec.Cmd {
+			return exec.Command(bin, "--type", "f", "--hidden", "--no-ignore",
+				"--threads", fmt.Sprintf("%d", runtime.NumCPU()), ".", rootPath)
+		},
+		count: func(output []byte) (int, int) {
+			return bytes.Count(output, []byte("\n")), -1
+		},
+		binaries: []string{"fd", "fdfind"},
+	},
+	ExternalDu: {
+		Name:    ExternalDu,
+		Workers: 1,
+		command: func(bin, rootPath string) *exec.Cmd {
+			return exec.Command(bin, "-s", rootPath)
+		},
+		count: func(output []byte) (int, int) {
+			// du only reports sizes
+			return -1, -1
+		},
+		binaries: []string{"du"},
+	},
+}
+
+// parseExternalBaselines parses a comma separated list of external tool names
+func parseExternalBaselines(value string) ([]ExternalBaseline, error) {
+	baselines := []ExternalBaseline{}
+	if value == "" {
+		return baselines, nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		baseline, ok := externalBaselines[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown external baseline: %s", name)
+		}
+		baselines = append(baselines, baseline)
+	}
+	return baselines, nil
+}
+
+// lookPath returns the first available binary for the baseline
+func (b ExternalBaseline) lookPath() (string, error) {
+	for _, name := range b.binaries {
+		if bin, err := exec.LookPath(name); err == nil {
+			return bin, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH", b.Name)
+}
+
+// runExternalBenchmark executes an external tool once and measures its wall time
+func runExternalBenchmark(rootPath, structure string, baseline ExternalBaseline) (*BenchmarkResult, error) {
+	bin, err := baseline.lookPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := baseline.command(bin, rootPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	output, err := cmd.Output()
+	duration := time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", baseline.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	files, dirs := baseline.count(output)
+
+	// Only the duration, the counts and the CPU times of the process are known
+	r := unmeasuredResult()
+	r.Structure = structure
+	r.Strategy = externalStrategyPrefix + baseline.Name
+	r.Workers = baseline.Workers
+	r.WorkersPerCPU = workersPerCPU(baseline.Workers)
+	r.Duration = duration
+	r.FilesScanned = files
+	r.DirsScanned = dirs
+	r.ConcurrentScans = 1
+	r.UserCPU = cmd.ProcessState.UserTime()
+	r.SystemCPU = cmd.ProcessState.SystemTime()
+	return &r, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fanOutHints estimates the number of subdirectories of a directory for the
+// priority task order: exactly from earlier runs of the same cell, otherwise
+// from the link count of the directory
+type fanOutHints struct {
+	mu      sync.RWMutex
+	subdirs map[string]int
+}
+
+// newFanOutHints returns hints without any earlier scan
+func newFanOutHints() *fanOutHints {
+	return &fanOutHints{subdirs: map[string]int{}}
+}
+
+// record remembers the number of subdirectories found in a directory
+func (h *fanOutHints) record(path string, subdirs int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.subdirs[path] = subdirs
+	h.mu.Unlock()
+}
+
+// estimate returns the expected number of subdirectories of a directory, -1
+// when nothing is known
+func (h *fanOutHints) estimate(path string) int {
+	if h != nil {
+		h.mu.RLock()
+		n, ok := h.subdirs[path]
+		h.mu.RUnlock()
+		if ok {
+			return n
+		}
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return -1
+	}
+	return subdirsFromLinks(info)
+}
+
+// stragglerShare is the share of directories after which the rest of a scan
+// counts as its straggler time
+const stragglerShare = 0.95
+
+// progressSampleInterval is the sampling interval of scan progress
+const progressSampleInterval = time.Millisecond
+
+// fileProgressShares are the shares of the final file count whose discovery
+// times are reported; the time between the last two is the tail of a scan
+var fileProgressShares = []float64{0.5, 0.9, 0.99, 1}
+
+// progressSample is the number of directories done and files found at a
+// point of a scan
+type progressSample struct {
+	at    time.Duration
+	dirs  int64
+	files int64
+}
+
+// progressTracker counts the directories scanned and files found so far. It
+// samples the counts to find the time the scan spent on its last directories
+// and files (TrackStragglers) and passes them on as snapshots (Snapshots).
+type progressTracker struct {
+	dirs     int64
+	files    int64
+	start    time.Time
+	sampling bool
+	samples  []progressSample
+	stop     chan struct{}
+	finished chan struct{}
+	// snapshots receives the counts every snapshotFiles files, once the
+	// file count reaches nextSnapshot, and on every tick of the interval
+	snapshots     func(ScanSnapshot)
+	snapshotFiles int64
+	nextSnapshot  int64
+	snapshotMu    sync.Mutex
+	stopped       bool
+	// snapshotInterval is the tick of the snapshots, 0 for none
+	snapshotInterval time.Duration
+}
+
+// startProgressTracker starts counting the progress of a scan, sampled for
+// TrackStragglers and reported for Snapshots of options
+func startProgressTracker(options ScanOptions) *progressTracker {
+	t := newProgressTracker(options)
+	t.begin()
+	return t
+}
+
+// newProgressTracker prepares a tracker for options that counts nothing
+// until begin
+func newProgressTracker(options ScanOptions) *progressTracker {
+	t := &progressTracker{
+		sampling:         options.TrackStragglers,
+		samples:          []progressSample{{}},
+		stop:             make(chan struct{}),
+		finished:         make(chan struct{}),
+		snapshotInterval: options.SnapshotInterval,
+	}
+	if options.Snapshots != nil {
+		t.snapshots, t.snapshotFiles, t.nextSnapshot = options.Snapshots, options.SnapshotFiles, options.SnapshotFiles
+	}
+	return t
+}
+
+// begin starts the clock and the sampling of the tracker
+func (t *progressTracker) begin() {
+	t.start = time.Now()
+	go func() {
+		defer close(t.finished)
+		// A nil channel never ticks
+		var sample, snapshot <-chan time.Time
+		if t.sampling {
+			ticker := time.NewTicker(progressSampleInterval)
+			defer ticker.Stop()
+			sample = ticker.C
+		}
+		if t.snapshots != nil && t.snapshotInterval > 0 {
+			ticker := time.NewTicker(t.snapshotInterval)
+			defer ticker.Stop()
+			snapshot = ticker.C
+		}
+		for {
+			select {
+			case now := <-sample:
+				t.samples = append(t.samples, progressSample{now.Sub(t.start), atomic.LoadInt64(&t.dirs), atomic.LoadInt64(&t.files)})
+			case <-snapshot:
+				t.snapshot()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// dirDone counts a directory whose listing has finished
+func (t *progressTracker) dirDone() {
+	if t != nil {
+		atomic.AddInt64(&t.dirs, 1)
+	}
+}
+
+// filesFound counts files found in a directory listing
+func (t *progressTracker) filesFound(n int64) {
+	if t != nil && n > 0 {
+		files := atomic.AddInt64(&t.files, n)
+		if t.snapshotFiles > 0 {
+			next := atomic.LoadInt64(&t.nextSnapshot)
+			if files >= next && atomic.CompareAndSwapInt64(&t.nextSnapshot, next, (files/t.snapshotFiles+1)*t.snapshotFiles) {
+				t.snapshot()
+			}
+		}
+	}
+}
+
+// Stop stops sampling and returns the time between stragglerShare of the
+// directories and the end of the scan, -1 when no directory was scanned, and
+// the times since the start at which fileProgressShares of the files had
+// been found, nil when no file was found. Times are interpolated between
+// samples.
+func (t *progressTracker) Stop() (straggler time.Duration, fileProgress []time.Duration) {
+	end := time.Since(t.start)
+	close(t.stop)
+	<-t.finished
+	t.snapshotMu.Lock()
+	t.stopped = true
+	t.snapshotMu.Unlock()
+	straggler = -1
+	if !t.sampling {
+		return straggler, nil
+	}
+	dirs, files := atomic.LoadInt64(&t.dirs), atomic.LoadInt64(&t.files)
+	samples := append(t.samples, progressSample{end, dirs, files})
+	if dirs > 0 {
+		straggler = end - crossingTime(samples, func(s progressSample) int64 { return s.dirs }, stragglerShare*float64(dirs))
+	}
+	if files > 0 {
+		for _, share := range fileProgressShares {
+			fileProgress = append(fileProgress, crossingTime(samples, func(s progressSample) int64 { return s.files }, share*float64(files)))
+		}
+	}
+	return straggler, fileProgress
+}
+
+// crossingTime returns the time at which a count of the samples reached the
+// threshold, interpolated linearly between the samples around it
+func crossingTime(samples []progressSample, count func(progressSample) int64, threshold float64) time.Duration {
+	i := sort.Search(len(samples), func(i int) bool { return float64(count(samples[i])) >= threshold })
+	if i == 0 {
+		return 0
+	}
+	before, after := samples[i-1], samples[i]
+	fraction := (threshold - float64(count(before))) / float64(count(after)-count(before))
+	return before.at + time.Duration(fraction*float64(after.at-before.at))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// fdSampleInterval is the sampling interval of the open file descriptor count
+const fdSampleInterval = time.Millisecond
+
+// fdTracker samples the number of open file descriptors and keeps the peak
+type fdTracker struct {
+	peak     int
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// startFDTracker starts sampling open file descriptors in the background
+func startFDTracker() *fdTracker {
+	t := &fdTracker{
+		peak:     openFDCount(),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(t.finished)
+		ticker := time.NewTicker(fdSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := openFDCount(); n > t.peak {
+					t.peak = n
+				}
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Stop stops sampling and returns the peak number of open file descriptors
+func (t *fdTracker) Stop() int {
+	close(t.stop)
+	<-t.finished
+	return t.peak
+}
+
+// strategyFDDemand estimates the directories a strategy may hold open at
+// once; unlimited is reported as -1
+func strategyFDDemand(strategy string, workers int, options ScanOptions) int {
+	if strategy == StrategyUnbounded {
+		if options.GoroutineCap <= 0 {
+			return -1
+		}
+		return options.GoroutineCap
+	}
+	if strategy == StrategyOpenat {
+		// Queued directories keep their descriptors open, and so do the
+		// ancestors of a directory processed inline
+		return options.ChannelCapacity + workers
+	}
+	if strategy == StrategyUring {
+		// Each worker also holds a batch of opened subdirectories
+		return options.ChannelCapacity + workers*options.batchSize(strategy)
+	}
+	return workers
+}
+
+// checkFDLimits warns about matrix cells that could exceed RLIMIT_NOFILE
+func checkFDLimits(strategies []string, workerCounts []int, base ScanOptions, params strategyParamSets, concurrentScans int) {
+	limit, err := fdLimit()
+	if err != nil {
+		return
+	}
+	inUse := openFDCount()
+
+	for _, strategy := range strategies {
+		options := params.options(strategy, base)
+		for _, workers := range strategyWorkerCounts(strategy, workerCounts) {
+			demand := strategyFDDemand(strategy, workers, options)
+			if demand < 0 {
+				fmt.Printf("警告: %s は上限なしで実行されるため、ファイルディスクリプタ上限 (%d) を超える可能性があります\n",
+					strategy, limit)
+				continue
+			}
+			if total := inUse + demand*concurrentScans; total > limit {
+				cell := fmt.Sprintf("%s (ワーカー数 %d)", strategy, workers)
+				if strategy == StrategyUnbounded {
+					cell = fmt.Sprintf("%s (-max-goroutines %d)", strategy, options.GoroutineCap)
+				}
+				fmt.Printf("警告: %s は最大 %d 個のファイルディスクリプタを使用する可能性があり、上限 (%d) を超えています\n",
+					cell, total, limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// openFDCount is not supported on this platform
+func openFDCount() int {
+	return -1
+}
+
+// fdLimit is not supported on this platform
+func fdLimit() (int, error) {
+	return 0, errors.New("file descriptor limit is not supported on this platform")
+}
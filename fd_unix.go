@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// openFDCount returns the number of file descriptors open in this process,
+// or -1 if it cannot be determined
+func openFDCount() int {
+	dir := "/dev/fd"
+	if runtime.GOOS == "linux" {
+		dir = "/proc/self/fd"
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return -1
+	}
+	// Exclude the descriptor used for the listing itself
+	return len(names) - 1
+}
+
+// fdLimit returns the soft RLIMIT_NOFILE of this process
+func fdLimit() (int, error) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, err
+	}
+	return int(rlimit.Cur), nil
+}
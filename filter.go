@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cellPattern selects benchmark cells by structure, strategy and worker
+// count; empty names and negative worker counts match anything
+type cellPattern struct {
+	structure string
+	strategy  string
+	workers   int
+}
+
+// cellFilter selects the cells given by -only; an empty filter runs every cell
+type cellFilter []cellPattern
+
+// parseCellFilter parses comma separated structure/strategy/workers
+// patterns. Trailing parts may be omitted and any part may be "*". A
+// structure given by -paths may contain slashes, so the last two parts of a
+// pattern with three or more are the strategy and the worker count.
+func parseCellFilter(value string, strategies []string) (cellFilter, error) {
+	filter := cellFilter{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.Split(field, "/")
+		if len(parts) > 3 {
+			parts = append([]string{strings.Join(parts[:len(parts)-2], "/")}, parts[len(parts)-2:]...)
+		}
+		for len(parts) < 3 {
+			parts = append(parts, "*")
+		}
+		pattern := cellPattern{workers: -1}
+		if parts[0] != "*" {
+			pattern.structure = parts[0]
+		}
+		if parts[1] != "*" && parts[1] != "" {
+			if !slices.Contains(strategies, parts[1]) {
+				return nil, fmt.Errorf("unknown strategy in %s: %s", field, parts[1])
+			}
+			pattern.strategy = parts[1]
+		}
+		if parts[2] != "*" && parts[2] != "" {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid worker count in %s: %s", field, parts[2])
+			}
+			pattern.workers = n
+		}
+		filter = append(filter, pattern)
+	}
+	return filter, nil
+}
+
+// match reports whether a cell is selected
+func (f cellFilter) match(structure, strategy string, workers int) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, p := range f {
+		if (p.structure == "" || p.structure == structure) &&
+			(p.strategy == "" || p.strategy == strategy) &&
+			(p.workers < 0 || p.workers == workers) {
+			return true
+		}
+	}
+	return false
+}
+
+// structures keeps the structures that have a selected cell, so that no
+// other fixture is generated
+func (f cellFilter) structures(structures []string) []string {
+	if len(f) == 0 {
+		return structures
+	}
+	kept := []string{}
+	for _, structure := range structures {
+		for _, p := range f {
+			if p.structure == "" || p.structure == structure {
+				kept = append(kept, structure)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// workers returns the worker counts of a strategy selected for a structure
+func (f cellFilter) workers(structure, strategy string, workerCounts []int) []int {
+	if len(f) == 0 {
+		return workerCounts
+	}
+	selected := []int{}
+	for _, workers := range workerCounts {
+		if f.match(structure, strategy, workers) {
+			selected = append(selected, workers)
+		}
+	}
+	return selected
+}
+
+// filterStrategies keeps the strategies named by a comma separated list in
+// run order; every name must be one of the strategies of this invocation
+func filterStrategies(value string, strategies []string) ([]string, error) {
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(strategies, name) {
+			return nil, fmt.Errorf("unknown or unavailable strategy: %s (%s)", name, strings.Join(strategies, ", "))
+		}
+		wanted[name] = true
+	}
+	if len(wanted) == 0 {
+		return nil, fmt.Errorf("no strategy given")
+	}
+	kept := []string{}
+	for _, strategy := range strategies {
+		if wanted[strategy] {
+			kept = append(kept, strategy)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+// StrategyFindFile lists every directory with FindFirstFileEx, asking for
+// the basic information only and a large fetch buffer, which returns the
+// names, attributes and sizes of many entries per call (Windows)
+const StrategyFindFile = "findfirstfileex"
+
+// File attributes and reparse tag bits of WIN32_FIND_DATAW
+const (
+	fileAttributeDirectory    = 0x00000010
+	fileAttributeReparsePoint = 0x00000400
+	// ioReparseTagNameSurrogate marks reparse points standing for another
+	// named entity, symbolic links and junctions, which os.ReadDir reports as
+	// symlinks
+	ioReparseTagNameSurrogate = 0x20000000
+)
+
+// findDataEntry converts the fields of a WIN32_FIND_DATAW to a nativeEntry.
+// reserved0 is the reparse tag of reparse points. Other reparse points, like
+// deduplicated or cloud files, are regular files as for os.ReadDir.
+func findDataEntry(name string, attributes, reserved0, sizeHigh, sizeLow uint32) nativeEntry {
+	e := nativeEntry{name: name}
+	switch {
+	case attributes&fileAttributeReparsePoint != 0 && reserved0&ioReparseTagNameSurrogate != 0:
+		e.symlink = true
+	case attributes&fileAttributeDirectory != 0:
+		e.dir = true
+	default:
+		e.regular = true
+		e.size = int64(sizeHigh)<<32 | int64(sizeLow)
+	}
+	return e
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// findFileSupported reports whether the FindFirstFileEx strategy is available
+const findFileSupported = false
+
+// newFindFileScanner returns the FindFirstFileEx strategy, only implemented
+// on Windows
+func newFindFileScanner(numWorkers int, options ScanOptions) strategyScanner {
+	return unsupportedScanner{errors.New("the findfirstfileex strategy is only supported on Windows")}
+}
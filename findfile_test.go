@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestFindDataEntry(t *testing.T) {
+	const (
+		tagSymlink  = 0xA000000C
+		tagJunction = 0xA0000003
+		tagDedup    = 0x80000013
+	)
+	tests := []struct {
+		name                  string
+		attributes, reserved0 uint32
+		high, low             uint32
+		want                  nativeEntry
+	}{
+		{"file", 0x20, 0, 1, 2, nativeEntry{name: "file", regular: true, size: 1<<32 | 2}},
+		{"dir", fileAttributeDirectory, 0, 0, 0, nativeEntry{name: "dir", dir: true}},
+		{"symlink", fileAttributeReparsePoint, tagSymlink, 0, 0, nativeEntry{name: "symlink", symlink: true}},
+		{"junction", fileAttributeDirectory | fileAttributeReparsePoint, tagJunction, 0, 0, nativeEntry{name: "junction", symlink: true}},
+		{"dedup", fileAttributeReparsePoint, tagDedup, 0, 7, nativeEntry{name: "dedup", regular: true, size: 7}},
+		// The reserved field is only a tag on reparse points
+		{"stale tag", fileAttributeDirectory, tagSymlink, 0, 0, nativeEntry{name: "stale tag", dir: true}},
+	}
+	for _, tt := range tests {
+		if got := findDataEntry(tt.name, tt.attributes, tt.reserved0, tt.high, tt.low); got != tt.want {
+			t.Errorf("%s: findDataEntry = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// findFileSupported reports whether the FindFirstFileEx strategy is available
+const findFileSupported = true
+
+// FINDEX_INFO_LEVELS, FINDEX_SEARCH_OPS and the flags of FindFirstFileExW,
+// which the syscall package does not define
+const (
+	findExInfoBasic       = 1
+	findExSearchNameMatch = 0
+	findFirstExLargeFetch = 2
+)
+
+var (
+	procFindFirstFileExW = syscall.NewLazyDLL("kernel32.dll").NewProc("FindFirstFileExW")
+	procFindNextFileW    = syscall.NewLazyDLL("kernel32.dll").NewProc("FindNextFileW")
+)
+
+// win32FindData is WIN32_FIND_DATAW. syscall.Win32finddata declares
+// AlternateFileName one element short and cannot be passed to the API.
+type win32FindData struct {
+	FileAttributes    uint32
+	CreationTime      syscall.Filetime
+	LastAccessTime    syscall.Filetime
+	LastWriteTime     syscall.Filetime
+	FileSizeHigh      uint32
+	FileSizeLow       uint32
+	Reserved0         uint32
+	Reserved1         uint32
+	FileName          [syscall.MAX_PATH]uint16
+	AlternateFileName [14]uint16
+}
+
+// newFindFileScanner returns the FindFirstFileEx strategy: the task channel
+// scan of nativeScanner reading each directory with FindFirstFileEx
+func newFindFileScanner(numWorkers int, options ScanOptions) strategyScanner {
+	return &nativeScanner{numWorkers: numWorkers, options: options, list: listFindFile}
+}
+
+// listFindFile calls fn for every entry of a directory. The buffer of
+// FIND_FIRST_EX_LARGE_FETCH is managed by the system, so buf is unused, and
+// the sizes come with every entry whether asked or not.
+func listFindFile(path string, buf []byte, sizes bool, fn func(nativeEntry)) error {
+	pattern, err := syscall.UTF16PtrFromString(path + `\*`)
+	if err != nil {
+		return &os.PathError{Op: "FindFirstFileEx", Path: path, Err: err}
+	}
+	var data win32FindData
+	h, _, errno := procFindFirstFileExW.Call(uintptr(unsafe.Pointer(pattern)), findExInfoBasic,
+		uintptr(unsafe.Pointer(&data)), findExSearchNameMatch, 0, findFirstExLargeFetch)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		// The root of an empty drive has not even "." and ".."
+		if errno == syscall.ERROR_FILE_NOT_FOUND {
+			return nil
+		}
+		return &os.PathError{Op: "FindFirstFileEx", Path: path, Err: errno}
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+
+	for {
+		name := syscall.UTF16ToString(data.FileName[:])
+		if name != "." && name != ".." {
+			fn(findDataEntry(name, data.FileAttributes, data.Reserved0, data.FileSizeHigh, data.FileSizeLow))
+		}
+		if ok, _, errno := procFindNextFileW.Call(h, uintptr(unsafe.Pointer(&data))); ok == 0 {
+			if errno == syscall.ERROR_NO_MORE_FILES {
+				return nil
+			}
+			return &os.PathError{Op: "FindNextFile", Path: path, Err: errno}
+		}
+	}
+}
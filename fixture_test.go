@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// structureCountTest is a fixture with its files and directories, the root
+// included and the ownership marker excluded
+type structureCountTest struct {
+	name      string
+	structure string
+	config    Config
+	files     int
+	dirs      int
+}
+
+var structureCountTests = []structureCountTest{
+	{"shallow", StructureShallow, Config{ShallowDirs: 3, ShallowFiles: 4}, 12, 4},
+	{"shallow without files", StructureShallow, Config{ShallowDirs: 5}, 0, 6},
+	{"shallow without dirs", StructureShallow, Config{ShallowFiles: 7}, 0, 1},
+	// Files only at the deepest level: 3^2 leaf directories of 3 files each
+	{"deep", StructureDeep, Config{DeepLevels: 2, DeepDirsPerLevel: 3}, 27, 13},
+	{"deep one level", StructureDeep, Config{DeepLevels: 1, DeepDirsPerLevel: 2}, 4, 3},
+	{"deep without levels", StructureDeep, Config{DeepDirsPerLevel: 5}, 5, 1},
+	{"deep exotic names", StructureDeep, Config{DeepLevels: 3, DeepDirsPerLevel: 2, NameStyle: NameStyleExotic}, 16, 15},
+	{"flat", StructureFlat, Config{FlatFiles: 9}, 9, 1},
+	{"flat exotic names", StructureFlat, Config{FlatFiles: 9, NameStyle: NameStyleExotic}, 9, 1},
+	// Mailboxes with cur, new and tmp; only cur holds messages
+	{"maildir", StructureMaildir, Config{MaildirBoxes: 2, MaildirMessages: 3}, 6, 9},
+	// 2015 and 2016, 12 + 2 months and one directory per day
+	{"logdirs", StructureLogDirs, Config{LogDays: 400}, 400, 417},
+}
+
+func TestStructureCounts(t *testing.T) {
+	for _, tt := range structureCountTests {
+		files, dirs := structureCounts(tt.structure, tt.config)
+		if files != tt.files || dirs != tt.dirs {
+			t.Errorf("%s: structureCounts = %d files, %d dirs, want %d and %d", tt.name, files, dirs, tt.files, tt.dirs)
+		}
+	}
+}
+
+// walkCounts counts the files and directories (including root) below root
+func walkCounts(t *testing.T, root string) (files, dirs int) {
+	t.Helper()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking %s: %v", root, err)
+	}
+	return files, dirs
+}
+
+func TestGeneratedFixturesMatchExpectedCounts(t *testing.T) {
+	// The special files of every kind and the extra hardlinks count as files
+	tests := append(structureCountTests, structureCountTest{"shallow with special files and hardlinks", StructureShallow,
+		Config{ShallowDirs: 3, ShallowFiles: 4, SpecialFiles: 2, HardlinkFiles: 3}, 12 + 2*len(specialFileKinds) + 3, 4})
+
+	for _, tt := range tests {
+		root := filepath.Join(t.TempDir(), "fixture")
+		if err := generateFixture(root, tt.structure, tt.config); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		wantFiles, wantDirs := expectedCounts(tt.structure, tt.config)
+		if wantFiles != tt.files+1 || wantDirs != tt.dirs {
+			t.Errorf("%s: expectedCounts = %d files, %d dirs, want %d (with the marker) and %d", tt.name, wantFiles, wantDirs, tt.files+1, tt.dirs)
+		}
+		if files, dirs := walkCounts(t, root); files != wantFiles || dirs != wantDirs {
+			t.Errorf("%s: generated %d files and %d dirs, expected %d and %d", tt.name, files, dirs, wantFiles, wantDirs)
+		}
+
+		for _, strategy := range testStrategies() {
+			for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+				result, err := scanWith(t, strategy, workers, defaultScanOptions(), root)
+				if err != nil {
+					t.Errorf("%s: %s with %d workers: %v", tt.name, strategy, workers, err)
+				}
+				if result.Files != int64(wantFiles) || result.Dirs != int64(wantDirs) {
+					t.Errorf("%s: %s with %d workers found %d files and %d dirs, want %d and %d",
+						tt.name, strategy, workers, result.Files, result.Dirs, wantFiles, wantDirs)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// freqSampleInterval is the sampling interval of the CPU frequency
+const freqSampleInterval = 50 * time.Millisecond
+
+// defaultFreqDropThreshold is how far, in percent, the mean clock of a cell
+// may fall below the fastest cell before it is flagged as throttled
+const defaultFreqDropThreshold = 10.0
+
+// freqTracker samples the mean CPU clock of the host during a scan and counts
+// the thermal throttling events the kernel reported meanwhile
+type freqTracker struct {
+	sum, min        float64
+	samples         int
+	throttlesBefore int64
+	stop            chan struct{}
+	finished        chan struct{}
+}
+
+// freqStats summarizes the CPU clock of one scan
+type freqStats struct {
+	// AvgMHz and MinMHz are the mean and lowest sampled clock, -1 when unknown
+	AvgMHz, MinMHz float64
+	// Throttles is the number of throttling events, -1 when not reported
+	Throttles int64
+}
+
+// startFreqTracker starts sampling the CPU clock in the background
+func startFreqTracker() *freqTracker {
+	t := &freqTracker{
+		throttlesBefore: readThrottleCount(),
+		stop:            make(chan struct{}),
+		finished:        make(chan struct{}),
+	}
+	t.sample()
+
+	go func() {
+		defer close(t.finished)
+		ticker := time.NewTicker(freqSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.sample()
+			case <-t.stop:
+				t.sample()
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// sample records the current mean clock
+func (t *freqTracker) sample() {
+	mhz, ok := readCPUFreq()
+	if !ok {
+		return
+	}
+	if t.samples == 0 || mhz < t.min {
+		t.min = mhz
+	}
+	t.sum += mhz
+	t.samples++
+}
+
+// Stop stops sampling and returns the clock statistics of the scan
+func (t *freqTracker) Stop() freqStats {
+	close(t.stop)
+	<-t.finished
+	stats := freqStats{AvgMHz: -1, MinMHz: -1, Throttles: -1}
+	if t.samples > 0 {
+		stats.AvgMHz = t.sum / float64(t.samples)
+		stats.MinMHz = t.min
+	}
+	if after := readThrottleCount(); after >= 0 && t.throttlesBefore >= 0 {
+		stats.Throttles = after - t.throttlesBefore
+	}
+	return stats
+}
+
+// averageFreq combines the clock statistics of runs: the mean of the mean
+// clocks, the lowest clock and the total of the throttling events
+func averageFreq(runs []BenchmarkResult) freqStats {
+	stats := freqStats{AvgMHz: -1, MinMHz: -1, Throttles: -1}
+	var sum float64
+	for i, r := range runs {
+		if r.CPUFreqMHz < 0 {
+			return freqStats{AvgMHz: -1, MinMHz: -1, Throttles: -1}
+		}
+		sum += r.CPUFreqMHz
+		if i == 0 || r.CPUFreqMinMHz < stats.MinMHz {
+			stats.MinMHz = r.CPUFreqMinMHz
+		}
+		if r.ThrottleEvents >= 0 {
+			stats.Throttles = max(stats.Throttles, 0) + r.ThrottleEvents
+		}
+	}
+	if len(runs) > 0 {
+		stats.AvgMHz = sum / float64(len(runs))
+	}
+	return stats
+}
+
+// markThrottled flags the results whose mean clock fell more than threshold
+// percent below the fastest result, or during which the kernel reported
+// thermal throttling. It returns the reference clock, -1 when no clock was
+// measured.
+func markThrottled(results []BenchmarkResult, threshold float64) float64 {
+	reference := -1.0
+	for _, r := range results {
+		reference = max(reference, r.CPUFreqMHz)
+	}
+	throttled := func(r *BenchmarkResult) bool {
+		return r.ThrottleEvents > 0 || (r.CPUFreqMHz >= 0 && r.CPUFreqMHz < reference*(1-threshold/100))
+	}
+	for i := range results {
+		r := &results[i]
+		r.Throttled = throttled(r)
+		for j := range r.runs {
+			r.runs[j].Throttled = throttled(&r.runs[j])
+		}
+	}
+	return reference
+}
+
+// printClockSummary lists the cells that ran at a reduced clock
+func printClockSummary(results []BenchmarkResult, reference, threshold float64) {
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "AvgMHz", "MinMHz", "vsMax", "Throttles"},
+		right:  []bool{false, false, true, true, true, true, true},
+	}
+	for _, r := range results {
+		if !r.Throttled {
+			continue
+		}
+		throttles := "-"
+		if r.ThrottleEvents >= 0 {
+			throttles = fmt.Sprintf("%d", r.ThrottleEvents)
+		}
+		vsMax := "-"
+		if r.CPUFreqMHz >= 0 && reference > 0 {
+			vsMax = fmt.Sprintf("%.0f%%", r.CPUFreqMHz/reference*100)
+		}
+		table.add(r.Structure, r.Label(), fmt.Sprintf("%d", r.Workers), fmt.Sprintf("%.0f", r.CPUFreqMHz),
+			fmt.Sprintf("%.0f", r.CPUFreqMinMHz), vsMax, throttles)
+	}
+	if len(table.rows) == 0 {
+		return
+	}
+	fmt.Printf("\n===== クロック低下・サーマルスロットリングの発生したセル (最速 %.0fMHz から %.0f%% 超の低下) =====\n", reference, threshold)
+	table.render(os.Stdout, false)
+	fmt.Println("これらのセルの速度向上率は、並列化ではなくクロックの違いの影響を受けている可能性があります")
+}
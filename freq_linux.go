@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import "path/filepath"
+
+// readCPUFreq returns the mean current clock of all CPUs in MHz. Virtual
+// machines usually do not expose cpufreq.
+func readCPUFreq() (float64, bool) {
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq")
+	var sum uint64
+	n := 0
+	for _, path := range paths {
+		khz, err := readUintFile(path)
+		if err != nil {
+			continue
+		}
+		sum += khz
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return float64(sum) / float64(n) / 1000, true
+}
+
+// readThrottleCount returns the total of the core and package thermal
+// throttling counters of all CPUs (x86 only), or -1 when not available
+func readThrottleCount() int64 {
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/*_throttle_count")
+	if len(paths) == 0 {
+		return -1
+	}
+	var total int64
+	for _, path := range paths {
+		count, err := readUintFile(path)
+		if err != nil {
+			return -1
+		}
+		total += int64(count)
+	}
+	return total
+}
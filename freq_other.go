@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// readCPUFreq is not supported on this platform
+func readCPUFreq() (float64, bool) {
+	return 0, false
+}
+
+// readThrottleCount is not supported on this platform
+func readThrottleCount() int64 {
+	return -1
+}
@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// linuxFilesystemMagics names the f_type values that statfs(2) returns on
+// Linux for common filesystems
+var linuxFilesystemMagics = map[uint32]string{
+	0xEF53:     "ext4", // also ext2 and ext3
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x2FC12FC1: "zfs",
+	0xF2F52010: "f2fs",
+	0x01021994: "tmpfs",
+	0x858458F6: "ramfs",
+	0x794C7630: "overlay",
+	0x61756673: "aufs",
+	0x73717368: "squashfs",
+	0x65735546: "fuse",
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x01021997: "9p",
+	0x00C36400: "ceph",
+	0x5346544E: "ntfs",
+	0x4D44:     "vfat",
+	0x2011BAB0: "exfat",
+}
+
+// linuxFilesystemName returns the name of a statfs f_type, or its value in
+// hexadecimal when unknown
+func linuxFilesystemName(magic uint32) string {
+	if name, ok := linuxFilesystemMagics[magic]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", magic)
+}
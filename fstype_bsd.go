@@ -0,0 +1,21 @@
+//go:build darwin || freebsd
+
+package main
+
+import "syscall"
+
+// filesystemType returns the type of the filesystem containing path
+func filesystemType(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", err
+	}
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import "syscall"
+
+// filesystemType returns the type of the filesystem containing path
+func filesystemType(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", err
+	}
+	return linuxFilesystemName(uint32(st.Type)), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// filesystemType is not supported on this platform
+func filesystemType(path string) (string, error) {
+	return "", errors.New("filesystem type query is not supported on this platform")
+}
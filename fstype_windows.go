@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var procGetVolumeInformationW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetVolumeInformationW")
+
+// filesystemType returns the type of the filesystem containing path, such as
+// NTFS or ReFS
+func filesystemType(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := syscall.UTF16PtrFromString(filepath.VolumeName(abs) + `\`)
+	if err != nil {
+		return "", err
+	}
+	var name [syscall.MAX_PATH + 1]uint16
+	r, _, err := procGetVolumeInformationW.Call(uintptr(unsafe.Pointer(root)), 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&name[0])), uintptr(len(name)))
+	if r == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(name[:]), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Hardlink tracking modes
+const (
+	// HardlinksOff counts every directory entry
+	HardlinksOff = "off"
+	// HardlinksSharded tracks (dev, inode) pairs in mutex-protected map shards
+	HardlinksSharded = "sharded"
+	// HardlinksSyncMap tracks (dev, inode) pairs in a sync.Map
+	HardlinksSyncMap = "syncmap"
+)
+
+// linkShards is the number of shards of the sharded set
+const linkShards = 64
+
+// fileKey identifies a file independently of the paths linking to it
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// linkSet records file keys and reports whether a key was already seen
+type linkSet interface {
+	Add(key fileKey) (seen bool)
+}
+
+type shardedLinkSet struct {
+	shards [linkShards]struct {
+		mu   sync.Mutex
+		keys map[fileKey]struct{}
+	}
+}
+
+func newShardedLinkSet() *shardedLinkSet {
+	s := &shardedLinkSet{}
+	for i := range s.shards {
+		s.shards[i].keys = map[fileKey]struct{}{}
+	}
+	return s
+}
+
+func (s *shardedLinkSet) Add(key fileKey) bool {
+	shard := &s.shards[(key.ino^key.dev)%linkShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.keys[key]; ok {
+		return true
+	}
+	shard.keys[key] = struct{}{}
+	return false
+}
+
+type syncMapLinkSet struct {
+	keys sync.Map
+}
+
+func (s *syncMapLinkSet) Add(key fileKey) bool {
+	_, seen := s.keys.LoadOrStore(key, struct{}{})
+	return seen
+}
+
+// linkTracker counts additional links to files already seen during a scan.
+// Only files with more than one link are recorded. All methods are no-ops
+// on a nil receiver.
+type linkTracker struct {
+	set        linkSet
+	duplicates int64
+}
+
+func newLinkTracker(mode string) *linkTracker {
+	switch mode {
+	case HardlinksSharded:
+		return &linkTracker{set: newShardedLinkSet()}
+	case HardlinksSyncMap:
+		return &linkTracker{set: &syncMapLinkSet{}}
+	}
+	return nil
+}
+
+// AddEntry records a non-directory entry, reading its metadata if the
+// listing did not already provide it
+func (t *linkTracker) AddEntry(entry fs.DirEntry) {
+	if t == nil {
+		return
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return
+	}
+	t.AddInfo(info)
+}
+
+// AddInfo records a non-directory entry from its metadata
+func (t *linkTracker) AddInfo(info os.FileInfo) {
+	if t == nil {
+		return
+	}
+	if key, ok := linkedFileKey(info); ok && t.set.Add(key) {
+		atomic.AddInt64(&t.duplicates, 1)
+	}
+}
+
+// Duplicates returns the number of entries that were additional links
+func (t *linkTracker) Duplicates() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.duplicates)
+}
+
+// parseHardlinkModes parses a comma separated list of hardlink tracking modes
+func parseHardlinkModes(value string) ([]string, error) {
+	modes := []string{}
+	for _, mode := range strings.Split(value, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case HardlinksOff, HardlinksSharded, HardlinksSyncMap:
+			modes = append(modes, mode)
+		default:
+			return nil, fmt.Errorf("unknown hardlink mode: %s", mode)
+		}
+	}
+	return modes, nil
+}
+
+// createHardlinks adds config.HardlinkFiles extra links to regular files of a
+// generated fixture, each placed in a different directory than its source
+func createHardlinks(rootPath string, config Config) error {
+	if config.HardlinkFiles == 0 {
+		return nil
+	}
+
+	files := []string{}
+	dirs := []string{}
+	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		} else if d.Type().IsRegular() && d.Name() != fixtureMarkerName {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files to link in %s", rootPath)
+	}
+
+	for i := 0; i < config.HardlinkFiles; i++ {
+		source := files[i%len(files)]
+		dir := dirs[(i+1)%len(dirs)]
+		if err := os.Link(source, filepath.Join(dir, fmt.Sprintf("hardlink_%d", i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
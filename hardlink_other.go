@@ -0,0 +1,25 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// hardlinksSupported reports whether files can be identified by (dev, inode).
+// Windows file IDs need an open handle per file and are not tracked.
+const hardlinksSupported = false
+
+// linkedFileKey is not supported on this platform
+func linkedFileKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
+
+// fileIdentity is not supported on this platform
+func fileIdentity(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
+
+// subdirsFromLinks is not supported on this platform: directories have no
+// meaningful link count
+func subdirsFromLinks(info os.FileInfo) int {
+	return -1
+}
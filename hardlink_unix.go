@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinksSupported reports whether files can be identified by (dev, inode)
+const hardlinksSupported = true
+
+// linkedFileKey returns the (dev, inode) pair of a file with more than one link
+func linkedFileKey(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// fileIdentity returns the (dev, inode) pair of any file
+func fileIdentity(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// subdirsFromLinks estimates the subdirectories of a directory from its link
+// count, which counts "." and the ".." of every subdirectory on most Unix
+// file systems; -1 when the count says nothing, as on btrfs
+func subdirsFromLinks(info os.FileInfo) int {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return -1
+	}
+	return int(st.Nlink) - 2
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultNoisyThreshold is the share of all CPUs, in percent, that other
+// processes may use during a scan before its result is marked noisy
+const defaultNoisyThreshold = 10.0
+
+// hostCPUSample is a snapshot of the CPU time of the whole host
+type hostCPUSample struct {
+	busy, total uint64
+	// cpus is the number of CPUs of the host
+	cpus int
+	ok   bool
+}
+
+// hostCPUUsage describes the load of the host during a scan
+type hostCPUUsage struct {
+	// Host is the number of busy cores of the whole host and Other the part
+	// not used by this process
+	Host, Other float64
+	// LoadAvg is the one-minute load average at the end of the scan
+	LoadAvg float64
+	// Noisy reports whether Other exceeded the threshold
+	Noisy bool
+}
+
+// measureHostCPU compares two host snapshots taken around a scan of the given
+// duration during which this process used processCPU. ok is false when the
+// host CPU time is not available.
+func measureHostCPU(before, after hostCPUSample, duration, processCPU time.Duration, threshold float64) (usage hostCPUUsage, ok bool) {
+	if !before.ok || !after.ok || after.total <= before.total || duration <= 0 {
+		return hostCPUUsage{}, false
+	}
+	busy := float64(after.busy-before.busy) / float64(after.total-before.total)
+	usage.Host = busy * float64(after.cpus)
+	usage.Other = usage.Host - float64(processCPU)/float64(duration)
+	if usage.Other < 0 {
+		// The host counters tick at a coarser resolution than the process CPU time
+		usage.Other = 0
+	}
+	usage.LoadAvg = readLoadAverage()
+	usage.Noisy = usage.Other/float64(after.cpus)*100 > threshold
+	return usage, true
+}
+
+// printNoisySummary lists the cells measured while other processes used more
+// CPU than the threshold
+func printNoisySummary(results []BenchmarkResult, threshold float64) {
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "HostCPU", "OtherCPU", "Load1"},
+		right:  []bool{false, false, true, true, true, true},
+	}
+	noisy := 0
+	for _, r := range results {
+		if !r.Noisy {
+			continue
+		}
+		noisy++
+		table.add(r.Structure, r.Label(), fmt.Sprintf("%d", r.Workers),
+			fmt.Sprintf("%.2f", r.HostCPU), fmt.Sprintf("%.2f", r.OtherCPU), fmt.Sprintf("%.2f", r.LoadAvg))
+	}
+	if noisy == 0 {
+		return
+	}
+	fmt.Printf("\n===== ノイズの多い環境で計測されたセル (他のプロセスのCPU使用 > %.0f%%) =====\n", threshold)
+	table.render(os.Stdout, false)
+	fmt.Println("速度向上率が低い場合、他のプロセスとのCPUの奪い合いが原因の可能性があります")
+}
+
+// averageHostCPU returns the mean host and other CPU use of runs, the highest
+// load average and whether any run was noisy; the values are -1 when any run
+// lacks them
+func averageHostCPU(runs []BenchmarkResult) (host, other, load float64, noisy bool) {
+	if len(runs) == 0 {
+		return -1, -1, -1, false
+	}
+	load = -1
+	for _, r := range runs {
+		if r.HostCPU < 0 {
+			return -1, -1, -1, false
+		}
+		host += r.HostCPU
+		other += r.OtherCPU
+		if r.LoadAvg > load {
+			load = r.LoadAvg
+		}
+		noisy = noisy || r.Noisy
+	}
+	n := float64(len(runs))
+	return host / n, other / n, load, noisy
+}
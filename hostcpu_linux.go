@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readHostCPU reads the aggregate CPU times of the host from /proc/stat
+func readHostCPU() hostCPUSample {
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return hostCPUSample{}
+	}
+	sample := hostCPUSample{}
+	for _, line := range bytes.Split(stat, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			sample.cpus++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already part of user
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return hostCPUSample{}
+			}
+			sample.total += v
+			if i != 4 && i != 5 {
+				sample.busy += v
+			}
+		}
+	}
+	sample.ok = sample.total > 0 && sample.cpus > 0
+	return sample
+}
+
+// readLoadAverage returns the one-minute load average, or -1 if unknown
+func readLoadAverage() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return -1
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return -1
+	}
+	return load
+}
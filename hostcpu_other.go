@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// readHostCPU is not supported on this platform
+func readHostCPU() hostCPUSample {
+	return hostCPUSample{}
+}
+
+// readLoadAverage is not supported on this platform
+func readLoadAverage() float64 {
+	return -1
+}
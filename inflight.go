@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ioSemaphore bounds the directory listing calls in flight across all
+// workers of a scan, independently of the worker count. SMB clients can only
+// have as many requests outstanding as the server granted credits, so more
+// workers than calls in flight separates the cost of waiting for a credit
+// from the cost of the workers themselves. All methods are no-ops on a nil
+// receiver.
+type ioSemaphore struct {
+	slots chan struct{}
+	// waited is the total time callers spent waiting for a slot, in nanoseconds
+	waited int64
+}
+
+// newIOSemaphore returns a semaphore of limit slots, or nil for a limit of 0
+func newIOSemaphore(limit int) *ioSemaphore {
+	if limit <= 0 {
+		return nil
+	}
+	return &ioSemaphore{slots: make(chan struct{}, limit)}
+}
+
+// acquire blocks until a slot is free or ctx is cancelled
+func (s *ioSemaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	start := time.Now()
+	defer func() { atomic.AddInt64(&s.waited, int64(time.Since(start))) }()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-done:
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire
+func (s *ioSemaphore) release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// Waited returns the total time callers waited for a slot
+func (s *ioSemaphore) Waited() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.waited))
+}
+
+// parseInflightLimits parses a comma separated list of limits of listing
+// calls in flight; 0 means unlimited
+func parseInflightLimits(value string) ([]int, error) {
+	limits := []int{}
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("limit must not be negative: %d", n)
+		}
+		limits = append(limits, n)
+	}
+	return limits, nil
+}
+
+// printInflightMatrix prints the mean scan duration of every strategy
+// variant as a matrix of worker counts by -max-inflight-io limits, so that
+// the two dimensions can be read independently: down a column only the
+// workers change, along a row only the calls in flight
+func printInflightMatrix(results []BenchmarkResult, limits []int) {
+	type row struct {
+		structure, label string
+		workers          int
+	}
+	durations := map[row]map[int]time.Duration{}
+	rows := []row{}
+	for _, r := range results {
+		unlimited := r
+		unlimited.MaxInflightIO = 0
+		key := row{r.Structure, unlimited.Label(), r.Workers}
+		if durations[key] == nil {
+			durations[key] = map[int]time.Duration{}
+			rows = append(rows, key)
+		}
+		durations[key][r.MaxInflightIO] = r.Duration
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].structure != rows[j].structure {
+			return rows[i].structure < rows[j].structure
+		}
+		if rows[i].label != rows[j].label {
+			return rows[i].label < rows[j].label
+		}
+		return rows[i].workers < rows[j].workers
+	})
+
+	fmt.Println("\n===== ワーカー数×同時I/O数 (平均時間 ms) =====")
+	fmt.Printf("%-10s %-36s %-8s", "Structure", "Strategy", "Workers")
+	for _, limit := range limits {
+		if limit == 0 {
+			fmt.Printf(" %10s", "io=∞")
+		} else {
+			fmt.Printf(" %10s", "io="+strconv.Itoa(limit))
+		}
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 56+11*len(limits)))
+	for _, key := range rows {
+		fmt.Printf("%-10s %-36s %-8d", key.structure, key.label, key.workers)
+		for _, limit := range limits {
+			if d, ok := durations[key][limit]; ok {
+				fmt.Printf(" %10.3f", d.Seconds()*1000)
+			} else {
+				fmt.Printf(" %10s", "-")
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIOSemaphore(t *testing.T) {
+	const limit, workers = 2, 8
+	s := newIOSemaphore(limit)
+	var mu sync.Mutex
+	inflight, peak := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := s.acquire(context.Background()); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				inflight++
+				peak = max(peak, inflight)
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				inflight--
+				mu.Unlock()
+				s.release()
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > limit {
+		t.Errorf("%d calls in flight, limit %d", peak, limit)
+	}
+	if s.Waited() <= 0 {
+		t.Error("no wait recorded with more workers than slots")
+	}
+
+	// A cancelled wait gives up its turn
+	ctx, cancel := context.WithCancel(context.Background())
+	full := newIOSemaphore(1)
+	if err := full.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := full.acquire(ctx); err == nil {
+		t.Error("acquire of a full semaphore returned after cancellation without error")
+	}
+
+	var unlimited *ioSemaphore
+	if newIOSemaphore(0) != nil || unlimited.acquire(context.Background()) != nil || unlimited.Waited() != 0 {
+		t.Error("a limit of 0 is not unlimited")
+	}
+	unlimited.release()
+}
+
+func TestParseInflightLimits(t *testing.T) {
+	limits, err := parseInflightLimits("0, 2,8")
+	if err != nil || len(limits) != 3 || limits[0] != 0 || limits[1] != 2 || limits[2] != 8 {
+		t.Errorf("parseInflightLimits = %v, %v", limits, err)
+	}
+	for _, value := range []string{"-1", "x", ""} {
+		if _, err := parseInflightLimits(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueSampleInterval is the sampling interval of the task queue depth
+const queueSampleInterval = time.Millisecond
+
+// QueueSample is the task queue depth at a point in time
+type QueueSample struct {
+	Elapsed time.Duration
+	Depth   int
+}
+
+// ScanMetrics holds the internal metrics of one instrumented scan
+type ScanMetrics struct {
+	QueueSamples    []QueueSample `json:"-"`
+	QueueDepthMax   int
+	QueueDepthAvg   float64
+	WorkerBusy      []float64 // busy ratio per worker
+	InlineFallbacks int64
+	// WorkerCPU is the CPU time per worker, nil unless measured
+	WorkerCPU []time.Duration
+}
+
+// WorkerCPUSkew returns the CPU time of the busiest worker over the mean, 1
+// for a perfectly balanced scan and 0 when not measured
+func (m *ScanMetrics) WorkerCPUSkew() float64 {
+	var sum, max time.Duration
+	for _, cpu := range m.WorkerCPU {
+		sum += cpu
+		if cpu > max {
+			max = cpu
+		}
+	}
+	if sum == 0 {
+		return 0
+	}
+	return float64(max) / (float64(sum) / float64(len(m.WorkerCPU)))
+}
+
+// BusyRatioAvg returns the mean busy ratio across workers
+func (m *ScanMetrics) BusyRatioAvg() float64 {
+	if len(m.WorkerBusy) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, ratio := range m.WorkerBusy {
+		sum += ratio
+	}
+	return sum / float64(len(m.WorkerBusy))
+}
+
+// BusyRatioMin returns the busy ratio of the least utilized worker
+func (m *ScanMetrics) BusyRatioMin() float64 {
+	if len(m.WorkerBusy) == 0 {
+		return 0
+	}
+	min := m.WorkerBusy[0]
+	for _, ratio := range m.WorkerBusy[1:] {
+		if ratio < min {
+			min = ratio
+		}
+	}
+	return min
+}
+
+// ScanInstrumentation records queue depth, worker busy time and inline
+// fallbacks during a scan. All methods are no-ops on a nil receiver.
+type ScanInstrumentation struct {
+	start time.Time
+	busy  []int64 // nanoseconds per worker
+	// cpu attributes the CPU time of busy periods to workers when set
+	cpu      *CPUMonitor
+	inline   int64
+	mu       sync.Mutex
+	samples  []QueueSample
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+func newScanInstrumentation(numWorkers int) *ScanInstrumentation {
+	return &ScanInstrumentation{
+		start: time.Now(),
+		busy:  make([]int64, numWorkers),
+	}
+}
+
+// SetQueue starts sampling the depth reported by the given function
+func (inst *ScanInstrumentation) SetQueue(depth func() int) {
+	if inst == nil || inst.stop != nil {
+		return
+	}
+	inst.stop = make(chan struct{})
+	inst.finished = make(chan struct{})
+
+	go func() {
+		defer close(inst.finished)
+		ticker := time.NewTicker(queueSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				inst.mu.Lock()
+				inst.samples = append(inst.samples, QueueSample{Elapsed: time.Since(inst.start), Depth: depth()})
+				inst.mu.Unlock()
+			case <-inst.stop:
+				return
+			}
+		}
+	}()
+}
+
+// busyStart marks the start of a unit of work
+type busyStart struct {
+	at  time.Time
+	cpu time.Duration
+}
+
+// StartBusy returns the start of a unit of work. With CPU attribution the
+// goroutine stays on its OS thread until EndBusy.
+func (inst *ScanInstrumentation) StartBusy() busyStart {
+	if inst == nil {
+		return busyStart{}
+	}
+	return busyStart{at: time.Now(), cpu: inst.cpu.BeginWorker()}
+}
+
+// EndBusy adds the time since start to the worker's busy time
+func (inst *ScanInstrumentation) EndBusy(worker int, start busyStart) {
+	if inst == nil {
+		return
+	}
+	inst.cpu.EndWorker(worker, start.cpu)
+	if worker >= len(inst.busy) {
+		return
+	}
+	atomic.AddInt64(&inst.busy[worker], int64(time.Since(start.at)))
+}
+
+// InlineFallback records a directory processed inline because the queue was full
+func (inst *ScanInstrumentation) InlineFallback() {
+	if inst == nil {
+		return
+	}
+	atomic.AddInt64(&inst.inline, 1)
+}
+
+// finish stops sampling and computes the metrics for a scan of the given duration
+func (inst *ScanInstrumentation) finish(duration time.Duration) *ScanMetrics {
+	if inst.stop != nil {
+		close(inst.stop)
+		<-inst.finished
+	}
+
+	metrics := &ScanMetrics{
+		QueueSamples:    inst.samples,
+		InlineFallbacks: atomic.LoadInt64(&inst.inline),
+		WorkerBusy:      make([]float64, len(inst.busy)),
+	}
+
+	var total int
+	for _, sample := range inst.samples {
+		total += sample.Depth
+		if sample.Depth > metrics.QueueDepthMax {
+			metrics.QueueDepthMax = sample.Depth
+		}
+	}
+	if len(inst.samples) > 0 {
+		metrics.QueueDepthAvg = float64(total) / float64(len(inst.samples))
+	}
+
+	if inst.cpu != nil {
+		metrics.WorkerCPU = inst.cpu.WorkerCPU(len(inst.busy))
+	}
+	for i := range inst.busy {
+		if duration > 0 {
+			metrics.WorkerBusy[i] = float64(atomic.LoadInt64(&inst.busy[i])) / float64(duration)
+		}
+	}
+	return metrics
+}
+
+// formatBusyRatios formats per-worker busy ratios as a semicolon separated list
+func formatBusyRatios(ratios []float64) string {
+	parts := make([]string, len(ratios))
+	for i, ratio := range ratios {
+		parts[i] = fmt.Sprintf("%.3f", ratio)
+	}
+	return strings.Join(parts, ";")
+}
+
+// formatWorkerCPU formats per-worker CPU times in milliseconds with the
+// given separator
+func formatWorkerCPU(times []time.Duration, sep string) string {
+	parts := make([]string, len(times))
+	for i, cpu := range times {
+		parts[i] = fmt.Sprintf("%.3f", float64(cpu)/float64(time.Millisecond))
+	}
+	return strings.Join(parts, sep)
+}
+
+// printMetrics prints the internal metrics of instrumented results
+func printMetrics(results []BenchmarkResult) {
+	fmt.Println("\n===== 内部メトリクス =====")
+	fmt.Printf("%-10s %-22s %-8s %-8s %-8s %-8s %-8s %-8s %-8s\n",
+		"Structure", "Strategy", "Workers", "QMax", "QAvg", "BusyAvg", "BusyMin", "Inline", "CPUSkew")
+	fmt.Println(strings.Repeat("-", 97))
+	for _, r := range results {
+		if r.Metrics == nil {
+			continue
+		}
+		skew := "-"
+		if r.Metrics.WorkerCPU != nil {
+			skew = fmt.Sprintf("%.2f", r.Metrics.WorkerCPUSkew())
+		}
+		fmt.Printf("%-10s %-22s %-8d %-8d %-8.1f %-8.2f %-8.2f %-8d %-8s\n",
+			r.Structure, r.Strategy, r.Workers,
+			r.Metrics.QueueDepthMax, r.Metrics.QueueDepthAvg,
+			r.Metrics.BusyRatioAvg(), r.Metrics.BusyRatioMin(),
+			r.Metrics.InlineFallbacks, skew)
+	}
+}
+
+// exportQueueSamplesToCSV exports the queue depth time series of all results
+func exportQueueSamplesToCSV(results []BenchmarkResult, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"Structure", "Strategy", "Workers", "Listing", "Elapsed_ms", "QueueDepth"})
+	for _, r := range results {
+		if r.Metrics == nil {
+			continue
+		}
+		for _, sample := range r.Metrics.QueueSamples {
+			writer.Write([]string{
+				r.Structure,
+				r.Strategy,
+				fmt.Sprintf("%d", r.Workers),
+				r.Listing,
+				fmt.Sprintf("%.3f", sample.Elapsed.Seconds()*1000),
+				fmt.Sprintf("%d", sample.Depth),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// latencySubBuckets is the number of linear sub-buckets per power of two,
+// giving a relative precision of about 6%
+const latencySubBuckets = 16
+
+// latencyBuckets covers every int64 nanosecond value
+const latencyBuckets = latencySubBuckets + (64-4)*latencySubBuckets
+
+// latencyHistogram is an HDR-style log-linear histogram of durations that can
+// be recorded from many goroutines. All methods are no-ops on a nil receiver.
+type latencyHistogram struct {
+	counts [latencyBuckets]int64
+	max    int64
+}
+
+// LatencySummary holds the percentiles of a latency histogram
+type LatencySummary struct {
+	Count int64
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func latencyBucket(ns int64) int {
+	if ns < latencySubBuckets {
+		if ns < 0 {
+			return 0
+		}
+		return int(ns)
+	}
+	exp := bits.Len64(uint64(ns)) - 1
+	sub := int(ns>>(exp-4)) & (latencySubBuckets - 1)
+	return latencySubBuckets + (exp-4)*latencySubBuckets + sub
+}
+
+// latencyBucketValue returns the lowest duration falling into a bucket
+func latencyBucketValue(bucket int) time.Duration {
+	if bucket < latencySubBuckets {
+		return time.Duration(bucket)
+	}
+	exp := (bucket-latencySubBuckets)/latencySubBuckets + 4
+	sub := (bucket - latencySubBuckets) % latencySubBuckets
+	return time.Duration(int64(latencySubBuckets+sub) << (exp - 4))
+}
+
+// Record adds one duration to the histogram
+func (h *latencyHistogram) Record(d time.Duration) {
+	if h == nil {
+		return
+	}
+	ns := int64(d)
+	atomic.AddInt64(&h.counts[latencyBucket(ns)], 1)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if ns <= max || atomic.CompareAndSwapInt64(&h.max, max, ns) {
+			return
+		}
+	}
+}
+
+// Merge adds the counts of another histogram
+func (h *latencyHistogram) Merge(other *latencyHistogram) {
+	if h == nil || other == nil {
+		return
+	}
+	for i := range other.counts {
+		h.counts[i] += other.counts[i]
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Summary returns the count and percentiles of the recorded durations
+func (h *latencyHistogram) Summary() *LatencySummary {
+	if h == nil {
+		return nil
+	}
+	var total int64
+	for _, c := range h.counts {
+		total += c
+	}
+	summary := &LatencySummary{Count: total, Max: time.Duration(h.max)}
+	if total == 0 {
+		return summary
+	}
+
+	percentile := func(p float64) time.Duration {
+		rank := int64(p * float64(total))
+		if rank >= total {
+			rank = total - 1
+		}
+		var seen int64
+		for i, c := range h.counts {
+			seen += c
+			if seen > rank {
+				return latencyBucketValue(i)
+			}
+		}
+		return summary.Max
+	}
+	summary.P50 = percentile(0.50)
+	summary.P95 = percentile(0.95)
+	summary.P99 = percentile(0.99)
+	return summary
+}
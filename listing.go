@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Directory listing modes
+const (
+	// ListingReadDir lstats every entry after os.ReadDir, as ioutil.ReadDir
+	// did: entries are sorted and carry their full metadata
+	ListingReadDir = "readdir"
+	// ListingSorted uses os.ReadDir: entries are sorted by name but not
+	// stat'ed, so that it differs from names only by the sort
+	ListingSorted = "sorted"
+	// ListingNames uses (*os.File).ReadDir(-1): unsorted, no per-entry stat
+	ListingNames = "names"
+	// ListingChunked uses (*os.File).ReadDir(n) repeatedly so that huge
+	// directories are never held in memory as a whole
+	ListingChunked = "chunked"
+	// ListingDType reads raw entries with getdents and trusts d_type, with an
+	// lstat only for DT_UNKNOWN entries (Linux)
+	ListingDType = "dtype"
+	// ListingInode reads raw entries with getdents, sorts them by inode
+	// number and lstats them in that order; it differs from readdir only by
+	// the order of the lstat calls and of the processing (Linux)
+	ListingInode = "inode"
+)
+
+// defaultListing is the listing mode of filepath.WalkDir, which serial scans
+// use when nothing needs to see their directory reads
+const defaultListing = ListingSorted
+
+// defaultReadDirChunk is the number of entries read per call in chunked mode
+const defaultReadDirChunk = 1024
+
+// parseListings parses a comma separated list of listing modes
+func parseListings(value string) ([]string, error) {
+	listings := []string{}
+	for _, listing := range strings.Split(value, ",") {
+		listing = strings.TrimSpace(listing)
+		switch listing {
+		case ListingReadDir, ListingSorted, ListingNames, ListingChunked:
+			listings = append(listings, listing)
+		case ListingDType, ListingInode:
+			if !dtypeSupported {
+				return nil, fmt.Errorf("listing mode %s is only supported on Linux", listing)
+			}
+			listings = append(listings, listing)
+		default:
+			return nil, fmt.Errorf("unknown listing mode: %s", listing)
+		}
+	}
+	return listings, nil
+}
+
+// listDir returns the entries of a directory using the given listing mode.
+// The dtype mode counts its entries and stat fallbacks in counter.
+func listDir(path string, listing string, counter *dtypeCounter) ([]fs.DirEntry, error) {
+	if listing == ListingDType {
+		return readDirDType(path, counter)
+	}
+	if listing == ListingInode {
+		return readDirInodeOrder(path)
+	}
+	if listing == ListingNames {
+		return readDirUnsorted(path)
+	}
+	if listing == ListingSorted {
+		// os.ReadDir is readDirUnsorted followed by this sort
+		entries, err := readDirUnsorted(path)
+		slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+		return entries, err
+	}
+
+	return readDirStat(path)
+}
+
+// readDirStat returns the sorted entries of a directory with the metadata of
+// each from lstat. Entries removed since the listing are skipped, as
+// ioutil.ReadDir skipped them.
+func readDirStat(path string) ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(path)
+	stated := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return stated, err
+		}
+		stated = append(stated, fs.FileInfoToDirEntry(info))
+	}
+	return stated, err
+}
+
+// readDirUnsorted returns the entries of a directory in the order the file
+// system returns them, without sorting or stat'ing them
+func readDirUnsorted(path string) ([]fs.DirEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.ReadDir(-1)
+}
+
+// eachDirEntry calls fn for every entry of a directory using the listing
+// mode of options. In chunked mode entries are passed on as each chunk is
+// read. Listing calls are timed when enabled: the whole listing for readdir
+// and names, each chunk read for chunked. Rate limiting applies to the same
+// calls. Once the scan is cancelled the directory is not read and the
+// cancellation error is returned. The workload of options sees the directory
+// before it is read and each file after fn. Files count towards the progress
+// as they are passed to fn. Entries are passed as the symlink mode of options
+// counts them.
+func eachDirEntry(path string, options ScanOptions, fn func(entry fs.DirEntry)) error {
+	if err := options.ctxErr(); err != nil {
+		return err
+	}
+	defer options.progress.dirDone()
+	if options.symlinks.leaf(path) {
+		return nil
+	}
+	options.visits.visit(path)
+	if options.progress != nil {
+		count := fn
+		fn = func(entry fs.DirEntry) {
+			if !entry.IsDir() {
+				options.progress.filesFound(1)
+			}
+			count(entry)
+		}
+	}
+	if options.files != nil {
+		scan := fn
+		fn = func(entry fs.DirEntry) {
+			scan(entry)
+			if !entry.IsDir() {
+				options.files(path, entry)
+			}
+		}
+	}
+	options.workload.Dir(path)
+	if options.workload != nil {
+		scan := fn
+		fn = func(entry fs.DirEntry) {
+			scan(entry)
+			if !entry.IsDir() {
+				options.workload.File(path, entry)
+			}
+		}
+	}
+	if options.Listing != ListingChunked {
+		if err := options.throttle(); err != nil {
+			return err
+		}
+		start := options.startListing()
+		var entries []fs.DirEntry
+		err := options.stale.do(options.ctx, func() (err error) {
+			entries, err = listDir(path, options.Listing, options.dtype)
+			return err
+		})
+		options.endListing(path, start)
+		options.releaseIO()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fn(options.symlinks.entry(path, entry))
+		}
+		return nil
+	}
+
+	var f *os.File
+	err := options.stale.do(options.ctx, func() (err error) {
+		f, err = os.Open(path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		if err := options.throttle(); err != nil {
+			return err
+		}
+		start := options.startListing()
+		entries, err := f.ReadDir(options.ReadDirChunk)
+		options.endListing(path, start)
+		options.releaseIO()
+		for _, entry := range entries {
+			fn(options.symlinks.entry(path, entry))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// walkDir counts a directory tree serially using the listing mode of options.
+// Directories that cannot be read, including path itself, are recorded as
+// errors of result and their subtrees skipped.
+func walkDir(path string, options ScanOptions, result *ScanResult) {
+	subdirs := []string{}
+	err := eachDirEntry(path, options, func(entry fs.DirEntry) {
+		if entry.IsDir() {
+			subdirs = append(subdirs, filepath.Join(path, entry.Name()))
+		} else {
+			result.Files++
+			options.links.AddEntry(entry)
+		}
+	})
+	if err != nil {
+		result.addError(err)
+		return
+	}
+
+	result.Dirs++
+
+	for _, subdir := range subdirs {
+		walkDir(subdir, options, result)
+	}
+}
+
+// printListingDelta prints the duration change of each listing mode relative
+// to the reference mode for the same structure, strategy variant and worker
+// count
+func printListingDelta(results []BenchmarkResult, reference string) {
+	type cellKey struct {
+		structure, label string
+		workers          int
+	}
+	// The key is the label without the listing mode and its chunk size
+	key := func(r BenchmarkResult) cellKey {
+		plain := r
+		plain.Listing, plain.ReadDirChunk = "", 0
+		return cellKey{r.Structure, plain.Label(), r.Workers}
+	}
+
+	referenceDurations := map[cellKey]float64{}
+	for _, r := range results {
+		if r.Listing == reference {
+			referenceDurations[key(r)] = r.Duration.Seconds()
+		}
+	}
+
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "Listing", "Delta"},
+		right:  []bool{false, false, true, false, true},
+	}
+	for _, r := range results {
+		if r.Listing == reference {
+			continue
+		}
+		base, ok := referenceDurations[key(r)]
+		if !ok || base == 0 {
+			continue
+		}
+		delta := (r.Duration.Seconds() - base) / base * 100
+		table.add(r.Structure, r.Label(), strconv.Itoa(r.Workers), r.Listing, fmt.Sprintf("%+.1f%%", delta))
+	}
+	fmt.Printf("\n===== リスティング方式の比較 (基準: %s) =====\n", reference)
+	table.render(os.Stdout, false)
+}
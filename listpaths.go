@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Orders of the path listing of the list subcommand
+const (
+	// ListOrderArrival writes the paths in the order the workers find them,
+	// through one shared writer; the order differs from run to run
+	ListOrderArrival = "arrival"
+	// ListOrderMerge sorts the paths of every worker in that worker and
+	// merges the sorted chunks while writing
+	ListOrderMerge = "sorted-merge"
+	// ListOrderGlobal collects the paths of all workers and sorts them once
+	ListOrderGlobal = "sorted-global"
+)
+
+// listTiming is the cost of producing one listing
+type listTiming struct {
+	scan, order, write time.Duration
+	paths              int
+	// hash identifies the written listing, to check that both sorted
+	// orders are deterministic and equal
+	hash uint64
+}
+
+func (t listTiming) total() time.Duration { return t.scan + t.order + t.write }
+
+// listPaths walks root with the traversal of the recursive-task strategy and
+// passes the paths of the entries of every directory to sink, with the index
+// of the worker that read the directory
+func listPaths(root string, numWorkers int, sink func(worker int, paths []string)) error {
+	tasks := make(chan string, defaultChannelCapacity)
+	var pending sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+
+	var visit func(dir string, worker int)
+	visit = func(dir string, worker int) {
+		entries, err := readDirUnsorted(dir)
+		if err != nil {
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+			return
+		}
+		paths := make([]string, len(entries))
+		for i, entry := range entries {
+			paths[i] = filepath.Join(dir, entry.Name())
+		}
+		sink(worker, paths)
+		for i, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			pending.Add(1)
+			select {
+			case tasks <- paths[i]:
+			default:
+				// Channel full, process inline
+				visit(paths[i], worker)
+				pending.Done()
+			}
+		}
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func(worker int) {
+			defer workers.Done()
+			for dir := range tasks {
+				visit(dir, worker)
+				pending.Done()
+			}
+		}(i)
+	}
+	pending.Add(1)
+	tasks <- root
+	pending.Wait()
+	close(tasks)
+	workers.Wait()
+	return firstErr
+}
+
+// hashingWriter writes lines to a file through a buffer and hashes them
+type hashingWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	hash interface {
+		io.Writer
+		Sum64() uint64
+	}
+}
+
+func createHashingWriter(filename string) (*hashingWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := &hashingWriter{file: f, hash: fnv.New64a()}
+	w.buf = bufio.NewWriterSize(io.MultiWriter(f, w.hash), 1<<16)
+	return w, nil
+}
+
+func (w *hashingWriter) line(path string) {
+	w.buf.WriteString(path)
+	w.buf.WriteByte('\n')
+}
+
+// close flushes and closes the file and returns the hash of its content
+func (w *hashingWriter) close() (uint64, error) {
+	err := w.buf.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return w.hash.Sum64(), err
+}
+
+// listArrival writes the paths as the workers find them
+func listArrival(root string, numWorkers int, filename string) (listTiming, error) {
+	t := listTiming{}
+	w, err := createHashingWriter(filename)
+	if err != nil {
+		return t, err
+	}
+	var mu sync.Mutex
+	start := time.Now()
+	err = listPaths(root, numWorkers, func(_ int, paths []string) {
+		mu.Lock()
+		for _, p := range paths {
+			w.line(p)
+		}
+		t.paths += len(paths)
+		mu.Unlock()
+	})
+	t.scan = time.Since(start)
+	start = time.Now()
+	hash, cerr := w.close()
+	t.write, t.hash = time.Since(start), hash
+	if err == nil {
+		err = cerr
+	}
+	return t, err
+}
+
+// listSorted writes the paths in byte order, either by merging the chunks
+// the workers sorted themselves or by one global sort
+func listSorted(root string, numWorkers int, filename, order string) (listTiming, error) {
+	t := listTiming{}
+	chunks := make([][]string, numWorkers)
+	start := time.Now()
+	err := listPaths(root, numWorkers, func(worker int, paths []string) {
+		chunks[worker] = append(chunks[worker], paths...)
+	})
+	t.scan = time.Since(start)
+	if err != nil {
+		return t, err
+	}
+
+	start = time.Now()
+	var sorted []string
+	if order == ListOrderMerge {
+		var wg sync.WaitGroup
+		for _, chunk := range chunks {
+			wg.Add(1)
+			go func(chunk []string) {
+				defer wg.Done()
+				sort.Strings(chunk)
+			}(chunk)
+		}
+		wg.Wait()
+	} else {
+		for _, chunk := range chunks {
+			sorted = append(sorted, chunk...)
+		}
+		sort.Strings(sorted)
+	}
+	t.order = time.Since(start)
+
+	w, err := createHashingWriter(filename)
+	if err != nil {
+		return t, err
+	}
+	start = time.Now()
+	if order == ListOrderMerge {
+		t.paths = mergeSortedChunks(chunks, w.line)
+	} else {
+		for _, p := range sorted {
+			w.line(p)
+		}
+		t.paths = len(sorted)
+	}
+	hash, err := w.close()
+	t.write, t.hash = time.Since(start), hash
+	return t, err
+}
+
+// chunkCursor is the next path of a sorted chunk during a merge
+type chunkCursor struct {
+	chunk []string
+	next  int
+}
+
+// chunkHeap orders cursors by their next path
+type chunkHeap []*chunkCursor
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].chunk[h[i].next] < h[j].chunk[h[j].next] }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(*chunkCursor)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeSortedChunks passes the paths of sorted chunks to emit in order and
+// returns their number
+func mergeSortedChunks(chunks [][]string, emit func(string)) int {
+	h := chunkHeap{}
+	for _, chunk := range chunks {
+		if len(chunk) > 0 {
+			h = append(h, &chunkCursor{chunk: chunk})
+		}
+	}
+	heap.Init(&h)
+	n := 0
+	for h.Len() > 0 {
+		c := h[0]
+		emit(c.chunk[c.next])
+		n++
+		c.next++
+		if c.next == len(c.chunk) {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return n
+}
+
+// runList writes the paths of a tree to a file and compares the cost of
+// arrival order with the two ways of producing a sorted listing
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan workers")
+	out := fs.String("list-paths", "", "file the paths are written to, one per line (default benchmark/paths_<timestamp>.txt)")
+	order := fs.String("order", "sorted", "order of the written file: arrival or sorted")
+	runs := fs.Int("runs", 3, "runs per order; durations are averaged")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *workers < 1 || *runs < 1 || (*order != ListOrderArrival && *order != "sorted") {
+		fmt.Println("使い方: list [-workers N] [-runs N] [-order arrival|sorted] [-list-paths out.txt] <ディレクトリ>")
+		return 2
+	}
+	root := fs.Arg(0)
+	filename := *out
+	if filename == "" {
+		if err := os.MkdirAll("benchmark", 0755); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+		filename = fmt.Sprintf("benchmark/paths_%s.txt", time.Now().Format("20060102_150405"))
+	}
+
+	// The order written last is the content of the file
+	orders := []string{ListOrderArrival, ListOrderGlobal, ListOrderMerge}
+	if *order == ListOrderArrival {
+		orders = []string{ListOrderMerge, ListOrderGlobal, ListOrderArrival}
+	}
+
+	fmt.Printf("パス一覧: %s (ワーカー数 %d, 各 %d 回)\n", root, *workers, *runs)
+	// Warm-up scan, so that the first order is not the only one read cold
+	if _, err := listArrival(root, *workers, os.DevNull); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	timings := map[string]listTiming{}
+	hashes := map[string]map[uint64]bool{}
+	for _, o := range orders {
+		avg := listTiming{}
+		hashes[o] = map[uint64]bool{}
+		for i := 0; i < *runs; i++ {
+			var t listTiming
+			var err error
+			if o == ListOrderArrival {
+				t, err = listArrival(root, *workers, filename)
+			} else {
+				t, err = listSorted(root, *workers, filename, o)
+			}
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				return 1
+			}
+			avg.scan += t.scan / time.Duration(*runs)
+			avg.order += t.order / time.Duration(*runs)
+			avg.write += t.write / time.Duration(*runs)
+			avg.paths = t.paths
+			hashes[o][t.hash] = true
+		}
+		timings[o] = avg
+	}
+
+	table := &textTable{
+		header: []string{"Order", "Scan", "Sort", "Write", "Total", "Overhead", "Deterministic"},
+		right:  []bool{false, true, true, true, true, true, false},
+	}
+	arrival := timings[ListOrderArrival].total()
+	for _, o := range []string{ListOrderArrival, ListOrderMerge, ListOrderGlobal} {
+		t := timings[o]
+		deterministic := "はい"
+		if len(hashes[o]) > 1 {
+			deterministic = fmt.Sprintf("いいえ (%d 通り)", len(hashes[o]))
+		}
+		table.add(o, formatDuration(t.scan), formatDuration(t.order), formatDuration(t.write), formatDuration(t.total()),
+			fmt.Sprintf("%+.1f%%", (float64(t.total())/float64(arrival)-1)*100), deterministic)
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+
+	merged, global := hashes[ListOrderMerge], hashes[ListOrderGlobal]
+	if len(merged) == 1 && len(global) == 1 {
+		for h := range merged {
+			if !global[h] {
+				fmt.Println("警告: sorted-merge と sorted-global の出力が一致しません")
+			}
+		}
+	}
+	fmt.Printf("\nパス一覧を出力しました: %s (%d パス, %s)\n", filename, timings[orders[len(orders)-1]].paths, orders[len(orders)-1])
+	return 0
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
+	"maps"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -22,51 +29,255 @@ type Config struct {
 	ShallowFiles     int
 	DeepLevels       int
 	DeepDirsPerLevel int
+	MaildirBoxes     int
+	MaildirMessages  int
+	LogDays          int
+	FlatFiles        int
+	// NameStyle selects the file names of generated fixtures
+	NameStyle string
+	// SpecialFiles is the number of special files of each kind per fixture
+	SpecialFiles int
+	// HardlinkFiles is the number of extra hardlinks to existing files per fixture
+	HardlinkFiles int
+	// XattrFraction is the fraction of fixture files given an extended attribute
+	XattrFraction float64
 }
 
 // BenchmarkResult holds benchmark results
 type BenchmarkResult struct {
-	Structure    string
-	Strategy     string
-	Workers      int
-	Duration     time.Duration
+	Structure string
+	Strategy  string
+	Workers   int
+	// WorkersPerCPU is Workers relative to the CPUs of the machine, -1 for
+	// strategies without a worker count
+	WorkersPerCPU float64
+	Duration      time.Duration
+	// DurationCI is the half width of the 95% confidence interval of Duration
+	// over the runs of the cell, -1 with a single run
+	DurationCI time.Duration
+	// Outlier marks a run whose duration deviates strongly from the other
+	// runs of its cell; Outliers counts such runs of a cell and TrimmedRuns
+	// those excluded from its averages
+	Outlier     bool
+	Outliers    int
+	TrimmedRuns int
+	// FilesScanned and DirsScanned are -1 when an external tool does not
+	// report them
 	FilesScanned int
 	DirsScanned  int
 	Speedup      float64
+	Listing      string
+	// ReadDirChunk is the entries read per call, 0 unless the listing is chunked
+	ReadDirChunk int
+	// ChannelCapacity is the task channel capacity, 0 for strategies without one
+	ChannelCapacity int
+	// BatchSize is the entries read or subdirectories opened per call, 0 for
+	// strategies without batches
+	BatchSize int
+	// Fallback, TaskOrder and CutoffDepth are the queueing parameters of the
+	// task channel strategies; Fallback and TaskOrder are empty for other
+	// strategies
+	Fallback    string
+	TaskOrder   string
+	CutoffDepth int
+	// Counters is the counter mode of the directory-based and recursive-task
+	// strategies, empty for other strategies
+	Counters string
+	// GoroutineCap is the concurrency cap of the unbounded strategy, -1 for
+	// other strategies
+	GoroutineCap int
+	// Hardlinks is the hardlink tracking mode
+	Hardlinks string
+	// Symlinks is how symlinks to directories were counted, empty for the
+	// external baselines
+	Symlinks string
+	// UniqueFiles is the file count with hardlinks counted once, -1 when not tracked
+	UniqueFiles int
+	// ChurnRate is the rate of tree modifications during the scan
+	ChurnRate int
+	// ChurnOps is the number of tree modifications applied during the scan
+	ChurnOps int64
+	// ScanErrors is the number of entries that could not be read
+	ScanErrors int64
+	// PermissionErrors, NotFoundErrors and IOErrors split ScanErrors by category
+	PermissionErrors int64
+	NotFoundErrors   int64
+	IOErrors         int64
+	// FirstError describes the first failure of the last run, empty when none
+	FirstError string
+	// MaxReadDirPerSec is the listing call limit of the cell (0 = unlimited)
+	MaxReadDirPerSec int
+	// ReadDirPerSec is the achieved rate of listing calls
+	ReadDirPerSec float64
+	// ThrottleWait is the total time workers waited for the rate limiter
+	ThrottleWait time.Duration
+	// ReadDirDelay is the delay added to every listing call (-readdir-delay)
+	ReadDirDelay time.Duration
+	// MaxInflightIO is the limit of listing calls in flight of the cell (0 = unlimited)
+	MaxInflightIO int
+	// InflightWait is the total time workers waited for a slot of MaxInflightIO
+	InflightWait time.Duration
+	// StaleRetries is the number of listings retried after ESTALE, summed
+	// over the runs like errors
+	StaleRetries int64
+	// TargetProfile is the -target-profile of the session
+	TargetProfile string
+	// StorageProfile is the -storage-profile of the session, empty if none
+	StorageProfile string
+	// CacheMode is the -cache-mode of the cell
+	CacheMode string
+	// runs holds the individual runs of a cell, in order
+	runs []BenchmarkResult
+	// Priority describes the nice/ionice settings of the process, empty when unchanged
+	Priority string
+	// TimedOut reports that a scan was cancelled by -scan-timeout or
+	// -cell-timeout; the counts are partial
+	TimedOut bool
+	// Abandoned reports that a timed out scan did not stop and its counts were lost
+	Abandoned bool
+	// Stalled reports that -stall-timeout cancelled the scan, which then
+	// also counts as timed out; StallDump is the file with the goroutine stacks
+	Stalled   bool
+	StallDump string `json:",omitempty"`
+	// ReadDirLatency holds listing call latency percentiles, nil when not recorded
+	ReadDirLatency *LatencySummary
+	// readDirHist is the histogram behind ReadDirLatency, merged across runs
+	readDirHist *latencyHistogram
+	// dirTimes holds the listing time per directory, merged across runs
+	dirTimes *dirTimer
+	// Allocs is the number of heap allocations per scan
+	Allocs uint64
+	// GC statistics per scan
+	NumGC          uint32
+	GCPause        time.Duration
+	BytesAllocated uint64
+	// PeakFDs is the peak number of open file descriptors, -1 when not tracked
+	PeakFDs int
+	// PeakHeap is the peak heap growth in bytes during the scan, -1 when not tracked
+	PeakHeap int64
+	// MemLimit is the soft memory limit of the benchmark in bytes, 0 when not set
+	MemLimit int64
+	// PeakMemory is the peak memory of the Go runtime the soft memory limit
+	// applies to, -1 when not tracked
+	PeakMemory int64
+	// GCLimited reports that the GC CPU limiter was engaged during the scan:
+	// the GC ran so often to stay within the memory limit that it was capped
+	GCLimited bool
+	// PeakThreads is the peak number of OS threads of the process, -1 when not tracked
+	PeakThreads int
+	// Straggler is the time between 95% of the directories and the end of
+	// the scan, -1 when not tracked
+	Straggler time.Duration
+	// Visits compares the directories listed by the scan with a reference
+	// walk, nil when not verified
+	Visits *visitReport
+	// FileProgress holds the times since the start at which 50, 90, 99 and
+	// 100% of the files had been found (fileProgressShares), nil when not
+	// tracked
+	FileProgress []time.Duration
+	// Roots holds the counts and durations of every root of -combine-paths,
+	// nil for single trees
+	Roots []RootResult
+	// Subtrees holds the counts and durations of the top-level directories
+	// of a directory-based scan with several workers, nil when not recorded
+	Subtrees []SubtreeResult
+	// UserCPU and SystemCPU are the CPU time of the process during the scan,
+	// -1 when the platform does not report them
+	UserCPU   time.Duration
+	SystemCPU time.Duration
+	// MaxRSS is the peak resident set size of the process in bytes, -1 when unknown
+	MaxRSS int64
+	// CPUPeak is the highest CPU utilization of the process over one sampling
+	// interval in busy cores, -1 when not sampled
+	CPUPeak float64
+	// HostCPU is the number of busy cores of the whole host during the scan
+	// and OtherCPU the part used by other processes; -1 when not measured
+	HostCPU  float64
+	OtherCPU float64
+	// LoadAvg is the one-minute load average after the scan, -1 when unknown
+	LoadAvg float64
+	// Noisy reports that other processes used more CPU than the threshold
+	Noisy bool
+	// EnergyJoules is the energy used by the CPU packages during the scan,
+	// -1 when not measured
+	EnergyJoules float64
+	// CPUFreqMHz and CPUFreqMinMHz are the mean and lowest sampled CPU clock,
+	// -1 when not tracked
+	CPUFreqMHz    float64
+	CPUFreqMinMHz float64
+	// ThrottleEvents is the number of thermal throttling events reported by
+	// the kernel during the scan, -1 when unknown
+	ThrottleEvents int64
+	// Throttled reports a clock well below the fastest cell or thermal
+	// throttling; set once all cells have run
+	Throttled bool
+	// Metrics holds internal scanner metrics of the last run when instrumented
+	Metrics *ScanMetrics
+	// ConcurrentScans is the number of scans that ran simultaneously in this cell
+	ConcurrentScans int
+	// Target is the fixture directory of the cell when several targets are compared
+	Target string
+	// Filesystem is the type of the filesystem of the scanned tree, such as
+	// ext4 or overlay, empty when unknown
+	Filesystem string
+	// Workload is the workload applied to the scanned entries, empty for a plain scan
+	Workload string
+	// CopyWorkers is the size of the separate copier pool of the copy workload
+	CopyWorkers int
+	// CopiedFiles and CopiedBytes are the files (including symlinks) and bytes
+	// written by the copy workload; CopySkipped counts the special files it skipped
+	CopiedFiles int64
+	CopiedBytes int64
+	CopySkipped int64
+	// StatCalls and StatBytes are the entries lstat'ed by the stat workload
+	// and the total size of the regular files among them
+	StatCalls int64
+	StatBytes int64
+	// StatCall is the call of the stat workload (empty in other workloads)
+	// and StatFallbacks the entries read with lstat as statx was missing
+	StatCall      string
+	StatFallbacks int64
+	// XattrFiles, XattrCalls and XattrBytes are the files with extended
+	// attributes, the listxattr/getxattr calls and the size of the values
+	// read by the xattr workload
+	XattrFiles int64
+	XattrCalls int64
+	XattrBytes int64
+	// AgeHistogram counts the files of the age workload per mtime age
+	// bucket (ageBucketNames)
+	AgeHistogram [ageBucketCount]int64
+	// DTypeEntries is the number of entries listed in dtype mode and
+	// DTypeFallbacks those reported as DT_UNKNOWN and lstat'ed; -1 in other modes
+	DTypeEntries   int64
+	DTypeFallbacks int64
 }
 
 // Directory structure types
 const (
 	StructureShallow = "shallow"
 	StructureDeep    = "deep"
+	// StructureMaildir is dominated by empty or nearly-empty mailbox directories
+	StructureMaildir = "maildir"
+	// StructureLogDirs has one directory per day holding a single log file
+	StructureLogDirs = "logdirs"
+	// StructureFlat puts every file into the root directory
+	StructureFlat = "flat"
 )
 
 // Parallelization strategies
 const (
 	StrategyDirectoryBased = "directory-based"
 	StrategyRecursiveTask  = "recursive-task"
+	// StrategyRecursiveTaskPooled is the allocation-optimized recursive-task variant
+	StrategyRecursiveTaskPooled = "recursive-task-pooled"
+	// StrategyOpenat opens subdirectories relative to their parent's descriptor
+	StrategyOpenat = "openat"
+	// StrategyUring is the openat strategy submitting the opens through io_uring
+	StrategyUring = "io_uring"
+	// StrategyUnbounded spawns one goroutine per directory without a worker pool
+	StrategyUnbounded = "unbounded-goroutine"
 )
 
-// getConfig returns configuration based on development mode
-func getConfig(isDev bool) Config {
-	if isDev {
-		return Config{
-			IsDevelopment:    true,
-			ShallowDirs:      4,
-			ShallowFiles:     4,
-			DeepLevels:       4,
-			DeepDirsPerLevel: 2,
-		}
-	}
-	return Config{
-		IsDevelopment:    false,
-		ShallowDirs:      100,
-		ShallowFiles:     100,
-		DeepLevels:       4,
-		DeepDirsPerLevel: 10,
-	}
-}
-
 // createShallowStructure creates a shallow directory structure
 func createShallowStructure(rootPath string, config Config) error {
 	for i := 0; i < config.ShallowDirs; i++ {
@@ -76,9 +287,9 @@ func createShallowStructure(rootPath string, config Config) error {
 		}
 
 		for j := 0; j < config.ShallowFiles; j++ {
-			filePath := filepath.Join(dirPath, fmt.Sprintf("file_%03d.txt", j))
+			filePath := filepath.Join(dirPath, fixtureFileName(config, fmt.Sprintf("file_%03d", j), ".txt", j))
 			content := []byte(fmt.Sprintf("File %d in directory %d", j, i))
-			if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+			if err := os.WriteFile(filePath, content, 0644); err != nil {
 				return err
 			}
 		}
@@ -94,9 +305,9 @@ func createDeepStructure(rootPath string, config Config) error {
 		if level >= config.DeepLevels {
 			// Create files at the deepest level
 			for i := 0; i < config.DeepDirsPerLevel; i++ {
-				filePath := filepath.Join(path, fmt.Sprintf("file_%03d.txt", i))
+				filePath := filepath.Join(path, fixtureFileName(config, fmt.Sprintf("file_%03d", i), ".txt", i))
 				content := []byte(fmt.Sprintf("File at level %d", level))
-				if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+				if err := os.WriteFile(filePath, content, 0644); err != nil {
 					return err
 				}
 			}
@@ -119,110 +330,275 @@ func createDeepStructure(rootPath string, config Config) error {
 	return createLevel(rootPath, 0)
 }
 
-// ScanResult holds the scan results
+// createFixture generates the files of a structure, its hardlinks and
+// special files in dirPath, which must exist
+func createFixture(dirPath, structure string, config Config) error {
+	var err error
+	switch structure {
+	case StructureShallow:
+		err = createShallowStructure(dirPath, config)
+	case StructureDeep:
+		err = createDeepStructure(dirPath, config)
+	case StructureMaildir:
+		err = createMaildirStructure(dirPath, config)
+	case StructureLogDirs:
+		err = createLogDirsStructure(dirPath, config)
+	case StructureFlat:
+		err = createFlatStructure(dirPath, config)
+	default:
+		err = fmt.Errorf("unknown structure: %s", structure)
+	}
+	if err == nil {
+		err = createHardlinks(dirPath, config)
+	}
+	if err == nil {
+		err = createSpecialFiles(dirPath, config)
+	}
+	if err == nil {
+		err = createXattrs(dirPath, config)
+	}
+	return err
+}
+
+// generateFixture (re)creates the fixture root dirPath with its ownership
+// marker and the files of a structure
+func generateFixture(dirPath, structure string, config Config) error {
+	if err := checkFixtureOwner(dirPath); err != nil {
+		return err
+	}
+	os.RemoveAll(dirPath)
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		return err
+	}
+	// Written first so that a crash during generation still leaves an owned tree
+	if err := writeFixtureMarker(dirPath, config); err != nil {
+		return err
+	}
+	return createFixture(dirPath, structure, config)
+}
+
+// expectedCounts returns the number of files and directories (including the
+// root) a generated structure contains. Special files and the ownership
+// marker count as files.
+func expectedCounts(structure string, config Config) (files, dirs int) {
+	files, dirs = structureCounts(structure, config)
+	return files + config.SpecialFiles*len(specialFileKinds) + config.HardlinkFiles + 1, dirs
+}
+
+// structureCounts returns the counts of a structure without special files
+func structureCounts(structure string, config Config) (files, dirs int) {
+	switch structure {
+	case StructureShallow:
+		return config.ShallowDirs * config.ShallowFiles, config.ShallowDirs + 1
+	case StructureMaildir:
+		return maildirCounts(config)
+	case StructureLogDirs:
+		return logDirsCounts(config)
+	case StructureFlat:
+		return config.FlatFiles, 1
+	}
+
+	// For deep structure: files are only at the deepest level
+	// Number of leaf directories = dirsPerLevel^levels
+	// Files per leaf directory = dirsPerLevel
+	levelDirs := 1
+	dirs = 1
+	for i := 0; i < config.DeepLevels; i++ {
+		levelDirs *= config.DeepDirsPerLevel
+		dirs += levelDirs
+	}
+	return levelDirs * config.DeepDirsPerLevel, dirs
+}
+
+// ScanResult holds the scan results.
+//
+// Scanners never abort on a failure: an entry that cannot be read is counted
+// in Errors and in its category, its subtree is skipped and the scan goes on.
+// Scan always returns the (possibly partial) result together with all
+// failures joined by errors.Join, or a nil error when everything was read.
 type ScanResult struct {
 	Files int64
 	Dirs  int64
+	// Errors is the number of entries that could not be read
+	Errors int64
+	// PermissionErrors, NotFoundErrors and IOErrors split Errors by category
+	PermissionErrors int64
+	NotFoundErrors   int64
+	IOErrors         int64
+
+	errMu     sync.Mutex
+	errs      []error
+	cancelled bool
 }
 
 // DirectoryBasedScanner implements directory-based parallel scanning
 type DirectoryBasedScanner struct {
 	numWorkers int
+	options    ScanOptions
 }
 
 func (s *DirectoryBasedScanner) Scan(rootPath string) (*ScanResult, error) {
 	result := &ScanResult{}
 
 	if s.numWorkers == 1 {
-		return s.scanSerial(rootPath)
+		activity := s.options.Activity.Worker(0)
+		activity.Enter(rootPath)
+		busyStart := s.options.instrumentation.StartBusy()
+		serialResult := s.scanSerial(rootPath)
+		s.options.instrumentation.EndBusy(0, busyStart)
+		activity.AddFiles(serialResult.Files)
+		activity.Idle()
+		return serialResult, serialResult.Err()
 	}
 
-	// Get top-level directories
-	entries, err := ioutil.ReadDir(rootPath)
+	// Get top-level directories and count root-level files
+	dirs := []string{}
+	var rootFiles int64
+	rootStart := time.Now()
+	err := eachDirEntry(rootPath, s.options, func(entry fs.DirEntry) {
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(rootPath, entry.Name()))
+		} else {
+			rootFiles++
+			s.options.links.AddEntry(entry)
+		}
+	})
 	if err != nil {
-		return nil, err
+		result.addError(err)
+		return result, result.Err()
 	}
+	s.options.subtrees.record(rootPath, &ScanResult{Files: rootFiles, Dirs: 1}, time.Since(rootStart))
 
-	dirChan := make(chan string, len(entries))
+	dirChan := make(chan string, len(dirs))
 	var wg sync.WaitGroup
+	workerResults := s.options.newWorkerResults(s.numWorkers)
+	queueDepth := func() int { return len(dirChan) }
+	s.options.Activity.SetQueue(queueDepth)
+	s.options.instrumentation.SetQueue(queueDepth)
 
 	// Start workers
 	for i := 0; i < s.numWorkers; i++ {
 		wg.Add(1)
+		workerID := i
+		activity := s.options.Activity.Worker(i)
 		go func() {
 			defer wg.Done()
+			defer activity.Idle()
 			for dirPath := range dirChan {
-				localResult, err := s.scanSerial(dirPath)
-				if err != nil {
-					fmt.Printf("Error scanning %s: %v\n", dirPath, err)
-					continue
-				}
-				atomic.AddInt64(&result.Files, localResult.Files)
-				atomic.AddInt64(&result.Dirs, localResult.Dirs)
+				activity.Enter(dirPath)
+				busyStart := s.options.instrumentation.StartBusy()
+				start := time.Now()
+				localResult := s.scanSerial(dirPath)
+				s.options.subtrees.record(dirPath, localResult, time.Since(start))
+				s.options.instrumentation.EndBusy(workerID, busyStart)
+				activity.AddFiles(localResult.Files)
+				workerResult(result, workerResults, workerID).add(localResult)
 			}
 		}()
 	}
 
-	// Count root directory and process root-level entries
+	// Count root directory and root-level files
 	atomic.AddInt64(&result.Dirs, 1)
+	atomic.AddInt64(&result.Files, rootFiles)
 
-	// Queue directories and count root-level files
-	for _, entry := range entries {
-		if entry.IsDir() {
-			dirChan <- filepath.Join(rootPath, entry.Name())
-		} else {
-			atomic.AddInt64(&result.Files, 1)
-		}
+	// Queue directories
+	for _, dirPath := range dirs {
+		dirChan <- dirPath
 	}
 	close(dirChan)
 
 	wg.Wait()
+	for _, r := range workerResults {
+		result.add(r)
+	}
 
-	return result, nil
+	return result, result.Err()
 }
 
-func (s *DirectoryBasedScanner) scanSerial(path string) (*ScanResult, error) {
+// scanSerial counts a subtree on the calling goroutine. Failures are recorded
+// in the returned result.
+func (s *DirectoryBasedScanner) scanSerial(path string) *ScanResult {
 	result := &ScanResult{}
 
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	if s.options.walksExplicitly() {
+		walkDir(path, s.options, result)
+		return result
+	}
+
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err := s.options.ctxErr(); err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if err != nil {
+			// Entries that vanish or cannot be read are counted, not fatal
+			result.addError(err)
+			if entry != nil && entry.IsDir() {
+				// A directory that cannot be read was counted by the call
+				// before, but the other scanners count only directories read
+				result.Dirs--
+			}
+			return nil
+		}
+		if entry.IsDir() {
 			result.Dirs++
 		} else {
 			result.Files++
+			s.options.links.AddEntry(entry)
 		}
 		return nil
 	})
+	if err != nil {
+		result.addError(err)
+	}
 
-	return result, err
+	return result
 }
 
 // RecursiveTaskScanner implements recursive task-based parallel scanning
 type RecursiveTaskScanner struct {
 	numWorkers int
+	options    ScanOptions
+	// root is the scanned root, the reference of -strategy-params CutoffDepth
+	root string
 }
 
 func (s *RecursiveTaskScanner) Scan(rootPath string) (*ScanResult, error) {
 	result := &ScanResult{}
+	s.root = rootPath
 
 	if s.numWorkers == 1 {
-		return s.scanSerialRecursive(rootPath)
+		activity := s.options.Activity.Worker(0)
+		activity.Enter(rootPath)
+		busyStart := s.options.instrumentation.StartBusy()
+		serialResult := s.scanSerialRecursive(rootPath)
+		s.options.instrumentation.EndBusy(0, busyStart)
+		activity.AddFiles(serialResult.Files)
+		activity.Idle()
+		return serialResult, serialResult.Err()
 	}
 
 	// Use a buffered channel for tasks
-	taskChan := make(chan string, 1000)
+	queue := newTaskQueue[string](s.options.ChannelCapacity, s.options.TaskOrder, s.options.hints.estimate)
 	var wg sync.WaitGroup
 	var taskWg sync.WaitGroup
+	workerResults := s.options.newWorkerResults(s.numWorkers)
+	queueDepth := queue.depth
+	s.options.Activity.SetQueue(queueDepth)
+	s.options.instrumentation.SetQueue(queueDepth)
 
 	// Start workers
 	wg.Add(s.numWorkers)
 	for i := 0; i < s.numWorkers; i++ {
+		workerID := i
+		activity := s.options.Activity.Worker(i)
+		local := workerResult(result, workerResults, i)
 		go func() {
 			defer wg.Done()
-			for path := range taskChan {
-				s.processPath(path, taskChan, &taskWg, result)
+			for path, ok := queue.take(); ok; path, ok = queue.take() {
+				busyStart := s.options.instrumentation.StartBusy()
+				s.processPath(path, queue, &taskWg, local, activity)
+				s.options.instrumentation.EndBusy(workerID, busyStart)
+				activity.Idle()
 				taskWg.Done()
 			}
 		}()
@@ -230,341 +606,2692 @@ func (s *RecursiveTaskScanner) Scan(rootPath string) (*ScanResult, error) {
 
 	// Add initial task
 	taskWg.Add(1)
-	taskChan <- rootPath
+	queue.offer(rootPath)
 
 	// Wait for all tasks to complete
 	taskWg.Wait()
-	close(taskChan)
+	queue.close()
 
 	// Wait for all workers to finish
 	wg.Wait()
-
-	return result, nil
-}
-
-func (s *RecursiveTaskScanner) processPath(path string, taskChan chan<- string, taskWg *sync.WaitGroup, result *ScanResult) {
-	entries, err := ioutil.ReadDir(path)
-	if err != nil {
-		fmt.Printf("Error reading %s: %v\n", path, err)
-		return
+	for _, r := range workerResults {
+		result.add(r)
 	}
 
-	atomic.AddInt64(&result.Dirs, 1)
+	return result, result.Err()
+}
 
-	for _, entry := range entries {
+func (s *RecursiveTaskScanner) processPath(path string, queue taskQueue[string], taskWg *sync.WaitGroup, result *ScanResult, activity *WorkerActivity) {
+	activity.Enter(path)
+	subdirs := 0
+	err := eachDirEntry(path, s.options, func(entry fs.DirEntry) {
 		if entry.IsDir() {
+			subdirs++
 			fullPath := filepath.Join(path, entry.Name())
-			// Try to add task to channel
-			select {
-			case taskChan <- fullPath:
-				taskWg.Add(1)
-			default:
-				// Channel full, process inline
-				s.processPathRecursive(fullPath, result)
+			if s.options.CutoffDepth > 0 && !s.options.queuesDepth(pathDepth(s.root, fullPath)) {
+				s.processPathRecursive(fullPath, result, activity)
+				return
+			}
+			// Try to add task to the queue; it is counted before it is sent
+			// so that a worker finishing it cannot end the scan early
+			taskWg.Add(1)
+			if !queue.offer(fullPath) {
+				// Queue full, process inline
+				taskWg.Done()
+				s.options.instrumentation.InlineFallback()
+				if s.options.requeues() {
+					s.processPath(fullPath, queue, taskWg, result, activity)
+				} else {
+					s.processPathRecursive(fullPath, result, activity)
+				}
 			}
 		} else {
-			atomic.AddInt64(&result.Files, 1)
+			s.options.count(&result.Files, 1)
+			activity.AddFiles(1)
+			s.options.links.AddEntry(entry)
 		}
-	}
-}
-
-func (s *RecursiveTaskScanner) processPathRecursive(path string, result *ScanResult) {
-	entries, err := ioutil.ReadDir(path)
+	})
 	if err != nil {
+		result.addError(err)
 		return
 	}
+	s.options.hints.record(path, subdirs)
 
-	atomic.AddInt64(&result.Dirs, 1)
+	s.options.count(&result.Dirs, 1)
+}
 
-	for _, entry := range entries {
+func (s *RecursiveTaskScanner) processPathRecursive(path string, result *ScanResult, activity *WorkerActivity) {
+	activity.Enter(path)
+	err := eachDirEntry(path, s.options, func(entry fs.DirEntry) {
 		if entry.IsDir() {
-			s.processPathRecursive(filepath.Join(path, entry.Name()), result)
+			s.processPathRecursive(filepath.Join(path, entry.Name()), result, activity)
 		} else {
-			atomic.AddInt64(&result.Files, 1)
+			s.options.count(&result.Files, 1)
+			activity.AddFiles(1)
+			s.options.links.AddEntry(entry)
 		}
+	})
+	if err != nil {
+		result.addError(err)
+		return
 	}
+
+	s.options.count(&result.Dirs, 1)
 }
 
-func (s *RecursiveTaskScanner) scanSerialRecursive(path string) (*ScanResult, error) {
+// scanSerialRecursive counts a tree on the calling goroutine. Failures are
+// recorded in the returned result.
+func (s *RecursiveTaskScanner) scanSerialRecursive(path string) *ScanResult {
 	result := &ScanResult{}
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	if s.options.walksExplicitly() {
+		walkDir(path, s.options, result)
+		return result
+	}
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err := s.options.ctxErr(); err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if err != nil {
+			// Entries that vanish or cannot be read are counted, not fatal
+			result.addError(err)
+			if entry != nil && entry.IsDir() {
+				// A directory that cannot be read was counted by the call
+				// before, but the other scanners count only directories read
+				result.Dirs--
+			}
+			return nil
+		}
+		if entry.IsDir() {
 			result.Dirs++
 		} else {
 			result.Files++
+			s.options.links.AddEntry(entry)
 		}
 		return nil
 	})
-	return result, err
+	if err != nil {
+		result.addError(err)
+	}
+	return result
+}
+
+// Label returns the strategy name with the options that differ from the
+// defaults, followed by the target when several targets are compared
+func (r BenchmarkResult) Label() string {
+	label := r.Strategy
+	variant := joinLabels(variantLabel(r.Listing, r.ChannelCapacity, r.ReadDirChunk, r.Hardlinks, r.ChurnRate, r.MaxReadDirPerSec, r.MaxInflightIO, r.CopyWorkers),
+		paramsLabel(r.Strategy, r.BatchSize, r.Fallback, r.TaskOrder, r.CutoffDepth, r.GoroutineCap, r.Counters), workloadVariantLabel(r.Workload, r.StatCall),
+		symlinksLabel(r.Symlinks))
+	if variant != "" {
+		label = fmt.Sprintf("%s [%s]", r.Strategy, variant)
+	}
+	if r.Target != "" {
+		label += " @" + r.Target
+	}
+	return label
+}
+
+// BytesPerFile returns the heap bytes allocated per scanned file
+func (r BenchmarkResult) BytesPerFile() float64 {
+	if r.FilesScanned <= 0 {
+		return 0
+	}
+	return float64(r.BytesAllocated) / float64(r.FilesScanned)
+}
+
+// CPUUtilization returns the CPU time per wall-clock second of the scan,
+// i.e. the average number of busy cores, or -1 when CPU time is unknown
+func (r BenchmarkResult) CPUUtilization() float64 {
+	if r.UserCPU < 0 || r.SystemCPU < 0 || r.Duration <= 0 {
+		return -1
+	}
+	return float64(r.UserCPU+r.SystemCPU) / float64(r.Duration)
+}
+
+// averageCPU returns the mean user and system CPU time of runs, or -1 for
+// both when any run lacks them
+func averageCPU(runs []BenchmarkResult) (user, system time.Duration) {
+	if len(runs) == 0 {
+		return -1, -1
+	}
+	for _, r := range runs {
+		if r.UserCPU < 0 || r.SystemCPU < 0 {
+			return -1, -1
+		}
+		user += r.UserCPU
+		system += r.SystemCPU
+	}
+	n := time.Duration(len(runs))
+	return user / n, system / n
 }
 
 // runBenchmark executes a single benchmark
-func runBenchmark(rootPath, structure, strategy string, numWorkers int) (*BenchmarkResult, error) {
-	start := time.Now()
+func runBenchmark(rootPath, structure, strategy string, numWorkers int, options ScanOptions) (*BenchmarkResult, error) {
+	// Everything that can fail is prepared before any tracker or background
+	// goroutine starts, so that an error return leaves nothing running
+	if strategy == StrategyRemoveAll && options.Workload != WorkloadDelete {
+		return nil, fmt.Errorf("%s only runs with -workload %s", strategy, WorkloadDelete)
+	}
 
-	var scanner interface {
-		Scan(string) (*ScanResult, error)
+	// The reference walk of -verify-visits runs before any measurement
+	var visitReference map[fileKey]string
+	if options.VerifyVisits && strategy != StrategyRemoveAll {
+		visitReference = map[fileKey]string{}
+		for _, root := range scannedRoots(rootPath, options) {
+			maps.Copy(visitReference, referenceVisits(root))
+		}
+		options.visits = newVisitSet()
 	}
 
-	switch strategy {
-	case StrategyDirectoryBased:
-		scanner = &DirectoryBasedScanner{numWorkers: numWorkers}
-	case StrategyRecursiveTask:
-		scanner = &RecursiveTaskScanner{numWorkers: numWorkers}
-	default:
-		return nil, fmt.Errorf("unknown strategy: %s", strategy)
+	var cpuMonitor *CPUMonitor
+	if options.CPUSampleInterval > 0 || options.WorkerCPU {
+		cpuMonitor = NewCPUMonitor(options.CPUSampleInterval)
+	}
+	var instrumentation *ScanInstrumentation
+	if options.Instrument || options.WorkerCPU {
+		instrumentation = newScanInstrumentation(numWorkers)
+		if options.WorkerCPU {
+			instrumentation.cpu = cpuMonitor
+		}
+		options.instrumentation = instrumentation
 	}
 
-	result, err := scanner.Scan(rootPath)
+	options.links = newLinkTracker(options.Hardlinks)
+	options.limiter = newRateLimiter(options.MaxReadDirPerSec)
+	options.stale = newStaleRetry(options.StaleRetries)
+	options.inflight = newIOSemaphore(options.MaxInflightIO)
+	if options.Listing == ListingDType {
+		options.dtype = &dtypeCounter{}
+	}
+	workload, err := newWorkloadRun(options, rootPath)
 	if err != nil {
 		return nil, err
 	}
+	if strategy != StrategyRemoveAll {
+		options.workload = workload
+	}
+	if options.ReadDirLatency {
+		options.readDirLatency = &latencyHistogram{}
+	}
+	if options.DirTimes {
+		options.dirTimes = newDirTimer(rootPath)
+	}
 
-	duration := time.Since(start)
+	var churn *churner
+	if options.ChurnRate > 0 {
+		if churn, err = newChurner(rootPath, options.ChurnRate); err != nil {
+			return nil, err
+		}
+	}
 
-	return &BenchmarkResult{
-		Structure:    structure,
-		Strategy:     strategy,
-		Workers:      numWorkers,
-		Duration:     duration,
-		FilesScanned: int(result.Files),
-		DirsScanned:  int(result.Dirs),
-	}, nil
-}
+	parent := options.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if options.ScanTimeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, options.ScanTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+	options.ctx = ctx
 
-// exportResultsToCSV exports results to CSV file
-func exportResultsToCSV(results []BenchmarkResult, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+	if options.Subtrees && strategy == StrategyDirectoryBased {
+		options.subtrees = &subtreeRecorder{}
+	}
+	var progress *progressTracker
+	if options.TrackStragglers || options.Snapshots != nil || options.StallTimeout > 0 {
+		progress = newProgressTracker(options)
+		options.progress = progress
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Header
-	writer.Write([]string{"Structure", "Strategy", "Workers", "Duration_ms", "Files", "Dirs", "Speedup"})
-
-	// Data
-	for _, r := range results {
-		writer.Write([]string{
-			r.Structure,
-			r.Strategy,
-			fmt.Sprintf("%d", r.Workers),
-			fmt.Sprintf("%.2f", r.Duration.Seconds()*1000),
-			fmt.Sprintf("%d", r.FilesScanned),
-			fmt.Sprintf("%d", r.DirsScanned),
-			fmt.Sprintf("%.2f", r.Speedup),
-		})
+	var scanner strategyScanner = removeAllScanner{}
+	if strategy != StrategyRemoveAll {
+		if scanner, err = newScanner(strategy, numWorkers, options); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
-}
+	workload.start()
 
-func main() {
-	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
-	var memprofile = flag.String("memprofile", "", "write memory profile to file")
-	flag.Parse()
+	// Started first so that its forced GC is not counted in the scan's GC statistics
+	var heap *heapTracker
+	if options.TrackHeap {
+		heap = startHeapTracker()
+	}
 
-	// Setup CPU profiling
-	if *cpuprofile != "" {
-		// Create prof directory if not exists
-		profDir := filepath.Dir(*cpuprofile)
-		if profDir != "." && profDir != "" {
-			if err := os.MkdirAll(profDir, 0755); err != nil {
-				fmt.Printf("プロファイルディレクトリ作成エラー: %v\n", err)
-				os.Exit(1)
-			}
-		}
-		f, err := os.Create(*cpuprofile)
-		if err != nil {
-			fmt.Printf("CPUプロファイル作成エラー: %v\n", err)
-			os.Exit(1)
-		}
-		defer f.Close()
-		if err := pprof.StartCPUProfile(f); err != nil {
-			fmt.Printf("CPUプロファイル開始エラー: %v\n", err)
-			os.Exit(1)
-		}
-		defer pprof.StopCPUProfile()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	usageBefore := readProcessUsage()
+	var hostBefore hostCPUSample
+	if options.HostCPU {
+		hostBefore = readHostCPU()
 	}
 
-	// Check command line arguments
-	isDev := false
-	for _, arg := range flag.Args() {
-		if arg == "dev" {
-			isDev = true
-			break
-		}
+	if options.Activity != nil {
+		options.Activity.Begin(fmt.Sprintf("%s / %s / %d workers", structure, strategy, numWorkers), numWorkers)
+		defer options.Activity.End()
 	}
-	config := getConfig(isDev)
 
-	fmt.Println("ディレクトリスキャン並列化ベンチマーク")
-	fmt.Printf("モード: %s\n", map[bool]string{true: "開発", false: "本番"}[isDev])
-	fmt.Printf("CPU数: %d\n", runtime.NumCPU())
-	fmt.Println("=====================================")
+	var fds *fdTracker
+	if options.TrackFDs {
+		fds = startFDTracker()
+	}
+	var threads *threadTracker
+	if options.TrackThreads {
+		threads = startThreadTracker()
+	}
+	var freq *freqTracker
+	if options.TrackFreq {
+		freq = startFreqTracker()
+	}
+	if options.CPUSampleInterval > 0 {
+		cpuMonitor.Start()
+	}
+	if churn != nil {
+		churn.start()
+	}
 
-	// Setup test data
-	testDirs := map[string]string{
-		StructureShallow: "benchmark_shallow",
-		StructureDeep:    "benchmark_deep",
+	var energyBefore energySample
+	if options.Energy {
+		energyBefore = readEnergy()
+	}
+	if progress != nil {
+		progress.begin()
+	}
+	// os.RemoveAll reports no progress
+	var watchdog *stallWatchdog
+	if options.StallTimeout > 0 && strategy != StrategyRemoveAll {
+		watchdog = startStallWatchdog(progress, options.StallTimeout, cancel, fmt.Sprintf("%s / %s / %d workers", structure, strategy, numWorkers), stallDumpDir)
 	}
+	start := time.Now()
 
-	// Create test data
-	for structure, dirPath := range testDirs {
-		fmt.Printf("\n%s構造のテストデータを作成中...\n", structure)
-		os.RemoveAll(dirPath)
-		if err := os.Mkdir(dirPath, 0755); err != nil {
-			fmt.Printf("エラー: %v\n", err)
-			return
+	scan := scanner.Scan
+	var rootResults []RootResult
+	if len(options.Roots) > 0 {
+		scan = func(string) (*ScanResult, error) {
+			m, err := scanRoots(strategy, numWorkers, options, options.Roots)
+			if m == nil {
+				return &ScanResult{}, err
+			}
+			rootResults = m.Roots
+			return m.Total, err
 		}
+	}
 
-		var err error
-		switch structure {
-		case StructureShallow:
-			err = createShallowStructure(dirPath, config)
-		case StructureDeep:
-			err = createDeepStructure(dirPath, config)
-		}
+	// Failures are counted in the partial result, so they do not end the benchmark
+	result, abandoned, scanErr := runScan(ctx, scan, rootPath)
+	stalled, stallDump, stallDumpErr := watchdog.Stop()
+	if stallDumpErr != nil {
+		stallDump = fmt.Sprintf("(書き込みエラー: %v)", stallDumpErr)
+	}
+	if !abandoned && options.workload != nil {
+		options.workload.finish(numWorkers, result)
+		scanErr = result.Err()
+	}
+	duration := time.Since(start)
+	if abandoned {
+		rootResults = nil
+	}
+	var visits *visitReport
+	if options.visits != nil && !abandoned {
+		report := options.visits.compare(visitReference)
+		visits = &report
+	}
+	straggler := time.Duration(-1)
+	var fileProgress []time.Duration
+	if progress != nil {
+		straggler, fileProgress = progress.Stop()
+	}
+	energy := -1.0
+	if options.Energy {
+		energy = readEnergy().joulesSince(energyBefore)
+	}
 
-		if err != nil {
-			fmt.Printf("エラー: %v\n", err)
-			return
-		}
+	dtypeEntries, dtypeFallbacks := options.dtype.counts()
+	var copiedFiles, copiedBytes, copySkipped, statCalls, statBytes, statFallbacks int64
+	var xattrFiles, xattrCalls, xattrBytes int64
+	var ages [ageBucketCount]int64
+	statCall := ""
+	if workload != nil {
+		ages = workload.ages
+		copiedFiles, copiedBytes, copySkipped = workload.copiedFiles, workload.copiedBytes, workload.skipped
+		statCalls, statBytes, statFallbacks = workload.statCalls, workload.statBytes, workload.statFallbacks
+		xattrFiles, xattrCalls, xattrBytes = workload.xattrFiles, workload.xattrCalls, workload.xattrBytes
+	}
+	if options.Workload == WorkloadStat {
+		statCall = options.StatCall
+	}
 
-		// Verify file count
-		var expectedFiles int
-		if structure == StructureShallow {
-			expectedFiles = config.ShallowDirs * config.ShallowFiles
-		} else {
-			// For deep structure: files are only at the deepest level
-			// Number of leaf directories = dirsPerLevel^levels
-			// Files per leaf directory = dirsPerLevel
-			leafDirs := 1
-			for i := 0; i < config.DeepLevels; i++ {
-				leafDirs *= config.DeepDirsPerLevel
-			}
-			expectedFiles = leafDirs * config.DeepDirsPerLevel
-		}
-		fmt.Printf("期待されるファイル数: %d\n", expectedFiles)
+	var churnOps int64
+	if churn != nil {
+		churnOps = churn.Stop()
 	}
 
-	// Run benchmarks
-	strategies := []string{StrategyDirectoryBased, StrategyRecursiveTask}
-	workerCounts := []int{1, 2, 4, 8}
-	results := []BenchmarkResult{}
+	readDirPerSec := 0.0
+	if options.limiter != nil && duration > 0 {
+		readDirPerSec = float64(options.limiter.Calls()) / duration.Seconds()
+	}
 
-	fmt.Println("\n===== ベンチマーク実行 =====")
+	firstError := ""
+	if scanErr != nil {
+		firstError = strings.SplitN(scanErr.Error(), "\n", 2)[0]
+	}
 
-	for structure, dirPath := range testDirs {
-		fmt.Printf("\n構造: %s\n", structure)
+	usageAfter := readProcessUsage()
+	userCPU, systemCPU := usageAfter.cpuSince(usageBefore)
+	host := hostCPUUsage{Host: -1, Other: -1, LoadAvg: -1}
+	if options.HostCPU && userCPU >= 0 {
+		if usage, ok := measureHostCPU(hostBefore, readHostCPU(), duration, userCPU+systemCPU, options.NoisyThreshold); ok {
+			host = usage
+		}
+	}
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
 
-		for _, strategy := range strategies {
-			fmt.Printf("\n戦略: %s\n", strategy)
+	peakFDs := -1
+	if fds != nil {
+		peakFDs = fds.Stop()
+	}
+	peakThreads := -1
+	if threads != nil {
+		peakThreads = threads.Stop()
+	}
+	clock := freqStats{AvgMHz: -1, MinMHz: -1, Throttles: -1}
+	if freq != nil {
+		clock = freq.Stop()
+	}
+	cpuPeak := -1.0
+	if options.CPUSampleInterval > 0 {
+		cpuMonitor.Stop()
+		if stats := cpuMonitor.GetStats(); stats.SampleCount > 0 {
+			cpuPeak = stats.Max / 100
+		}
+	}
 
-			// Store baseline for speedup calculation
-			var baselineDuration time.Duration
+	var peakHeap, peakMemory int64 = -1, -1
+	gcLimited := false
+	if heap != nil {
+		peakHeap = heap.Stop()
+		peakMemory, gcLimited = heap.limits()
+	}
 
-			for _, workers := range workerCounts {
-				fmt.Printf("  ワーカー数 %d でベンチマーク実行中...", workers)
+	channelCapacity, fallback, taskOrder, cutoffDepth := 0, "", "", 0
+	if usesChannelCapacity(strategy) {
+		channelCapacity, fallback, taskOrder, cutoffDepth = options.ChannelCapacity, options.Fallback, options.TaskOrder, options.CutoffDepth
+	}
+	batchSize := 0
+	if usesBatchSize(strategy) {
+		batchSize = options.batchSize(strategy)
+	}
+	counters := ""
+	if usesCounters(strategy) {
+		counters = options.Counters
+	}
+	goroutineCap := -1
+	if strategy == StrategyUnbounded {
+		goroutineCap = options.GoroutineCap
+	}
 
-				// Run multiple times and take average
-				const numRuns = 3
-				var totalDuration time.Duration
-				var result *BenchmarkResult
+	readDirChunk := 0
+	if options.Listing == ListingChunked {
+		readDirChunk = options.ReadDirChunk
+	}
 
-				for i := 0; i < numRuns; i++ {
-					r, err := runBenchmark(dirPath, structure, strategy, workers)
-					if err != nil {
-						fmt.Printf("\n  エラー: %v\n", err)
-						break
-					}
-					totalDuration += r.Duration
-					result = r
-				}
+	uniqueFiles := -1
+	if options.links != nil {
+		uniqueFiles = int(result.Files - options.links.Duplicates())
+	}
 
-				if result != nil {
-					result.Duration = totalDuration / numRuns
+	var metrics *ScanMetrics
+	if instrumentation != nil {
+		metrics = instrumentation.finish(duration)
+	}
 
-					// Calculate speedup
-					if workers == 1 {
-						baselineDuration = result.Duration
-						result.Speedup = 1.0
-					} else {
-						result.Speedup = float64(baselineDuration) / float64(result.Duration)
-					}
+	return &BenchmarkResult{
+		Structure:     structure,
+		Strategy:      strategy,
+		Workers:       numWorkers,
+		WorkersPerCPU: workersPerCPU(numWorkers),
+		Duration:      duration,
+		DurationCI:    -1,
+		FilesScanned:  int(result.Files),
+		DirsScanned:   int(result.Dirs),
+		Listing:       options.Listing,
+		ReadDirChunk:  readDirChunk,
+
+		ChannelCapacity: channelCapacity,
+		BatchSize:       batchSize,
+		Fallback:        fallback,
+		TaskOrder:       taskOrder,
+		CutoffDepth:     cutoffDepth,
+		Counters:        counters,
+		GoroutineCap:    goroutineCap,
+		Hardlinks:       options.Hardlinks,
+		Symlinks:        options.Symlinks,
+		UniqueFiles:     uniqueFiles,
+		ChurnRate:       options.ChurnRate,
+		ChurnOps:        churnOps,
+		ScanErrors:      result.Errors,
+
+		PermissionErrors: result.PermissionErrors,
+		NotFoundErrors:   result.NotFoundErrors,
+		IOErrors:         result.IOErrors,
+		FirstError:       firstError,
+		MaxReadDirPerSec: options.MaxReadDirPerSec,
+		ReadDirPerSec:    readDirPerSec,
+		ThrottleWait:     options.limiter.Waited(),
+		ReadDirDelay:     options.ReadDirDelay,
+		StaleRetries:     options.stale.Retries(),
+		MaxInflightIO:    options.MaxInflightIO,
+		InflightWait:     options.inflight.Waited(),
+
+		ReadDirLatency: options.readDirLatency.Summary(),
+		readDirHist:    options.readDirLatency,
+		dirTimes:       options.dirTimes,
+		Allocs:         memAfter.Mallocs - memBefore.Mallocs,
+
+		NumGC:          memAfter.NumGC - memBefore.NumGC,
+		GCPause:        time.Duration(memAfter.PauseTotalNs - memBefore.PauseTotalNs),
+		BytesAllocated: memAfter.TotalAlloc - memBefore.TotalAlloc,
+		Metrics:        metrics,
+		PeakFDs:        peakFDs,
+		PeakHeap:       peakHeap,
+		MemLimit:       options.MemLimit,
+		PeakMemory:     peakMemory,
+		GCLimited:      gcLimited,
+		Straggler:      straggler,
+		FileProgress:   fileProgress,
+		Visits:         visits,
+		Roots:          rootResults,
+		Subtrees:       options.subtrees.results(),
+		PeakThreads:    peakThreads,
+		CPUPeak:        cpuPeak,
+		HostCPU:        host.Host,
+		OtherCPU:       host.Other,
+		LoadAvg:        host.LoadAvg,
+		Noisy:          host.Noisy,
+		EnergyJoules:   energy,
+		CPUFreqMHz:     clock.AvgMHz,
+		CPUFreqMinMHz:  clock.MinMHz,
+		ThrottleEvents: clock.Throttles,
+		UserCPU:        userCPU,
+		SystemCPU:      systemCPU,
+		MaxRSS:         usageAfter.MaxRSS,
+
+		ConcurrentScans: 1,
+		Workload:        workloadLabel(options.Workload),
+		CopyWorkers:     options.CopyWorkers,
+		CopiedFiles:     copiedFiles,
+		CopiedBytes:     copiedBytes,
+		CopySkipped:     copySkipped,
+		StatCalls:       statCalls,
+		StatBytes:       statBytes,
+		StatCall:        statCall,
+		StatFallbacks:   statFallbacks,
+		XattrFiles:      xattrFiles,
+		XattrCalls:      xattrCalls,
+		XattrBytes:      xattrBytes,
+		AgeHistogram:    ages,
+		DTypeEntries:    dtypeEntries,
+		DTypeFallbacks:  dtypeFallbacks,
+		TimedOut:        result.Cancelled() || abandoned,
+		Abandoned:       abandoned,
+		Stalled:         stalled,
+		StallDump:       stallDump,
+	}, nil
+}
 
-					results = append(results, *result)
+// scanAbandonGrace is how long a cancelled scan may take to wind down before
+// it is abandoned, e.g. when a worker is stuck in a system call on a hung mount
+const scanAbandonGrace = 2 * time.Second
 
-					// Verify file count
-					var expectedFiles int
-					if structure == StructureShallow {
-						expectedFiles = config.ShallowDirs * config.ShallowFiles
-					} else {
-						// For deep structure: files are only at the deepest level
-						// Number of leaf directories = dirsPerLevel^levels
-						// Files per leaf directory = dirsPerLevel
-						leafDirs := 1
-						for i := 0; i < config.DeepLevels; i++ {
-							leafDirs *= config.DeepDirsPerLevel
-						}
-						expectedFiles = leafDirs * config.DeepDirsPerLevel
-					}
+// strategyScanner is the scanner of one strategy
+type strategyScanner interface {
+	Scan(string) (*ScanResult, error)
+}
 
-					if result.FilesScanned != expectedFiles {
-						fmt.Printf(" 警告: ファイル数が一致しません (期待: %d, 実際: %d)",
-							expectedFiles, result.FilesScanned)
-					}
-					fmt.Printf(" 完了 (%.3fs, speedup: %.2fx)\n",
-						result.Duration.Seconds(), result.Speedup)
-				}
-			}
+// newScanner returns the scanner of a strategy that walks a tree itself,
+// i.e. every strategy except os.RemoveAll
+func newScanner(strategy string, numWorkers int, options ScanOptions) (strategyScanner, error) {
+	if options.symlinks == nil {
+		options.symlinks = newSymlinkResolver(options.Symlinks)
+	}
+	if options.Snapshots != nil && options.progress == nil {
+		return newStreamingScanner(strategy, numWorkers, options)
+	}
+	switch strategy {
+	case StrategyDirectoryBased:
+		return &DirectoryBasedScanner{numWorkers: numWorkers, options: options}, nil
+	case StrategyRecursiveTask:
+		return &RecursiveTaskScanner{numWorkers: numWorkers, options: options}, nil
+	case StrategyRecursiveTaskPooled:
+		return &PooledRecursiveTaskScanner{numWorkers: numWorkers, options: options}, nil
+	case StrategyUnbounded:
+		return &UnboundedScanner{options: options}, nil
+	case StrategyBulkAttr:
+		if options.workload != nil && options.Workload != WorkloadStat {
+			return nil, fmt.Errorf("%s does not support -workload %s", strategy, options.Workload)
+		}
+		return newBulkAttrScanner(numWorkers, options), nil
+	case StrategyFindFile:
+		if options.workload != nil && options.Workload != WorkloadStat {
+			return nil, fmt.Errorf("%s does not support -workload %s", strategy, options.Workload)
 		}
+		return newFindFileScanner(numWorkers, options), nil
+	case StrategyMFT:
+		if options.workload != nil {
+			return nil, fmt.Errorf("%s does not support -workload %s", strategy, options.Workload)
+		}
+		if options.symlinks != nil {
+			return nil, fmt.Errorf("%s does not support -symlinks %s", strategy, options.Symlinks)
+		}
+		return newMFTScanner(numWorkers, options), nil
+	case StrategyOpenat, StrategyUring:
+		if options.workload != nil {
+			return nil, fmt.Errorf("%s does not support -workload %s", strategy, options.Workload)
+		}
+		return &OpenatScanner{numWorkers: numWorkers, options: options, uring: strategy == StrategyUring}, nil
 	}
+	return nil, fmt.Errorf("unknown strategy: %s", strategy)
+}
 
-	// Display results
-	fmt.Println("\n===== ベンチマーク結果サマリー =====")
-	fmt.Printf("%-10s %-20s %-8s %-12s %-10s %-10s %-10s\n",
-		"Structure", "Strategy", "Workers", "Duration", "Files", "Dirs", "Speedup")
-	fmt.Println(strings.Repeat("-", 80))
+// scannedRoots returns the trees a scan of rootPath covers: the roots of
+// -combine-paths, or rootPath itself
+func scannedRoots(rootPath string, options ScanOptions) []string {
+	if len(options.Roots) > 0 {
+		return options.Roots
+	}
+	return []string{rootPath}
+}
 
-	for _, result := range results {
-		fmt.Printf("%-10s %-20s %-8d %-12s %-10d %-10d %-10.2fx\n",
-			result.Structure,
-			result.Strategy,
-			result.Workers,
-			result.Duration.Round(time.Millisecond),
-			result.FilesScanned,
-			result.DirsScanned,
-			result.Speedup)
+// runScan runs scan in its own goroutine so that a scan which does not react
+// to cancellation cannot block the benchmark. An abandoned scan keeps running
+// in the background and its counts are lost.
+func runScan(ctx context.Context, scan func(string) (*ScanResult, error), rootPath string) (*ScanResult, bool, error) {
+	type outcome struct {
+		result *ScanResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := scan(rootPath)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, false, o.err
+	case <-ctx.Done():
 	}
+	select {
+	case o := <-done:
+		return o.result, false, o.err
+	case <-time.After(scanAbandonGrace):
+		return &ScanResult{}, true, ctx.Err()
+	}
+}
 
-	// Export to CSV
-	// Create benchmark directory if not exists
-	benchmarkDir := "benchmark"
-	if err := os.MkdirAll(benchmarkDir, 0755); err != nil {
-		fmt.Printf("\nベンチマークディレクトリ作成エラー: %v\n", err)
-	} else {
-		csvFilename := fmt.Sprintf("%s/benchmark_results_%s.csv",
-			benchmarkDir,
-			time.Now().Format("20060102_150405"))
-		if err := exportResultsToCSV(results, csvFilename); err != nil {
-			fmt.Printf("\nCSV出力エラー: %v\n", err)
-		} else {
-			fmt.Printf("\n結果をCSVファイルに出力しました: %s\n", csvFilename)
-		}
+// defaultMaxRuns is the default upper limit of runs of a calibrated cell
+const defaultMaxRuns = 1000
+
+// runBenchmarkCell runs one benchmark cell numRuns times, or more often when
+// calibrated, and returns the last result with the average duration. A cell
+// whose scan times out stops after that run and is reported with its partial
+// counts.
+func runBenchmarkCell(dirPath string, roots []string, structure, strategy string, numWorkers int, options ScanOptions, numRuns int) (*BenchmarkResult, error) {
+	cell := newBenchmarkCell(dirPath, roots, structure, strategy, numWorkers, options)
+	for cell.pending() && !cell.enough(numRuns) {
+		cell.runOnce()
 	}
+	return cell.result()
+}
 
-	// Cleanup
-	fmt.Println("\nテストデータを削除中...")
-	for _, dirPath := range testDirs {
-		os.RemoveAll(dirPath)
+// benchmarkCell collects the runs of one cell. The runs may be interleaved
+// with those of other cells; -cell-timeout then only counts the cell's own
+// time.
+type benchmarkCell struct {
+	dirPath, structure, strategy string
+	roots                        []string
+	numWorkers                   int
+	options                      ScanOptions
+	// remaining is the unused -cell-timeout budget, 0 without a timeout
+	remaining time.Duration
+	runs      []BenchmarkResult
+	timedOut  bool
+	err       error
+}
+
+// newBenchmarkCell prepares a cell without running it
+func newBenchmarkCell(dirPath string, roots []string, structure, strategy string, numWorkers int, options ScanOptions) *benchmarkCell {
+	if options.TaskOrder == TaskOrderPriority {
+		options.hints = newFanOutHints()
 	}
-	fmt.Println("完了")
+	return &benchmarkCell{
+		dirPath:    dirPath,
+		structure:  structure,
+		strategy:   strategy,
+		roots:      roots,
+		numWorkers: numWorkers,
+		options:    options,
+		remaining:  options.CellTimeout,
+	}
+}
+
+// pending reports whether further runs of the cell are useful: a timed out
+// scan is not repeated since the remaining runs would hang the same way
+func (c *benchmarkCell) pending() bool {
+	return c.err == nil && !c.timedOut
+}
+
+// calibrated reports whether the number of runs is calibrated by -min-time
+// or -ci-target instead of fixed
+func (o ScanOptions) calibrated() bool {
+	return o.MinTime > 0 || o.CITarget > 0
+}
+
+// enough reports whether the cell has been run often enough: numRuns times,
+// or when calibrated at least numRuns times and until the run time and
+// precision targets are met or MaxRuns is reached
+func (c *benchmarkCell) enough(numRuns int) bool {
+	n := len(c.runs)
+	if n < numRuns {
+		return false
+	}
+	if !c.options.calibrated() || (c.options.MaxRuns > 0 && n >= c.options.MaxRuns) {
+		return true
+	}
+	var measured time.Duration
+	for _, r := range c.runs {
+		measured += r.Duration
+	}
+	if measured < c.options.MinTime {
+		return false
+	}
+	if c.options.CITarget > 0 {
+		ci := durationCI(c.runs)
+		mean := measured / time.Duration(n)
+		if ci < 0 || mean <= 0 || float64(ci)/float64(mean) > c.options.CITarget {
+			return false
+		}
+	}
+	return true
+}
+
+// runOnce runs the cell once more
+func (c *benchmarkCell) runOnce() {
+	if !c.pending() {
+		return
+	}
+	options := c.options
+	ctx := context.Background()
+	if options.CellTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.remaining)
+		defer cancel()
+	}
+	options.ctx = ctx
+	start := time.Now()
+
+	var r *BenchmarkResult
+	if options.Prepare != nil {
+		if c.err = options.Prepare(); c.err != nil {
+			return
+		}
+	}
+	if options.CacheMode == CacheModeCold {
+		// After Prepare, which may have written the tree
+		if c.err = dropCaches(); c.err != nil {
+			return
+		}
+	}
+	if len(c.roots) > 1 {
+		r, c.err = runConcurrentBenchmark(c.roots, c.structure, c.strategy, c.numWorkers, options)
+	} else {
+		r, c.err = runBenchmark(c.dirPath, c.structure, c.strategy, c.numWorkers, options)
+	}
+	if c.err != nil {
+		return
+	}
+	c.remaining -= time.Since(start)
+	if r.TimedOut || ctx.Err() != nil || (options.CellTimeout > 0 && c.remaining <= 0) {
+		r.TimedOut = true
+		c.timedOut = true
+	}
+	c.runs = append(c.runs, *r)
+}
+
+// result returns the last run with the averages and peaks of all runs
+func (c *benchmarkCell) result() (*BenchmarkResult, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	outliers := markOutliers(c.runs, c.options.OutlierK)
+	runs := c.runs
+	trimmed := 0
+	if c.options.TrimOutliers && outliers > 0 {
+		runs = []BenchmarkResult{}
+		for _, r := range c.runs {
+			if !r.Outlier {
+				runs = append(runs, r)
+			}
+		}
+		trimmed = outliers
+	}
+	result := runs[len(runs)-1]
+
+	var totalDuration time.Duration
+	var totalAllocs, totalBytes uint64
+	var totalNumGC uint32
+	var totalPause time.Duration
+	peakFDs, peakThreads := -1, -1
+	var peakHeap, peakMemory, maxRSS int64 = -1, -1, -1
+	gcLimited := false
+	cpuPeak := -1.0
+	var totalChurnOps, totalErrors int64
+	var totalPermission, totalNotFound, totalIO, totalStaleRetries int64
+	var totalReadDirRate float64
+	var totalThrottleWait, totalInflightWait time.Duration
+	var totalStraggler time.Duration
+	stragglerRuns := 0
+	totalFileProgress := make([]time.Duration, len(fileProgressShares))
+	fileProgressRuns := 0
+	firstError := ""
+	var readDirHist *latencyHistogram
+	if c.options.ReadDirLatency {
+		readDirHist = &latencyHistogram{}
+	}
+	var dirTimes *dirTimer
+	if c.options.DirTimes {
+		dirTimes = newDirTimer(c.dirPath)
+	}
+	for _, r := range runs {
+		totalDuration += r.Duration
+		totalAllocs += r.Allocs
+		totalBytes += r.BytesAllocated
+		totalNumGC += r.NumGC
+		totalPause += r.GCPause
+		if r.PeakFDs > peakFDs {
+			peakFDs = r.PeakFDs
+		}
+		if r.PeakThreads > peakThreads {
+			peakThreads = r.PeakThreads
+		}
+		if r.CPUPeak > cpuPeak {
+			cpuPeak = r.CPUPeak
+		}
+		if r.PeakHeap > peakHeap {
+			peakHeap = r.PeakHeap
+		}
+		peakMemory = max(peakMemory, r.PeakMemory)
+		gcLimited = gcLimited || r.GCLimited
+		if r.MaxRSS > maxRSS {
+			maxRSS = r.MaxRSS
+		}
+		totalChurnOps += r.ChurnOps
+		totalErrors += r.ScanErrors
+		totalPermission += r.PermissionErrors
+		totalNotFound += r.NotFoundErrors
+		totalIO += r.IOErrors
+		totalStaleRetries += r.StaleRetries
+		totalReadDirRate += r.ReadDirPerSec
+		totalThrottleWait += r.ThrottleWait
+		totalInflightWait += r.InflightWait
+		if r.Straggler >= 0 {
+			totalStraggler += r.Straggler
+			stragglerRuns++
+		}
+		if r.FileProgress != nil {
+			for i, d := range r.FileProgress {
+				totalFileProgress[i] += d
+			}
+			fileProgressRuns++
+		}
+		if firstError == "" {
+			firstError = r.FirstError
+		}
+		readDirHist.Merge(r.readDirHist)
+		dirTimes.Merge(r.dirTimes)
+	}
+
+	n := len(runs)
+	result.TimedOut = c.timedOut
+	// The stalled run ends the cell but may have been trimmed as an outlier
+	for _, r := range c.runs {
+		if r.Stalled {
+			result.Stalled, result.StallDump = true, r.StallDump
+		}
+	}
+	result.Duration = totalDuration / time.Duration(n)
+	result.DurationCI = durationCI(runs)
+	result.Allocs = totalAllocs / uint64(n)
+	result.BytesAllocated = totalBytes / uint64(n)
+	result.NumGC = totalNumGC / uint32(n)
+	result.GCPause = totalPause / time.Duration(n)
+	result.PeakFDs = peakFDs
+	result.PeakHeap = peakHeap
+	result.PeakMemory, result.GCLimited = peakMemory, gcLimited
+	result.PeakThreads = peakThreads
+	result.CPUPeak = cpuPeak
+	result.MaxRSS = maxRSS
+	result.UserCPU, result.SystemCPU = averageCPU(runs)
+	result.HostCPU, result.OtherCPU, result.LoadAvg, result.Noisy = averageHostCPU(runs)
+	result.EnergyJoules = averageEnergy(runs)
+	clock := averageFreq(runs)
+	result.CPUFreqMHz, result.CPUFreqMinMHz, result.ThrottleEvents = clock.AvgMHz, clock.MinMHz, clock.Throttles
+	result.ChurnOps = totalChurnOps / int64(n)
+	result.ReadDirPerSec = totalReadDirRate / float64(n)
+	result.ThrottleWait = totalThrottleWait / time.Duration(n)
+	result.InflightWait = totalInflightWait / time.Duration(n)
+	result.Straggler = -1
+	if stragglerRuns > 0 {
+		result.Straggler = totalStraggler / time.Duration(stragglerRuns)
+	}
+	if result.Visits != nil {
+		// Differences are summed like errors
+		visits := &visitReport{}
+		for _, r := range runs {
+			visits.add(r.Visits)
+		}
+		result.Visits = visits
+	}
+	result.Subtrees = averageSubtrees(runs)
+	result.FileProgress = nil
+	if fileProgressRuns > 0 {
+		for i := range totalFileProgress {
+			totalFileProgress[i] /= time.Duration(fileProgressRuns)
+		}
+		result.FileProgress = totalFileProgress
+	}
+	// Errors are summed so that rare failures are not averaged away
+	result.ScanErrors = totalErrors
+	result.PermissionErrors = totalPermission
+	result.NotFoundErrors = totalNotFound
+	result.IOErrors = totalIO
+	result.StaleRetries = totalStaleRetries
+	result.FirstError = firstError
+	if readDirHist != nil {
+		result.ReadDirLatency = readDirHist.Summary()
+		result.readDirHist = readDirHist
+	}
+	result.dirTimes = dirTimes
+	result.Outlier = false
+	result.Outliers = outliers
+	result.TrimmedRuns = trimmed
+	result.runs = c.runs
+	return &result, nil
+}
+
+// resultsSchemaVersion is the version of the result columns, written by
+// every output format: to the first line of the CSV files, to the session
+// metadata of the JSON files and to the Parquet, SQLite, Markdown and
+// Prometheus files. Version 2 added the per-run file and the Run, Runs, CPU
+// and memory columns; version 3 the Host and Session columns; version 4 the
+// Workload column; version 5 the columns of the copy workload; version 6 the
+// d_type columns; version 7 the PeakThreads column; version 8 the
+// WorkerCPU_ms column; version 9 the CPUPeak column; version 10 the host CPU
+// columns; version 11 the energy columns; version 12 the CPU clock columns;
+// version 13 the DurationCI95_ms column; version 14 the outlier columns;
+// version 15 the strategy parameter columns; version 16 the WorkersPerCPU
+// column; version 17 the TaskOrder column; version 18 the Straggler_ms
+// column; version 19 the file progress columns; version 20 the Counters
+// column; version 21 the columns of the stat workload; version 22 the
+// StatCall and StatFallbacks columns; version 23 the columns of the xattr
+// workload; version 24 the age histogram columns; version 25 the memory
+// limit columns; version 26 the Stalled column; version 27 made sorted the
+// default listing, which was readdir before; version 28 the Symlinks column;
+// version 29 the Filesystem column; version 30 the TargetProfile,
+// ReadDirDelay_ms and StaleRetries columns; version 31 the StorageProfile
+// and CacheMode columns; version 32 the MaxInflightIO and InflightWait_ms
+// columns.
+const resultsSchemaVersion = 32
+
+// resultsCSVHeader is the column set shared by the results and runs CSV files
+var resultsCSVHeader = []string{"Structure", "Strategy", "Workers", "Duration_ms", "Files", "Dirs", "Speedup", "ConcurrentScans", "Listing", "ChannelCapacity", "Allocs", "NumGC", "GCPause_ms", "BytesPerFile",
+	"QueueDepthMax", "QueueDepthAvg", "BusyRatioAvg", "BusyRatioMin", "InlineFallbacks", "WorkerBusyRatios", "PeakFDs", "Target", "ReadDirChunk", "PeakHeapBytes", "Hardlinks", "UniqueFiles", "ChurnRate", "ChurnOps", "ScanErrors",
+	"ReadDirCalls", "ReadDirP50_us", "ReadDirP95_us", "ReadDirP99_us", "ReadDirMax_us",
+	"PermissionErrors", "NotFoundErrors", "IOErrors", "TimedOut",
+	"MaxReadDirPerSec", "ReadDirPerSec", "ThrottleWait_ms", "Priority",
+	"Run", "Runs", "UserCPU_ms", "SystemCPU_ms", "CPUUtilization", "BytesAllocated", "MaxRSSBytes",
+	"Host", "Session", "Workload", "CopyWorkers", "CopiedFiles", "CopiedBytes", "CopySkipped",
+	"DTypeEntries", "DTypeFallbacks", "PeakThreads", "WorkerCPU_ms", "CPUPeak",
+	"HostCPU", "OtherCPU", "LoadAvg1", "Noisy", "Energy_J", "FilesPerJoule",
+	"CPUFreq_MHz", "CPUFreqMin_MHz", "ThrottleEvents", "Throttled",
+	"DurationCI95_ms", "Outliers", "TrimmedRuns",
+	"BatchSize", "Fallback", "CutoffDepth", "GoroutineCap", "WorkersPerCPU", "TaskOrder", "Straggler_ms",
+	"Files50_ms", "Files90_ms", "Files99_ms", "Files100_ms", "Counters", "StatCalls", "StatBytes", "StatCall", "StatFallbacks",
+	"XattrFiles", "XattrCalls", "XattrBytes", "Age1d", "Age1w", "Age1m", "Age1y", "AgeOlder",
+	"MemLimitBytes", "PeakMemoryBytes", "GCLimited", "Stalled", "Symlinks", "Filesystem",
+	"TargetProfile", "ReadDirDelay_ms", "StaleRetries", "StorageProfile", "CacheMode",
+	"MaxInflightIO", "InflightWait_ms"}
+
+// exportResultsToCSV exports one aggregate row per benchmark cell. Durations,
+// allocations and CPU times are means over the runs, errors are summed, peaks
+// are maxima and the counts are those of the last run; the individual runs are
+// written by exportRunsToCSV.
+func exportResultsToCSV(results []BenchmarkResult, metadata SessionMetadata, filename string) error {
+	return writeResultsCSV(filename, "aggregate", sessionCSVRows(newResultsSession(metadata, results)))
+}
+
+// exportRunsToCSV exports one row per individual run of every benchmark cell
+func exportRunsToCSV(results []BenchmarkResult, metadata SessionMetadata, filename string) error {
+	return writeResultsCSV(filename, "run", runCSVRows(results, metadata))
+}
+
+// runCSVRows formats one row per individual run of every benchmark cell
+func runCSVRows(results []BenchmarkResult, metadata SessionMetadata) [][]string {
+	rows := [][]string{}
+	for _, result := range results {
+		for i, r := range cellRuns(result) {
+			rows = append(rows, resultCSVRow(r, metadata, i+1, 1))
+		}
+	}
+	return rows
+}
+
+// csvSchemaComment returns the first line of a CSV file holding rows of kind
+func csvSchemaComment(kind string) string {
+	return fmt.Sprintf("# go-parallel-dir-scan-benchmark schema=%d rows=%s", resultsSchemaVersion, kind)
+}
+
+// writeResultsCSV writes the schema comment, the header and rows
+func writeResultsCSV(filename, kind string, rows [][]string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintln(file, csvSchemaComment(kind))
+	return writeCSVRows(file, append([][]string{resultsCSVHeader}, rows...))
+}
+
+// writeCSVRows writes rows as CSV records
+func writeCSVRows(w io.Writer, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	writer.WriteAll(rows)
+	return writer.Error()
+}
+
+// cellRuns returns the individual runs of a cell with the cell-level fields
+// filled in. The speedup of a run is relative to the cell's baseline.
+func cellRuns(result BenchmarkResult) []BenchmarkResult {
+	runs := make([]BenchmarkResult, len(result.runs))
+	for i, r := range result.runs {
+		r.Target = result.Target
+		r.Priority = result.Priority
+		if r.Duration > 0 {
+			r.Speedup = result.Speedup * float64(result.Duration) / float64(r.Duration)
+		}
+		runs[i] = r
+	}
+	return runs
+}
+
+// resultCSVRow formats r as a CSV row; run is the 1-based run index, 0 for
+// an aggregate row, and runs the number of runs the row covers
+func resultCSVRow(r BenchmarkResult, metadata SessionMetadata, run, runs int) []string {
+	row := []string{
+		r.Structure,
+		r.Strategy,
+		fmt.Sprintf("%d", r.Workers),
+		fmt.Sprintf("%.2f", r.Duration.Seconds()*1000),
+		optionalCount(r.FilesScanned),
+		optionalCount(r.DirsScanned),
+		fmt.Sprintf("%.2f", r.Speedup),
+		fmt.Sprintf("%d", r.ConcurrentScans),
+		r.Listing,
+		fmt.Sprintf("%d", r.ChannelCapacity),
+		fmt.Sprintf("%d", r.Allocs),
+		fmt.Sprintf("%d", r.NumGC),
+		fmt.Sprintf("%.3f", r.GCPause.Seconds()*1000),
+		fmt.Sprintf("%.1f", r.BytesPerFile()),
+	}
+	if r.Metrics != nil {
+		row = append(row,
+			fmt.Sprintf("%d", r.Metrics.QueueDepthMax),
+			fmt.Sprintf("%.2f", r.Metrics.QueueDepthAvg),
+			fmt.Sprintf("%.3f", r.Metrics.BusyRatioAvg()),
+			fmt.Sprintf("%.3f", r.Metrics.BusyRatioMin()),
+			fmt.Sprintf("%d", r.Metrics.InlineFallbacks),
+			formatBusyRatios(r.Metrics.WorkerBusy))
+	} else {
+		row = append(row, "", "", "", "", "", "")
+	}
+	if r.PeakFDs >= 0 {
+		row = append(row, fmt.Sprintf("%d", r.PeakFDs))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row, r.Target, fmt.Sprintf("%d", r.ReadDirChunk))
+	if r.PeakHeap >= 0 {
+		row = append(row, fmt.Sprintf("%d", r.PeakHeap))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row, r.Hardlinks)
+	if r.UniqueFiles >= 0 {
+		row = append(row, fmt.Sprintf("%d", r.UniqueFiles))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row,
+		fmt.Sprintf("%d", r.ChurnRate),
+		fmt.Sprintf("%d", r.ChurnOps),
+		fmt.Sprintf("%d", r.ScanErrors))
+	if l := r.ReadDirLatency; l != nil {
+		row = append(row,
+			fmt.Sprintf("%d", l.Count),
+			fmt.Sprintf("%.1f", float64(l.P50)/float64(time.Microsecond)),
+			fmt.Sprintf("%.1f", float64(l.P95)/float64(time.Microsecond)),
+			fmt.Sprintf("%.1f", float64(l.P99)/float64(time.Microsecond)),
+			fmt.Sprintf("%.1f", float64(l.Max)/float64(time.Microsecond)))
+	} else {
+		row = append(row, "", "", "", "", "")
+	}
+	row = append(row,
+		fmt.Sprintf("%d", r.PermissionErrors),
+		fmt.Sprintf("%d", r.NotFoundErrors),
+		fmt.Sprintf("%d", r.IOErrors),
+		strconv.FormatBool(r.TimedOut),
+		fmt.Sprintf("%d", r.MaxReadDirPerSec),
+		fmt.Sprintf("%.1f", r.ReadDirPerSec),
+		fmt.Sprintf("%.3f", r.ThrottleWait.Seconds()*1000),
+		r.Priority)
+	if run > 0 {
+		row = append(row, strconv.Itoa(run))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row, strconv.Itoa(runs))
+	if r.UserCPU >= 0 && r.SystemCPU >= 0 {
+		row = append(row,
+			fmt.Sprintf("%.3f", r.UserCPU.Seconds()*1000),
+			fmt.Sprintf("%.3f", r.SystemCPU.Seconds()*1000),
+			fmt.Sprintf("%.3f", r.CPUUtilization()))
+	} else {
+		row = append(row, "", "", "")
+	}
+	row = append(row, strconv.FormatUint(r.BytesAllocated, 10))
+	if r.MaxRSS >= 0 {
+		row = append(row, strconv.FormatInt(r.MaxRSS, 10))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row, metadata.Host, metadata.Session, r.Workload,
+		strconv.Itoa(r.CopyWorkers), strconv.FormatInt(r.CopiedFiles, 10), strconv.FormatInt(r.CopiedBytes, 10), strconv.FormatInt(r.CopySkipped, 10))
+	if r.DTypeEntries >= 0 {
+		row = append(row, strconv.FormatInt(r.DTypeEntries, 10), strconv.FormatInt(r.DTypeFallbacks, 10))
+	} else {
+		row = append(row, "", "")
+	}
+	if r.PeakThreads >= 0 {
+		row = append(row, strconv.Itoa(r.PeakThreads))
+	} else {
+		row = append(row, "")
+	}
+	if r.Metrics != nil && r.Metrics.WorkerCPU != nil {
+		row = append(row, formatWorkerCPU(r.Metrics.WorkerCPU, ";"))
+	} else {
+		row = append(row, "")
+	}
+	if r.CPUPeak >= 0 {
+		row = append(row, fmt.Sprintf("%.3f", r.CPUPeak))
+	} else {
+		row = append(row, "")
+	}
+	if r.HostCPU >= 0 {
+		load := ""
+		if r.LoadAvg >= 0 {
+			load = fmt.Sprintf("%.2f", r.LoadAvg)
+		}
+		row = append(row, fmt.Sprintf("%.3f", r.HostCPU), fmt.Sprintf("%.3f", r.OtherCPU), load, strconv.FormatBool(r.Noisy))
+	} else {
+		row = append(row, "", "", "", "")
+	}
+	if r.EnergyJoules >= 0 {
+		row = append(row, fmt.Sprintf("%.3f", r.EnergyJoules))
+	} else {
+		row = append(row, "")
+	}
+	if perJoule := r.FilesPerJoule(); perJoule >= 0 {
+		row = append(row, fmt.Sprintf("%.0f", perJoule))
+	} else {
+		row = append(row, "")
+	}
+	if r.CPUFreqMHz >= 0 {
+		row = append(row, fmt.Sprintf("%.0f", r.CPUFreqMHz), fmt.Sprintf("%.0f", r.CPUFreqMinMHz))
+	} else {
+		row = append(row, "", "")
+	}
+	if r.ThrottleEvents >= 0 {
+		row = append(row, strconv.FormatInt(r.ThrottleEvents, 10))
+	} else {
+		row = append(row, "")
+	}
+	if r.CPUFreqMHz >= 0 || r.ThrottleEvents >= 0 {
+		row = append(row, strconv.FormatBool(r.Throttled))
+	} else {
+		row = append(row, "")
+	}
+	if r.DurationCI >= 0 {
+		row = append(row, fmt.Sprintf("%.3f", float64(r.DurationCI)/float64(time.Millisecond)))
+	} else {
+		row = append(row, "")
+	}
+	if run > 0 {
+		// A run row covers one run, which either is an outlier or not
+		outliers := 0
+		if r.Outlier {
+			outliers = 1
+		}
+		row = append(row, strconv.Itoa(outliers), "")
+	} else {
+		row = append(row, strconv.Itoa(r.Outliers), strconv.Itoa(r.TrimmedRuns))
+	}
+	row = append(row, strconv.Itoa(r.BatchSize), r.Fallback, strconv.Itoa(r.CutoffDepth))
+	if r.GoroutineCap >= 0 {
+		row = append(row, strconv.Itoa(r.GoroutineCap))
+	} else {
+		row = append(row, "")
+	}
+	if r.WorkersPerCPU >= 0 {
+		row = append(row, strconv.FormatFloat(r.WorkersPerCPU, 'f', -1, 64))
+	} else {
+		row = append(row, "")
+	}
+	row = append(row, r.TaskOrder)
+	if r.Straggler >= 0 {
+		row = append(row, fmt.Sprintf("%.3f", r.Straggler.Seconds()*1000))
+	} else {
+		row = append(row, "")
+	}
+	for i := range fileProgressShares {
+		if r.FileProgress != nil {
+			row = append(row, fmt.Sprintf("%.3f", r.FileProgress[i].Seconds()*1000))
+		} else {
+			row = append(row, "")
+		}
+	}
+	row = append(row, r.Counters, strconv.FormatInt(r.StatCalls, 10), strconv.FormatInt(r.StatBytes, 10),
+		r.StatCall, strconv.FormatInt(r.StatFallbacks, 10),
+		strconv.FormatInt(r.XattrFiles, 10), strconv.FormatInt(r.XattrCalls, 10), strconv.FormatInt(r.XattrBytes, 10))
+	for _, n := range r.AgeHistogram {
+		row = append(row, strconv.FormatInt(n, 10))
+	}
+	row = append(row, strconv.FormatInt(r.MemLimit, 10))
+	if r.PeakMemory >= 0 {
+		row = append(row, strconv.FormatInt(r.PeakMemory, 10), strconv.FormatBool(r.GCLimited))
+	} else {
+		row = append(row, "", "")
+	}
+	row = append(row, strconv.FormatBool(r.Stalled), r.Symlinks, r.Filesystem)
+	row = append(row, r.TargetProfile, fmt.Sprintf("%.3f", r.ReadDirDelay.Seconds()*1000), strconv.FormatInt(r.StaleRetries, 10))
+	row = append(row, r.StorageProfile, r.CacheMode)
+	row = append(row, strconv.Itoa(r.MaxInflightIO), fmt.Sprintf("%.3f", r.InflightWait.Seconds()*1000))
+	return row
+}
+
+func main() {
+	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+	var memprofile = flag.String("memprofile", "", "write memory profile to file")
+	var concurrentScans = flag.Int("concurrent-scans", 1, "number of simultaneous scans per benchmark cell")
+	var concurrentRootsMode = flag.String("concurrent-roots", ConcurrentRootsSame, "roots for concurrent scans: same or mixed")
+	var structureList = flag.String("structures", strings.Join(defaultStructures, ","), "comma separated fixture structures: shallow,deep,maildir,logdirs,flat")
+	var sizeFlag = flag.String("size", defaultSize, "fixture size preset: "+strings.Join(sizeNames, ", "))
+	var shallowDirs = flag.Int("shallow-dirs", 0, "directories of the shallow fixture (0 = size preset)")
+	var shallowFiles = flag.Int("shallow-files", 0, "files per directory of the shallow fixture (0 = size preset)")
+	var deepLevels = flag.Int("deep-levels", 0, "directory levels of the deep fixture (0 = size preset)")
+	var deepDirs = flag.Int("deep-dirs", 0, "directories per level and files per leaf of the deep fixture (0 = size preset)")
+	var structureOrder = flag.String("structure-order", StructureOrderGiven, "run order of the structures: given (order of -structures or -paths), name, reverse or random (seeded by -shuffle-seed)")
+	var strategyParamsFile = flag.String("strategy-params", "", "JSON file of per-strategy parameter sets (ChannelCapacity, BatchSize, Fallback, TaskOrder, CutoffDepth, GoroutineCap) applied on top of the command line options")
+	var workerMultiplierList = flag.String("workers-multiplier", defaultWorkerMultipliers, "comma separated worker counts per CPU to run, e.g. 0.5,1,2,4 (a serial run with 1 worker is always added)")
+	var workerList = flag.String("workers", "", "comma separated absolute worker counts to run instead of -workers-multiplier")
+	var strategyList = flag.String("strategies", "", "comma separated strategies to run (default: all available)")
+	var onlyList = flag.String("only", "", "comma separated structure/strategy/workers patterns of the cells to run, e.g. deep/recursive-task/8 (trailing parts may be omitted, * matches anything)")
+	var nameStyleFlag = flag.String("names", NameStyleASCII, "file name style of generated fixtures: ascii or exotic")
+	var specialFiles = flag.Int("special-files", 0, "number of FIFOs, unix sockets and dangling symlinks each to add to every fixture")
+	var hardlinkFiles = flag.Int("hardlink-files", 0, "number of extra hardlinks to existing files to add to every fixture")
+	var xattrFraction = flag.Float64("xattr-fraction", 0, "fraction (0-1) of the files of every fixture given a user.benchmark extended attribute (Linux)")
+	var hardlinkList = flag.String("hardlinks", HardlinksOff, "comma separated hardlink tracking modes to sweep: off,sharded,syncmap")
+	var symlinkMode = flag.String("symlinks", SymlinksFile, "how every strategy counts symlinks to directories: file (like any symlink), dir (as a directory, not listed) or follow (listed like a directory; symlinks to an ancestor are counted but not listed)")
+	var readDirRateList = flag.String("max-readdir-per-sec", "0", "comma separated limits of directory listing calls per second shared by all workers (0 = unlimited)")
+	var inflightList = flag.String("max-inflight-io", "0", "comma separated limits of directory listing calls in flight across all workers to sweep, independently of the worker count (0 = unlimited); e.g. the SMB credits or connections of a share")
+	var readDirDelay = flag.Duration("readdir-delay", 0, "delay added to every directory listing call to simulate the round trip of a FUSE or network filesystem on a local tree (0 = none)")
+	var staleRetries = flag.Int("estale-retries", 0, "retry a directory listing that fails with ESTALE (stale file handle) up to this many times, with a backoff from 10ms")
+	var targetProfile = flag.String("target-profile", TargetProfileLocal, "defaults for the kind of filesystem scanned, applied to the flags not given: "+strings.Join(targetProfileNames, ", ")+" (fuse: timeouts, fewer workers and ESTALE retries for sshfs, s3fs or rclone mounts; fuse-sim: fuse with -readdir-delay 1ms on a local tree)")
+	var storageProfile = flag.String("storage-profile", "", "defaults of worker counts, channel capacity, retries, timeouts and cache mode for a storage class, applied to the flags not given after -target-profile: "+strings.Join(storageProfileNames, ", "))
+	var cacheMode = flag.String("cache-mode", CacheModeWarm, "page cache state of every run: warm (as left by the fixture creation and earlier runs) or cold (sync and drop the page, dentry and inode caches before every run; Linux, requires root)")
+	var niceValue = flag.String("nice", "", "niceness (-20..19) applied to the process before scanning (Linux)")
+	var ioniceValue = flag.String("ionice", "", "I/O scheduling class applied before scanning: idle, best-effort[:0-7] or realtime[:0-7] (Linux)")
+	var churnList = flag.String("churn", "0", "comma separated rates of create/delete/rename operations per second applied while scanning (0 = static tree)")
+	var pathList = flag.String("paths", "", "comma separated existing directories to scan instead of generated fixtures; they are never modified or deleted")
+	var combinePaths = flag.Bool("combine-paths", false, "scan all -paths together in every scan, splitting the workers over them, and report the merged counts with those of every path")
+	var expectFile = flag.String("expect", "", "JSON file with the expected files, dirs and bytes of each scanned tree")
+	var fixtureDirList = flag.String("fixture-dir", ".", "comma separated directories in which fixtures are created (e.g. a tmpfs or network mount); several directories are compared side by side")
+	var overlayLayers = flag.Int("overlay-layers", 0, "also create the fixtures of every -fixture-dir inside an overlayfs mount with this many lower layers, like a container filesystem, and compare it side by side (Linux, root; 0 = off)")
+	var skipDiskCheck = flag.Bool("skip-disk-check", false, "skip the free disk space check before creating fixtures")
+	var dryRun = flag.Bool("dry-run", false, "print the benchmark plan without creating fixtures or scanning")
+	var readDirLatency = flag.Bool("readdir-latency", false, "record a latency histogram of directory listing calls and report p50/p95/p99")
+	var subtreeOrder = flag.String("subtrees", "", "report the files, directories and scan time of every top-level directory, from the directory-based cells with several workers, sorted by time or files (empty = disabled)")
+	var dirTimesTop = flag.Int("dir-times", 0, "record listing time per directory and export the N slowest subtrees (0 = disabled)")
+	var dirTimesFolded = flag.Bool("dir-times-folded", false, "also export per-directory times as folded stacks for flamegraph tools (requires -dir-times)")
+	var scanTimeout = flag.Duration("scan-timeout", 0, "cancel a scan that runs longer than this and report its partial counts (0 = no limit)")
+	var stallTimeout = flag.Duration("stall-timeout", 0, "dump the goroutine stacks to benchmark/ and cancel a scan that finds no directory or file for this long, then skip the rest of its cell (0 = off)")
+	var progressInterval = flag.Duration("progress", 0, "print the files and directories counted so far at this interval during each scan (0 = disabled)")
+	var progressFiles = flag.Int64("progress-files", 0, "also print the counts so far every this many files found (0 = disabled)")
+	var significance = flag.Bool("significance", true, "test whether each cell differs significantly from the fastest cell of the same structure and worker count (Welch's t-test and Mann-Whitney U test on the run durations)")
+	var outlierK = flag.Float64("outlier-k", defaultOutlierK, "flag runs whose duration deviates more than this many median absolute deviations from the median of their cell (0 = off, needs 3 runs)")
+	var trimOutliers = flag.Bool("trim-outliers", false, "exclude the runs flagged by -outlier-k from the averages of their cell")
+	var minTime = flag.Duration("min-time", 0, "repeat each cell until its runs add up to this duration, like go test -benchtime (0 = fixed 3 runs)")
+	var ciTarget = flag.Float64("ci-target", 0, "repeat each cell until the 95% confidence interval of its mean duration is within this percentage of the mean (0 = off)")
+	var maxRuns = flag.Int("max-runs", defaultMaxRuns, "upper limit of runs per cell with -min-time or -ci-target")
+	var shuffle = flag.Bool("shuffle", false, "run the cells in random order and interleave their repetitions, one round over all cells per run, to spread cache warming and thermal drift evenly")
+	var shuffleSeed = flag.Int64("shuffle-seed", 0, "seed of the -shuffle order (0 = random, printed for reproduction)")
+	var cellTimeout = flag.Duration("cell-timeout", 0, "stop the runs of a benchmark cell once it runs longer than this (0 = no limit)")
+	var formatList = flag.String("format", FormatCSV, "comma separated result file formats: "+outputFormatsHelp())
+	var sortFlag = flag.String("sort", SortNone, "order of the summary table within each structure: duration or speedup (default: run order)")
+	var noColor = flag.Bool("no-color", false, "do not highlight the fastest cell of the summary table (also disabled by NO_COLOR or when stdout is not a terminal)")
+	var quiet = flag.Bool("quiet", false, "print only the final summary table; progress and fixture output are discarded and errors go to stderr")
+	var quietPaths = flag.Bool("quiet-paths", false, "like -quiet but print only the paths of the written result files, one per line")
+	var failOnMismatch = flag.Bool("fail-on-mismatch", false, "exit with code 3 when file, directory or byte counts differ from the expected values")
+	var maxScanErrors = flag.Int64("max-scan-errors", -1, "exit with code 4 when a cell has more read errors than this (-1 = no limit)")
+	var baselineFile = flag.String("baseline", "", "results file (.csv or .json) of a previous run to check for performance regressions")
+	var maxRegression = flag.Float64("max-regression", 0, "exit with code 5 when a cell is slower than -baseline by more than this many percent (0 = not checked)")
+	var appendFile = flag.String("append", "", "also append the results to this file across invocations: a .json file keeps metadata and runs, any other name is a CSV of per-cell rows")
+	var influxURL = flag.String("influx-url", "", "InfluxDB write URL to push results to as line protocol, e.g. http://localhost:8086/api/v2/write?org=lab&bucket=bench")
+	var influxToken = flag.String("influx-token", os.Getenv("INFLUX_TOKEN"), "InfluxDB API token (default: $INFLUX_TOKEN)")
+	var otlpEndpoint = flag.String("otlp-endpoint", "", "OTLP/HTTP metrics URL to push results to, e.g. http://localhost:4318/v1/metrics")
+	var otlpHeaderList = flag.String("otlp-headers", "", "comma separated key=value headers sent with OTLP requests")
+	var trackHeap = flag.Bool("track-heap", false, "sample the peak heap size per run")
+	var memLimitFlag = flag.String("mem-limit", "", "set the Go soft memory limit, e.g. 256MiB, and report per cell whether the scans stayed within it and whether the GC was throttled (empty = no limit)")
+	var verifyVisits = flag.Bool("verify-visits", false, "debug mode: record the (dev, inode) of every directory each scan lists and report directories listed twice, missed or outside a serial reference walk (Unix)")
+	var trackStragglers = flag.Bool("track-stragglers", false, "measure the straggler time of each run, the time between 95% of the directories and the end of the scan, and when 50, 90, 99 and 100% of the files had been found (on with -task-order priority)")
+	var chunkList = flag.String("readdir-chunk", strconv.Itoa(defaultReadDirChunk), "comma separated entries per ReadDir call to sweep for the chunked listing mode")
+	var trackFDs = flag.Bool("track-fds", false, "sample the peak number of open file descriptors per run")
+	var hostCPU = flag.Bool("host-cpu", false, "measure the CPU use of the whole host and the load average during each scan and flag results disturbed by other processes (Linux)")
+	var noisyThreshold = flag.Float64("noisy-threshold", defaultNoisyThreshold, "percentage of all CPUs other processes may use during a scan before its result is flagged as noisy (with -host-cpu)")
+	var energy = flag.Bool("energy", false, "measure the energy used by the CPU packages during each scan from the RAPL counters and report files per joule (Linux, usually requires root)")
+	var trackFreq = flag.Bool("track-freq", false, "sample the CPU clock and thermal throttling counters during each scan and flag cells that ran at reduced clocks (Linux)")
+	var freqDropThreshold = flag.Float64("freq-drop-threshold", defaultFreqDropThreshold, "percentage by which the mean clock of a cell may fall below the fastest cell before it is flagged (with -track-freq)")
+	var cpuSampleInterval = flag.Duration("cpu-sample-interval", 0, "sample the CPU utilization of the process at this interval during each scan and report the peak (0 = disabled)")
+	var workerCPU = flag.Bool("worker-cpu", false, "attribute CPU time to each worker by pinning it to its OS thread while busy (Linux; implies -instrument)")
+	var trackThreads = flag.Bool("track-threads", false, "sample the peak number of OS threads per run; blocking directory reads make the runtime start extra threads")
+	var goroutineCap = flag.Int("max-goroutines", defaultGoroutineCap, "safety cap of directories read concurrently by the unbounded strategy (0 = no limit)")
+	var taskOrderList = flag.String("task-order", TaskOrderFIFO, "comma separated orders to sweep in which task channel strategies take pending directories: fifo (breadth-first), lifo (depth-first) or priority (most subdirectories first)")
+	var counterList = flag.String("counters", CountersShared, "comma separated counter modes to sweep for the directory-based and recursive-task strategies: shared (atomic counters shared by all workers) or per-worker (one result per worker, merged at the end)")
+	var capacityList = flag.String("channel-capacity", strconv.Itoa(defaultChannelCapacity), "comma separated task channel capacities to sweep for recursive-task strategies")
+	var listingList = flag.String("listings", defaultListing, "comma separated directory listing modes: readdir,sorted,names,chunked,dtype,inode")
+	var instrument = flag.Bool("instrument", false, "record queue depth, worker busy ratios and inline fallbacks")
+	var tui = flag.Bool("tui", false, "show a live dashboard of per-worker activity while scanning")
+	var externalList = flag.String("external-baselines", "", "comma separated external tools to compare against: find,fd,du")
+	var workloadFlag = flag.String("workload", WorkloadScan, "work done on the scanned entries: scan, stat (lstat every entry on the worker that found it), xattr (read the extended attributes of every file, Linux), age (bucket the files by mtime age), delete (removes generated fixtures with each strategy, compared with os.RemoveAll) or copy (mirrors the trees into -dest); scan, stat, xattr and age can be swept together, e.g. scan,stat,age")
+	var statCallList = flag.String("stat-call", StatCallLstat, "comma separated calls of the stat workload: lstat, or statx asking only for the type and size (Linux amd64/arm64, falls back to lstat on kernels without statx)")
+	var copyDest = flag.String("dest", "", "directory the copy workload writes its copies to; each tree is copied to a new subdirectory named after it")
+	var copyWorkerList = flag.String("copy-workers", "0", "comma separated sizes of a separate copier pool to sweep for the copy workload (0 = scan workers copy the files themselves)")
+	var ioUring = flag.Bool("io-uring", false, "also run the experimental io_uring strategy, which batches the subdirectory opens of the openat strategy (Linux)")
+	var mft = flag.Bool("mft", false, "also run the experimental mft strategy, which counts the entries of the tree from the file records of its NTFS volume read with FSCTL_ENUM_USN_DATA (Windows, administrator)")
+	flag.Parse()
+
+	if flag.NArg() > 0 && flag.Arg(0) == "report" {
+		os.Exit(runReport(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "clean" {
+		os.Exit(runClean(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "cache" {
+		os.Exit(runCache(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "tune" {
+		os.Exit(runTune(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "scan" {
+		os.Exit(runScanCommand(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "cancel" {
+		os.Exit(runCancel(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "watch" {
+		os.Exit(runWatch(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "snapshot" {
+		os.Exit(runSnapshot(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "list" {
+		os.Exit(runList(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "diff" {
+		os.Exit(runDiff(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "dupes" {
+		os.Exit(runDupes(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "top" {
+		os.Exit(runTop(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "quota" {
+		os.Exit(runQuota(flag.Args()[1:]))
+	}
+
+	// Registered first so that it runs after every other deferred cleanup
+	exitCode := ExitOK
+	defer func() { os.Exit(exitCode) }()
+
+	// The profile only changes defaults, so it is applied before any flag is read
+	profileSettings, err := applyTargetProfile(flag.CommandLine, *targetProfile)
+	if err != nil {
+		fmt.Printf("エラー: -target-profile: %v\n", err)
+		os.Exit(1)
+	}
+	storageSettings, err := applyStorageProfile(flag.CommandLine, *storageProfile)
+	if err != nil {
+		fmt.Printf("エラー: -storage-profile: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Setup CPU profiling
+	if *cpuprofile != "" {
+		// Create prof directory if not exists
+		profDir := filepath.Dir(*cpuprofile)
+		if profDir != "." && profDir != "" {
+			if err := os.MkdirAll(profDir, 0755); err != nil {
+				fmt.Printf("プロファイルディレクトリ作成エラー: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			fmt.Printf("CPUプロファイル作成エラー: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Printf("CPUプロファイル開始エラー: %v\n", err)
+			os.Exit(1)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	// The positional dev argument predates -size and still selects its preset
+	size := *sizeFlag
+	for _, arg := range flag.Args() {
+		if arg == SizeDev {
+			size = SizeDev
+			break
+		}
+	}
+	config, err := sizeConfig(size)
+	if err != nil {
+		fmt.Printf("エラー: -size: %v\n", err)
+		os.Exit(1)
+	}
+	customSize, err := SizeOverrides{
+		ShallowDirs:      *shallowDirs,
+		ShallowFiles:     *shallowFiles,
+		DeepLevels:       *deepLevels,
+		DeepDirsPerLevel: *deepDirs,
+	}.apply(&config)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+	size = sizeLabel(size, customSize)
+
+	nameStyle, err := parseNameStyle(*nameStyleFlag)
+	if err != nil {
+		fmt.Printf("エラー: -names: %v\n", err)
+		os.Exit(1)
+	}
+	config.NameStyle = nameStyle
+	config.SpecialFiles = *specialFiles
+	config.HardlinkFiles = *hardlinkFiles
+	if *xattrFraction < 0 || *xattrFraction > 1 {
+		fmt.Println("エラー: -xattr-fraction は0から1の範囲で指定してください")
+		os.Exit(1)
+	}
+	if *xattrFraction > 0 && !xattrSupported {
+		fmt.Println("エラー: -xattr-fraction は Linux でのみ使用できます")
+		os.Exit(1)
+	}
+	config.XattrFraction = *xattrFraction
+
+	sortOrder, err := parseSortOrder(*sortFlag)
+	if err != nil {
+		fmt.Printf("エラー: -sort: %v\n", err)
+		os.Exit(1)
+	}
+	policy := exitPolicy{FailOnMismatch: *failOnMismatch, MaxScanErrors: *maxScanErrors, MaxRegression: *maxRegression}
+	if *maxRegression < 0 || (*maxRegression > 0 && *baselineFile == "") {
+		fmt.Println("エラー: -max-regression には正の値と -baseline が必要です")
+		os.Exit(1)
+	}
+	if *baselineFile != "" {
+		if policy.baseline, err = loadBaseline(*baselineFile); err != nil {
+			fmt.Printf("エラー: -baseline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Decided before -quiet replaces stdout
+	color := colorEnabled(*noColor)
+	if *quiet || *quietPaths {
+		if *tui {
+			fmt.Println("エラー: -tui は -quiet と併用できません")
+			os.Exit(1)
+		}
+		if *dryRun {
+			fmt.Println("エラー: -dry-run は -quiet と併用できません")
+			os.Exit(1)
+		}
+	}
+
+	listings, err := parseListings(*listingList)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	workloads, err := parseWorkloads(*workloadFlag)
+	if err != nil {
+		fmt.Printf("エラー: -workload: %v\n", err)
+		os.Exit(1)
+	}
+	// The first workload is the base of the cells; the read-only workloads are swept
+	workload := workloads[0]
+
+	var activity *ActivityMonitor
+	if *tui {
+		if *concurrentScans > 1 {
+			fmt.Println("エラー: -tui は -concurrent-scans と同時に使用できません")
+			os.Exit(1)
+		}
+		activity = NewActivityMonitor()
+	}
+	var memLimit int64
+	if *memLimitFlag != "" {
+		if memLimit, err = parseByteSize(*memLimitFlag); err != nil || memLimit == 0 {
+			fmt.Printf("エラー: -mem-limit: %s (例: 256MiB)\n", *memLimitFlag)
+			os.Exit(1)
+		}
+		debug.SetMemoryLimit(memLimit)
+	}
+	if *progressInterval < 0 || *progressFiles < 0 {
+		fmt.Println("エラー: -progress と -progress-files には0以上を指定してください")
+		os.Exit(1)
+	}
+	if *stallTimeout < 0 {
+		fmt.Println("エラー: -stall-timeout には0以上を指定してください")
+		os.Exit(1)
+	}
+	if *tui && (*progressInterval > 0 || *progressFiles > 0) {
+		fmt.Println("エラー: -progress・-progress-files は -tui と併用できません")
+		os.Exit(1)
+	}
+
+	multipliers, err := parseWorkerMultipliers(*workerMultiplierList)
+	if err != nil {
+		fmt.Printf("エラー: -workers-multiplier: %v\n", err)
+		os.Exit(1)
+	}
+	workerCounts := multipliedWorkerCounts(multipliers, runtime.NumCPU())
+	if *workerList != "" {
+		if workerCounts, err = parseIntList(*workerList); err != nil {
+			fmt.Printf("エラー: -workers: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	capacities, err := parseIntList(*capacityList)
+	if err != nil {
+		fmt.Printf("エラー: -channel-capacity: %v\n", err)
+		os.Exit(1)
+	}
+
+	taskOrders, err := parseTaskOrders(*taskOrderList)
+	if err != nil {
+		fmt.Printf("エラー: -task-order: %v\n", err)
+		os.Exit(1)
+	}
+
+	statCalls, err := parseStatCalls(*statCallList)
+	if err != nil {
+		fmt.Printf("エラー: -stat-call: %v\n", err)
+		os.Exit(1)
+	}
+	if (len(statCalls) > 1 || statCalls[0] != StatCallLstat) && !slices.Contains(workloads, WorkloadStat) {
+		fmt.Println("エラー: -stat-call は -workload stat と同時に指定してください")
+		os.Exit(1)
+	}
+
+	counterModes, err := parseCounterModes(*counterList)
+	if err != nil {
+		fmt.Printf("エラー: -counters: %v\n", err)
+		os.Exit(1)
+	}
+
+	hardlinkModes, err := parseHardlinkModes(*hardlinkList)
+	if err != nil {
+		fmt.Printf("エラー: -hardlinks: %v\n", err)
+		os.Exit(1)
+	}
+
+	churnRates, err := parseChurnRates(*churnList)
+	if err != nil {
+		fmt.Printf("エラー: -churn: %v\n", err)
+		os.Exit(1)
+	}
+
+	priority, err := parsePriority(*niceValue, *ioniceValue)
+	if err != nil {
+		fmt.Printf("エラー: -nice/-ionice: %v\n", err)
+		os.Exit(1)
+	}
+
+	formats, err := parseFormats(*formatList)
+	if err != nil {
+		fmt.Printf("エラー: -format: %v\n", err)
+		os.Exit(1)
+	}
+
+	otlpHeaders, err := parseHeaders(*otlpHeaderList)
+	if err != nil {
+		fmt.Printf("エラー: -otlp-headers: %v\n", err)
+		os.Exit(1)
+	}
+
+	readDirRates, err := parseReadDirRates(*readDirRateList)
+	if err != nil {
+		fmt.Printf("エラー: -max-readdir-per-sec: %v\n", err)
+		os.Exit(1)
+	}
+	inflightLimits, err := parseInflightLimits(*inflightList)
+	if err != nil {
+		fmt.Printf("エラー: -max-inflight-io: %v\n", err)
+		os.Exit(1)
+	}
+	if *readDirDelay < 0 || *staleRetries < 0 {
+		fmt.Println("エラー: -readdir-delay と -estale-retries は0以上を指定してください")
+		os.Exit(1)
+	}
+	if !slices.Contains(cacheModeNames, *cacheMode) {
+		fmt.Printf("エラー: 不明な -cache-mode: %s (%s)\n", *cacheMode, strings.Join(cacheModeNames, ", "))
+		os.Exit(1)
+	}
+	if *cacheMode == CacheModeCold && !*dryRun {
+		if err := checkDropCaches(); err != nil {
+			if !slices.Contains(storageSettings, profileSetting{"cache-mode", CacheModeCold}) {
+				fmt.Printf("エラー: -cache-mode cold: キャッシュを破棄できません: %v\n", err)
+				os.Exit(1)
+			}
+			// A default of the profile that cannot be honored is not an error
+			fmt.Printf("警告: キャッシュを破棄できないため、-cache-mode warm で実行します: %v\n", err)
+			*cacheMode = CacheModeWarm
+		}
+	}
+
+	chunks, err := parseIntList(*chunkList)
+	if err != nil {
+		fmt.Printf("エラー: -readdir-chunk: %v\n", err)
+		os.Exit(1)
+	}
+
+	baselines, err := parseExternalBaselines(*externalList)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	structures, err := parseStructures(*structureList)
+	if err != nil {
+		fmt.Printf("エラー: -structures: %v\n", err)
+		os.Exit(1)
+	}
+
+	fixtureDirs, err := parseFixtureDirs(*fixtureDirList)
+	if err != nil {
+		fmt.Printf("エラー: -fixture-dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	userPaths, err := parseUserPaths(*pathList)
+	if err != nil {
+		fmt.Printf("エラー: -paths: %v\n", err)
+		os.Exit(1)
+	}
+	if len(userPaths) > 0 {
+		// Real trees must never be changed, and they have no fixture to plan
+		for _, rate := range churnRates {
+			if rate > 0 {
+				fmt.Println("エラー: -churn は -paths と併用できません")
+				os.Exit(1)
+			}
+		}
+		if len(fixtureDirs) > 1 || fixtureDirs[0] != "." {
+			fmt.Println("エラー: -fixture-dir は -paths と併用できません")
+			os.Exit(1)
+		}
+		if *dryRun {
+			fmt.Println("エラー: -dry-run は -paths と併用できません")
+			os.Exit(1)
+		}
+		if *overlayLayers > 0 {
+			fmt.Println("エラー: -overlay-layers は -paths と併用できません")
+			os.Exit(1)
+		}
+		// Each path takes the place of a structure and is labeled by itself
+		structures = userPaths
+		if *combinePaths {
+			// All paths form one target, labeled by the path list
+			structures = []string{combinedRootsLabel(userPaths)}
+		}
+	}
+	if *combinePaths {
+		switch {
+		case len(userPaths) < 2:
+			fmt.Println("エラー: -combine-paths には -paths で2つ以上のディレクトリが必要です")
+			os.Exit(1)
+		case *concurrentScans > 1, *externalList != "", workloadWrites(workload):
+			fmt.Println("エラー: -combine-paths は -concurrent-scans・-external-baselines・-workload と併用できません")
+			os.Exit(1)
+		case *instrument, *workerCPU, *tui, *dirTimesTop > 0:
+			// The scanners of the roots number their workers from 0 each
+			fmt.Println("エラー: -combine-paths は -instrument・-worker-cpu・-tui・-dir-times と併用できません")
+			os.Exit(1)
+		}
+	}
+	if workloadWrites(workload) {
+		// Every run changes a tree, so it must be restored and nothing else may use it
+		switch {
+		case *concurrentScans > 1:
+			fmt.Printf("エラー: -workload %s は -concurrent-scans と併用できません\n", workload)
+			os.Exit(1)
+		case *externalList != "":
+			fmt.Printf("エラー: -workload %s は -external-baselines と併用できません\n", workload)
+			os.Exit(1)
+		case *niceValue != "" || *ioniceValue != "":
+			fmt.Printf("エラー: -workload %s は -nice/-ionice と併用できません\n", workload)
+			os.Exit(1)
+		}
+	}
+	if workload == WorkloadDelete {
+		if len(userPaths) > 0 {
+			fmt.Println("エラー: -workload delete は -paths と併用できません（生成したテストデータだけを削除します）")
+			os.Exit(1)
+		}
+		for _, rate := range churnRates {
+			if rate > 0 {
+				fmt.Println("エラー: -workload delete は -churn と併用できません")
+				os.Exit(1)
+			}
+		}
+	}
+	if *overlayLayers != 0 {
+		switch {
+		case *overlayLayers < 0:
+			fmt.Println("エラー: -overlay-layers は0以上を指定してください")
+			os.Exit(1)
+		case !overlaySupported:
+			fmt.Println("エラー: -overlay-layers はLinuxでのみ使用できます")
+			os.Exit(1)
+		case workload == WorkloadDelete:
+			// Regenerating a fixture through the mount would write it to the upper layer
+			fmt.Println("エラー: -overlay-layers は -workload delete と併用できません")
+			os.Exit(1)
+		}
+	}
+	copyWorkerCounts := []int{0}
+	if workload == WorkloadCopy {
+		if *copyDest == "" {
+			fmt.Println("エラー: -workload copy には -dest が必要です")
+			os.Exit(1)
+		}
+		if copyWorkerCounts, err = parseCopyWorkers(*copyWorkerList); err != nil {
+			fmt.Printf("エラー: -copy-workers: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *copyDest != "" {
+		fmt.Println("エラー: -dest は -workload copy でのみ使用できます")
+		os.Exit(1)
+	}
+	if *energy && !readEnergy().ok {
+		fmt.Println("エラー: -energy にはRAPLのエネルギーカウンタ（/sys/class/powercap/intel-rapl:*/energy_uj）の読み取り権限が必要です（Linuxのみ、通常はroot）")
+		os.Exit(1)
+	}
+	if _, ok := readCPUFreq(); *trackFreq && !ok {
+		fmt.Println("エラー: -track-freq にはcpufreq（/sys/devices/system/cpu/cpu*/cpufreq/scaling_cur_freq）が必要です（Linuxのみ、仮想マシンでは通常使用できません）")
+		os.Exit(1)
+	}
+	if *subtreeOrder != "" && *subtreeOrder != SubtreeSortTime && *subtreeOrder != SubtreeSortFiles {
+		fmt.Printf("エラー: -subtrees: %s (%s, %s)\n", *subtreeOrder, SubtreeSortTime, SubtreeSortFiles)
+		os.Exit(1)
+	}
+	if *minTime < 0 || *ciTarget < 0 || *maxRuns < 1 {
+		fmt.Println("エラー: -min-time と -ci-target は0以上、-max-runs は1以上を指定してください")
+		os.Exit(1)
+	}
+	if *workerCPU && !threadCPUSupported {
+		fmt.Println("エラー: -worker-cpu はLinuxでのみ使用できます")
+		os.Exit(1)
+	}
+	if *verifyVisits && !hardlinksSupported {
+		fmt.Println("エラー: -verify-visits はUnixでのみ使用できます")
+		os.Exit(1)
+	}
+	symlinks, err := parseSymlinkMode(*symlinkMode)
+	if err != nil {
+		fmt.Printf("エラー: -symlinks: %v\n", err)
+		os.Exit(1)
+	}
+	if symlinks != SymlinksFile {
+		switch {
+		case workload == WorkloadDelete || workload == WorkloadCopy:
+			fmt.Printf("エラー: -symlinks %s は -workload %s と併用できません（シンボリックリンクの先を変更しないため）\n", symlinks, workload)
+			os.Exit(1)
+		case *externalList != "":
+			fmt.Printf("エラー: -symlinks %s は -external-baselines と併用できません（外部ツールは設定に従いません）\n", symlinks)
+			os.Exit(1)
+		case *verifyVisits && symlinks == SymlinksFollow:
+			fmt.Println("エラー: -symlinks follow は -verify-visits と併用できません（基準の走査はシンボリックリンクをたどりません）")
+			os.Exit(1)
+		}
+	}
+	if *ioUring {
+		if !slices.Contains(workloads, WorkloadScan) {
+			fmt.Printf("エラー: -io-uring は -workload %s と併用できません\n", workload)
+			os.Exit(1)
+		}
+		// Rings may be disabled by kernel.io_uring_disabled or seccomp
+		ring, err := newUring(uringEntries)
+		if err != nil {
+			fmt.Printf("エラー: -io-uring: %v\n", err)
+			os.Exit(1)
+		}
+		ring.Close()
+	}
+	if *mft {
+		switch {
+		case !mftSupported:
+			fmt.Println("エラー: -mft はWindowsでのみ使用できます")
+			os.Exit(1)
+		case !slices.Contains(workloads, WorkloadScan):
+			fmt.Printf("エラー: -mft は -workload %s と併用できません\n", workload)
+			os.Exit(1)
+		case symlinks != SymlinksFile:
+			fmt.Printf("エラー: -mft は -symlinks %s と併用できません（ファイルレコードはシンボリックリンクの先を解決しません）\n", symlinks)
+			os.Exit(1)
+		}
+	}
+
+	strategies := []string{StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled, StrategyUnbounded}
+	// openat and io_uring only run the scan of a -workload scan,stat sweep
+	if openatSupported && slices.Contains(workloads, WorkloadScan) {
+		strategies = append(strategies, StrategyOpenat)
+	}
+	if *ioUring {
+		strategies = append(strategies, StrategyUring)
+	}
+	if *mft {
+		strategies = append(strategies, StrategyMFT)
+	}
+	// getattrlistbulk and FindFirstFileEx only run the scan and the stat workload
+	if slices.Contains(workloads, WorkloadScan) || slices.Contains(workloads, WorkloadStat) {
+		if bulkAttrSupported {
+			strategies = append(strategies, StrategyBulkAttr)
+		}
+		if findFileSupported {
+			strategies = append(strategies, StrategyFindFile)
+		}
+	}
+	if workload == WorkloadDelete {
+		strategies = append(strategies, StrategyRemoveAll)
+	}
+	if *strategyList != "" {
+		if strategies, err = filterStrategies(*strategyList, strategies); err != nil {
+			fmt.Printf("エラー: -strategies: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	params := strategyParamSets{}
+	if *strategyParamsFile != "" {
+		if params, err = loadStrategyParams(*strategyParamsFile); err != nil {
+			fmt.Printf("エラー: -strategy-params: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	only, err := parseCellFilter(*onlyList, strategies)
+	if err != nil {
+		fmt.Printf("エラー: -only: %v\n", err)
+		os.Exit(1)
+	}
+	// Fixtures without a selected cell are neither generated nor scanned
+	if structures = only.structures(structures); len(structures) == 0 {
+		fmt.Println("エラー: -only に一致する構造がありません")
+		os.Exit(1)
+	}
+	orderSeed := *shuffleSeed
+	if orderSeed == 0 {
+		orderSeed = time.Now().UnixNano()
+	}
+	if structures, err = orderStructures(structures, *structureOrder, rand.New(rand.NewSource(orderSeed))); err != nil {
+		fmt.Printf("エラー: -structure-order: %v\n", err)
+		os.Exit(1)
+	}
+
+	expects := expectations{}
+	if *expectFile != "" {
+		if expects, err = loadExpectations(*expectFile); err != nil {
+			fmt.Printf("エラー: -expect: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var quietOut *quietOutput
+	if *quiet || *quietPaths {
+		if quietOut, err = startQuiet(); err != nil {
+			fmt.Printf("エラー: -quiet: %v\n", err)
+			os.Exit(1)
+		}
+		defer quietOut.Close()
+	}
+
+	fmt.Println("ディレクトリスキャン並列化ベンチマーク")
+	fmt.Printf("サイズ: %s\n", size)
+	fmt.Printf("CPU数: %d\n", runtime.NumCPU())
+	fmt.Printf("ワーカー数: %s\n", joinInts(workerCounts))
+	if len(profileSettings) > 0 {
+		fmt.Printf("ターゲットプロファイル: %s (%s)\n", *targetProfile, profileSettingsLabel(profileSettings))
+	} else if *targetProfile != TargetProfileLocal {
+		fmt.Printf("ターゲットプロファイル: %s\n", *targetProfile)
+	}
+	if len(storageSettings) > 0 {
+		fmt.Printf("ストレージプロファイル: %s (%s)\n", *storageProfile, profileSettingsLabel(storageSettings))
+	} else if *storageProfile != "" {
+		fmt.Printf("ストレージプロファイル: %s\n", *storageProfile)
+	}
+	if *cacheMode != CacheModeWarm {
+		fmt.Printf("キャッシュ: %s（実行ごとにページキャッシュを破棄）\n", *cacheMode)
+	}
+	if *readDirDelay > 0 {
+		fmt.Printf("一覧の呼び出しごとの遅延: %v\n", *readDirDelay)
+	}
+	if *structureOrder != StructureOrderGiven {
+		fmt.Printf("構造の実行順: %s (%s)\n", strings.Join(structures, ", "), *structureOrder)
+	}
+	if len(userPaths) > 0 {
+		fmt.Printf("スキャン対象: %s\n", strings.Join(userPaths, ", "))
+	} else if len(fixtureDirs) > 1 || fixtureDirs[0] != "." {
+		fmt.Printf("テストデータ作成先: %s\n", strings.Join(fixtureDirs, ", "))
+	}
+	if *concurrentScans > 1 {
+		fmt.Printf("同時スキャン数: %d (%s)\n", *concurrentScans, *concurrentRootsMode)
+	}
+	if workload == WorkloadCopy {
+		fmt.Printf("ワークロード: %s (コピー先: %s)\n", workload, *copyDest)
+	} else if len(workloads) > 1 || workload != WorkloadScan {
+		fmt.Printf("ワークロード: %s\n", strings.Join(workloads, ", "))
+	}
+	fmt.Println("=====================================")
+
+	// Setup test data, one copy per target
+	targetTestDirs := map[string][]testDir{}
+	for _, dir := range fixtureDirs {
+		targetTestDirs[dir] = fixtureTestDirs(dir, structures)
+	}
+	if len(userPaths) > 0 {
+		userTestDirs := []testDir{}
+		for _, path := range structures {
+			userTestDirs = append(userTestDirs, testDir{path, path})
+		}
+		targetTestDirs[fixtureDirs[0]] = userTestDirs
+	}
+	if workload == WorkloadCopy {
+		roots := []string{}
+		for _, testDirs := range targetTestDirs {
+			for _, d := range testDirs {
+				roots = append(roots, d.Path)
+			}
+		}
+		if err := checkCopyDest(*copyDest, roots); err != nil {
+			fmt.Printf("エラー: -dest: %v\n", err)
+			quietOut.Close()
+			os.Exit(1)
+		}
+	}
+
+	// Run multiple times and take average
+	const numRuns = 3
+
+	baseOptions := defaultScanOptions()
+	baseOptions.Activity = activity
+	baseOptions.Instrument = *instrument
+	baseOptions.GoroutineCap = *goroutineCap
+	baseOptions.TrackFDs = *trackFDs
+	baseOptions.TrackThreads = *trackThreads
+	baseOptions.WorkerCPU = *workerCPU
+	baseOptions.CPUSampleInterval = *cpuSampleInterval
+	baseOptions.HostCPU = *hostCPU
+	baseOptions.NoisyThreshold = *noisyThreshold
+	baseOptions.Energy = *energy
+	baseOptions.TrackFreq = *trackFreq
+	baseOptions.OutlierK = *outlierK
+	baseOptions.TrimOutliers = *trimOutliers
+	baseOptions.MinTime = *minTime
+	baseOptions.CITarget = *ciTarget / 100
+	baseOptions.MaxRuns = *maxRuns
+	baseOptions.TrackHeap = *trackHeap || memLimit > 0
+	baseOptions.MemLimit = memLimit
+	baseOptions.TrackStragglers = *trackStragglers || slices.Contains(taskOrders, TaskOrderPriority)
+	baseOptions.VerifyVisits = *verifyVisits
+	baseOptions.Symlinks = symlinks
+	baseOptions.ScanTimeout = *scanTimeout
+	baseOptions.StallTimeout = *stallTimeout
+	baseOptions.ReadDirDelay = *readDirDelay
+	baseOptions.StaleRetries = *staleRetries
+	baseOptions.CacheMode = *cacheMode
+	if *progressInterval > 0 || *progressFiles > 0 {
+		baseOptions.Snapshots = printSnapshot
+		baseOptions.SnapshotInterval = *progressInterval
+		baseOptions.SnapshotFiles = *progressFiles
+	}
+	baseOptions.CellTimeout = *cellTimeout
+	baseOptions.ReadDirLatency = *readDirLatency
+	baseOptions.DirTimes = *dirTimesTop > 0
+	baseOptions.Subtrees = *subtreeOrder != ""
+	baseOptions.Workload = workload
+	baseOptions.CopyDest = *copyDest
+	if *combinePaths {
+		baseOptions.Roots = userPaths
+	}
+
+	axes := SweepAxes{
+		Listings:   listings,
+		Capacities: capacities,
+		TaskOrders: taskOrders,
+		Counters:   counterModes,
+		Workloads:  workloads,
+		StatCalls:  statCalls,
+		Chunks:     chunks,
+		Hardlinks:  hardlinkModes,
+		ChurnRates: churnRates,
+
+		ReadDirRates:   readDirRates,
+		InflightLimits: inflightLimits,
+		CopyWorkers:    copyWorkerCounts,
+	}
+
+	if *dryRun {
+		printPlan(BenchmarkPlan{
+			Config:          config,
+			FixtureDirs:     fixtureDirs,
+			Structures:      structures,
+			Strategies:      strategies,
+			WorkerCounts:    workerCounts,
+			Only:            only,
+			Params:          params,
+			BaseOptions:     baseOptions,
+			Axes:            axes,
+			Baselines:       baselines,
+			NumRuns:         numRuns,
+			ConcurrentScans: *concurrentScans,
+		})
+		return
+	}
+
+	// Each fixture directory gets an overlayfs target next to it
+	overlays := map[string]*overlayTarget{}
+	if *overlayLayers > 0 {
+		for _, dir := range slices.Clone(fixtureDirs) {
+			ov, err := newOverlayTarget(dir, *overlayLayers)
+			if err != nil {
+				fmt.Printf("エラー: -overlay-layers: %v\n", err)
+				exitCode = ExitError
+				return
+			}
+			fixtureDirs = append(fixtureDirs, ov.merged())
+			targetTestDirs[ov.merged()] = fixtureTestDirs(ov.merged(), structures)
+			overlays[ov.merged()] = ov
+		}
+	}
+
+	// Real trees given by -paths are neither set up, generated nor deleted
+	createDirs := fixtureDirs
+	if len(userPaths) > 0 {
+		createDirs = nil
+	}
+
+	if workload == WorkloadCopy {
+		if err := os.MkdirAll(*copyDest, 0755); err != nil {
+			fmt.Printf("エラー: -dest: %v\n", err)
+			quietOut.Close()
+			os.Exit(1)
+		}
+	}
+
+	for _, fixtureDir := range createDirs {
+		if err := os.MkdirAll(fixtureDir, 0755); err != nil {
+			fmt.Printf("テストデータ作成先の作成エラー: %v\n", err)
+			quietOut.Close()
+			os.Exit(1)
+		}
+
+		if config.NameStyle == NameStyleExotic {
+			if nfd, err := probeNFDNormalization(fixtureDir); err != nil {
+				fmt.Printf("ファイル名の正規化を確認できません (%s): %v\n", fixtureDir, err)
+			} else if nfd {
+				fmt.Printf("ファイル名の正規化 (%s): NFDに変換されます\n", fixtureDir)
+			} else {
+				fmt.Printf("ファイル名の正規化 (%s): 変換されません\n", fixtureDir)
+			}
+		}
+
+		if !*skipDiskCheck {
+			var requiredBytes int64
+			for _, d := range targetTestDirs[fixtureDir] {
+				files, dirs := expectedCounts(d.Structure, config)
+				requiredBytes += estimateFixtureBytes(files, dirs)
+			}
+			if err := checkDiskSpace(fixtureDir, requiredBytes); err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				fmt.Println("(-skip-disk-check で確認を省略できます)")
+				quietOut.Close()
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Create test data
+	for _, fixtureDir := range createDirs {
+		if ov := overlays[fixtureDir]; ov != nil {
+			// Unmounts and removes the layers however the benchmark ends
+			defer func() {
+				if err := ov.remove(); err != nil {
+					fmt.Printf("エラー: %v\n", err)
+				}
+			}()
+			for _, d := range targetTestDirs[fixtureDir] {
+				fmt.Printf("\n%s構造のテストデータを作成中 (overlayfs %d層: %s)...\n", d.Structure, ov.layers, ov.root)
+				if err := ov.build(d.Structure, config); err != nil {
+					fmt.Printf("エラー: %v\n", err)
+					exitCode = ExitError
+					return
+				}
+			}
+			if err := ov.mount(); err != nil {
+				fmt.Printf("エラー: -overlay-layers: %v（root権限が必要です）\n", err)
+				exitCode = ExitError
+				return
+			}
+			continue
+		}
+		for _, d := range targetTestDirs[fixtureDir] {
+			structure, dirPath := d.Structure, d.Path
+			fmt.Printf("\n%s構造のテストデータを作成中 (%s)...\n", structure, dirPath)
+			if err := generateFixture(dirPath, structure, config); err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				exitCode = ExitError
+				return
+			}
+
+			// Verify file count
+			expectedFiles, _ := expectedCounts(structure, config)
+			fmt.Printf("期待されるファイル数: %d\n", expectedFiles)
+		}
+	}
+
+	// Run benchmarks
+	results := []BenchmarkResult{}
+
+	checkFDLimits(strategies, workerCounts, baseOptions, params, *concurrentScans)
+
+	// mismatches counts verification warnings for -fail-on-mismatch
+	mismatches := 0
+
+	// Sizes are not collected by the scanners, so expected bytes are checked once per tree
+	for _, fixtureDir := range fixtureDirs {
+		for _, d := range targetTestDirs[fixtureDir] {
+			structure, dirPath := d.Structure, d.Path
+			expected, ok := expects.lookup(dirPath, structure)
+			if !ok || expected.Bytes == nil {
+				continue
+			}
+			var bytes int64
+			for _, root := range scannedRoots(dirPath, baseOptions) {
+				bytes += treeBytes(root)
+			}
+			if bytes != *expected.Bytes {
+				fmt.Printf("警告: %s のバイト数が一致しません (期待: %d, 実際: %d)\n", dirPath, *expected.Bytes, bytes)
+				mismatches++
+			} else {
+				fmt.Printf("%s のバイト数: %d (期待値と一致)\n", dirPath, bytes)
+			}
+		}
+	}
+
+	if priority.IsSet() {
+		dirPath := testDirPath(targetTestDirs[fixtureDirs[0]], structures[0])
+		workers := workerCounts[len(workerCounts)-1]
+		if err := measurePriorityEffect(priority, dirPath, structures[0], workers, baseOptions, numRuns); err != nil {
+			fmt.Printf("エラー: -nice/-ionice: %v\n", err)
+			exitCode = ExitError
+			return
+		}
+	}
+
+	fmt.Println("\n===== ベンチマーク実行 =====")
+
+	// cellOptions adds the per-run preparation of the workload to a cell's options
+	cellOptions := func(options ScanOptions, dirPath, structure string) ScanOptions {
+		if workload == WorkloadDelete {
+			// Each run deletes the fixture, so it is regenerated before every run
+			options.Prepare = func() error { return generateFixture(dirPath, structure, config) }
+		} else if workload == WorkloadCopy {
+			// The copy did not exist before the benchmark, so it is ours to remove
+			mirror := copyMirror(*copyDest, dirPath)
+			options.Prepare = func() error { return os.RemoveAll(mirror) }
+		}
+		return options
+	}
+
+	var schedule *cellSchedule
+	var shuffleSeedUsed int64
+	if *shuffle {
+		shuffleSeedUsed = *shuffleSeed
+		if shuffleSeedUsed == 0 {
+			shuffleSeedUsed = time.Now().UnixNano()
+		}
+		fmt.Printf("\n実行順をシャッフルします (シード: %d)\n", shuffleSeedUsed)
+		schedule = newCellSchedule(shuffleSeedUsed)
+		for _, fixtureDir := range fixtureDirs {
+			testDirs := targetTestDirs[fixtureDir]
+			for _, d := range testDirs {
+				structure, dirPath := d.Structure, d.Path
+				roots, err := concurrentRoots(dirPath, testDirs, *concurrentScans, *concurrentRootsMode)
+				if err != nil {
+					// Reported when the structure's results are collected
+					continue
+				}
+				for _, strategy := range strategies {
+					for _, options := range params.variants(strategy, baseOptions, axes) {
+						options = cellOptions(options, dirPath, structure)
+						for _, workers := range only.workers(structure, strategy, strategyWorkerCounts(strategy, workerCounts)) {
+							schedule.add(newBenchmarkCell(dirPath, roots, structure, strategy, workers, options))
+						}
+					}
+				}
+			}
+		}
+		schedule.run(numRuns)
+	}
+
+	for _, fixtureDir := range fixtureDirs {
+		testDirs := targetTestDirs[fixtureDir]
+		target := ""
+		if len(fixtureDirs) > 1 {
+			target = fixtureDir
+		}
+
+		for _, d := range testDirs {
+			structure, dirPath := d.Structure, d.Path
+			if target != "" {
+				fmt.Printf("\n構造: %s (%s)\n", structure, target)
+			} else {
+				fmt.Printf("\n構造: %s\n", structure)
+			}
+			filesystem, _ := filesystemType(dirPath)
+			if filesystem != "" {
+				fmt.Printf("ファイルシステム: %s\n", filesystem)
+			}
+
+			roots, err := concurrentRoots(dirPath, testDirs, *concurrentScans, *concurrentRootsMode)
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				exitCode = ExitError
+				return
+			}
+
+			// Serial duration of the first strategy, used as reference for external tools
+			var structureBaseline time.Duration
+
+			for _, strategy := range strategies {
+				cellWorkers := only.workers(structure, strategy, strategyWorkerCounts(strategy, workerCounts))
+				if len(cellWorkers) == 0 {
+					continue
+				}
+				for _, options := range params.variants(strategy, baseOptions, axes) {
+					options = cellOptions(options, dirPath, structure)
+					if variant := optionsLabel(strategy, options); variant != "" {
+						fmt.Printf("\n戦略: %s [%s]\n", strategy, variant)
+					} else {
+						fmt.Printf("\n戦略: %s\n", strategy)
+					}
+
+					// Store baseline for speedup calculation
+					var baselineDuration time.Duration
+
+					for _, workers := range cellWorkers {
+						if strategy == StrategyRemoveAll {
+							fmt.Printf("  ベンチマーク実行中...")
+						} else if workers == 0 {
+							fmt.Printf("  ワーカー数 無制限 でベンチマーク実行中...")
+						} else {
+							fmt.Printf("  ワーカー数 %d でベンチマーク実行中...", workers)
+						}
+						if options.Snapshots != nil {
+							// Progress lines go below the cell line
+							fmt.Println()
+						}
+
+						var result *BenchmarkResult
+						if cell := schedule.lookup(dirPath, strategy, workers, options); cell != nil {
+							result, err = cell.result()
+						} else {
+							result, err = runBenchmarkCell(dirPath, roots, structure, strategy, workers, options, numRuns)
+						}
+						if err != nil {
+							fmt.Printf("\n  エラー: %v\n", err)
+							continue
+						}
+
+						// Calculate speedup; partial scans are not comparable
+						if result.TimedOut {
+							result.Speedup = 0
+						} else if workers == 1 {
+							baselineDuration = result.Duration
+							if structureBaseline == 0 {
+								structureBaseline = result.Duration
+							}
+							result.Speedup = 1.0
+						} else if baselineDuration > 0 {
+							result.Speedup = float64(baselineDuration) / float64(result.Duration)
+						} else if structureBaseline > 0 {
+							// Strategies without a worker count compare against the serial scan
+							result.Speedup = float64(structureBaseline) / float64(result.Duration)
+						}
+
+						result.Target = target
+						result.Filesystem = filesystem
+						result.TargetProfile = *targetProfile
+						result.StorageProfile = *storageProfile
+						result.CacheMode = *cacheMode
+						result.Priority = priority.String()
+						results = append(results, *result)
+
+						// Verify counts against -expect, or the fixture formula
+						expected, hasExpected := expects.lookup(dirPath, structure)
+						if !hasExpected && len(userPaths) == 0 {
+							files, _ := expectedCounts(structure, config)
+							expectedFiles := int64(files)
+							expected, hasExpected = ExpectedCounts{Files: &expectedFiles}, true
+						}
+
+						if result.Stalled {
+							fmt.Printf(" 停止: %s の間進まないため中断しました", options.StallTimeout)
+							if result.Abandoned {
+								fmt.Printf("（スキャンが停止しないため結果を破棄）")
+							} else {
+								fmt.Printf(" 部分結果 (ファイル: %d, ディレクトリ: %d)", result.FilesScanned, result.DirsScanned)
+							}
+							fmt.Printf(" ゴルーチンのスタック: %s", result.StallDump)
+						} else if result.Abandoned {
+							fmt.Printf(" タイムアウト: スキャンが停止しないため結果を破棄しました")
+						} else if result.TimedOut {
+							fmt.Printf(" タイムアウト: 部分結果 (ファイル: %d, ディレクトリ: %d)",
+								result.FilesScanned, result.DirsScanned)
+						} else if result.ChurnRate > 0 {
+							// The tree changes during the scan, so counts are not exact
+							fmt.Printf(" 変更操作: %d", result.ChurnOps)
+						} else if strategy == StrategyRemoveAll {
+							// os.RemoveAll does not report what it removed
+
+						} else if mismatch := expected.mismatch(result.FilesScanned, result.DirsScanned); hasExpected && mismatch != "" {
+							fmt.Printf(" 警告: %s", mismatch)
+							mismatches++
+						}
+						if options.calibrated() {
+							fmt.Printf(" 実行回数: %d", len(result.runs))
+						}
+						if result.TrimmedRuns > 0 {
+							fmt.Printf(" 外れ値: %d回 (除外)", result.TrimmedRuns)
+						} else if result.Outliers > 0 {
+							fmt.Printf(" 外れ値: %d回", result.Outliers)
+						}
+						if result.ScanErrors > 0 {
+							fmt.Printf(" 読み取りエラー: %d (権限: %d, 存在しない: %d, I/O: %d)",
+								result.ScanErrors, result.PermissionErrors, result.NotFoundErrors, result.IOErrors)
+							if result.FirstError != "" {
+								fmt.Printf(" 例: %s", result.FirstError)
+							}
+						}
+						if workload == WorkloadCopy && !result.TimedOut {
+							fmt.Printf(" コピー: %d ファイル, %s (%s/s)", result.CopiedFiles, formatBytes(result.CopiedBytes),
+								formatBytes(int64(float64(result.CopiedBytes)/result.Duration.Seconds())))
+							if result.CopySkipped > 0 {
+								fmt.Printf(" 特殊ファイルを除外: %d", result.CopySkipped)
+							}
+							if copied := result.CopiedFiles + result.CopySkipped; copied != int64(result.FilesScanned) {
+								fmt.Printf(" 警告: コピーしたファイル数が一致しません (スキャン: %d, コピー: %d)", result.FilesScanned, copied)
+								mismatches++
+							}
+						}
+						if result.Workload == WorkloadStat && !result.TimedOut {
+							fmt.Printf(" %s: %d 回, %s (%.0f回/s)", result.StatCall, result.StatCalls, formatBytes(result.StatBytes),
+								float64(result.StatCalls)/result.Duration.Seconds())
+							if result.StatFallbacks > 0 {
+								fmt.Printf(" 警告: statx を使用できないため %d 件を lstat で読みました", result.StatFallbacks)
+							}
+							if entries := int64(result.FilesScanned + result.DirsScanned); result.ScanErrors == 0 && result.ChurnRate == 0 && result.StatCalls != entries {
+								fmt.Printf(" 警告: statしたエントリ数が一致しません (スキャン: %d, stat: %d)", entries, result.StatCalls)
+								mismatches++
+							}
+						}
+						if result.Workload == WorkloadAge && !result.TimedOut {
+							var files int64
+							buckets := []string{}
+							for i, n := range result.AgeHistogram {
+								files += n
+								buckets = append(buckets, fmt.Sprintf("%s %d", ageBucketNames[i], n))
+							}
+							fmt.Printf(" 更新日時: %s", strings.Join(buckets, ", "))
+							if result.ScanErrors == 0 && result.ChurnRate == 0 && files != int64(result.FilesScanned) {
+								fmt.Printf(" 警告: 分類したファイル数が一致しません (スキャン: %d, 分類: %d)", result.FilesScanned, files)
+								mismatches++
+							}
+						}
+						if result.Workload == WorkloadXattr && !result.TimedOut {
+							fmt.Printf(" xattr: 属性のあるファイル %d, %s, 呼び出し %d 回 (%.0f回/s)", result.XattrFiles, formatBytes(result.XattrBytes),
+								result.XattrCalls, float64(result.XattrCalls)/result.Duration.Seconds())
+						}
+						if workload == WorkloadDelete && !result.TimedOut {
+							if _, err := os.Lstat(dirPath); err == nil {
+								fmt.Printf(" 警告: 削除後もテストデータが残っています")
+								mismatches++
+							}
+						}
+						if len(userPaths) == 0 && result.ChurnRate == 0 && result.UniqueFiles >= 0 && hardlinksSupported && strategy != StrategyRemoveAll {
+							expectedFiles, _ := expectedCounts(structure, config)
+							if result.UniqueFiles != expectedFiles-config.HardlinkFiles {
+								fmt.Printf(" 警告: 重複排除後のファイル数が一致しません (期待: %d, 実際: %d)",
+									expectedFiles-config.HardlinkFiles, result.UniqueFiles)
+								mismatches++
+							}
+						}
+						if result.Visits != nil && !result.TimedOut && result.ChurnRate == 0 {
+							if s := result.Visits.String(); s != "" {
+								fmt.Printf(" 警告: %s", s)
+								mismatches++
+							} else {
+								fmt.Printf(" 走査の検証: 一致")
+							}
+						}
+						if len(result.Roots) > 0 {
+							fmt.Printf(" ルート別: %s", formatRootResults(result.Roots))
+						}
+						if result.PeakFDs >= 0 {
+							fmt.Printf(" 最大FD数: %d", result.PeakFDs)
+						}
+						if result.PeakThreads >= 0 {
+							fmt.Printf(" 最大スレッド数: %d", result.PeakThreads)
+						}
+						if result.CPUPeak >= 0 {
+							fmt.Printf(" CPUピーク: %.2fコア", result.CPUPeak)
+						}
+						if result.HostCPU >= 0 {
+							fmt.Printf(" ホストCPU: %.2fコア (他のプロセス: %.2f)", result.HostCPU, result.OtherCPU)
+							if result.Noisy {
+								fmt.Print(" 警告: ノイズの多い環境")
+							}
+						}
+						if result.EnergyJoules >= 0 {
+							fmt.Printf(" エネルギー: %.2fJ", result.EnergyJoules)
+							if perJoule := result.FilesPerJoule(); perJoule >= 0 {
+								fmt.Printf(" (%.0fファイル/J)", perJoule)
+							}
+						}
+						if result.CPUFreqMHz >= 0 {
+							fmt.Printf(" クロック: %.0fMHz (最低 %.0f)", result.CPUFreqMHz, result.CPUFreqMinMHz)
+						}
+						if result.ThrottleEvents > 0 {
+							fmt.Printf(" 警告: サーマルスロットリング %d回", result.ThrottleEvents)
+						}
+						if m := result.Metrics; m != nil && len(m.WorkerCPU) > 1 {
+							fmt.Printf(" ワーカーCPU(ms): %s (偏り %.2fx)", formatWorkerCPU(m.WorkerCPU, "/"), m.WorkerCPUSkew())
+						}
+						if result.UniqueFiles >= 0 {
+							fmt.Printf(" 重複排除後: %d", result.UniqueFiles)
+						}
+						if result.DTypeEntries >= 0 {
+							fmt.Printf(" d_type未設定: %d/%d", result.DTypeFallbacks, result.DTypeEntries)
+						}
+						if l := result.ReadDirLatency; l != nil {
+							fmt.Printf(" ReadDir p50/p95/p99: %v/%v/%v", l.P50, l.P95, l.P99)
+						}
+						if result.PeakHeap >= 0 {
+							fmt.Printf(" 最大ヒープ: %s", formatBytes(result.PeakHeap))
+						}
+						fmt.Print(memLimitStatus(result))
+						if result.Straggler >= 0 {
+							fmt.Printf(" 終盤の遅延: %v", result.Straggler.Round(10*time.Microsecond))
+						}
+						if p := result.FileProgress; p != nil {
+							fmt.Printf(" ファイル発見 50/90/99/100%%: %v/%v/%v/%v", p[0].Round(10*time.Microsecond),
+								p[1].Round(10*time.Microsecond), p[2].Round(10*time.Microsecond), p[3].Round(10*time.Microsecond))
+						}
+						fmt.Printf(" 完了 (%.3fs %s, speedup: %.2fx)\n",
+							result.Duration.Seconds(), formatCI(result.DurationCI), result.Speedup)
+					}
+				}
+			}
+
+			if len(baselines) > 0 {
+				fmt.Printf("\n外部ツール比較\n")
+			}
+			for _, baseline := range baselines {
+				fmt.Printf("  %s を実行中...", baseline.Name)
+
+				var totalDuration time.Duration
+				var result *BenchmarkResult
+				runs := []BenchmarkResult{}
+				for i := 0; i < numRuns; i++ {
+					if *cacheMode == CacheModeCold {
+						if err := dropCaches(); err != nil {
+							fmt.Printf(" スキップ: %v\n", err)
+							result = nil
+							break
+						}
+					}
+					r, err := runExternalBenchmark(dirPath, structure, baseline)
+					if err != nil {
+						fmt.Printf(" スキップ: %v\n", err)
+						result = nil
+						break
+					}
+					totalDuration += r.Duration
+					runs = append(runs, *r)
+					result = r
+				}
+				if result == nil {
+					continue
+				}
+
+				result.Duration = totalDuration / numRuns
+				result.DurationCI = durationCI(runs)
+				result.UserCPU, result.SystemCPU = averageCPU(runs)
+				result.runs = runs
+				if structureBaseline > 0 {
+					result.Speedup = float64(structureBaseline) / float64(result.Duration)
+				}
+				result.Target = target
+				result.Filesystem = filesystem
+				result.TargetProfile = *targetProfile
+				result.StorageProfile = *storageProfile
+				result.CacheMode = *cacheMode
+				result.Priority = priority.String()
+				results = append(results, *result)
+				fmt.Printf(" 完了 (%.3fs %s, speedup: %.2fx)\n",
+					result.Duration.Seconds(), formatCI(result.DurationCI), result.Speedup)
+			}
+		}
+	}
+
+	// Display results
+	fmt.Println("\n===== ベンチマーク結果サマリー =====")
+	if !*quietPaths {
+		printSummary(quietOut.Stdout(), results, sortOrder, color)
+	}
+
+	if *instrument || *workerCPU {
+		printMetrics(results)
+	}
+
+	if len(listings) > 1 {
+		printListingDelta(results, listings[0])
+	}
+
+	if len(readDirRates) > 1 || readDirRates[0] > 0 {
+		printThrottleSummary(results)
+	}
+	if len(inflightLimits) > 1 || inflightLimits[0] > 0 {
+		printInflightMatrix(results, inflightLimits)
+	}
+
+	printOutlierSummary(results, *trimOutliers)
+	if *significance {
+		printSignificanceSummary(results)
+	}
+	if *trackFreq {
+		reference := markThrottled(results, *freqDropThreshold)
+		printClockSummary(results, reference, *freqDropThreshold)
+	}
+	printDTypeSummary(results)
+	printWorkloadOverhead(results)
+	if *subtreeOrder != "" {
+		printSubtreeReport(results, *subtreeOrder)
+	}
+	if *hostCPU {
+		printNoisySummary(results, *noisyThreshold)
+	}
+	if *energy {
+		printEnergySummary(results)
+	}
+
+	// Export to CSV
+	// Create benchmark directory if not exists
+	written := []string{}
+	benchmarkDir := "benchmark"
+	if err := os.MkdirAll(benchmarkDir, 0755); err != nil {
+		fmt.Printf("\nベンチマークディレクトリ作成エラー: %v\n", err)
+	} else {
+		session := time.Now().Format("20060102_150405")
+		metadata := newSessionMetadata(session, size, config.IsDevelopment)
+		metadata.ShuffleSeed = shuffleSeedUsed
+		base := fmt.Sprintf("%s/benchmark_results_%s", benchmarkDir, session)
+		csvFilename := base + ".csv"
+		fmt.Println()
+		for _, format := range formats {
+			files, err := format.writer.Write(newResultsSession(metadata, results), base)
+			for _, f := range files {
+				fmt.Printf("%s: %s\n", f.description, f.path)
+				written = append(written, f.path)
+			}
+			if err != nil {
+				fmt.Printf("\n%s出力エラー: %v\n", format.label, err)
+			}
+		}
+
+		if *appendFile != "" {
+			if err := appendResults(*appendFile, newResultsSession(metadata, results)); err != nil {
+				fmt.Printf("\n追記エラー: %v\n", err)
+			} else {
+				fmt.Printf("結果を追記しました: %s\n", *appendFile)
+				written = append(written, *appendFile)
+			}
+		}
+
+		if *instrument {
+			queueFilename := strings.Replace(csvFilename, "benchmark_results_", "queue_depth_", 1)
+			if err := exportQueueSamplesToCSV(results, queueFilename); err != nil {
+				fmt.Printf("\nCSV出力エラー: %v\n", err)
+			} else {
+				fmt.Printf("キュー深さの時系列を出力しました: %s\n", queueFilename)
+				written = append(written, queueFilename)
+			}
+		}
+
+		if *subtreeOrder != "" {
+			subtreesFilename := strings.Replace(csvFilename, "benchmark_results_", "subtrees_", 1)
+			if err := exportSubtreesToCSV(results, *subtreeOrder, subtreesFilename); err != nil {
+				fmt.Printf("\nCSV出力エラー: %v\n", err)
+			} else {
+				fmt.Printf("トップレベルのディレクトリ別の結果を出力しました: %s\n", subtreesFilename)
+				written = append(written, subtreesFilename)
+			}
+		}
+
+		if *dirTimesTop > 0 {
+			dirTimesFilename := strings.Replace(csvFilename, "benchmark_results_", "dir_times_", 1)
+			if err := exportDirTimesToCSV(results, *dirTimesTop, dirTimesFilename); err != nil {
+				fmt.Printf("\nCSV出力エラー: %v\n", err)
+			} else {
+				fmt.Printf("遅いサブツリーの一覧を出力しました: %s\n", dirTimesFilename)
+				written = append(written, dirTimesFilename)
+			}
+			if *dirTimesFolded {
+				foldedFilename := strings.TrimSuffix(dirTimesFilename, ".csv") + ".folded"
+				if err := exportDirTimesFolded(results, foldedFilename); err != nil {
+					fmt.Printf("\nfolded出力エラー: %v\n", err)
+				} else {
+					fmt.Printf("ディレクトリ別の時間をfolded形式で出力しました: %s\n", foldedFilename)
+					written = append(written, foldedFilename)
+				}
+			}
+		}
+	}
+
+	if *influxURL != "" {
+		if err := pushInflux(*influxURL, *influxToken, results); err != nil {
+			fmt.Printf("\nInfluxDBへの送信エラー: %v\n", err)
+		} else {
+			fmt.Printf("結果をInfluxDBに送信しました: %s\n", *influxURL)
+		}
+	}
+	if *otlpEndpoint != "" {
+		if err := pushOTLP(*otlpEndpoint, otlpHeaders, results); err != nil {
+			fmt.Printf("\nOTLPへの送信エラー: %v\n", err)
+		} else {
+			fmt.Printf("結果をOTLPで送信しました: %s\n", *otlpEndpoint)
+		}
+	}
+
+	// Cleanup
+	if workload == WorkloadCopy {
+		for _, testDirs := range targetTestDirs {
+			for _, d := range testDirs {
+				os.RemoveAll(copyMirror(*copyDest, d.Path))
+			}
+		}
+	}
+	if len(userPaths) == 0 {
+		fmt.Println("\nテストデータを削除中...")
+		for dir, testDirs := range targetTestDirs {
+			// Overlay targets are removed with their layers after unmounting
+			if overlays[dir] != nil {
+				continue
+			}
+			for _, d := range testDirs {
+				os.RemoveAll(d.Path)
+			}
+		}
+		fmt.Println("完了")
+	}
+
+	if *quietPaths {
+		for _, filename := range written {
+			fmt.Fprintln(quietOut.Stdout(), filename)
+		}
+	}
+
+	exitCode = policy.evaluate(results, mismatches)
 
 	// Write memory profile if requested
 	if *memprofile != "" {
@@ -573,12 +3300,14 @@ func main() {
 		if profDir != "." && profDir != "" {
 			if err := os.MkdirAll(profDir, 0755); err != nil {
 				fmt.Printf("プロファイルディレクトリ作成エラー: %v\n", err)
+				exitCode = ExitError
 				return
 			}
 		}
 		f, err := os.Create(*memprofile)
 		if err != nil {
 			fmt.Printf("メモリプロファイル作成エラー: %v\n", err)
+			exitCode = ExitError
 			return
 		}
 		defer f.Close()
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Runtime metrics of the memory the soft memory limit applies to and of the
+// GC CPU limiter, which caps the GC once it runs too often to stay within it
+const (
+	memTotalMetric    = "/memory/classes/total:bytes"
+	memReleasedMetric = "/memory/classes/heap/released:bytes"
+	gcCyclesMetric    = "/gc/cycles/total:gc-cycles"
+	gcLimiterMetric   = "/gc/limiter/last-enabled:gc-cycle"
+)
+
+// byteSizeUnits are the suffixes of parseByteSize, as in GOMEMLIMIT
+var byteSizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+}
+
+// parseByteSize parses a size such as 256MiB, 1GiB or 1048576
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	scale := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, scale = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 256MiB, 1GiB)", s)
+	}
+	if n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * scale, nil
+}
+
+// memLimitStatus describes the memory use of a result against the limit for
+// the cell line, empty when no limit is set
+func memLimitStatus(r *BenchmarkResult) string {
+	if r.MemLimit <= 0 || r.PeakMemory < 0 {
+		return ""
+	}
+	status := fmt.Sprintf(" メモリ: %s / 上限 %s", formatBytes(r.PeakMemory), formatBytes(r.MemLimit))
+	if r.PeakMemory > r.MemLimit {
+		status += " 警告: メモリ上限を超過"
+	}
+	if r.GCLimited {
+		status += " (GCリミッタ作動)"
+	}
+	return status
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// heapSampleInterval is the sampling interval of the heap size
+const heapSampleInterval = time.Millisecond
+
+// heapMetric is the runtime metric sampled by heapTracker. Unlike
+// runtime.ReadMemStats it can be read without stopping the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// heapTracker samples the heap size and keeps the peak growth over the live
+// heap at the start. It also keeps the peak of the memory the soft memory
+// limit applies to and the GC cycle at the start, to tell whether the GC CPU
+// limiter was engaged during the scan.
+type heapTracker struct {
+	base       int64
+	peak       int64
+	peakMemory int64
+	startCycle uint64
+	sample     []metrics.Sample
+	stop       chan struct{}
+	finished   chan struct{}
+}
+
+// startHeapTracker collects garbage left by earlier runs and starts sampling
+// the heap size in the background
+func startHeapTracker() *heapTracker {
+	t := &heapTracker{
+		sample:   []metrics.Sample{{Name: heapMetric}, {Name: memTotalMetric}, {Name: memReleasedMetric}, {Name: gcCyclesMetric}, {Name: gcLimiterMetric}},
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	runtime.GC()
+	t.base = t.read()
+	t.peak = t.base
+	t.peakMemory = t.memory()
+	t.startCycle = t.uint64(3)
+
+	go func() {
+		defer close(t.finished)
+		ticker := time.NewTicker(heapSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := t.read(); n > t.peak {
+					t.peak = n
+				}
+				t.peakMemory = max(t.peakMemory, t.memory())
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// read reads the metrics and returns the heap size
+func (t *heapTracker) read() int64 {
+	metrics.Read(t.sample)
+	return int64(t.uint64(0))
+}
+
+// memory returns the memory the soft memory limit applies to, as of the last read
+func (t *heapTracker) memory() int64 {
+	return int64(t.uint64(1)) - int64(t.uint64(2))
+}
+
+// uint64 returns a metric of the last read, 0 when the runtime lacks it
+func (t *heapTracker) uint64(i int) uint64 {
+	if t.sample[i].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return t.sample[i].Value.Uint64()
+}
+
+// Stop stops sampling and returns the peak heap growth in bytes
+func (t *heapTracker) Stop() int64 {
+	close(t.stop)
+	<-t.finished
+	if n := t.read(); n > t.peak {
+		t.peak = n
+	}
+	t.peakMemory = max(t.peakMemory, t.memory())
+	return t.peak - t.base
+}
+
+// limits returns the peak memory the soft memory limit applies to and
+// whether the GC CPU limiter was engaged since the start, after Stop
+func (t *heapTracker) limits() (peakMemory int64, gcLimited bool) {
+	return t.peakMemory, t.uint64(4) > t.startCycle
+}
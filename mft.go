@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// StrategyMFT counts the entries of a tree from the MFT records of its NTFS
+// volume, read with FSCTL_ENUM_USN_DATA, instead of listing directories
+// (experimental, Windows, administrator)
+const StrategyMFT = "mft"
+
+// usnRecordV2Size is the fixed part of USN_RECORD_V2, up to FileName
+const usnRecordV2Size = 60
+
+// mftRecord is the parent and attributes of a file record
+type mftRecord struct {
+	parent     uint64
+	attributes uint32
+}
+
+// mftIndex maps the file reference numbers of a volume to their records.
+// Each file has one record whatever its hard links.
+type mftIndex map[uint64]mftRecord
+
+// addUSNRecords adds the USN_RECORD_V2 records that FSCTL_ENUM_USN_DATA
+// wrote to buf, after the next start reference it returns first
+func (idx mftIndex) addUSNRecords(buf []byte) (next uint64, err error) {
+	ne := binary.NativeEndian
+	if len(buf) < 8 {
+		return 0, fmt.Errorf("USN data of %d bytes", len(buf))
+	}
+	next, buf = ne.Uint64(buf), buf[8:]
+	for len(buf) > 0 {
+		if len(buf) < usnRecordV2Size {
+			return 0, fmt.Errorf("USN record of %d bytes", len(buf))
+		}
+		length := int(ne.Uint32(buf))
+		if length < usnRecordV2Size || length > len(buf) {
+			return 0, fmt.Errorf("malformed USN record of %d bytes", length)
+		}
+		if major := ne.Uint16(buf[4:]); major != 2 {
+			return 0, fmt.Errorf("USN record version %d, only 2 (NTFS) is supported", major)
+		}
+		idx[ne.Uint64(buf[8:])] = mftRecord{parent: ne.Uint64(buf[16:]), attributes: ne.Uint32(buf[52:])}
+		buf = buf[length:]
+	}
+	return next, nil
+}
+
+// count returns the files and directories below root, root included, the
+// way the scanners count them: reparse points, symlinks and junctions among
+// them, are files whose records are not descended. ctxErr stops the count
+// of a cancelled scan.
+func (idx mftIndex) count(root uint64, ctxErr func() error) (files, dirs int64, err error) {
+	// below caches whether the children of a record are in the tree
+	below := map[uint64]bool{root: true}
+	var inTree func(ref uint64) bool
+	inTree = func(ref uint64) bool {
+		if in, ok := below[ref]; ok {
+			return in
+		}
+		// Guards against a cycle of corrupt records
+		below[ref] = false
+		r, ok := idx[ref]
+		if !ok || r.parent == ref || r.attributes&fileAttributeDirectory == 0 || r.attributes&fileAttributeReparsePoint != 0 {
+			return false
+		}
+		in := inTree(r.parent)
+		below[ref] = in
+		return in
+	}
+
+	dirs = 1
+	n := 0
+	for ref, r := range idx {
+		if n++; n%65536 == 0 {
+			if err := ctxErr(); err != nil {
+				return 0, 0, err
+			}
+		}
+		if ref == root || !inTree(r.parent) {
+			continue
+		}
+		if r.attributes&fileAttributeDirectory != 0 && r.attributes&fileAttributeReparsePoint == 0 {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	return files, dirs, nil
+}
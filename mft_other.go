@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// mftSupported reports whether the MFT strategy is available
+const mftSupported = false
+
+// newMFTScanner returns the MFT strategy, only implemented on Windows
+func newMFTScanner(numWorkers int, options ScanOptions) strategyScanner {
+	return unsupportedScanner{errors.New("the mft strategy is only supported on Windows")}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// packUSNRecord packs a USN_RECORD_V2 with its name, padded to eight bytes
+func packUSNRecord(ref, parent uint64, attributes uint32, name string) []byte {
+	ne := binary.NativeEndian
+	b := make([]byte, usnRecordV2Size, usnRecordV2Size+2*len(name)+8)
+	ne.PutUint16(b[4:], 2)
+	ne.PutUint64(b[8:], ref)
+	ne.PutUint64(b[16:], parent)
+	ne.PutUint32(b[52:], attributes)
+	ne.PutUint16(b[56:], uint16(2*len(name)))
+	ne.PutUint16(b[58:], usnRecordV2Size)
+	for _, c := range name {
+		b = binary.LittleEndian.AppendUint16(b, uint16(c))
+	}
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	ne.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func TestAddUSNRecords(t *testing.T) {
+	buf := binary.NativeEndian.AppendUint64(nil, 42)
+	buf = append(buf, packUSNRecord(10, 5, fileAttributeDirectory, "dir")...)
+	buf = append(buf, packUSNRecord(11, 10, 0x20, "file.txt")...)
+
+	idx := mftIndex{}
+	next, err := idx.addUSNRecords(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 42 {
+		t.Errorf("next = %d, want 42", next)
+	}
+	want := mftIndex{10: {parent: 5, attributes: fileAttributeDirectory}, 11: {parent: 10, attributes: 0x20}}
+	if len(idx) != len(want) || idx[10] != want[10] || idx[11] != want[11] {
+		t.Errorf("index = %v, want %v", idx, want)
+	}
+
+	record := packUSNRecord(10, 5, 0, "a")
+	v3 := append([]byte(nil), record...)
+	binary.NativeEndian.PutUint16(v3[4:], 3)
+	for name, data := range map[string][]byte{
+		"truncated":       record[:len(record)-8],
+		"short record":    record[:usnRecordV2Size-1],
+		"unknown version": v3,
+	} {
+		if _, err := (mftIndex{}).addUSNRecords(append(binary.NativeEndian.AppendUint64(nil, 0), data...)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestMFTIndexCount(t *testing.T) {
+	const dir, reparseDir = fileAttributeDirectory, fileAttributeDirectory | fileAttributeReparsePoint
+	idx := mftIndex{
+		5: {parent: 5, attributes: dir}, // the volume root is its own parent
+		// root/{a/{f1, f2, b/{f3}}, junction, link, f4}
+		10: {parent: 5, attributes: dir},
+		11: {parent: 10, attributes: dir},
+		12: {parent: 11, attributes: 0x20},
+		13: {parent: 11, attributes: 0x20},
+		14: {parent: 11, attributes: dir},
+		15: {parent: 14, attributes: 0x20},
+		16: {parent: 10, attributes: reparseDir},
+		17: {parent: 10, attributes: fileAttributeReparsePoint},
+		18: {parent: 10, attributes: 0x20},
+		// Below the junction only through its own record
+		19: {parent: 16, attributes: 0x20},
+		// Outside the root
+		20: {parent: 5, attributes: 0x20},
+		21: {parent: 99, attributes: 0x20},
+		// A cycle of corrupt records
+		30: {parent: 31, attributes: dir},
+		31: {parent: 30, attributes: dir},
+		32: {parent: 31, attributes: 0x20},
+	}
+	noCancel := func() error { return nil }
+	files, dirs, err := idx.count(10, noCancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 6 || dirs != 3 {
+		t.Errorf("count(10) = %d files, %d dirs, want 6 and 3", files, dirs)
+	}
+	if files, dirs, _ := idx.count(14, noCancel); files != 1 || dirs != 1 {
+		t.Errorf("count(14) = %d files, %d dirs, want 1 and 1", files, dirs)
+	}
+
+	// Cancellation is checked every 65536 records
+	big := mftIndex{}
+	for i := uint64(0); i < 70000; i++ {
+		big[i+100] = mftRecord{parent: 5}
+	}
+	cancelled := errors.New("cancelled")
+	if _, _, err := big.count(5, func() error { return cancelled }); err != cancelled {
+		t.Errorf("cancelled count returned %v, want %v", err, cancelled)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// mftSupported reports whether the MFT strategy is available
+const mftSupported = true
+
+// fsctlEnumUSNData is FSCTL_ENUM_USN_DATA, which the syscall package does
+// not define
+const fsctlEnumUSNData = 0x000900b3
+
+// mftBufferSize is the buffer each FSCTL_ENUM_USN_DATA call fills, several
+// thousand records
+const mftBufferSize = 1 << 20
+
+// mftEnumData is MFT_ENUM_DATA_V0
+type mftEnumData struct {
+	StartFileReferenceNumber uint64
+	LowUsn                   int64
+	HighUsn                  int64
+}
+
+// mftScanner reads the file records of the whole volume of the root and
+// counts those below the root. Its time grows with the volume, not the tree.
+type mftScanner struct {
+	options ScanOptions
+}
+
+// newMFTScanner returns the MFT strategy, which runs on one goroutine
+func newMFTScanner(numWorkers int, options ScanOptions) strategyScanner {
+	return &mftScanner{options: options}
+}
+
+func (s *mftScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+	files, dirs, err := s.count(rootPath)
+	if err != nil {
+		result.addError(err)
+		return result, result.Err()
+	}
+	result.Files, result.Dirs = files, dirs
+	s.options.progress.filesFound(files)
+	return result, result.Err()
+}
+
+func (s *mftScanner) count(rootPath string) (files, dirs int64, err error) {
+	if err := s.options.ctxErr(); err != nil {
+		return 0, 0, err
+	}
+	root, err := fileReference(rootPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	idx, err := readMFT(rootPath, s.options.ctxErr)
+	if err != nil {
+		return 0, 0, err
+	}
+	return idx.count(root, s.options.ctxErr)
+}
+
+// fileReference returns the file reference number of path
+func fileReference(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := syscall.CreateFile(p, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.CloseHandle(h)
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return 0, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
+	}
+	return uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow), nil
+}
+
+// readMFT opens the volume of path, which needs administrator rights, and
+// indexes all its file records
+func readMFT(path string, ctxErr func() error) (mftIndex, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	volume := filepath.VolumeName(abs)
+	if len(volume) != 2 || volume[1] != ':' {
+		return nil, fmt.Errorf("%s: the mft strategy needs a path on a local drive", path)
+	}
+	device, err := syscall.UTF16PtrFromString(`\\.\` + volume)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(device, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, 0, 0)
+	if err == syscall.ERROR_ACCESS_DENIED {
+		return nil, fmt.Errorf("opening volume %s needs administrator rights: %w", volume, err)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: volume, Err: err}
+	}
+	defer syscall.CloseHandle(h)
+
+	idx := mftIndex{}
+	in := mftEnumData{HighUsn: math.MaxInt64}
+	buf := make([]byte, mftBufferSize)
+	for {
+		if err := ctxErr(); err != nil {
+			return nil, err
+		}
+		var n uint32
+		err := syscall.DeviceIoControl(h, fsctlEnumUSNData, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)),
+			&buf[0], uint32(len(buf)), &n, nil)
+		if err == syscall.ERROR_HANDLE_EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "FSCTL_ENUM_USN_DATA", Path: volume, Err: err}
+		}
+		next, err := idx.addUSNRecords(buf[:n])
+		if err != nil {
+			return nil, &os.PathError{Op: "FSCTL_ENUM_USN_DATA", Path: volume, Err: err}
+		}
+		in.StartFileReferenceNumber = next
+	}
+}
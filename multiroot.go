@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RootResult is the part of a multi-root scan found below one root
+type RootResult struct {
+	Root string
+	// Workers is the share of the workers that scanned the root
+	Workers  int
+	Files    int64
+	Dirs     int64
+	Errors   int64
+	Duration time.Duration
+}
+
+// MultiRootResult is the result of scanning several roots in one call: the
+// merged counts and those of every root
+type MultiRootResult struct {
+	Total *ScanResult
+	Roots []RootResult
+}
+
+// combinedRootsLabel names a set of roots scanned together, as a path list
+func combinedRootsLabel(roots []string) string {
+	return strings.Join(roots, string(filepath.ListSeparator))
+}
+
+// rootWorkerShares splits the workers over the roots, at least one each;
+// strategies without a worker count keep 0
+func rootWorkerShares(numWorkers, numRoots int) []int {
+	shares := make([]int, numRoots)
+	for i := range shares {
+		if numWorkers > 0 {
+			shares[i] = numWorkers / numRoots
+			if i < numWorkers%numRoots {
+				shares[i]++
+			}
+			shares[i] = max(1, shares[i])
+		}
+	}
+	return shares
+}
+
+// scanRoots scans the roots concurrently, each with its own scanner of the
+// strategy and its share of the workers, and merges their results. A root
+// that fails does not stop the others; its failures are counted in the
+// merged result.
+func scanRoots(strategy string, numWorkers int, options ScanOptions, roots []string) (*MultiRootResult, error) {
+	shares := rootWorkerShares(numWorkers, len(roots))
+	scanners := make([]strategyScanner, len(roots))
+	for i := range roots {
+		scanner, err := newScanner(strategy, shares[i], options)
+		if err != nil {
+			return nil, err
+		}
+		scanners[i] = scanner
+	}
+
+	m := &MultiRootResult{Total: &ScanResult{}, Roots: make([]RootResult, len(roots))}
+	var wg sync.WaitGroup
+	wg.Add(len(roots))
+	for i, root := range roots {
+		go func(i int, root string) {
+			defer wg.Done()
+			start := time.Now()
+			result, err := scanners[i].Scan(root)
+			if result == nil {
+				result = &ScanResult{}
+				result.addError(err)
+			}
+			m.Roots[i] = RootResult{Root: root, Workers: shares[i], Files: result.Files, Dirs: result.Dirs,
+				Errors: result.Errors, Duration: time.Since(start)}
+			m.Total.add(result)
+		}(i, root)
+	}
+	wg.Wait()
+	return m, m.Total.Err()
+}
+
+// formatRootResults describes the counts and durations of the roots
+func formatRootResults(roots []RootResult) string {
+	parts := make([]string, len(roots))
+	for i, r := range roots {
+		parts[i] = fmt.Sprintf("%s %dファイル/%dディレクトリ %s", r.Root, r.Files, r.Dirs, formatDuration(r.Duration))
+		if r.Workers > 0 {
+			parts[i] += fmt.Sprintf(" (ワーカー数 %d)", r.Workers)
+		}
+		if r.Errors > 0 {
+			parts[i] += fmt.Sprintf(" 読み取りエラー %d", r.Errors)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File name styles of generated fixtures
+const (
+	// NameStyleASCII uses short ASCII names such as file_001.txt
+	NameStyleASCII = "ascii"
+	// NameStyleExotic mixes multi-byte UTF-8, combining characters, names
+	// close to NAME_MAX, spaces and shell metacharacters
+	NameStyleExotic = "exotic"
+)
+
+// maxNameBytes is the length of long names, just below the common NAME_MAX of 255 bytes
+const maxNameBytes = 250
+
+// exoticNameVariants decorate a base name. Only characters that are legal
+// on Windows are used, so the same fixture can be built on every platform.
+var exoticNameVariants = []func(base string) string{
+	func(base string) string { return base + "_日本語のファイル名" },
+	// Precomposed U+00E9, the form an NFD filesystem rewrites
+	func(base string) string { return base + "_caf\u00e9" },
+	// Decomposed e + U+0301 combining acute accent
+	func(base string) string { return base + "_cafe\u0301" },
+	func(base string) string { return base + "_\U0001F5C2\uFE0F\U0001F4C1" },
+	func(base string) string { return base + " with  spaces " },
+	func(base string) string { return base + "_$HOME `ls` 'q' !&;(){}[]#~" },
+	func(base string) string {
+		return base + "_" + strings.Repeat("x", maxNameBytes-len(base)-len(".txt")-1)
+	},
+}
+
+// parseNameStyle validates a file name style
+func parseNameStyle(value string) (string, error) {
+	switch value {
+	case NameStyleASCII, NameStyleExotic:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown name style: %s", value)
+}
+
+// fixtureFileName returns the name of the index-th generated file with the
+// given base name and extension
+func fixtureFileName(config Config, base, ext string, index int) string {
+	if config.NameStyle != NameStyleExotic {
+		return base + ext
+	}
+	return exoticNameVariants[index%len(exoticNameVariants)](base) + ext
+}
+
+// probeNFDNormalization reports whether the filesystem containing dir
+// rewrites file names to NFD, as HFS+ on macOS does. A file with a
+// precomposed name is created and the name returned by the listing is
+// compared with it. Scanners always use the names returned by the listing,
+// so normalization changes the bytes but not the counts.
+func probeNFDNormalization(dir string) (bool, error) {
+	name := ".nfd_probe_caf\u00e9"
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		return false, err
+	}
+	defer os.Remove(path)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return false, nil
+		}
+		if entry.Name() == ".nfd_probe_cafe\u0301" {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("probe file not found in %s", dir)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// nativeEntry is a directory entry read by a platform listing call
+type nativeEntry struct {
+	name    string
+	dir     bool
+	symlink bool
+	regular bool
+	// size is the size of regular files when the call returns sizes
+	size int64
+	// err is the error of reading the entry, nil if none
+	err error
+}
+
+// nativeLister reads the entries of the directory path with a platform
+// call into buf and calls fn for each. sizes asks for the sizes of files.
+type nativeLister func(path string, buf []byte, sizes bool, fn func(nativeEntry)) error
+
+// nativeScanner distributes directories through a task channel like the
+// recursive-task strategy, but reads each directory with a platform call
+// returning many entries with their types, and their sizes under -workload
+// stat, so that the stat workload needs no lstat per entry
+type nativeScanner struct {
+	numWorkers int
+	options    ScanOptions
+	list       nativeLister
+	// bufSize is the size of the buffer of each worker
+	bufSize int
+	root    string
+	sizes   bool
+}
+
+// nativeWorker holds the per-goroutine state of a native scan
+type nativeWorker struct {
+	buf      []byte
+	activity *WorkerActivity
+}
+
+func (s *nativeScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+	s.root = rootPath
+	if s.options.Workload == WorkloadStat {
+		// Only the root is not part of a listing
+		s.sizes = true
+		s.options.workload.Dir(rootPath)
+	}
+
+	workers := make([]*nativeWorker, s.numWorkers)
+	for i := range workers {
+		workers[i] = &nativeWorker{buf: make([]byte, s.bufSize), activity: s.options.Activity.Worker(i)}
+	}
+	if s.numWorkers == 1 {
+		busyStart := s.options.instrumentation.StartBusy()
+		s.processDir(rootPath, nil, nil, workers[0], result)
+		s.options.instrumentation.EndBusy(0, busyStart)
+		workers[0].activity.Idle()
+		return result, result.Err()
+	}
+
+	queue := newTaskQueue[string](s.options.ChannelCapacity, s.options.TaskOrder, s.options.hints.estimate)
+	var wg sync.WaitGroup
+	var taskWg sync.WaitGroup
+	s.options.Activity.SetQueue(queue.depth)
+	s.options.instrumentation.SetQueue(queue.depth)
+
+	wg.Add(s.numWorkers)
+	for i := 0; i < s.numWorkers; i++ {
+		workerID := i
+		w := workers[i]
+		go func() {
+			defer wg.Done()
+			for path, ok := queue.take(); ok; path, ok = queue.take() {
+				busyStart := s.options.instrumentation.StartBusy()
+				s.processDir(path, queue, &taskWg, w, result)
+				s.options.instrumentation.EndBusy(workerID, busyStart)
+				w.activity.Idle()
+				taskWg.Done()
+			}
+		}()
+	}
+
+	taskWg.Add(1)
+	queue.offer(rootPath)
+	taskWg.Wait()
+	queue.close()
+	wg.Wait()
+
+	return result, result.Err()
+}
+
+// processDir lists a directory and hands its subdirectories to the queue
+// when there is room, otherwise they are processed inline. A nil queue
+// processes everything inline.
+func (s *nativeScanner) processDir(path string, queue taskQueue[string], taskWg *sync.WaitGroup, w *nativeWorker, result *ScanResult) {
+	w.activity.Enter(path)
+	if err := s.options.ctxErr(); err != nil {
+		result.addError(err)
+		return
+	}
+	defer s.options.progress.dirDone()
+	if err := s.options.throttle(); err != nil {
+		result.addError(err)
+		return
+	}
+
+	var files int64
+	subdirs := []string{}
+	start := s.options.startListing()
+	err := s.list(path, w.buf, s.sizes, func(e nativeEntry) {
+		if e.err != nil {
+			result.addError(&os.PathError{Op: "read", Path: filepath.Join(path, e.name), Err: e.err})
+			return
+		}
+		isDir, list := e.dir, e.dir
+		if e.symlink {
+			isDir, list = false, false
+			if s.options.symlinks != nil {
+				isDir, list = s.options.symlinks.resolve(path, e.name)
+			}
+		}
+		s.options.workload.statListed(e.regular, e.size)
+		switch {
+		case list:
+			subdirs = append(subdirs, filepath.Join(path, e.name))
+		case isDir:
+			atomic.AddInt64(&result.Dirs, 1)
+			s.options.progress.dirDone()
+		default:
+			files++
+		}
+	})
+	s.options.endListing(path, start)
+	s.options.releaseIO()
+	if err != nil {
+		result.addError(err)
+		return
+	}
+	atomic.AddInt64(&result.Files, files)
+	atomic.AddInt64(&result.Dirs, 1)
+	w.activity.AddFiles(files)
+	s.options.progress.filesFound(files)
+	s.options.hints.record(path, len(subdirs))
+
+	for _, subdir := range subdirs {
+		if queue != nil && s.options.queuesDepth(pathDepth(s.root, subdir)) {
+			taskWg.Add(1)
+			if queue.offer(subdir) {
+				continue
+			}
+			// Queue full, process inline
+			taskWg.Done()
+			s.options.instrumentation.InlineFallback()
+			if s.options.requeues() {
+				s.processDir(subdir, queue, taskWg, w, result)
+				continue
+			}
+		}
+		s.processDir(subdir, nil, nil, w, result)
+	}
+}
+
+// unsupportedScanner is the scanner of a strategy that is not available on
+// this platform
+type unsupportedScanner struct {
+	err error
+}
+
+func (s unsupportedScanner) Scan(rootPath string) (*ScanResult, error) {
+	return nil, s.err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// readDirLister is a nativeLister built on os.ReadDir, to test the scan of
+// nativeScanner on every platform
+func readDirLister(path string, buf []byte, sizes bool, fn func(nativeEntry)) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		e := nativeEntry{name: entry.Name(), dir: entry.IsDir(), symlink: entry.Type()&os.ModeSymlink != 0, regular: entry.Type().IsRegular()}
+		if sizes && e.regular {
+			info, err := entry.Info()
+			if err != nil {
+				e.err = err
+			} else {
+				e.size = info.Size()
+			}
+		}
+		fn(e)
+	}
+	return nil
+}
+
+func TestNativeScannerMatchesReferenceWalk(t *testing.T) {
+	for _, tree := range scannerTrees {
+		root := writeTree(t, tree.fsys)
+		wantFiles, wantDirs := referenceCounts(t, tree.fsys)
+		for _, workers := range testWorkerCounts {
+			scanner := &nativeScanner{numWorkers: workers, options: defaultScanOptions(), list: readDirLister}
+			result, err := scanner.Scan(root)
+			if err != nil {
+				t.Errorf("%s with %d workers: %v", tree.name, workers, err)
+			}
+			if result.Files != wantFiles || result.Dirs != wantDirs {
+				t.Errorf("%s with %d workers found %d files and %d dirs, want %d and %d",
+					tree.name, workers, result.Files, result.Dirs, wantFiles, wantDirs)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Cell matching modes of report normalize
+const (
+	// NormalizeMatchWorkers compares cells with the same absolute worker count
+	NormalizeMatchWorkers = "workers"
+	// NormalizeMatchPerCPU compares cells with the same workers per CPU, so
+	// that 8 workers on 8 CPUs meet 16 workers on 16 CPUs
+	NormalizeMatchPerCPU = "per-cpu"
+)
+
+// normalizeReference is the configuration every machine's durations are
+// divided by: a strategy with default parameters at a worker count
+type normalizeReference struct {
+	strategy string
+	workers  int
+}
+
+// parseNormalizeReference parses strategy[/workers]; the worker count
+// defaults to the serial run
+func parseNormalizeReference(value string) (normalizeReference, error) {
+	strategy, workers, found := strings.Cut(value, "/")
+	ref := normalizeReference{strategy: strings.TrimSpace(strategy), workers: 1}
+	if ref.strategy == "" {
+		return ref, fmt.Errorf("reference strategy is required: %s", value)
+	}
+	if found {
+		n, err := strconv.Atoi(strings.TrimSpace(workers))
+		if err != nil || n < 0 {
+			return ref, fmt.Errorf("invalid reference worker count: %s", workers)
+		}
+		ref.workers = n
+	}
+	return ref, nil
+}
+
+// String formats the reference as given on the command line
+func (r normalizeReference) String() string {
+	return fmt.Sprintf("%s/%d", r.strategy, r.workers)
+}
+
+// normalizeMachine is one column of the comparison: a session of a machine
+type normalizeMachine struct {
+	name     string
+	metadata SessionMetadata
+	// relative maps cell keys to durations relative to the reference, -1 for
+	// cells that timed out
+	relative map[string]float64
+}
+
+// normalizeRow is one compared cell
+type normalizeRow struct {
+	key, structure, label, workers string
+}
+
+// runReportNormalize divides the durations of every machine in merged JSON
+// results by the duration of a reference configuration on the same machine
+// and structure, and prints the relative durations side by side
+func runReportNormalize(args []string) error {
+	fs := flag.NewFlagSet("report normalize", flag.ContinueOnError)
+	reference := fs.String("reference", StrategyDirectoryBased+"/1", "reference configuration of every machine, strategy[/workers]")
+	match := fs.String("match", NormalizeMatchWorkers, "how cells of different machines are paired: workers (absolute count) or per-cpu (workers per CPU)")
+	out := fs.String("out", "", "also write the comparison to this CSV file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one JSON results file is required")
+	}
+	if *match != NormalizeMatchWorkers && *match != NormalizeMatchPerCPU {
+		return fmt.Errorf("unknown -match: %s (%s, %s)", *match, NormalizeMatchWorkers, NormalizeMatchPerCPU)
+	}
+	ref, err := parseNormalizeReference(*reference)
+	if err != nil {
+		return err
+	}
+
+	merged, _, err := mergeResultsFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(merged.Sessions) == 0 {
+		return fmt.Errorf("no sessions in the results files")
+	}
+
+	hosts := map[string]int{}
+	for _, session := range merged.Sessions {
+		hosts[session.Metadata.Host]++
+	}
+	machines := []normalizeMachine{}
+	rows := []normalizeRow{}
+	seenRows := map[string]bool{}
+	for _, session := range merged.Sessions {
+		machine := normalizeMachine{name: session.Metadata.Host, metadata: session.Metadata, relative: map[string]float64{}}
+		if hosts[machine.name] > 1 {
+			machine.name = session.Metadata.key()
+		}
+		results := session.results()
+
+		// The reference duration of every structure on this machine
+		refDurations := map[string]float64{}
+		for _, r := range results {
+			if r.Label() == ref.strategy && r.Workers == ref.workers && !r.TimedOut {
+				refDurations[summaryGroup(r)] = r.Duration.Seconds()
+			}
+		}
+		if len(refDurations) == 0 {
+			fmt.Printf("警告: %s に基準の構成 %s の結果がないため除外します\n", machine.name, ref)
+			continue
+		}
+		for _, r := range results {
+			refDuration, ok := refDurations[summaryGroup(r)]
+			if !ok {
+				continue
+			}
+			row := normalizeRow{structure: r.Structure, label: r.Label(), workers: normalizeWorkers(r, session.Metadata, *match)}
+			row.key = strings.Join([]string{summaryGroup(r), row.label, row.workers}, "\x00")
+			if !seenRows[row.key] {
+				seenRows[row.key] = true
+				rows = append(rows, row)
+			}
+			if r.TimedOut {
+				machine.relative[row.key] = -1
+			} else {
+				machine.relative[row.key] = r.Duration.Seconds() / refDuration
+			}
+		}
+		machines = append(machines, machine)
+	}
+	if len(machines) == 0 {
+		return fmt.Errorf("no machine has results of the reference %s", ref)
+	}
+
+	fmt.Printf("基準: %s (各マシン・構造で基準の実行時間を1とした相対値。小さいほど速い)\n", ref)
+	for _, m := range machines {
+		fmt.Printf("  %s: %s/%s, CPU数 %d, %s\n", m.name, m.metadata.OS, m.metadata.Arch, m.metadata.CPUs, m.metadata.Session)
+	}
+	fmt.Println()
+
+	header := []string{"Structure", "Strategy", "Workers"}
+	right := []bool{false, false, true}
+	for _, m := range machines {
+		header = append(header, m.name)
+		right = append(right, true)
+	}
+	header = append(header, "Spread")
+	right = append(right, true)
+	table := &textTable{header: header, right: right}
+	csvRows := [][]string{header}
+	for _, row := range rows {
+		cells := []string{row.structure, row.label, row.workers}
+		record := append([]string{}, cells...)
+		lo, hi := math.Inf(1), 0.0
+		for _, m := range machines {
+			v, ok := m.relative[row.key]
+			switch {
+			case !ok:
+				cells, record = append(cells, "-"), append(record, "")
+			case v < 0:
+				cells, record = append(cells, "timeout"), append(record, "")
+			default:
+				cells, record = append(cells, fmt.Sprintf("%.3f", v)), append(record, fmt.Sprintf("%.4f", v))
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+		// Spread is how much the machines disagree on the cell, max/min
+		if hi > 0 {
+			cells, record = append(cells, fmt.Sprintf("%.2fx", hi/lo)), append(record, fmt.Sprintf("%.4f", hi/lo))
+		} else {
+			cells, record = append(cells, "-"), append(record, "")
+		}
+		table.add(cells...)
+		csvRows = append(csvRows, record)
+	}
+	table.render(os.Stdout, false)
+
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := writeCSVRows(file, csvRows); err != nil {
+			return err
+		}
+		fmt.Printf("\n比較表をCSVファイルに出力しました: %s\n", *out)
+	}
+	return nil
+}
+
+// normalizeWorkers returns the worker count a cell is paired by. Results
+// written before WorkersPerCPU was recorded fall back to the CPU count of
+// their session.
+func normalizeWorkers(r BenchmarkResult, metadata SessionMetadata, match string) string {
+	if match == NormalizeMatchWorkers || r.Workers <= 0 {
+		return strconv.Itoa(r.Workers)
+	}
+	perCPU := r.WorkersPerCPU
+	if perCPU <= 0 && metadata.CPUs > 0 {
+		perCPU = float64(r.Workers) / float64(metadata.CPUs)
+	}
+	return formatWorkersPerCPU(perCPU)
+}
@@ -0,0 +1,338 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// openatSupported reports whether the openat strategy is available
+const openatSupported = true
+
+// pathNode is a directory name linked to its parent; the root node holds the
+// root path. Full paths are only joined when needed.
+type pathNode struct {
+	parent *pathNode
+	name   string
+}
+
+// path joins the names from the root down to n
+func (n *pathNode) path() string {
+	names := []string{}
+	for node := n; node != nil; node = node.parent {
+		names = append(names, node.name)
+	}
+	var b strings.Builder
+	for i := len(names) - 1; i >= 0; i-- {
+		b.WriteString(names[i])
+		if i > 0 && !strings.HasSuffix(names[i], string(os.PathSeparator)) {
+			b.WriteByte(os.PathSeparator)
+		}
+	}
+	return b.String()
+}
+
+// openatDir is a directory whose descriptor is open, waiting to be listed
+type openatDir struct {
+	fd   int
+	node *pathNode
+	// depth is the number of levels below the root
+	depth int
+}
+
+// openatChild is a listed entry to open as a subdirectory; probe marks
+// entries without d_type, which may turn out not to be directories, and
+// follow symlinks to directories listed by -symlinks follow
+type openatChild struct {
+	name   string
+	probe  bool
+	follow bool
+}
+
+// OpenatScanner keeps a descriptor per queued directory and opens each
+// subdirectory with openat relative to its parent, so that neither the
+// program nor the kernel handles absolute paths. Entries are read with
+// getdents and typed from d_type; DT_UNKNOWN entries are opened as
+// directories and count as files when that fails with ENOTDIR or ELOOP.
+// Paths are only built for errors and the live dashboard.
+type OpenatScanner struct {
+	numWorkers int
+	options    ScanOptions
+	// uring submits the opens of each directory's subdirectories as one
+	// io_uring batch per worker instead of one openat call each
+	uring bool
+}
+
+// openatWorker holds the per-goroutine state of an openat scan
+type openatWorker struct {
+	buf      []byte
+	activity *WorkerActivity
+	ring     *uring
+	// batch is the number of subdirectories opened at once
+	batch int
+	fds   []int
+	errs  []error
+}
+
+// newWorker returns the state of the worker with the given ID
+func (s *OpenatScanner) newWorker(id int) (*openatWorker, error) {
+	w := &openatWorker{buf: make([]byte, dtypeBufferSize), activity: s.options.Activity.Worker(id), batch: 1}
+	if s.uring {
+		w.batch = s.options.batchSize(StrategyUring)
+		ring, err := newUring(w.batch)
+		if err != nil {
+			return nil, err
+		}
+		w.ring = ring
+	}
+	w.fds = make([]int, w.batch)
+	w.errs = make([]error, w.batch)
+	return w, nil
+}
+
+// close releases the ring of the worker
+func (w *openatWorker) close() {
+	if w.ring != nil {
+		w.ring.Close()
+	}
+}
+
+// openatFlags open a subdirectory, failing with ELOOP on symlinks
+const openatFlags = syscall.O_RDONLY | syscall.O_DIRECTORY | syscall.O_CLOEXEC | syscall.O_NOFOLLOW
+
+// openAll opens the subdirectories of the directory dirfd into w.fds and
+// w.errs. Batches with symlinks to follow are opened one call each.
+func (w *openatWorker) openAll(dirfd int, subdirs []openatChild) {
+	if w.ring != nil && !slices.ContainsFunc(subdirs, func(sub openatChild) bool { return sub.follow }) {
+		names := make([]string, len(subdirs))
+		for i, sub := range subdirs {
+			names[i] = sub.name
+		}
+		w.ring.openat(dirfd, names, openatFlags, w.fds, w.errs)
+		return
+	}
+	for i, sub := range subdirs {
+		flags := openatFlags
+		if sub.follow {
+			flags &^= syscall.O_NOFOLLOW
+		}
+		w.fds[i], w.errs[i] = syscall.Openat(dirfd, sub.name, flags, 0)
+	}
+}
+
+// symlink returns how the symlink name in dir is counted: as a file, as a
+// directory or as a subdirectory to open
+func (s *OpenatScanner) symlink(dir *pathNode, name string, files *int64, result *ScanResult, subdirs []openatChild) []openatChild {
+	isDir, list := s.options.symlinks.resolve(dir.path(), name)
+	switch {
+	case list:
+		return append(subdirs, openatChild{name: name, follow: true})
+	case isDir:
+		atomic.AddInt64(&result.Dirs, 1)
+		s.options.progress.dirDone()
+	default:
+		*files++
+	}
+	return subdirs
+}
+
+func (s *OpenatScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+	fd, err := syscall.Open(rootPath, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		result.addError(&os.PathError{Op: "open", Path: rootPath, Err: err})
+		return result, result.Err()
+	}
+	root := openatDir{fd: fd, node: &pathNode{name: rootPath}}
+
+	workers := make([]*openatWorker, s.numWorkers)
+	for i := range workers {
+		if workers[i], err = s.newWorker(i); err != nil {
+			syscall.Close(fd)
+			for _, w := range workers[:i] {
+				w.close()
+			}
+			return nil, err
+		}
+	}
+	defer func() {
+		for _, w := range workers {
+			w.close()
+		}
+	}()
+
+	if s.numWorkers == 1 {
+		busyStart := s.options.instrumentation.StartBusy()
+		s.processDir(root, nil, nil, workers[0], result)
+		s.options.instrumentation.EndBusy(0, busyStart)
+		workers[0].activity.Idle()
+		return result, result.Err()
+	}
+
+	queue := newTaskQueue[openatDir](s.options.ChannelCapacity, s.options.TaskOrder, openatFanOut)
+	var wg sync.WaitGroup
+	var taskWg sync.WaitGroup
+	queueDepth := queue.depth
+	s.options.Activity.SetQueue(queueDepth)
+	s.options.instrumentation.SetQueue(queueDepth)
+
+	wg.Add(s.numWorkers)
+	for i := 0; i < s.numWorkers; i++ {
+		workerID := i
+		w := workers[i]
+		go func() {
+			defer wg.Done()
+			for dir, ok := queue.take(); ok; dir, ok = queue.take() {
+				busyStart := s.options.instrumentation.StartBusy()
+				s.processDir(dir, queue, &taskWg, w, result)
+				s.options.instrumentation.EndBusy(workerID, busyStart)
+				w.activity.Idle()
+				taskWg.Done()
+			}
+		}()
+	}
+
+	taskWg.Add(1)
+	queue.offer(root)
+	taskWg.Wait()
+	queue.close()
+	wg.Wait()
+
+	return result, result.Err()
+}
+
+// openatFanOut estimates the subdirectories of an open directory from its
+// link count for the priority task order; openat keeps no paths to look up
+// earlier scans by
+func openatFanOut(dir openatDir) int {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(dir.fd, &st); err != nil || st.Nlink < 2 {
+		return -1
+	}
+	return int(st.Nlink) - 2
+}
+
+// processDir lists an open directory, closes it and hands its subdirectories
+// on as open descriptors, opened w.batch at a time: to the queue when there
+// is room, otherwise they are processed inline. A nil queue processes
+// everything inline.
+func (s *OpenatScanner) processDir(dir openatDir, queue taskQueue[openatDir], taskWg *sync.WaitGroup, w *openatWorker, result *ScanResult) {
+	defer syscall.Close(dir.fd)
+	if s.options.Activity != nil {
+		w.activity.Enter(dir.node.path())
+	}
+	if err := s.options.ctxErr(); err != nil {
+		result.addError(err)
+		return
+	}
+	defer s.options.progress.dirDone()
+	if s.options.visits != nil {
+		var st syscall.Stat_t
+		if syscall.Fstat(dir.fd, &st) == nil {
+			s.options.visits.add(fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, dir.node.path())
+		}
+	}
+	if err := s.options.throttle(); err != nil {
+		result.addError(err)
+		return
+	}
+
+	var files int64
+	subdirs := []openatChild{}
+	start := s.options.startListing()
+	err := readDirents(dir.fd, w.buf, func(name []byte, _ uint64, typ uint8) {
+		mode, known := direntMode(typ)
+		switch {
+		case !known || mode.IsDir():
+			subdirs = append(subdirs, openatChild{name: string(name), probe: !known})
+		case mode&fs.ModeSymlink != 0 && s.options.symlinks != nil:
+			subdirs = s.symlink(dir.node, string(name), &files, result, subdirs)
+		default:
+			files++
+		}
+	})
+	if !start.IsZero() {
+		s.options.endListing(dir.node.path(), start)
+	}
+	s.options.releaseIO()
+	if err != nil {
+		result.addError(&os.PathError{Op: "getdents", Path: dir.node.path(), Err: err})
+		return
+	}
+	atomic.AddInt64(&result.Files, files)
+	atomic.AddInt64(&result.Dirs, 1)
+	w.activity.AddFiles(files)
+	s.options.progress.filesFound(files)
+
+	for len(subdirs) > 0 {
+		batch := subdirs
+		if len(batch) > w.batch {
+			batch = batch[:w.batch]
+		}
+		subdirs = subdirs[len(batch):]
+		// A batch of io_uring opens takes one slot like a single call
+		if err := s.options.acquireIO(); err != nil {
+			result.addError(err)
+			return
+		}
+		w.openAll(dir.fd, batch)
+		s.options.releaseIO()
+		fds, errs := w.fds[:len(batch)], w.errs[:len(batch)]
+		if len(batch) > 1 {
+			// The inline scans below reuse the worker's buffers
+			fds = append([]int(nil), fds...)
+			errs = append([]error(nil), errs...)
+		}
+
+		for i, sub := range batch {
+			if sub.probe && errs[i] == syscall.ELOOP && s.options.symlinks != nil {
+				// A symlink without d_type
+				isDir, list := s.options.symlinks.resolve(dir.node.path(), sub.name)
+				if list {
+					if err := s.options.acquireIO(); err != nil {
+						result.addError(err)
+						continue
+					}
+					fds[i], errs[i] = syscall.Openat(dir.fd, sub.name, openatFlags&^syscall.O_NOFOLLOW, 0)
+					s.options.releaseIO()
+				} else if isDir {
+					atomic.AddInt64(&result.Dirs, 1)
+					s.options.progress.dirDone()
+					continue
+				}
+			}
+			if sub.probe && (errs[i] == syscall.ENOTDIR || errs[i] == syscall.ELOOP) {
+				atomic.AddInt64(&result.Files, 1)
+				w.activity.AddFiles(1)
+				s.options.progress.filesFound(1)
+				continue
+			}
+			child := &pathNode{parent: dir.node, name: sub.name}
+			if errs[i] != nil {
+				result.addError(&os.PathError{Op: "openat", Path: child.path(), Err: errs[i]})
+				continue
+			}
+			next := openatDir{fd: fds[i], node: child, depth: dir.depth + 1}
+			if queue != nil && s.options.queuesDepth(next.depth) {
+				taskWg.Add(1)
+				if queue.offer(next) {
+					continue
+				}
+				// Queue full, process inline
+				taskWg.Done()
+				s.options.instrumentation.InlineFallback()
+				if s.options.requeues() {
+					s.processDir(next, queue, taskWg, w, result)
+					continue
+				}
+			}
+			s.processDir(next, nil, nil, w, result)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// openatSupported reports whether the openat strategy is available
+const openatSupported = false
+
+// OpenatScanner is only implemented with openat and getdents on Linux
+type OpenatScanner struct {
+	numWorkers int
+	options    ScanOptions
+	uring      bool
+}
+
+func (s *OpenatScanner) Scan(rootPath string) (*ScanResult, error) {
+	return nil, errors.New("the openat strategy is only supported on Linux")
+}
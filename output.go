@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result file formats
+const (
+	// FormatCSV is the per-cell summary CSV read by the report subcommand
+	FormatCSV = "csv"
+	// FormatParquet holds every individual run with typed columns
+	FormatParquet = "parquet"
+	// FormatJSON holds the cells, their runs and the session metadata
+	FormatJSON = "json"
+	// FormatMarkdown is the summary table for pasting into issues and docs
+	FormatMarkdown = "markdown"
+	// FormatSQLite holds the cells and the runs as tables of a database
+	FormatSQLite = "sqlite"
+	// FormatPrometheus is the text exposition format of the node_exporter
+	// textfile collector
+	FormatPrometheus = "prometheus"
+)
+
+// OutputWriter writes the results of a session in one file format
+type OutputWriter interface {
+	// Write writes the session to files named after base, the path of the
+	// results file without extension such as
+	// benchmark/benchmark_results_<session>, and returns the files written,
+	// also those written before an error
+	Write(session ResultsSession, base string) ([]outputFile, error)
+}
+
+// outputFile is a written result file and its description for the console
+type outputFile struct {
+	path        string
+	description string
+}
+
+// outputFormat is a format of -format
+type outputFormat struct {
+	name string
+	// label names the format in error messages
+	label  string
+	help   string
+	writer OutputWriter
+}
+
+// outputFormats are the formats of -format, in the order they are written.
+// A new format only needs an OutputWriter and an entry here.
+var outputFormats = []outputFormat{
+	{FormatCSV, "CSV", "per-cell summary and every run", csvOutput{}},
+	{FormatJSON, "JSON", "cells, runs and machine metadata", jsonOutput{}},
+	{FormatParquet, "Parquet", "every run", parquetOutput{}},
+	{FormatMarkdown, "Markdown", "summary table", markdownOutput{}},
+	{FormatSQLite, "SQLite", "cells and runs tables", sqliteOutput{}},
+	{FormatPrometheus, "Prometheus", "textfile collector metrics", prometheusOutput{}},
+}
+
+// outputFormatsHelp describes the formats for the -format flag
+func outputFormatsHelp() string {
+	help := []string{}
+	for _, f := range outputFormats {
+		help = append(help, fmt.Sprintf("%s (%s)", f.name, f.help))
+	}
+	return strings.Join(help, ", ")
+}
+
+// parseFormats parses a comma separated list of result file formats and
+// returns them in the order of outputFormats
+func parseFormats(value string) ([]outputFormat, error) {
+	selected := map[string]bool{}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.TrimSpace(format)
+		found := false
+		for _, f := range outputFormats {
+			found = found || f.name == format
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown format: %s", format)
+		}
+		selected[format] = true
+	}
+	formats := []outputFormat{}
+	for _, f := range outputFormats {
+		if selected[f.name] {
+			formats = append(formats, f)
+		}
+	}
+	return formats, nil
+}
+
+// runsBase returns the base name of the files holding every run
+func runsBase(base string) string {
+	return strings.Replace(base, "benchmark_results_", "benchmark_runs_", 1)
+}
+
+// csvOutput writes the aggregate and the per-run CSV files
+type csvOutput struct{}
+
+func (csvOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	results := session.results()
+	written := []outputFile{}
+	if err := exportResultsToCSV(results, session.Metadata, base+".csv"); err != nil {
+		return written, err
+	}
+	written = append(written, outputFile{base + ".csv", "結果をCSVファイルに出力しました"})
+	if err := exportRunsToCSV(results, session.Metadata, runsBase(base)+".csv"); err != nil {
+		return written, err
+	}
+	return append(written, outputFile{runsBase(base) + ".csv", "全実行の結果をCSVファイルに出力しました"}), nil
+}
+
+// jsonOutput writes the JSON results file
+type jsonOutput struct{}
+
+func (jsonOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	if err := exportResultsToJSON(session, base+".json"); err != nil {
+		return nil, err
+	}
+	return []outputFile{{base + ".json", "結果をJSONファイルに出力しました"}}, nil
+}
+
+// parquetOutput writes every run to a Parquet file
+type parquetOutput struct{}
+
+func (parquetOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	filename := runsBase(base) + ".parquet"
+	if err := exportRunsToParquet(session.results(), filename); err != nil {
+		return nil, err
+	}
+	return []outputFile{{filename, "全実行の結果をParquetファイルに出力しました"}}, nil
+}
+
+// markdownOutput writes the summary table as a Markdown table per structure
+type markdownOutput struct{}
+
+// escapeMarkdownCell keeps a value inside its table cell
+var escapeMarkdownCell = strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+func (markdownOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	filename := base + ".md"
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	m := session.Metadata
+	fmt.Fprintf(w, "# ディレクトリスキャン並列化ベンチマーク %s\n\n", m.Session)
+	fmt.Fprintf(w, "- ホスト: %s (%s/%s, CPU数 %d, %s)\n", m.Host, m.OS, m.Arch, m.CPUs, m.GoVersion)
+	if m.Size != "" {
+		fmt.Fprintf(w, "- サイズ: %s\n", m.Size)
+	}
+	if len(m.Args) > 0 {
+		fmt.Fprintf(w, "- 引数: `%s`\n", strings.Join(m.Args, " "))
+	}
+	fmt.Fprintf(w, "- スキーマ: %d\n", m.SchemaVersion)
+
+	results := session.results()
+	best := bestInGroups(results)
+	structure := ""
+	for i, r := range results {
+		if i == 0 || r.Structure != structure {
+			structure = r.Structure
+			fmt.Fprintf(w, "\n## %s\n\n", escapeMarkdownCell(structure))
+			fmt.Fprintln(w, "| Strategy | Workers | Duration | 95%CI | Files | Dirs | Speedup | Allocs/op | GC | B/file |")
+			fmt.Fprintln(w, "|----------|--------:|---------:|------:|------:|-----:|--------:|----------:|---:|-------:|")
+		}
+		duration, speedup := r.Duration.Round(time.Millisecond).String(), fmt.Sprintf("%.2fx", r.Speedup)
+		if j, ok := best[summaryGroup(r)]; ok && j == i {
+			duration, speedup = "**"+duration+"**", "**"+speedup+"**"
+		}
+		fmt.Fprintf(w, "| %s | %d | %s | %s | %s | %s | %s | %d | %d | %.1f |\n",
+			escapeMarkdownCell(r.Label()), r.Workers, duration, formatCI(r.DurationCI), formatCount(r.FilesScanned), formatCount(r.DirsScanned),
+			speedup, r.Allocs, r.NumGC, r.BytesPerFile())
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return []outputFile{{filename, "結果をMarkdownファイルに出力しました"}}, nil
+}
+
+// prometheusOutput writes the cells as gauges in the text exposition format,
+// for the textfile collector of node_exporter
+type prometheusOutput struct{}
+
+// prometheusMetric is a gauge written per cell
+type prometheusMetric struct {
+	name, help string
+	value      func(r BenchmarkResult) float64
+}
+
+// prometheusMetrics are the gauges of prometheusOutput
+var prometheusMetrics = []prometheusMetric{
+	{"dirscan_duration_seconds", "Mean scan duration of the benchmark cell.", func(r BenchmarkResult) float64 { return r.Duration.Seconds() }},
+	{"dirscan_files", "Files found by the last scan of the cell.", func(r BenchmarkResult) float64 { return float64(r.FilesScanned) }},
+	{"dirscan_dirs", "Directories found by the last scan of the cell.", func(r BenchmarkResult) float64 { return float64(r.DirsScanned) }},
+	{"dirscan_speedup", "Speedup over the single worker scan of the strategy.", func(r BenchmarkResult) float64 { return r.Speedup }},
+	{"dirscan_allocs", "Mean heap allocations per scan.", func(r BenchmarkResult) float64 { return float64(r.Allocs) }},
+	{"dirscan_bytes_allocated", "Mean bytes allocated per scan.", func(r BenchmarkResult) float64 { return float64(r.BytesAllocated) }},
+	{"dirscan_gc_cycles", "Mean GC cycles per scan.", func(r BenchmarkResult) float64 { return float64(r.NumGC) }},
+	{"dirscan_scan_errors", "Read errors summed over the runs of the cell.", func(r BenchmarkResult) float64 { return float64(r.ScanErrors) }},
+	{"dirscan_timed_out", "1 when the cell timed out.", func(r BenchmarkResult) float64 {
+		if r.TimedOut {
+			return 1
+		}
+		return 0
+	}},
+}
+
+// escapePrometheusLabel escapes a label value of the text exposition format
+var escapePrometheusLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+func (prometheusOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	filename := base + ".prom"
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintf(w, "# schema_version %d\n", session.Metadata.SchemaVersion)
+	results := session.results()
+	for _, metric := range prometheusMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for _, r := range results {
+			labels := []string{}
+			// Empty label values are the same as absent ones
+			for _, tag := range cellTags(r, session.Metadata.Host) {
+				if tag[1] != "" {
+					labels = append(labels, fmt.Sprintf(`%s="%s"`, tag[0], escapePrometheusLabel(tag[1])))
+				}
+			}
+			fmt.Fprintf(w, "%s{%s} %s\n", metric.name, strings.Join(labels, ","), strconv.FormatFloat(metric.value(r), 'g', -1, 64))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return []outputFile{{filename, "結果をPrometheusのテキスト形式で出力しました"}}, nil
+}
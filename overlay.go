@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overlayDirName is the directory below a fixture directory that holds the
+// layers and the mount point of its -overlay-layers target
+const overlayDirName = "benchmark-overlay"
+
+// overlayTarget is a fixture target inside an overlayfs mount, like the root
+// filesystem of a container: the fixtures are spread over read-only lower
+// layers and the writable upper layer starts empty
+type overlayTarget struct {
+	root    string
+	layers  int
+	mounted bool
+}
+
+// newOverlayTarget returns the overlay target below fixtureDir
+func newOverlayTarget(fixtureDir string, layers int) (*overlayTarget, error) {
+	root, err := filepath.Abs(filepath.Join(fixtureDir, overlayDirName))
+	if err != nil {
+		return nil, err
+	}
+	// The mount options separate the layers by ":" and the options by ","
+	if strings.ContainsAny(root, ":,") {
+		return nil, fmt.Errorf("%s: overlayfs layers cannot contain ':' or ','", root)
+	}
+	return &overlayTarget{root: root, layers: layers}, nil
+}
+
+// merged is the mount point, the fixture directory of the target
+func (o *overlayTarget) merged() string {
+	return filepath.Join(o.root, "merged")
+}
+
+// layer returns the directory of the i-th lower layer
+func (o *overlayTarget) layer(i int) string {
+	return filepath.Join(o.root, fmt.Sprintf("lower%d", i))
+}
+
+// build generates the fixture of structure in the first lower layer and
+// spreads its files over the other layers
+func (o *overlayTarget) build(structure string, config Config) error {
+	name := fixturePrefix + structure
+	for i := 0; i < o.layers; i++ {
+		if err := os.MkdirAll(o.layer(i), 0755); err != nil {
+			return err
+		}
+	}
+	if err := generateFixture(filepath.Join(o.layer(0), name), structure, config); err != nil {
+		return err
+	}
+	layers := make([]string, o.layers)
+	for i := range layers {
+		layers[i] = o.layer(i)
+	}
+	return spreadLayers(layers, name)
+}
+
+// spreadLayers moves the files of the tree name in the first layer round
+// robin to the layers and creates every directory in every layer, so that
+// overlayfs merges the listings of all layers for every directory. The
+// merged tree is the generated one.
+func spreadLayers(layers []string, name string) error {
+	n := 0
+	return filepath.WalkDir(filepath.Join(layers[0], name), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(layers[0], path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			for _, layer := range layers[1:] {
+				if err := os.Mkdir(filepath.Join(layer, rel), 0755); err != nil && !os.IsExist(err) {
+					return err
+				}
+			}
+			return nil
+		}
+		// WalkDir has read the whole directory, so its files may be moved
+		i := n % len(layers)
+		n++
+		if i == 0 {
+			return nil
+		}
+		return os.Rename(path, filepath.Join(layers[i], rel))
+	})
+}
+
+// options returns the overlayfs mount options; the last layer is the top one
+func (o *overlayTarget) options() string {
+	lower := make([]string, o.layers)
+	for i := range lower {
+		lower[i] = o.layer(o.layers - 1 - i)
+	}
+	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(lower, ":"),
+		filepath.Join(o.root, "upper"), filepath.Join(o.root, "work"))
+}
+
+// mount mounts the layers on the merged directory
+func (o *overlayTarget) mount() error {
+	for _, dir := range []string{"upper", "work", "merged"} {
+		if err := os.MkdirAll(filepath.Join(o.root, dir), 0755); err != nil {
+			return err
+		}
+	}
+	if err := mountOverlay(o.merged(), o.options()); err != nil {
+		return fmt.Errorf("mounting overlayfs on %s: %w", o.merged(), err)
+	}
+	o.mounted = true
+	return nil
+}
+
+// remove unmounts the target and removes its layers. Removing the fixtures
+// through the mount would only add whiteouts to the upper layer.
+func (o *overlayTarget) remove() error {
+	if o.mounted {
+		if err := unmountOverlay(o.merged()); err != nil {
+			return fmt.Errorf("unmounting %s: %w", o.merged(), err)
+		}
+		o.mounted = false
+	}
+	return os.RemoveAll(o.root)
+}
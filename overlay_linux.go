@@ -0,0 +1,16 @@
+package main
+
+import "syscall"
+
+// overlaySupported reports whether -overlay-layers can mount overlayfs
+const overlaySupported = true
+
+// mountOverlay mounts overlayfs on dir, which needs CAP_SYS_ADMIN
+func mountOverlay(dir, options string) error {
+	return syscall.Mount("overlay", dir, "overlay", 0, options)
+}
+
+// unmountOverlay unmounts the overlayfs on dir
+func unmountOverlay(dir string) error {
+	return syscall.Unmount(dir, 0)
+}
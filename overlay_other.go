@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// overlaySupported reports whether -overlay-layers can mount overlayfs
+const overlaySupported = false
+
+// mountOverlay is not supported on this platform
+func mountOverlay(dir, options string) error {
+	return errors.New("overlayfs is only supported on Linux")
+}
+
+// unmountOverlay is not supported on this platform
+func unmountOverlay(dir string) error {
+	return errors.New("overlayfs is only supported on Linux")
+}
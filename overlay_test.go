@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// treeEntries returns the relative paths below root, directories with a
+// trailing slash
+func treeEntries(t *testing.T, root string) []string {
+	t.Helper()
+	entries := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			rel += "/"
+		}
+		entries = append(entries, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestSpreadLayers(t *testing.T) {
+	fsys := withFiles(dirs("tree/a", "tree/a/b", "tree/empty"), "tree/1", "tree/2", "tree/3", "tree/a/4", "tree/a/5", "tree/a/b/6")
+	layers := []string{writeTree(t, fsys), t.TempDir(), t.TempDir()}
+	want := treeEntries(t, layers[0])
+
+	if err := spreadLayers(layers, "tree"); err != nil {
+		t.Fatal(err)
+	}
+	merged := map[string]bool{}
+	files := 0
+	for i, layer := range layers {
+		layerFiles := 0
+		for _, entry := range treeEntries(t, layer) {
+			merged[entry] = true
+			if entry[len(entry)-1] != '/' {
+				layerFiles++
+			}
+		}
+		// Every directory is in every layer, so that each listing is merged
+		for _, dir := range []string{"tree", "tree/a", "tree/a/b", "tree/empty"} {
+			if info, err := os.Stat(filepath.Join(layer, dir)); err != nil || !info.IsDir() {
+				t.Errorf("layer %d: %s is not a directory", i, dir)
+			}
+		}
+		if layerFiles != 2 {
+			t.Errorf("layer %d holds %d files, want 2", i, layerFiles)
+		}
+		files += layerFiles
+	}
+	got := []string{}
+	for entry := range merged {
+		got = append(got, entry)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if files != 6 || !slices.Equal(got, want) {
+		t.Errorf("merged layers hold %v (%d files), want %v", got, files, want)
+	}
+}
+
+func TestOverlayOptions(t *testing.T) {
+	o := &overlayTarget{root: "/data/" + overlayDirName, layers: 3}
+	want := "lowerdir=/data/benchmark-overlay/lower2:/data/benchmark-overlay/lower1:/data/benchmark-overlay/lower0," +
+		"upperdir=/data/benchmark-overlay/upper,workdir=/data/benchmark-overlay/work"
+	if got := o.options(); filepath.Separator == '/' && got != want {
+		t.Errorf("options = %s, want %s", got, want)
+	}
+	if _, err := newOverlayTarget("/data/a:b", 1); err == nil {
+		t.Error("newOverlayTarget accepted a directory with ':'")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Inline fallback policies of the task channel strategies: what a worker does
+// with a subdirectory when the task channel is full
+const (
+	// FallbackInline scans the whole subtree on the worker that found it
+	FallbackInline = "inline"
+	// FallbackRequeue lists the subdirectory on the worker and offers its
+	// subdirectories to the channel again
+	FallbackRequeue = "requeue"
+)
+
+// StrategyParams is the parameter set of one strategy in a -strategy-params
+// file; omitted parameters keep the defaults and command line values
+type StrategyParams struct {
+	ChannelCapacity *int    `json:",omitempty"`
+	BatchSize       *int    `json:",omitempty"`
+	Fallback        *string `json:",omitempty"`
+	TaskOrder       *string `json:",omitempty"`
+	CutoffDepth     *int    `json:",omitempty"`
+	GoroutineCap    *int    `json:",omitempty"`
+}
+
+// maxUringBatch is the largest io_uring submission batch accepted
+const maxUringBatch = 4096
+
+// strategyParamSets maps strategies to their parameter sets
+type strategyParamSets map[string]StrategyParams
+
+// usesBatchSize reports whether the strategy reads or opens entries in
+// batches of a configurable size
+func usesBatchSize(strategy string) bool {
+	return strategy == StrategyRecursiveTaskPooled || strategy == StrategyUring
+}
+
+// defaultBatchSize returns the batch size a strategy uses when none is set
+func defaultBatchSize(strategy string) int {
+	switch strategy {
+	case StrategyRecursiveTaskPooled:
+		return pooledReadDirBatch
+	case StrategyUring:
+		return uringEntries
+	}
+	return 0
+}
+
+// loadStrategyParams reads a JSON object of parameter sets keyed by strategy
+func loadStrategyParams(filename string) (strategyParamSets, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	sets := strategyParamSets{}
+	if err := decoder.Decode(&sets); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(filename), err)
+	}
+	for strategy, p := range sets {
+		if err := p.validate(strategy); err != nil {
+			return nil, fmt.Errorf("%s: %v", strategy, err)
+		}
+	}
+	return sets, nil
+}
+
+// validate checks that the strategy exists, uses every given parameter and
+// that the values are in range
+func (p StrategyParams) validate(strategy string) error {
+	switch strategy {
+	case StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled, StrategyUnbounded,
+		StrategyOpenat, StrategyUring, StrategyBulkAttr, StrategyFindFile, StrategyMFT, StrategyRemoveAll:
+	default:
+		return fmt.Errorf("unknown strategy")
+	}
+	queued := usesChannelCapacity(strategy)
+	switch {
+	case p.ChannelCapacity != nil && !queued:
+		return fmt.Errorf("ChannelCapacity does not apply")
+	case p.Fallback != nil && !queued:
+		return fmt.Errorf("Fallback does not apply")
+	case p.TaskOrder != nil && !queued:
+		return fmt.Errorf("TaskOrder does not apply")
+	case p.CutoffDepth != nil && !queued:
+		return fmt.Errorf("CutoffDepth does not apply")
+	case p.BatchSize != nil && !usesBatchSize(strategy):
+		return fmt.Errorf("BatchSize does not apply")
+	case p.GoroutineCap != nil && strategy != StrategyUnbounded:
+		return fmt.Errorf("GoroutineCap does not apply")
+	}
+	if p.ChannelCapacity != nil && *p.ChannelCapacity < 1 {
+		return fmt.Errorf("ChannelCapacity must be positive: %d", *p.ChannelCapacity)
+	}
+	if p.BatchSize != nil && (*p.BatchSize < 1 || (strategy == StrategyUring && *p.BatchSize > maxUringBatch)) {
+		return fmt.Errorf("BatchSize out of range: %d", *p.BatchSize)
+	}
+	if p.Fallback != nil && *p.Fallback != FallbackInline && *p.Fallback != FallbackRequeue {
+		return fmt.Errorf("unknown Fallback: %s (%s, %s)", *p.Fallback, FallbackInline, FallbackRequeue)
+	}
+	if p.TaskOrder != nil && !validTaskOrder(*p.TaskOrder) {
+		return fmt.Errorf("unknown TaskOrder: %s (%s, %s, %s)", *p.TaskOrder, TaskOrderFIFO, TaskOrderLIFO, TaskOrderPriority)
+	}
+	if p.CutoffDepth != nil && *p.CutoffDepth < 0 {
+		return fmt.Errorf("CutoffDepth must not be negative: %d", *p.CutoffDepth)
+	}
+	if p.GoroutineCap != nil && *p.GoroutineCap < 0 {
+		return fmt.Errorf("GoroutineCap must not be negative: %d", *p.GoroutineCap)
+	}
+	return nil
+}
+
+// options applies the strategy's parameter set to the base options
+func (s strategyParamSets) options(strategy string, base ScanOptions) ScanOptions {
+	p := s[strategy]
+	if p.ChannelCapacity != nil {
+		base.ChannelCapacity = *p.ChannelCapacity
+	}
+	if p.BatchSize != nil {
+		base.BatchSize = *p.BatchSize
+	}
+	if p.Fallback != nil {
+		base.Fallback = *p.Fallback
+	}
+	if p.TaskOrder != nil {
+		base.TaskOrder = *p.TaskOrder
+	}
+	if p.CutoffDepth != nil {
+		base.CutoffDepth = *p.CutoffDepth
+	}
+	if p.GoroutineCap != nil {
+		base.GoroutineCap = *p.GoroutineCap
+	}
+	return base
+}
+
+// variants expands the swept options of a strategy on top of its parameter
+// set; a capacity or task order fixed by the set is not swept
+func (s strategyParamSets) variants(strategy string, base ScanOptions, axes SweepAxes) []ScanOptions {
+	if s[strategy].ChannelCapacity != nil {
+		axes.Capacities = nil
+	}
+	if s[strategy].TaskOrder != nil {
+		axes.TaskOrders = nil
+	}
+	return scanVariants(strategy, s.options(strategy, base), axes)
+}
+
+// paramsLabel describes the strategy parameters of a variant that differ
+// from the defaults
+func paramsLabel(strategy string, batch int, fallback, order string, cutoff, goroutineCap int, counters string) string {
+	parts := []string{}
+	if batch != 0 && batch != defaultBatchSize(strategy) {
+		parts = append(parts, fmt.Sprintf("batch=%d", batch))
+	}
+	if fallback != "" && fallback != FallbackInline {
+		parts = append(parts, "fallback="+fallback)
+	}
+	if order != "" && order != TaskOrderFIFO {
+		parts = append(parts, "order="+order)
+	}
+	if cutoff > 0 {
+		parts = append(parts, fmt.Sprintf("cutoff=%d", cutoff))
+	}
+	if strategy == StrategyUnbounded && goroutineCap >= 0 && goroutineCap != defaultGoroutineCap {
+		parts = append(parts, fmt.Sprintf("goroutines=%d", goroutineCap))
+	}
+	if counters != "" && counters != CountersShared {
+		parts = append(parts, "counters="+counters)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"strconv"
+)
+
+// A minimal Parquet writer: one row group, one uncompressed PLAIN data page
+// per column, flat schema with required or optional columns. The file
+// metadata is encoded with the Thrift compact protocol.
+
+// Parquet physical types
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// Parquet enum values used by the writer
+const (
+	parquetRequired      = 0
+	parquetOptional      = 1
+	parquetConvertedUTF8 = 0
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetDataPage      = 0
+	parquetUncompressed  = 0
+)
+
+// parquetColumn holds the values of one column. Nil values of optional
+// columns are written as nulls.
+type parquetColumn struct {
+	name     string
+	kind     int
+	optional bool
+	values   []interface{}
+}
+
+// parquetTable is a set of columns of equal length written as one file
+type parquetTable struct {
+	columns []*parquetColumn
+	rows    int
+	// metadata are the key-value pairs of the file footer
+	metadata [][2]string
+}
+
+// column adds a column to the table
+func (t *parquetTable) column(name string, kind int, optional bool) *parquetColumn {
+	c := &parquetColumn{name: name, kind: kind, optional: optional}
+	t.columns = append(t.columns, c)
+	return c
+}
+
+// encodePage returns the definition levels and PLAIN encoded values of a column
+func (c *parquetColumn) encodePage() []byte {
+	var buf bytes.Buffer
+	if c.optional {
+		levels := make([]bool, len(c.values))
+		for i, v := range c.values {
+			levels[i] = v != nil
+		}
+		encoded := encodeBitPackedLevels(levels)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(encoded)))
+		buf.Write(encoded)
+	}
+
+	var bits []bool
+	for _, v := range c.values {
+		if v == nil {
+			continue
+		}
+		switch c.kind {
+		case parquetInt64:
+			binary.Write(&buf, binary.LittleEndian, v.(int64))
+		case parquetDouble:
+			binary.Write(&buf, binary.LittleEndian, math.Float64bits(v.(float64)))
+		case parquetByteArray:
+			s := v.(string)
+			binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		case parquetBoolean:
+			bits = append(bits, v.(bool))
+		}
+	}
+	if c.kind == parquetBoolean {
+		buf.Write(packBits(bits))
+	}
+	return buf.Bytes()
+}
+
+// encodeBitPackedLevels encodes definition levels of bit width 1 as a single
+// bit-packed run of the RLE/bit-packing hybrid encoding
+func encodeBitPackedLevels(levels []bool) []byte {
+	groups := (len(levels) + 7) / 8
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(groups)<<1|1)
+	buf.Write(packBits(levels))
+	return buf.Bytes()
+}
+
+// packBits packs booleans LSB first, padding the last byte with zeros
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// writeFile writes the table as a Parquet file
+func (t *parquetTable) writeFile(filename string) error {
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+
+	type chunkInfo struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunkInfo, len(t.columns))
+	for i, c := range t.columns {
+		data := c.encodePage()
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(len(c.values)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunks[i] = chunkInfo{offset: int64(out.Len()), size: int64(header.buf.Len() + len(data))}
+		out.Write(header.buf.Bytes())
+		out.Write(data)
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.listHeader(2, thriftStruct, len(t.columns)+1)
+	meta.beginListStruct()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(t.columns)))
+	meta.endStruct()
+	for _, c := range t.columns {
+		meta.beginListStruct()
+		meta.i32(1, int32(c.kind))
+		repetition := int32(parquetRequired)
+		if c.optional {
+			repetition = parquetOptional
+		}
+		meta.i32(3, repetition)
+		meta.str(4, c.name)
+		if c.kind == parquetByteArray {
+			meta.i32(6, parquetConvertedUTF8)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64(3, int64(t.rows))
+
+	var totalSize int64
+	for _, chunk := range chunks {
+		totalSize += chunk.size
+	}
+	meta.listHeader(4, thriftStruct, 1)
+	meta.beginListStruct()
+	meta.listHeader(1, thriftStruct, len(t.columns))
+	for i, c := range t.columns {
+		meta.beginListStruct()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3)
+		meta.i32(1, int32(c.kind))
+		meta.listHeader(2, thriftI32, 2)
+		meta.listI32(parquetEncodingPlain)
+		meta.listI32(parquetEncodingRLE)
+		meta.listHeader(3, thriftBinary, 1)
+		meta.listStr(c.name)
+		meta.i32(4, parquetUncompressed)
+		meta.i64(5, int64(len(c.values)))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(t.rows))
+	meta.endStruct()
+
+	if len(t.metadata) > 0 {
+		meta.listHeader(5, thriftStruct, len(t.metadata))
+		for _, kv := range t.metadata {
+			meta.beginListStruct()
+			meta.str(1, kv[0])
+			meta.str(2, kv[1])
+			meta.endStruct()
+		}
+	}
+	meta.str(6, "go-parallel-dir-scan-benchmark")
+	meta.stop()
+
+	out.Write(meta.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(meta.buf.Len()))
+	out.WriteString("PAR1")
+	return os.WriteFile(filename, out.Bytes(), 0644)
+}
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol
+type thriftWriter struct {
+	buf       bytes.Buffer
+	lastField int
+	stack     []int
+}
+
+func (w *thriftWriter) fieldHeader(id, kind int) {
+	if delta := id - w.lastField; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta<<4 | kind))
+	} else {
+		w.buf.WriteByte(byte(kind))
+		writeUvarint(&w.buf, zigzag(int64(id)))
+	}
+	w.lastField = id
+}
+
+func (w *thriftWriter) i32(id int, v int32) {
+	w.fieldHeader(id, thriftI32)
+	writeUvarint(&w.buf, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int, v int64) {
+	w.fieldHeader(id, thriftI64)
+	writeUvarint(&w.buf, zigzag(v))
+}
+
+func (w *thriftWriter) str(id int, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.listStr(s)
+}
+
+func (w *thriftWriter) listHeader(id, elemKind, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size<<4 | elemKind))
+	} else {
+		w.buf.WriteByte(byte(0xf0 | elemKind))
+		writeUvarint(&w.buf, uint64(size))
+	}
+}
+
+func (w *thriftWriter) listI32(v int32) {
+	writeUvarint(&w.buf, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) listStr(s string) {
+	writeUvarint(&w.buf, uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// beginStruct starts a struct valued field
+func (w *thriftWriter) beginStruct(id int) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginListStruct()
+}
+
+// beginListStruct starts a struct element of a list
+func (w *thriftWriter) beginListStruct() {
+	w.stack = append(w.stack, w.lastField)
+	w.lastField = 0
+}
+
+func (w *thriftWriter) endStruct() {
+	w.stop()
+	w.lastField = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// exportRunsToParquet exports every individual run of all results, one row
+// per run, with typed columns. Values that were not measured are null.
+func exportRunsToParquet(results []BenchmarkResult, filename string) error {
+	table := &parquetTable{metadata: [][2]string{{"schema_version", strconv.Itoa(resultsSchemaVersion)}}}
+	str := func(name string) *parquetColumn { return table.column(name, parquetByteArray, false) }
+	i64 := func(name string) *parquetColumn { return table.column(name, parquetInt64, false) }
+	optI64 := func(name string) *parquetColumn { return table.column(name, parquetInt64, true) }
+	f64 := func(name string) *parquetColumn { return table.column(name, parquetDouble, false) }
+	optF64 := func(name string) *parquetColumn { return table.column(name, parquetDouble, true) }
+
+	structure, strategy, label := str("structure"), str("strategy"), str("label")
+	target, listing, hardlinks, priority := str("target"), str("listing"), str("hardlinks"), str("priority")
+	symlinks, filesystem, targetProfile := str("symlinks"), str("filesystem"), str("target_profile")
+	storageProfile, cacheMode := str("storage_profile"), str("cache_mode")
+	workload, fallback, taskOrder, counters := str("workload"), str("fallback"), str("task_order"), str("counters")
+	batchSize, cutoffDepth, goroutineCap := i64("batch_size"), i64("cutoff_depth"), optI64("goroutine_cap")
+	copyWorkers, copiedFiles, copiedBytes, copySkipped := i64("copy_workers"), i64("copied_files"), i64("copied_bytes"), i64("copy_skipped")
+	statCalls, statBytes := i64("stat_calls"), i64("stat_bytes")
+	statCall, statFallbacks := str("stat_call"), i64("stat_fallbacks")
+	xattrFiles, xattrCalls, xattrBytes := i64("xattr_files"), i64("xattr_calls"), i64("xattr_bytes")
+	ages := [ageBucketCount]*parquetColumn{}
+	for i, name := range ageBucketNames {
+		ages[i] = i64("age_" + name)
+	}
+	workers, run, concurrent := i64("workers"), i64("run"), i64("concurrent_scans")
+	workersPerCPU := optF64("workers_per_cpu")
+	chunk, capacity, churnRate, rateLimit := i64("readdir_chunk"), i64("channel_capacity"), i64("churn_rate"), i64("max_readdir_per_sec")
+	duration, files, dirs := i64("duration_ns"), optI64("files"), optI64("dirs")
+	scanErrors, permission, notFound, ioErrors := i64("scan_errors"), i64("permission_errors"), i64("not_found_errors"), i64("io_errors")
+	timedOut := table.column("timed_out", parquetBoolean, false)
+	stalled := table.column("stalled", parquetBoolean, false)
+	outlier := table.column("outlier", parquetBoolean, false)
+	allocs, allocated, numGC, gcPause := i64("allocs"), i64("bytes_allocated"), i64("num_gc"), i64("gc_pause_ns")
+	churnOps, readDirRate, throttleWait := i64("churn_ops"), f64("readdir_per_sec"), i64("throttle_wait_ns")
+	readDirDelay, staleRetries := i64("readdir_delay_ns"), i64("stale_retries")
+	inflightLimit, inflightWait := i64("max_inflight_io"), i64("inflight_wait_ns")
+	straggler := optI64("straggler_ns")
+	fileProgress := []*parquetColumn{optI64("files50_ns"), optI64("files90_ns"), optI64("files99_ns"), optI64("files100_ns")}
+	peakFDs, peakHeap, uniqueFiles := optI64("peak_fds"), optI64("peak_heap_bytes"), optI64("unique_files")
+	memLimit, peakMemory := i64("mem_limit_bytes"), optI64("peak_memory_bytes")
+	gcLimited := table.column("gc_limited", parquetBoolean, true)
+	userCPU, systemCPU, maxRSS := optI64("user_cpu_ns"), optI64("system_cpu_ns"), optI64("max_rss_bytes")
+	dtypeEntries, dtypeFallbacks := optI64("dtype_entries"), optI64("dtype_fallbacks")
+	peakThreads, workerCPUSkew, cpuPeak := optI64("peak_threads"), optF64("worker_cpu_skew"), optF64("cpu_peak")
+	hostCPU, otherCPU, loadAvg := optF64("host_cpu"), optF64("other_cpu"), optF64("load_avg_1")
+	noisy := table.column("noisy", parquetBoolean, true)
+	energyJ, filesPerJoule := optF64("energy_j"), optF64("files_per_joule")
+	cpuFreq, cpuFreqMin, throttleEvents := optF64("cpu_freq_mhz"), optF64("cpu_freq_min_mhz"), optI64("throttle_events")
+	throttled := table.column("throttled", parquetBoolean, true)
+	readDirCalls, p50, p95, p99, maxLatency := optI64("readdir_calls"), optI64("readdir_p50_ns"), optI64("readdir_p95_ns"), optI64("readdir_p99_ns"), optI64("readdir_max_ns")
+	queueMax, queueAvg, busyAvg, busyMin, inline := optI64("queue_depth_max"), optF64("queue_depth_avg"), optF64("busy_ratio_avg"), optF64("busy_ratio_min"), optI64("inline_fallbacks")
+
+	// optional returns v, or nil when the value was not measured
+	optional := func(v int64, measured bool) interface{} {
+		if !measured {
+			return nil
+		}
+		return v
+	}
+
+	for _, result := range results {
+		for i, r := range result.runs {
+			table.rows++
+			structure.values = append(structure.values, r.Structure)
+			strategy.values = append(strategy.values, r.Strategy)
+			label.values = append(label.values, result.Label())
+			target.values = append(target.values, result.Target)
+			filesystem.values = append(filesystem.values, result.Filesystem)
+			targetProfile.values = append(targetProfile.values, result.TargetProfile)
+			storageProfile.values = append(storageProfile.values, result.StorageProfile)
+			cacheMode.values = append(cacheMode.values, result.CacheMode)
+			listing.values = append(listing.values, r.Listing)
+			hardlinks.values = append(hardlinks.values, r.Hardlinks)
+			symlinks.values = append(symlinks.values, r.Symlinks)
+			priority.values = append(priority.values, result.Priority)
+			workload.values = append(workload.values, r.Workload)
+			copyWorkers.values = append(copyWorkers.values, int64(r.CopyWorkers))
+			copiedFiles.values = append(copiedFiles.values, r.CopiedFiles)
+			copiedBytes.values = append(copiedBytes.values, r.CopiedBytes)
+			copySkipped.values = append(copySkipped.values, r.CopySkipped)
+			statCalls.values = append(statCalls.values, r.StatCalls)
+			statBytes.values = append(statBytes.values, r.StatBytes)
+			statCall.values = append(statCall.values, r.StatCall)
+			statFallbacks.values = append(statFallbacks.values, r.StatFallbacks)
+			xattrFiles.values = append(xattrFiles.values, r.XattrFiles)
+			xattrCalls.values = append(xattrCalls.values, r.XattrCalls)
+			xattrBytes.values = append(xattrBytes.values, r.XattrBytes)
+			for j, n := range r.AgeHistogram {
+				ages[j].values = append(ages[j].values, n)
+			}
+			workers.values = append(workers.values, int64(r.Workers))
+			if r.WorkersPerCPU >= 0 {
+				workersPerCPU.values = append(workersPerCPU.values, r.WorkersPerCPU)
+			} else {
+				workersPerCPU.values = append(workersPerCPU.values, nil)
+			}
+			run.values = append(run.values, int64(i+1))
+			concurrent.values = append(concurrent.values, int64(r.ConcurrentScans))
+			chunk.values = append(chunk.values, int64(r.ReadDirChunk))
+			capacity.values = append(capacity.values, int64(r.ChannelCapacity))
+			batchSize.values = append(batchSize.values, int64(r.BatchSize))
+			fallback.values = append(fallback.values, r.Fallback)
+			taskOrder.values = append(taskOrder.values, r.TaskOrder)
+			counters.values = append(counters.values, r.Counters)
+			cutoffDepth.values = append(cutoffDepth.values, int64(r.CutoffDepth))
+			goroutineCap.values = append(goroutineCap.values, optional(int64(r.GoroutineCap), r.GoroutineCap >= 0))
+			churnRate.values = append(churnRate.values, int64(r.ChurnRate))
+			rateLimit.values = append(rateLimit.values, int64(r.MaxReadDirPerSec))
+			duration.values = append(duration.values, int64(r.Duration))
+			files.values = append(files.values, optional(int64(r.FilesScanned), r.FilesScanned >= 0))
+			dirs.values = append(dirs.values, optional(int64(r.DirsScanned), r.DirsScanned >= 0))
+			scanErrors.values = append(scanErrors.values, r.ScanErrors)
+			permission.values = append(permission.values, r.PermissionErrors)
+			notFound.values = append(notFound.values, r.NotFoundErrors)
+			ioErrors.values = append(ioErrors.values, r.IOErrors)
+			timedOut.values = append(timedOut.values, r.TimedOut)
+			stalled.values = append(stalled.values, r.Stalled)
+			outlier.values = append(outlier.values, r.Outlier)
+			allocs.values = append(allocs.values, int64(r.Allocs))
+			allocated.values = append(allocated.values, int64(r.BytesAllocated))
+			numGC.values = append(numGC.values, int64(r.NumGC))
+			gcPause.values = append(gcPause.values, int64(r.GCPause))
+			churnOps.values = append(churnOps.values, r.ChurnOps)
+			readDirRate.values = append(readDirRate.values, r.ReadDirPerSec)
+			throttleWait.values = append(throttleWait.values, int64(r.ThrottleWait))
+			readDirDelay.values = append(readDirDelay.values, int64(r.ReadDirDelay))
+			staleRetries.values = append(staleRetries.values, r.StaleRetries)
+			inflightLimit.values = append(inflightLimit.values, int64(r.MaxInflightIO))
+			inflightWait.values = append(inflightWait.values, int64(r.InflightWait))
+			straggler.values = append(straggler.values, optional(int64(r.Straggler), r.Straggler >= 0))
+			for i, column := range fileProgress {
+				var ns int64
+				if r.FileProgress != nil {
+					ns = int64(r.FileProgress[i])
+				}
+				column.values = append(column.values, optional(ns, r.FileProgress != nil))
+			}
+			peakFDs.values = append(peakFDs.values, optional(int64(r.PeakFDs), r.PeakFDs >= 0))
+			peakHeap.values = append(peakHeap.values, optional(r.PeakHeap, r.PeakHeap >= 0))
+			memLimit.values = append(memLimit.values, r.MemLimit)
+			peakMemory.values = append(peakMemory.values, optional(r.PeakMemory, r.PeakMemory >= 0))
+			if r.PeakMemory >= 0 {
+				gcLimited.values = append(gcLimited.values, r.GCLimited)
+			} else {
+				gcLimited.values = append(gcLimited.values, nil)
+			}
+			uniqueFiles.values = append(uniqueFiles.values, optional(int64(r.UniqueFiles), r.UniqueFiles >= 0))
+			userCPU.values = append(userCPU.values, optional(int64(r.UserCPU), r.UserCPU >= 0))
+			systemCPU.values = append(systemCPU.values, optional(int64(r.SystemCPU), r.SystemCPU >= 0))
+			maxRSS.values = append(maxRSS.values, optional(r.MaxRSS, r.MaxRSS >= 0))
+			dtypeEntries.values = append(dtypeEntries.values, optional(r.DTypeEntries, r.DTypeEntries >= 0))
+			dtypeFallbacks.values = append(dtypeFallbacks.values, optional(r.DTypeFallbacks, r.DTypeEntries >= 0))
+			peakThreads.values = append(peakThreads.values, optional(int64(r.PeakThreads), r.PeakThreads >= 0))
+			if r.CPUPeak >= 0 {
+				cpuPeak.values = append(cpuPeak.values, r.CPUPeak)
+			} else {
+				cpuPeak.values = append(cpuPeak.values, nil)
+			}
+			if r.HostCPU >= 0 {
+				hostCPU.values = append(hostCPU.values, r.HostCPU)
+				otherCPU.values = append(otherCPU.values, r.OtherCPU)
+				noisy.values = append(noisy.values, r.Noisy)
+			} else {
+				hostCPU.values = append(hostCPU.values, nil)
+				otherCPU.values = append(otherCPU.values, nil)
+				noisy.values = append(noisy.values, nil)
+			}
+			if r.LoadAvg >= 0 {
+				loadAvg.values = append(loadAvg.values, r.LoadAvg)
+			} else {
+				loadAvg.values = append(loadAvg.values, nil)
+			}
+			if r.EnergyJoules >= 0 {
+				energyJ.values = append(energyJ.values, r.EnergyJoules)
+			} else {
+				energyJ.values = append(energyJ.values, nil)
+			}
+			if perJoule := r.FilesPerJoule(); perJoule >= 0 {
+				filesPerJoule.values = append(filesPerJoule.values, perJoule)
+			} else {
+				filesPerJoule.values = append(filesPerJoule.values, nil)
+			}
+			if r.CPUFreqMHz >= 0 {
+				cpuFreq.values = append(cpuFreq.values, r.CPUFreqMHz)
+				cpuFreqMin.values = append(cpuFreqMin.values, r.CPUFreqMinMHz)
+			} else {
+				cpuFreq.values = append(cpuFreq.values, nil)
+				cpuFreqMin.values = append(cpuFreqMin.values, nil)
+			}
+			throttleEvents.values = append(throttleEvents.values, optional(r.ThrottleEvents, r.ThrottleEvents >= 0))
+			if r.CPUFreqMHz >= 0 || r.ThrottleEvents >= 0 {
+				throttled.values = append(throttled.values, r.Throttled)
+			} else {
+				throttled.values = append(throttled.values, nil)
+			}
+
+			l := r.ReadDirLatency
+			if l == nil {
+				l = &LatencySummary{}
+			}
+			readDirCalls.values = append(readDirCalls.values, optional(l.Count, r.ReadDirLatency != nil))
+			p50.values = append(p50.values, optional(int64(l.P50), r.ReadDirLatency != nil))
+			p95.values = append(p95.values, optional(int64(l.P95), r.ReadDirLatency != nil))
+			p99.values = append(p99.values, optional(int64(l.P99), r.ReadDirLatency != nil))
+			maxLatency.values = append(maxLatency.values, optional(int64(l.Max), r.ReadDirLatency != nil))
+
+			if m := r.Metrics; m != nil {
+				queueMax.values = append(queueMax.values, int64(m.QueueDepthMax))
+				queueAvg.values = append(queueAvg.values, m.QueueDepthAvg)
+				busyAvg.values = append(busyAvg.values, m.BusyRatioAvg())
+				busyMin.values = append(busyMin.values, m.BusyRatioMin())
+				inline.values = append(inline.values, int64(m.InlineFallbacks))
+				if m.WorkerCPU != nil {
+					workerCPUSkew.values = append(workerCPUSkew.values, m.WorkerCPUSkew())
+				} else {
+					workerCPUSkew.values = append(workerCPUSkew.values, nil)
+				}
+			} else {
+				queueMax.values = append(queueMax.values, nil)
+				queueAvg.values = append(queueAvg.values, nil)
+				busyAvg.values = append(busyAvg.values, nil)
+				busyMin.values = append(busyMin.values, nil)
+				inline.values = append(inline.values, nil)
+				workerCPUSkew.values = append(workerCPUSkew.values, nil)
+			}
+		}
+	}
+	return table.writeFile(filename)
+}
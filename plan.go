@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// fsBlockSize is the allocation unit assumed when estimating fixture disk usage
+const fsBlockSize = 4096
+
+// calibrationEntries is the number of entries walked by the calibration scan
+const calibrationEntries = 20000
+
+// BenchmarkPlan describes the benchmark matrix of one invocation
+type BenchmarkPlan struct {
+	Config          Config
+	FixtureDirs     []string
+	Structures      []string
+	Strategies      []string
+	WorkerCounts    []int
+	Only            cellFilter
+	Params          strategyParamSets
+	BaseOptions     ScanOptions
+	Axes            SweepAxes
+	Baselines       []ExternalBaseline
+	NumRuns         int
+	ConcurrentScans int
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var errCalibrationDone = errors.New("calibration done")
+
+// calibrateScanCost walks part of an existing tree serially and returns the
+// average time per entry. Nothing is created on disk.
+func calibrateScanCost(root string) (time.Duration, string, error) {
+	entries := 0
+	start := time.Now()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		entries++
+		if entries >= calibrationEntries {
+			return errCalibrationDone
+		}
+		return nil
+	})
+	elapsed := time.Since(start)
+	if err != nil && err != errCalibrationDone {
+		return 0, root, err
+	}
+	if entries == 0 {
+		return 0, root, fmt.Errorf("no entries found under %s", root)
+	}
+	return elapsed / time.Duration(entries), root, nil
+}
+
+// printPlan prints the benchmark matrix, fixture statistics and estimates
+func printPlan(plan BenchmarkPlan) {
+	fmt.Println("\n===== ベンチマーク計画 (dry-run) =====")
+
+	fmt.Println("\nテストデータ:")
+	for _, fixtureDir := range plan.FixtureDirs {
+		testDirs := fixtureTestDirs(fixtureDir, plan.Structures)
+		var totalBytes int64
+		for _, d := range testDirs {
+			structure := d.Structure
+			files, dirs := expectedCounts(structure, plan.Config)
+			bytes := estimateFixtureBytes(files, dirs)
+			totalBytes += bytes
+			fmt.Printf("  %-10s %-20s ファイル: %-10d ディレクトリ: %-10d 推定ディスク使用量: %s\n",
+				structure, d.Path, files, dirs, formatBytes(bytes))
+		}
+		fmt.Printf("  合計推定ディスク使用量: %s\n", formatBytes(totalBytes))
+		if available, err := availableBytes(fixtureDir); err == nil {
+			fmt.Printf("  空き容量: %s\n", formatBytes(int64(available)))
+		}
+	}
+
+	fmt.Println("\nセル:")
+	cells := 0
+	var scannedEntries int64
+	for _, structure := range plan.Structures {
+		files, dirs := expectedCounts(structure, plan.Config)
+		for _, strategy := range plan.Strategies {
+			for _, options := range plan.Params.variants(strategy, plan.BaseOptions, plan.Axes) {
+				label := strategy
+				if variant := optionsLabel(strategy, options); variant != "" {
+					label = fmt.Sprintf("%s [%s]", strategy, variant)
+				}
+				for _, workers := range plan.Only.workers(structure, strategy, strategyWorkerCounts(strategy, plan.WorkerCounts)) {
+					fmt.Printf("  %-10s %-32s ワーカー数 %d\n", structure, label, workers)
+					cells++
+					scannedEntries += int64(files+dirs) * int64(plan.NumRuns*plan.ConcurrentScans)
+				}
+			}
+		}
+		for _, baseline := range plan.Baselines {
+			fmt.Printf("  %-10s %-32s ワーカー数 %d\n", structure, externalStrategyPrefix+baseline.Name, baseline.Workers)
+			cells++
+			scannedEntries += int64(files+dirs) * int64(plan.NumRuns)
+		}
+	}
+	if len(plan.FixtureDirs) > 1 {
+		fmt.Printf("  合計: %d セル × %d ターゲット × %d 回実行\n", cells, len(plan.FixtureDirs), plan.NumRuns)
+	} else {
+		fmt.Printf("  合計: %d セル × %d 回実行\n", cells, plan.NumRuns)
+	}
+	if plan.BaseOptions.calibrated() {
+		fmt.Printf("  -min-time / -ci-target により各セルは最低 %d 回、最大 %d 回実行されます（見積もりは最低回数）\n", plan.NumRuns, plan.BaseOptions.MaxRuns)
+	}
+
+	// Calibrate on each filesystem the fixtures will be created on
+	var estimate time.Duration
+	for _, fixtureDir := range plan.FixtureDirs {
+		perEntry, root, err := calibrateScanCost(fixtureDir)
+		if err != nil {
+			fmt.Printf("\n推定実行時間: 計測できません (%v)\n", err)
+			return
+		}
+		fmt.Printf("\nキャリブレーション: %s を逐次走査 (1エントリあたり %v)\n", root, perEntry)
+		estimate += perEntry * time.Duration(scannedEntries)
+	}
+	fmt.Printf("推定実行時間 (逐次スキャン換算の上限、テストデータ作成を除く): %v\n",
+		estimate.Round(time.Millisecond))
+}
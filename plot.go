@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Chart dimensions in pixels
+const (
+	chartWidth   = 800
+	chartHeight  = 500
+	chartMarginL = 70
+	chartMarginR = 200
+	chartMarginT = 50
+	chartMarginB = 60
+)
+
+// chartPalette holds the series colors
+var chartPalette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+}
+
+var (
+	colorBlack = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	colorGrid  = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	colorIdeal = color.RGBA{0xaa, 0xaa, 0xaa, 0xff}
+)
+
+// canvas is the minimal drawing surface shared by the SVG and PNG backends
+type canvas interface {
+	Line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	Rect(x, y, w, h float64, c color.RGBA)
+	Text(x, y float64, s string, anchor string)
+	Save(filename string) error
+}
+
+// chartSeries is one line (or bar group member) of a chart
+type chartSeries struct {
+	Name   string
+	Values map[int]float64 // keyed by worker count
+	// Errors holds the half width of the 95% confidence interval of Values
+	Errors map[int]float64
+}
+
+// plotResults renders a speedup line chart and a duration bar chart per
+// structure and returns the written file names
+func plotResults(results []BenchmarkResult, outDir, formats string) ([]string, error) {
+	formatList := []string{}
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.TrimSpace(format)
+		if format != "svg" && format != "png" {
+			return nil, fmt.Errorf("unknown chart format: %s", format)
+		}
+		formatList = append(formatList, format)
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	structures, workers, speedups, durations := chartData(results)
+	if len(structures) == 0 {
+		return nil, fmt.Errorf("no results to plot")
+	}
+
+	files := []string{}
+	for _, structure := range structures {
+		for _, format := range formatList {
+			name := filepath.Join(outDir, fmt.Sprintf("speedup_%s.%s", structure, format))
+			c := newCanvas(format)
+			drawLineChart(c, fmt.Sprintf("Speedup vs workers (%s)", structure), "workers", "speedup", workers, speedups[structure])
+			if err := c.Save(name); err != nil {
+				return nil, err
+			}
+			files = append(files, name)
+
+			name = filepath.Join(outDir, fmt.Sprintf("duration_%s.%s", structure, format))
+			c = newCanvas(format)
+			drawBarChart(c, fmt.Sprintf("Duration (%s)", structure), "workers", "duration [ms]", workers, durations[structure])
+			if err := c.Save(name); err != nil {
+				return nil, err
+			}
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// chartData groups results into per-structure series keyed by strategy
+func chartData(results []BenchmarkResult) ([]string, []int, map[string][]chartSeries, map[string][]chartSeries) {
+	structures := []string{}
+	workerSet := map[int]bool{}
+	speedups := map[string][]chartSeries{}
+	durations := map[string][]chartSeries{}
+	index := map[string]int{}
+
+	for _, r := range results {
+		if strings.HasPrefix(r.Strategy, externalStrategyPrefix) {
+			continue
+		}
+		name := r.Label()
+
+		if _, ok := speedups[r.Structure]; !ok {
+			structures = append(structures, r.Structure)
+		}
+		key := r.Structure + "/" + name
+		i, ok := index[key]
+		if !ok {
+			i = len(speedups[r.Structure])
+			index[key] = i
+			speedups[r.Structure] = append(speedups[r.Structure], chartSeries{Name: name, Values: map[int]float64{}, Errors: map[int]float64{}})
+			durations[r.Structure] = append(durations[r.Structure], chartSeries{Name: name, Values: map[int]float64{}, Errors: map[int]float64{}})
+		}
+		speedups[r.Structure][i].Values[r.Workers] = r.Speedup
+		durations[r.Structure][i].Values[r.Workers] = r.Duration.Seconds() * 1000
+		if r.DurationCI >= 0 && r.Duration > 0 {
+			// The speedup divides a fixed baseline by the duration, so its
+			// relative error is that of the duration
+			speedups[r.Structure][i].Errors[r.Workers] = r.Speedup * float64(r.DurationCI) / float64(r.Duration)
+			durations[r.Structure][i].Errors[r.Workers] = r.DurationCI.Seconds() * 1000
+		}
+		workerSet[r.Workers] = true
+	}
+
+	workers := []int{}
+	for w := range workerSet {
+		workers = append(workers, w)
+	}
+	sort.Ints(workers)
+	return structures, workers, speedups, durations
+}
+
+func newCanvas(format string) canvas {
+	if format == "png" {
+		return newPNGCanvas(chartWidth, chartHeight)
+	}
+	return newSVGCanvas(chartWidth, chartHeight)
+}
+
+// niceMax rounds v up to a readable axis maximum
+func niceMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 2.5, 5, 10} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// drawAxes draws the frame, grid, y ticks, category labels and title and
+// returns the plot area
+func drawAxes(c canvas, title, xLabel, yLabel string, categories []int, yMax float64) (x0, y0, w, h float64) {
+	x0 = chartMarginL
+	y0 = chartMarginT
+	w = chartWidth - chartMarginL - chartMarginR
+	h = chartHeight - chartMarginT - chartMarginB
+
+	c.Text(chartWidth/2, 25, title, "middle")
+
+	const ticks = 5
+	for i := 0; i <= ticks; i++ {
+		v := yMax * float64(i) / ticks
+		y := y0 + h - h*float64(i)/ticks
+		c.Line(x0, y, x0+w, y, colorGrid, 1)
+		c.Text(x0-8, y+4, formatTick(v), "end")
+	}
+
+	for i, category := range categories {
+		x := categoryX(x0, w, len(categories), i)
+		c.Text(x, y0+h+20, fmt.Sprintf("%d", category), "middle")
+	}
+
+	c.Line(x0, y0, x0, y0+h, colorBlack, 1)
+	c.Line(x0, y0+h, x0+w, y0+h, colorBlack, 1)
+	c.Text(x0+w/2, y0+h+45, xLabel, "middle")
+	c.Text(10, y0-15, yLabel, "start")
+	return x0, y0, w, h
+}
+
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// categoryX returns the x center of category i out of n
+func categoryX(x0, w float64, n, i int) float64 {
+	return x0 + w*(float64(i)+0.5)/float64(n)
+}
+
+// drawLegend draws one swatch per series followed by the extra entries
+func drawLegend(c canvas, series []chartSeries, extra map[string]color.RGBA) {
+	x := float64(chartWidth - chartMarginR + 15)
+	y := float64(chartMarginT + 10)
+	for i, s := range series {
+		c.Rect(x, y-8, 14, 10, chartPalette[i%len(chartPalette)])
+		c.Text(x+20, y+1, s.Name, "start")
+		y += 22
+	}
+	for name, col := range extra {
+		c.Rect(x, y-8, 14, 10, col)
+		c.Text(x+20, y+1, name, "start")
+		y += 22
+	}
+}
+
+// drawLineChart draws one polyline per series plus the ideal linear speedup
+func drawLineChart(c canvas, title, xLabel, yLabel string, categories []int, series []chartSeries) {
+	yMax := 0.0
+	for _, s := range series {
+		for category, v := range s.Values {
+			yMax = math.Max(yMax, v+s.Errors[category])
+		}
+	}
+	for _, category := range categories {
+		yMax = math.Max(yMax, float64(category))
+	}
+	yMax = niceMax(yMax)
+
+	x0, y0, w, h := drawAxes(c, title, xLabel, yLabel, categories, yMax)
+	yOf := func(v float64) float64 { return y0 + h - h*v/yMax }
+
+	// Ideal speedup equals the worker count
+	for i := 1; i < len(categories); i++ {
+		c.Line(categoryX(x0, w, len(categories), i-1), yOf(float64(categories[i-1])),
+			categoryX(x0, w, len(categories), i), yOf(float64(categories[i])), colorIdeal, 1)
+	}
+
+	for si, s := range series {
+		col := chartPalette[si%len(chartPalette)]
+		prevX, prevY, hasPrev := 0.0, 0.0, false
+		for i, category := range categories {
+			v, ok := s.Values[category]
+			if !ok {
+				hasPrev = false
+				continue
+			}
+			x, y := categoryX(x0, w, len(categories), i), yOf(v)
+			if hasPrev {
+				c.Line(prevX, prevY, x, y, col, 2)
+			}
+			c.Rect(x-3, y-3, 6, 6, col)
+			drawErrorBar(c, x, yOf(math.Max(v-s.Errors[category], 0)), yOf(v+s.Errors[category]), col)
+			prevX, prevY, hasPrev = x, y, true
+		}
+	}
+
+	drawLegend(c, series, map[string]color.RGBA{"ideal": colorIdeal})
+}
+
+// drawBarChart draws grouped bars, one group per category
+func drawBarChart(c canvas, title, xLabel, yLabel string, categories []int, series []chartSeries) {
+	yMax := 0.0
+	for _, s := range series {
+		for category, v := range s.Values {
+			yMax = math.Max(yMax, v+s.Errors[category])
+		}
+	}
+	yMax = niceMax(yMax)
+
+	x0, y0, w, h := drawAxes(c, title, xLabel, yLabel, categories, yMax)
+	yOf := func(v float64) float64 { return y0 + h - h*v/yMax }
+	groupWidth := w / float64(len(categories)) * 0.8
+	barWidth := groupWidth / float64(len(series))
+
+	for i, category := range categories {
+		left := categoryX(x0, w, len(categories), i) - groupWidth/2
+		for si, s := range series {
+			v, ok := s.Values[category]
+			if !ok {
+				continue
+			}
+			barHeight := h * v / yMax
+			barLeft := left + float64(si)*barWidth
+			c.Rect(barLeft, y0+h-barHeight, barWidth-2, barHeight, chartPalette[si%len(chartPalette)])
+			drawErrorBar(c, barLeft+(barWidth-2)/2, yOf(math.Max(v-s.Errors[category], 0)), yOf(v+s.Errors[category]), colorBlack)
+		}
+	}
+
+	drawLegend(c, series, nil)
+}
+
+// drawErrorBar draws a vertical error bar at x between the screen
+// coordinates yLow and yHigh; nothing when they coincide
+func drawErrorBar(c canvas, x, yLow, yHigh float64, col color.RGBA) {
+	if yLow == yHigh {
+		return
+	}
+	c.Line(x, yLow, x, yHigh, col, 1)
+	c.Line(x-3, yLow, x+3, yLow, col, 1)
+	c.Line(x-3, yHigh, x+3, yHigh, col, 1)
+}
+
+// svgCanvas renders to an SVG document
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	fmt.Fprintf(&c.buf, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	return c
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c *svgCanvas) Line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	fmt.Fprintf(&c.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"/>`+"\n",
+		x1, y1, x2, y2, svgColor(col), width)
+}
+
+func (c *svgCanvas) Rect(x, y, w, h float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n",
+		x, y, w, h, svgColor(col))
+}
+
+func (c *svgCanvas) Text(x, y float64, s string, anchor string) {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+	fmt.Fprintf(&c.buf, `<text x="%.1f" y="%.1f" text-anchor="%s">%s</text>`+"\n", x, y, anchor, s)
+}
+
+func (c *svgCanvas) Save(filename string) error {
+	c.buf.WriteString("</svg>\n")
+	return os.WriteFile(filename, c.buf.Bytes(), 0644)
+}
+
+// pngCanvas renders to a raster image using a built-in bitmap font
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func newPNGCanvas(width, height int) *pngCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return &pngCanvas{img: img}
+}
+
+func (c *pngCanvas) Line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	steps := math.Max(math.Abs(x2-x1), math.Abs(y2-y1))
+	if steps == 0 {
+		steps = 1
+	}
+	half := int(width / 2)
+	for i := 0.0; i <= steps; i++ {
+		x := int(math.Round(x1 + (x2-x1)*i/steps))
+		y := int(math.Round(y1 + (y2-y1)*i/steps))
+		for dx := -half; dx <= half; dx++ {
+			for dy := -half; dy <= half; dy++ {
+				c.img.SetRGBA(x+dx, y+dy, col)
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) Rect(x, y, w, h float64, col color.RGBA) {
+	for py := int(math.Round(y)); py < int(math.Round(y+h)); py++ {
+		for px := int(math.Round(x)); px < int(math.Round(x+w)); px++ {
+			c.img.SetRGBA(px, py, col)
+		}
+	}
+}
+
+func (c *pngCanvas) Text(x, y float64, s string, anchor string) {
+	width := float64(len(s) * bitmapGlyphAdvance)
+	switch anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	// y is the baseline; glyphs are 7 pixels above it
+	drawBitmapText(c.img, int(math.Round(x)), int(math.Round(y))-7, s, colorBlack)
+}
+
+func (c *pngCanvas) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, c.img)
+}
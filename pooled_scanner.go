@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// pooledReadDirBatch is the default number of entries read per ReadDir call
+const pooledReadDirBatch = 256
+
+// subdirPool reuses the slices collecting subdirectories of a directory
+var subdirPool = sync.Pool{
+	New: func() interface{} {
+		s := make([]string, 0, 64)
+		return &s
+	},
+}
+
+// PooledRecursiveTaskScanner is an allocation-optimized variant of
+// RecursiveTaskScanner that reuses subdirectory slices and reads directories
+// in batches
+type PooledRecursiveTaskScanner struct {
+	numWorkers int
+	options    ScanOptions
+	// root is the scanned root, the reference of -strategy-params CutoffDepth
+	root string
+}
+
+func (s *PooledRecursiveTaskScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+	s.root = rootPath
+
+	if s.numWorkers == 1 {
+		activity := s.options.Activity.Worker(0)
+		busyStart := s.options.instrumentation.StartBusy()
+		s.processPathRecursive(rootPath, result, activity)
+		s.options.instrumentation.EndBusy(0, busyStart)
+		activity.Idle()
+		return result, result.Err()
+	}
+
+	queue := newTaskQueue[string](s.options.ChannelCapacity, s.options.TaskOrder, s.options.hints.estimate)
+	var wg sync.WaitGroup
+	var taskWg sync.WaitGroup
+	queueDepth := queue.depth
+	s.options.Activity.SetQueue(queueDepth)
+	s.options.instrumentation.SetQueue(queueDepth)
+
+	wg.Add(s.numWorkers)
+	for i := 0; i < s.numWorkers; i++ {
+		workerID := i
+		activity := s.options.Activity.Worker(i)
+		go func() {
+			defer wg.Done()
+			for path, ok := queue.take(); ok; path, ok = queue.take() {
+				busyStart := s.options.instrumentation.StartBusy()
+				s.processPath(path, queue, &taskWg, result, activity)
+				s.options.instrumentation.EndBusy(workerID, busyStart)
+				activity.Idle()
+				taskWg.Done()
+			}
+		}()
+	}
+
+	taskWg.Add(1)
+	queue.offer(rootPath)
+
+	taskWg.Wait()
+	queue.close()
+
+	wg.Wait()
+
+	return result, result.Err()
+}
+
+func (s *PooledRecursiveTaskScanner) processPath(path string, queue taskQueue[string], taskWg *sync.WaitGroup, result *ScanResult, activity *WorkerActivity) {
+	subdirs := subdirPool.Get().(*[]string)
+	defer func() {
+		*subdirs = (*subdirs)[:0]
+		subdirPool.Put(subdirs)
+	}()
+
+	if err := s.readDir(path, subdirs, result, activity); err != nil {
+		result.addError(err)
+		return
+	}
+	s.options.hints.record(path, len(*subdirs))
+
+	for _, subdir := range *subdirs {
+		if s.options.CutoffDepth > 0 && !s.options.queuesDepth(pathDepth(s.root, subdir)) {
+			s.processPathRecursive(subdir, result, activity)
+			continue
+		}
+		taskWg.Add(1)
+		if !queue.offer(subdir) {
+			// Queue full, process inline
+			taskWg.Done()
+			s.options.instrumentation.InlineFallback()
+			if s.options.requeues() {
+				s.processPath(subdir, queue, taskWg, result, activity)
+			} else {
+				s.processPathRecursive(subdir, result, activity)
+			}
+		}
+	}
+}
+
+func (s *PooledRecursiveTaskScanner) processPathRecursive(path string, result *ScanResult, activity *WorkerActivity) {
+	subdirs := subdirPool.Get().(*[]string)
+	defer func() {
+		*subdirs = (*subdirs)[:0]
+		subdirPool.Put(subdirs)
+	}()
+
+	if err := s.readDir(path, subdirs, result, activity); err != nil {
+		result.addError(err)
+		return
+	}
+
+	for _, subdir := range *subdirs {
+		s.processPathRecursive(subdir, result, activity)
+	}
+}
+
+// readDir counts the files of path in batches and appends the full paths of
+// its subdirectories to subdirs
+func (s *PooledRecursiveTaskScanner) readDir(path string, subdirs *[]string, result *ScanResult, activity *WorkerActivity) error {
+	if err := s.options.ctxErr(); err != nil {
+		return err
+	}
+	defer s.options.progress.dirDone()
+	if s.options.symlinks.leaf(path) {
+		atomic.AddInt64(&result.Dirs, 1)
+		return nil
+	}
+	s.options.visits.visit(path)
+	activity.Enter(path)
+	s.options.workload.Dir(path)
+	var f *os.File
+	err := s.options.stale.do(s.options.ctx, func() (err error) {
+		f, err = os.Open(path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var files int64
+	for {
+		if err := s.options.throttle(); err != nil {
+			return err
+		}
+		start := s.options.startListing()
+		entries, err := f.ReadDir(s.options.batchSize(StrategyRecursiveTaskPooled))
+		s.options.endListing(path, start)
+		s.options.releaseIO()
+		for _, entry := range entries {
+			entry = s.options.symlinks.entry(path, entry)
+			if !entry.IsDir() {
+				files++
+				s.options.links.AddEntry(entry)
+				s.options.workload.File(path, entry)
+				if s.options.files != nil {
+					s.options.files(path, entry)
+				}
+				continue
+			}
+			// One allocation of the exact size, like a pooled buffer copied
+			// into a string would need
+			*subdirs = append(*subdirs, path+string(os.PathSeparator)+entry.Name())
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	atomic.AddInt64(&result.Dirs, 1)
+	atomic.AddInt64(&result.Files, files)
+	activity.AddFiles(files)
+	s.options.progress.filesFound(files)
+	return nil
+}
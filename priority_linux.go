@@ -0,0 +1,50 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set(2) constants
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+var ioprioClasses = map[string]int{
+	IOClassRealtime:   1,
+	IOClassBestEffort: 2,
+	IOClassIdle:       3,
+}
+
+// applyPriority sets the niceness and I/O priority of every thread of the
+// process. Both are per-thread attributes on Linux; threads started later
+// inherit them from the thread that creates them.
+func applyPriority(p ProcessPriority) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if p.SetNice {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, p.Nice); err != nil {
+				return fmt.Errorf("setpriority: %w", err)
+			}
+		}
+		if p.IOClass != "" {
+			ioprio := ioprioClasses[p.IOClass]<<ioprioClassShift | p.IOLevel
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+				return fmt.Errorf("ioprio_set: %w", errno)
+			}
+		}
+	}
+	return nil
+}
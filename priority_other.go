@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// applyPriority is not supported on this platform
+func applyPriority(p ProcessPriority) error {
+	return errors.New("nice/ionice is only supported on Linux")
+}
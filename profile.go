@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Target profiles of -target-profile
+const (
+	// TargetProfileLocal keeps the defaults, made for local filesystems
+	TargetProfileLocal = "local"
+	// TargetProfileFUSE adapts the defaults to FUSE mounts such as sshfs,
+	// s3fs or rclone, whose every call is a round trip to a userspace daemon
+	TargetProfileFUSE = "fuse"
+	// TargetProfileFUSESim is the FUSE profile on a local tree, with a delay
+	// added to every listing call to stand in for the round trip
+	TargetProfileFUSESim = "fuse-sim"
+)
+
+// profileSetting is a flag value a profile sets when the flag is not given
+type profileSetting struct {
+	flag  string
+	value string
+}
+
+// fuseSettings bound the time of scans that hang on a stuck daemon, run
+// fewer workers than CPUs since FUSE daemons often serve few requests at
+// once, and retry listings that fail with ESTALE after the daemon
+// reconnected
+var fuseSettings = []profileSetting{
+	{"scan-timeout", "10m"},
+	{"stall-timeout", "1m"},
+	{"workers-multiplier", "0.25,0.5,1"},
+	{"estale-retries", "3"},
+}
+
+// targetProfiles are the flag defaults of each profile
+var targetProfiles = map[string][]profileSetting{
+	TargetProfileLocal:   nil,
+	TargetProfileFUSE:    fuseSettings,
+	TargetProfileFUSESim: append(append([]profileSetting(nil), fuseSettings...), profileSetting{"readdir-delay", "1ms"}),
+}
+
+// targetProfileNames lists the profiles in the order of the help text
+var targetProfileNames = []string{TargetProfileLocal, TargetProfileFUSE, TargetProfileFUSESim}
+
+// Storage profiles of -storage-profile
+const (
+	StorageProfileSSD   = "ssd"
+	StorageProfileHDD   = "hdd"
+	StorageProfileNFS   = "nfs"
+	StorageProfileSMB   = "smb"
+	StorageProfileFUSE  = "fuse"
+	StorageProfileTmpfs = "tmpfs"
+)
+
+// storageProfiles are the flag defaults of each storage class:
+//   - ssd: cold caches so that the device is measured, and more workers,
+//     since flash serves many requests at once
+//   - hdd: cold caches, few workers and a small channel, so that more
+//     directories are processed inline depth-first instead of making the
+//     head seek between the branches of many workers
+//   - nfs: warm caches, many workers and a large channel to hide the round
+//     trips, generous timeouts and ESTALE retries
+//   - smb: like nfs, and a sweep of -max-inflight-io, since SMB clients
+//     are bound by the credits and connections the server grants rather
+//     than by their workers
+//   - fuse: the settings of -target-profile fuse with warm caches
+//   - tmpfs: warm caches, there is no device, and no more workers than
+//     CPUs since the scan is bound by the CPU
+var storageProfiles = map[string][]profileSetting{
+	StorageProfileSSD: {
+		{"workers-multiplier", "0.5,1,2,4,8"},
+		{"cache-mode", CacheModeCold},
+	},
+	StorageProfileHDD: {
+		{"workers-multiplier", "0.25,0.5,1"},
+		{"channel-capacity", "100"},
+		{"cache-mode", CacheModeCold},
+	},
+	StorageProfileNFS: {
+		{"workers-multiplier", "1,2,4,8"},
+		{"channel-capacity", "10000"},
+		{"scan-timeout", "30m"},
+		{"stall-timeout", "2m"},
+		{"estale-retries", "3"},
+		{"cache-mode", CacheModeWarm},
+	},
+	StorageProfileSMB: {
+		{"workers-multiplier", "1,2,4,8"},
+		{"max-inflight-io", "0,2,8,32"},
+		{"scan-timeout", "30m"},
+		{"stall-timeout", "2m"},
+		{"estale-retries", "3"},
+		{"cache-mode", CacheModeWarm},
+	},
+	StorageProfileFUSE: append(append([]profileSetting(nil), fuseSettings...), profileSetting{"cache-mode", CacheModeWarm}),
+	StorageProfileTmpfs: {
+		{"workers-multiplier", "0.5,1"},
+		{"cache-mode", CacheModeWarm},
+	},
+}
+
+// storageProfileNames lists the storage profiles in the order of the help text
+var storageProfileNames = []string{StorageProfileSSD, StorageProfileHDD, StorageProfileNFS, StorageProfileSMB, StorageProfileFUSE, StorageProfileTmpfs}
+
+// applyTargetProfile sets the flags of a profile that were not given on the
+// command line and returns the settings it applied
+func applyTargetProfile(fs *flag.FlagSet, profile string) ([]profileSetting, error) {
+	settings, ok := targetProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s (%s)", profile, strings.Join(targetProfileNames, ", "))
+	}
+	return applyProfileSettings(fs, settings)
+}
+
+// applyStorageProfile sets the flags of a storage profile like
+// applyTargetProfile; the empty profile sets nothing
+func applyStorageProfile(fs *flag.FlagSet, profile string) ([]profileSetting, error) {
+	if profile == "" {
+		return nil, nil
+	}
+	settings, ok := storageProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s (%s)", profile, strings.Join(storageProfileNames, ", "))
+	}
+	return applyProfileSettings(fs, settings)
+}
+
+// applyProfileSettings sets the flags of settings that were not given on the
+// command line or by an earlier profile and returns those it set
+func applyProfileSettings(fs *flag.FlagSet, settings []profileSetting) ([]profileSetting, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	applied := []profileSetting{}
+	for _, s := range settings {
+		if given[s.flag] {
+			continue
+		}
+		if err := fs.Set(s.flag, s.value); err != nil {
+			return nil, fmt.Errorf("-%s %s: %v", s.flag, s.value, err)
+		}
+		applied = append(applied, s)
+	}
+	return applied, nil
+}
+
+// profileSettingsLabel formats settings as command line flags
+func profileSettingsLabel(settings []profileSetting) string {
+	flags := make([]string, len(settings))
+	for i, s := range settings {
+		flags[i] = fmt.Sprintf("-%s %s", s.flag, s.value)
+	}
+	return strings.Join(flags, " ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyTargetProfile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	scanTimeout := fs.Duration("scan-timeout", 0, "")
+	stallTimeout := fs.Duration("stall-timeout", 0, "")
+	multipliers := fs.String("workers-multiplier", defaultWorkerMultipliers, "")
+	retries := fs.Int("estale-retries", 0, "")
+	delay := fs.Duration("readdir-delay", 0, "")
+	if err := fs.Parse([]string{"-stall-timeout", "5m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := applyTargetProfile(fs, TargetProfileFUSESim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The given -stall-timeout is kept
+	want := []profileSetting{{"scan-timeout", "10m"}, {"workers-multiplier", "0.25,0.5,1"}, {"estale-retries", "3"}, {"readdir-delay", "1ms"}}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied %v, want %v", applied, want)
+	}
+	if *scanTimeout != 10*time.Minute || *stallTimeout != 5*time.Minute || *multipliers != "0.25,0.5,1" || *retries != 3 || *delay != time.Millisecond {
+		t.Errorf("flags after the profile: %v %v %s %d %v", *scanTimeout, *stallTimeout, *multipliers, *retries, *delay)
+	}
+
+	if applied, err := applyTargetProfile(fs, TargetProfileLocal); err != nil || len(applied) != 0 {
+		t.Errorf("local profile applied %v, %v", applied, err)
+	}
+	if _, err := applyTargetProfile(fs, "nfs"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+func TestApplyStorageProfile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Duration("scan-timeout", 0, "")
+	fs.Duration("stall-timeout", 0, "")
+	multipliers := fs.String("workers-multiplier", defaultWorkerMultipliers, "")
+	capacity := fs.String("channel-capacity", "1000", "")
+	fs.Int("estale-retries", 0, "")
+	cacheMode := fs.String("cache-mode", CacheModeWarm, "")
+	if err := fs.Parse([]string{"-cache-mode", CacheModeWarm}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The target profile goes first and its settings are kept
+	if _, err := applyTargetProfile(fs, TargetProfileFUSE); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := applyStorageProfile(fs, StorageProfileHDD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []profileSetting{{"channel-capacity", "100"}}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied %v, want %v", applied, want)
+	}
+	if *multipliers != "0.25,0.5,1" || *capacity != "100" || *cacheMode != CacheModeWarm {
+		t.Errorf("flags after the profiles: %s %s %s", *multipliers, *capacity, *cacheMode)
+	}
+
+	if applied, err := applyStorageProfile(fs, ""); err != nil || applied != nil {
+		t.Errorf("no storage profile applied %v, %v", applied, err)
+	}
+	if _, err := applyStorageProfile(fs, "optane"); err == nil {
+		t.Error("unknown storage profile accepted")
+	}
+	for _, name := range storageProfileNames {
+		if _, ok := storageProfiles[name]; !ok {
+			t.Errorf("no settings for %s", name)
+		}
+	}
+}
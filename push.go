@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushTimeout bounds each request to a metrics endpoint
+const pushTimeout = 30 * time.Second
+
+// metricsServiceName identifies the benchmark in pushed metrics
+const metricsServiceName = "go-parallel-dir-scan-benchmark"
+
+// cellTags returns the attributes identifying the cell of a result
+func cellTags(r BenchmarkResult, host string) [][2]string {
+	return [][2]string{
+		{"host", host},
+		{"structure", r.Structure},
+		{"strategy", r.Strategy},
+		{"label", r.Label()},
+		{"workers", strconv.Itoa(r.Workers)},
+		{"listing", r.Listing},
+		{"target", r.Target},
+	}
+}
+
+// escapeInfluxTag escapes a tag key or value of the InfluxDB line protocol
+var escapeInfluxTag = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace
+
+// influxLine formats one point of the InfluxDB line protocol. Empty tag
+// values are omitted as the protocol does not allow them.
+func influxLine(measurement string, tags [][2]string, fields []string, timestamp time.Time) string {
+	var b strings.Builder
+	b.WriteString(escapeInfluxTag(measurement))
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", escapeInfluxTag(tag[0]), escapeInfluxTag(tag[1]))
+	}
+	fmt.Fprintf(&b, " %s %d", strings.Join(fields, ","), timestamp.UnixNano())
+	return b.String()
+}
+
+// influxLines returns one dirscan_cell point per result and one dirscan_run
+// point per individual run
+func influxLines(results []BenchmarkResult, host string, timestamp time.Time) []string {
+	lines := []string{}
+	for _, r := range results {
+		tags := cellTags(r, host)
+		lines = append(lines, influxLine("dirscan_cell", tags, []string{
+			fmt.Sprintf("duration_ns=%di", int64(r.Duration)),
+			fmt.Sprintf("files=%di", r.FilesScanned),
+			fmt.Sprintf("dirs=%di", r.DirsScanned),
+			fmt.Sprintf("speedup=%g", r.Speedup),
+			fmt.Sprintf("allocs=%di", r.Allocs),
+			fmt.Sprintf("bytes_allocated=%di", r.BytesAllocated),
+			fmt.Sprintf("num_gc=%di", r.NumGC),
+			fmt.Sprintf("scan_errors=%di", r.ScanErrors),
+			fmt.Sprintf("timed_out=%t", r.TimedOut),
+		}, timestamp))
+		for i, run := range r.runs {
+			runTags := append(append([][2]string{}, tags...), [2]string{"run", strconv.Itoa(i + 1)})
+			lines = append(lines, influxLine("dirscan_run", runTags, []string{
+				fmt.Sprintf("duration_ns=%di", int64(run.Duration)),
+				fmt.Sprintf("files=%di", run.FilesScanned),
+				fmt.Sprintf("dirs=%di", run.DirsScanned),
+				fmt.Sprintf("allocs=%di", run.Allocs),
+				fmt.Sprintf("scan_errors=%di", run.ScanErrors),
+			}, timestamp))
+		}
+	}
+	return lines
+}
+
+// pushInflux writes the results to an InfluxDB write endpoint, e.g.
+// http://localhost:8086/api/v2/write?org=lab&bucket=bench&precision=ns
+func pushInflux(url, token string, results []BenchmarkResult) error {
+	host, _ := os.Hostname()
+	body := strings.Join(influxLines(results, host, time.Now()), "\n") + "\n"
+	headers := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	if token != "" {
+		headers["Authorization"] = "Token " + token
+	}
+	return postMetrics(url, headers, []byte(body))
+}
+
+// OTLP/HTTP JSON encoding of the metrics data model
+type (
+	otlpAttribute struct {
+		Key   string            `json:"key"`
+		Value map[string]string `json:"value"`
+	}
+	otlpDataPoint struct {
+		Attributes   []otlpAttribute `json:"attributes"`
+		TimeUnixNano string          `json:"timeUnixNano"`
+		AsDouble     float64         `json:"asDouble"`
+	}
+	otlpMetric struct {
+		Name  string `json:"name"`
+		Unit  string `json:"unit,omitempty"`
+		Gauge struct {
+			DataPoints []otlpDataPoint `json:"dataPoints"`
+		} `json:"gauge"`
+	}
+)
+
+// otlpAttributes converts tags to OTLP string attributes
+func otlpAttributes(tags [][2]string) []otlpAttribute {
+	attributes := []otlpAttribute{}
+	for _, tag := range tags {
+		if tag[1] != "" {
+			attributes = append(attributes, otlpAttribute{Key: tag[0], Value: map[string]string{"stringValue": tag[1]}})
+		}
+	}
+	return attributes
+}
+
+// otlpPayload returns an ExportMetricsServiceRequest with one gauge per
+// measured value; cell and run values are separate metrics
+func otlpPayload(results []BenchmarkResult, host string, timestamp time.Time) map[string]interface{} {
+	metrics := map[string]*otlpMetric{}
+	order := []string{}
+	add := func(name, unit string, tags [][2]string, value float64) {
+		m, ok := metrics[name]
+		if !ok {
+			m = &otlpMetric{Name: name, Unit: unit}
+			metrics[name] = m
+			order = append(order, name)
+		}
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpDataPoint{
+			Attributes:   otlpAttributes(tags),
+			TimeUnixNano: strconv.FormatInt(timestamp.UnixNano(), 10),
+			AsDouble:     value,
+		})
+	}
+
+	for _, r := range results {
+		tags := cellTags(r, "")
+		add("dirscan.cell.duration", "s", tags, r.Duration.Seconds())
+		add("dirscan.cell.files", "{file}", tags, float64(r.FilesScanned))
+		add("dirscan.cell.dirs", "{dir}", tags, float64(r.DirsScanned))
+		add("dirscan.cell.speedup", "1", tags, r.Speedup)
+		add("dirscan.cell.allocs", "{alloc}", tags, float64(r.Allocs))
+		add("dirscan.cell.scan_errors", "{error}", tags, float64(r.ScanErrors))
+		for i, run := range r.runs {
+			runTags := append(append([][2]string{}, tags...), [2]string{"run", strconv.Itoa(i + 1)})
+			add("dirscan.run.duration", "s", runTags, run.Duration.Seconds())
+			add("dirscan.run.files", "{file}", runTags, float64(run.FilesScanned))
+		}
+	}
+
+	ordered := make([]*otlpMetric, len(order))
+	for i, name := range order {
+		ordered[i] = metrics[name]
+	}
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes([][2]string{{"service.name", metricsServiceName}, {"host.name", host}}),
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": metricsServiceName},
+				"metrics": ordered,
+			}},
+		}},
+	}
+}
+
+// pushOTLP sends the results to an OTLP/HTTP metrics endpoint using the JSON
+// encoding, e.g. http://localhost:4318/v1/metrics
+func pushOTLP(url string, headers map[string]string, results []BenchmarkResult) error {
+	host, _ := os.Hostname()
+	body, err := json.Marshal(otlpPayload(results, host, time.Now()))
+	if err != nil {
+		return err
+	}
+	all := map[string]string{"Content-Type": "application/json"}
+	for key, value := range headers {
+		all[key] = value
+	}
+	return postMetrics(url, all, body)
+}
+
+// parseHeaders parses a comma separated list of key=value HTTP headers
+func parseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("header must be key=value: %s", field)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// postMetrics posts a payload and fails on a non-2xx response
+func postMetrics(url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
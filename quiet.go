@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// quietOutput discards the progress and fixture output written to os.Stdout
+// so that stdout carries only the final results. Lines reporting errors or
+// warnings are passed on to stderr.
+type quietOutput struct {
+	stdout *os.File
+	pipe   *os.File
+	done   chan struct{}
+}
+
+// startQuiet redirects os.Stdout until Close
+func startQuiet() (*quietOutput, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	q := &quietOutput{stdout: os.Stdout, pipe: w, done: make(chan struct{})}
+	os.Stdout = w
+	go func() {
+		defer close(q.done)
+		defer r.Close()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if line := scanner.Text(); isProblemLine(line) {
+				fmt.Fprintln(os.Stderr, strings.TrimSpace(line))
+			}
+		}
+		// Keep draining so that writers never block on a full pipe
+		io.Copy(io.Discard, r)
+	}()
+	return q, nil
+}
+
+// isProblemLine reports whether a line of output reports an error or a warning
+func isProblemLine(line string) bool {
+	return strings.Contains(line, "エラー") || strings.Contains(line, "警告")
+}
+
+// Stdout returns the writer for the final results: the original stdout
+// while quiet, os.Stdout otherwise
+func (q *quietOutput) Stdout() io.Writer {
+	if q == nil {
+		return os.Stdout
+	}
+	return q.stdout
+}
+
+// Close restores os.Stdout and waits until the filtered output is flushed
+func (q *quietOutput) Close() {
+	if q == nil || q.pipe == nil {
+		return
+	}
+	os.Stdout = q.stdout
+	q.pipe.Close()
+	<-q.done
+	q.pipe = nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Budgets of the quota subcommand
+const (
+	QuotaFiles = "files"
+	QuotaBytes = "bytes"
+	QuotaTime  = "time"
+)
+
+// quotaWatch counts the files of a scan against the budgets and, once one is
+// exceeded, records the moment and cancels the scan unless it only alerts
+type quotaWatch struct {
+	maxFiles, maxBytes int64
+	files, bytes       int64
+	start              time.Time
+	cancel             func()
+	alert              bool
+
+	mu      sync.Mutex
+	trigger string
+	at      time.Duration
+}
+
+// add counts a file found by a scan worker; sizes are only read with a byte
+// budget, so that a file budget costs no stat
+func (q *quotaWatch) add(dir string, entry fs.DirEntry) {
+	if files := atomic.AddInt64(&q.files, 1); q.maxFiles > 0 && files > q.maxFiles {
+		q.exceed(QuotaFiles)
+	}
+	if q.maxBytes > 0 && entry.Type().IsRegular() {
+		if info, err := entry.Info(); err == nil && atomic.AddInt64(&q.bytes, info.Size()) > q.maxBytes {
+			q.exceed(QuotaBytes)
+		}
+	}
+}
+
+// exceed records the first budget exceeded and stops the scan
+func (q *quotaWatch) exceed(trigger string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.trigger != "" {
+		return
+	}
+	q.trigger, q.at = trigger, time.Since(q.start)
+	if !q.alert {
+		q.cancel()
+	}
+}
+
+// exceeded returns the budget exceeded first and when, empty when none was
+func (q *quotaWatch) exceeded() (string, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.trigger, q.at
+}
+
+// quotaTrial is one scan against the budgets
+type quotaTrial struct {
+	// trigger is the budget exceeded first, empty when the scan finished
+	// within all budgets
+	trigger string
+	// at is the time from the start until the budget was exceeded and stop
+	// the time from then until the scan returned
+	at, stop time.Duration
+	// files is counted until the scan returned
+	files     int64
+	abandoned bool
+}
+
+// quotaScan scans root until it is done or a budget is exceeded
+func quotaScan(root, strategy string, workers int, maxFiles, maxBytes int64, maxTime time.Duration, alert bool) (quotaTrial, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := &quotaWatch{maxFiles: maxFiles, maxBytes: maxBytes, cancel: cancel, alert: alert}
+	options := defaultScanOptions()
+	options.ctx = ctx
+	options.files = q.add
+	scanner, err := newScanner(strategy, workers, options)
+	if err != nil {
+		return quotaTrial{}, err
+	}
+
+	q.start = time.Now()
+	if maxTime > 0 {
+		timer := time.AfterFunc(maxTime, func() { q.exceed(QuotaTime) })
+		defer timer.Stop()
+	}
+	_, abandoned, scanErr := runScan(ctx, scanner.Scan, root)
+	returned := time.Since(q.start)
+	trigger, at := q.exceeded()
+	if trigger == "" && scanErr != nil {
+		return quotaTrial{}, scanErr
+	}
+	trial := quotaTrial{trigger: trigger, at: at, files: atomic.LoadInt64(&q.files), abandoned: abandoned}
+	if trigger != "" {
+		trial.stop = returned - at
+	}
+	return trial, nil
+}
+
+// runQuota scans a tree against file, byte and time budgets with every
+// strategy and reports how quickly each detects an exceeded budget and stops
+func runQuota(args []string) int {
+	fs := flag.NewFlagSet("quota", flag.ContinueOnError)
+	strategyList := fs.String("strategies", strings.Join(fileHookStrategies(), ","), "comma separated strategies: "+strings.Join(fileHookStrategies(), ", "))
+	workerList := fs.String("workers", strconv.Itoa(runtime.NumCPU()), "comma separated worker counts")
+	maxFiles := fs.Int64("max-files", 0, "file budget; the scan stops once more files are found (0 = none)")
+	maxBytes := fs.Int64("max-bytes", 0, "budget of the total size of the regular files found (0 = none)")
+	maxTime := fs.Duration("max-time", 0, "time budget of the scan (0 = none)")
+	alert := fs.Bool("alert", false, "only report when a budget is exceeded and let the scan run to the end")
+	runs := fs.Int("runs", 3, "scans per strategy and worker count, after one warm-up scan")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *runs < 1 || *maxFiles < 0 || *maxBytes < 0 || *maxTime < 0 || (*maxFiles == 0 && *maxBytes == 0 && *maxTime == 0) {
+		fmt.Println("使い方: quota [-max-files N] [-max-bytes N] [-max-time 1s] [-alert] [-strategies recursive-task,...] [-workers 4,...] [-runs 3] <ディレクトリ>")
+		return 2
+	}
+	strategies, err := filterStrategies(*strategyList, fileHookStrategies())
+	if err != nil {
+		fmt.Printf("エラー: -strategies: %v\n", err)
+		return 2
+	}
+	workerCounts, err := parseIntList(*workerList)
+	if err != nil {
+		fmt.Printf("エラー: -workers: %v\n", err)
+		return 2
+	}
+	root := fs.Arg(0)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	}
+
+	budgets := []string{}
+	if *maxFiles > 0 {
+		budgets = append(budgets, fmt.Sprintf("ファイル %d", *maxFiles))
+	}
+	if *maxBytes > 0 {
+		budgets = append(budgets, formatBytes(*maxBytes))
+	}
+	if *maxTime > 0 {
+		budgets = append(budgets, maxTime.String())
+	}
+	mode := "超えたら停止"
+	if *alert {
+		mode = "警告のみ"
+	}
+	fmt.Printf("上限の監視: %s (%s, %s, 各 %d 回)\n", root, strings.Join(budgets, ", "), mode, *runs)
+
+	table := &textTable{
+		header: []string{"Strategy", "Workers", "Exceeded", "Trigger", "Detect p50", "Stop p50", "Stop max", "Files p50", "Overshoot"},
+		right:  []bool{false, true, true, false, true, true, true, true, true},
+	}
+	anyExceeded := false
+	for _, strategy := range strategies {
+		for _, workers := range strategyWorkerCounts(strategy, workerCounts) {
+			fmt.Printf("  %s ワーカー数 %d ...", strategy, workers)
+			// The warm-up scan fills the cache, so that the first run is not
+			// the only one reading cold
+			trials := []quotaTrial{}
+			for i := 0; i <= *runs; i++ {
+				trial, err := quotaScan(root, strategy, workers, *maxFiles, *maxBytes, *maxTime, *alert)
+				if err != nil {
+					fmt.Printf(" エラー: %v", err)
+					break
+				}
+				if i > 0 {
+					trials = append(trials, trial)
+				}
+			}
+			fmt.Println(" 完了")
+			row, exceeded := summarizeQuotaTrials(trials, *maxFiles, *alert)
+			anyExceeded = anyExceeded || exceeded
+			table.add(append([]string{strategy, strconv.Itoa(workers)}, row...)...)
+		}
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+	fmt.Println("\nDetect: スキャン開始から上限を超えるまで / Stop: 上限を超えてからスキャンが戻るまで / Overshoot: 停止までに -max-files を超えて数えたファイル数")
+	if anyExceeded {
+		return ExitQuotaExceeded
+	}
+	return ExitOK
+}
+
+// summarizeQuotaTrials returns the table cells of the trials of one strategy
+// and worker count, and whether any trial exceeded a budget
+func summarizeQuotaTrials(trials []quotaTrial, maxFiles int64, alert bool) ([]string, bool) {
+	ats, stops, files, overshoots := []float64{}, []float64{}, []float64{}, []float64{}
+	triggers := map[string]int{}
+	order := []string{}
+	abandoned := 0
+	for _, t := range trials {
+		files = append(files, float64(t.files))
+		if t.trigger == "" {
+			continue
+		}
+		if triggers[t.trigger] == 0 {
+			order = append(order, t.trigger)
+		}
+		triggers[t.trigger]++
+		ats = append(ats, t.at.Seconds())
+		stops = append(stops, t.stop.Seconds())
+		if t.trigger == QuotaFiles {
+			overshoots = append(overshoots, float64(t.files-maxFiles))
+		}
+		if t.abandoned {
+			abandoned++
+		}
+	}
+	duration := func(seconds float64) string { return formatDuration(time.Duration(seconds * float64(time.Second))) }
+	row := []string{fmt.Sprintf("%d/%d", len(ats), len(trials)), strings.Join(order, ","), "-", "-", "-", "-", "-"}
+	if len(files) > 0 {
+		row[5] = fmt.Sprintf("%.0f", medianOf(files))
+	}
+	if len(ats) == 0 {
+		return row, false
+	}
+	row[2] = duration(medianOf(ats))
+	if !alert {
+		largest := stops[0]
+		for _, s := range stops {
+			largest = max(largest, s)
+		}
+		row[3], row[4] = duration(medianOf(stops)), duration(largest)
+		if abandoned > 0 {
+			row[4] += fmt.Sprintf(" (停止せず %d)", abandoned)
+		}
+	}
+	if len(overshoots) > 0 {
+		row[6] = fmt.Sprintf("%.0f", medianOf(overshoots))
+	}
+	return row, true
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runReport dispatches the report subcommands and returns the exit code
+func runReport(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("使い方: report <plot|merge|normalize|analyze|convert> [options] <results file>...")
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "plot":
+		err = runReportPlot(args[1:])
+	case "merge":
+		err = runReportMerge(args[1:])
+	case "normalize":
+		err = runReportNormalize(args[1:])
+	case "analyze":
+		err = runReportAnalyze(args[1:])
+	case "convert":
+		err = runReportConvert(args[1:])
+	default:
+		err = fmt.Errorf("unknown report command: %s", args[0])
+	}
+
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runReportPlot renders charts from a saved results file
+func runReportPlot(args []string) error {
+	fs := flag.NewFlagSet("report plot", flag.ContinueOnError)
+	outDir := fs.String("out", "benchmark", "output directory for charts")
+	formats := fs.String("format", "svg,png", "comma separated chart formats: svg,png")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("results file is required")
+	}
+
+	results, err := loadResultsCSV(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	files, err := plotResults(results, *outDir, *formats)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Printf("グラフを出力しました: %s\n", file)
+	}
+	return nil
+}
+
+// runReportMerge combines JSON results files of several machines or
+// invocations into one dataset, written as JSON or as a CSV of per-cell rows
+// carrying the host and session of each row
+func runReportMerge(args []string) error {
+	fs := flag.NewFlagSet("report merge", flag.ContinueOnError)
+	out := fs.String("out", "", "merged file, .json or .csv (default benchmark/merged_<timestamp>.json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one JSON results file is required")
+	}
+
+	merged, skipped, err := mergeResultsFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, key := range skipped {
+		fmt.Printf("重複したセッションをスキップしました: %s\n", key)
+	}
+
+	filename := *out
+	if filename == "" {
+		if err := os.MkdirAll("benchmark", 0755); err != nil {
+			return err
+		}
+		filename = fmt.Sprintf("benchmark/merged_%s.json", time.Now().Format("20060102_150405"))
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		rows := [][]string{}
+		for _, session := range merged.Sessions {
+			rows = append(rows, sessionCSVRows(session)...)
+		}
+		err = writeResultsCSV(filename, "aggregate", rows)
+	} else {
+		err = writeResultsJSON(merged, filename)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d セッションを結合しました: %s\n", len(merged.Sessions), filename)
+	return nil
+}
+
+// loadResultsCSV reads a results file written by exportResultsToCSV.
+// Columns are looked up by header name and the columns an older schema
+// version lacks are filled by readResultsCSVFile, so files from older
+// versions can still be loaded. The rows of a runs file are rejected, as
+// reports compare cells.
+func loadResultsCSV(filename string) ([]BenchmarkResult, error) {
+	c, err := readResultsCSVFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	warnNewerSchema(filename, c.version)
+	for _, name := range []string{"Structure", "Strategy", "Workers", "Duration_ms"} {
+		if !slices.Contains(c.header, name) {
+			return nil, fmt.Errorf("%s: missing column %s", filename, name)
+		}
+	}
+
+	results := []BenchmarkResult{}
+	for line, row := range c.rows {
+		field := func(name string) string { return row[name] }
+		if field("Run") != "" {
+			return nil, fmt.Errorf("%s: per-run rows cannot be reported, use the benchmark_results file", filename)
+		}
+
+		var r BenchmarkResult
+		r.Structure = field("Structure")
+		r.Strategy = field("Strategy")
+		r.Listing = field("Listing")
+		r.Target = field("Target")
+		r.Filesystem = field("Filesystem")
+		r.TargetProfile = field("TargetProfile")
+		r.StorageProfile = field("StorageProfile")
+		r.CacheMode = field("CacheMode")
+
+		workers, err := strconv.Atoi(field("Workers"))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid Workers: %v", filename, line+2, err)
+		}
+		r.Workers = workers
+		r.WorkersPerCPU = -1
+		if perCPU, err := strconv.ParseFloat(field("WorkersPerCPU"), 64); err == nil {
+			r.WorkersPerCPU = perCPU
+		}
+
+		durationMs, err := strconv.ParseFloat(field("Duration_ms"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid Duration_ms: %v", filename, line+2, err)
+		}
+		r.Duration = time.Duration(durationMs * float64(time.Millisecond))
+
+		r.FilesScanned, r.DirsScanned = -1, -1
+		if files, err := strconv.Atoi(field("Files")); err == nil {
+			r.FilesScanned = files
+		}
+		if dirs, err := strconv.Atoi(field("Dirs")); err == nil {
+			r.DirsScanned = dirs
+		}
+		r.Speedup, _ = strconv.ParseFloat(field("Speedup"), 64)
+		r.ConcurrentScans, _ = strconv.Atoi(field("ConcurrentScans"))
+		r.ChannelCapacity, _ = strconv.Atoi(field("ChannelCapacity"))
+		r.BatchSize, _ = strconv.Atoi(field("BatchSize"))
+		r.Fallback = field("Fallback")
+		r.TaskOrder = field("TaskOrder")
+		r.Counters = field("Counters")
+		r.CutoffDepth, _ = strconv.Atoi(field("CutoffDepth"))
+		r.GoroutineCap = -1
+		if goroutineCap, err := strconv.Atoi(field("GoroutineCap")); err == nil {
+			r.GoroutineCap = goroutineCap
+		}
+		r.ReadDirChunk, _ = strconv.Atoi(field("ReadDirChunk"))
+		r.Hardlinks = field("Hardlinks")
+		r.ChurnRate, _ = strconv.Atoi(field("ChurnRate"))
+		r.ChurnOps, _ = strconv.ParseInt(field("ChurnOps"), 10, 64)
+		r.ScanErrors, _ = strconv.ParseInt(field("ScanErrors"), 10, 64)
+		r.PermissionErrors, _ = strconv.ParseInt(field("PermissionErrors"), 10, 64)
+		r.NotFoundErrors, _ = strconv.ParseInt(field("NotFoundErrors"), 10, 64)
+		r.IOErrors, _ = strconv.ParseInt(field("IOErrors"), 10, 64)
+		r.TimedOut, _ = strconv.ParseBool(field("TimedOut"))
+		r.Stalled, _ = strconv.ParseBool(field("Stalled"))
+		r.Symlinks = field("Symlinks")
+		r.MaxReadDirPerSec, _ = strconv.Atoi(field("MaxReadDirPerSec"))
+		r.Priority = field("Priority")
+		r.Workload = field("Workload")
+		r.CopyWorkers, _ = strconv.Atoi(field("CopyWorkers"))
+		r.CopiedFiles, _ = strconv.ParseInt(field("CopiedFiles"), 10, 64)
+		r.CopiedBytes, _ = strconv.ParseInt(field("CopiedBytes"), 10, 64)
+		r.StatCalls, _ = strconv.ParseInt(field("StatCalls"), 10, 64)
+		r.StatBytes, _ = strconv.ParseInt(field("StatBytes"), 10, 64)
+		r.StatCall = field("StatCall")
+		r.StatFallbacks, _ = strconv.ParseInt(field("StatFallbacks"), 10, 64)
+		r.XattrFiles, _ = strconv.ParseInt(field("XattrFiles"), 10, 64)
+		r.XattrCalls, _ = strconv.ParseInt(field("XattrCalls"), 10, 64)
+		r.XattrBytes, _ = strconv.ParseInt(field("XattrBytes"), 10, 64)
+		for j, column := range []string{"Age1d", "Age1w", "Age1m", "Age1y", "AgeOlder"} {
+			r.AgeHistogram[j], _ = strconv.ParseInt(field(column), 10, 64)
+		}
+		r.MemLimit, _ = strconv.ParseInt(field("MemLimitBytes"), 10, 64)
+		r.PeakMemory = -1
+		if peakMemory, err := strconv.ParseInt(field("PeakMemoryBytes"), 10, 64); err == nil {
+			r.PeakMemory = peakMemory
+			r.GCLimited, _ = strconv.ParseBool(field("GCLimited"))
+		}
+		r.CopySkipped, _ = strconv.ParseInt(field("CopySkipped"), 10, 64)
+		r.DTypeEntries, r.DTypeFallbacks = -1, -1
+		if entries, err := strconv.ParseInt(field("DTypeEntries"), 10, 64); err == nil {
+			r.DTypeEntries = entries
+			r.DTypeFallbacks, _ = strconv.ParseInt(field("DTypeFallbacks"), 10, 64)
+		}
+		r.ReadDirPerSec, _ = strconv.ParseFloat(field("ReadDirPerSec"), 64)
+		if ms, err := strconv.ParseFloat(field("ThrottleWait_ms"), 64); err == nil {
+			r.ThrottleWait = time.Duration(ms * float64(time.Millisecond))
+		}
+		if ms, err := strconv.ParseFloat(field("ReadDirDelay_ms"), 64); err == nil {
+			r.ReadDirDelay = time.Duration(ms * float64(time.Millisecond))
+		}
+		r.StaleRetries, _ = strconv.ParseInt(field("StaleRetries"), 10, 64)
+		r.MaxInflightIO, _ = strconv.Atoi(field("MaxInflightIO"))
+		if ms, err := strconv.ParseFloat(field("InflightWait_ms"), 64); err == nil {
+			r.InflightWait = time.Duration(ms * float64(time.Millisecond))
+		}
+		r.Allocs, _ = strconv.ParseUint(field("Allocs"), 10, 64)
+
+		numGC, _ := strconv.ParseUint(field("NumGC"), 10, 32)
+		r.NumGC = uint32(numGC)
+		pauseMs, _ := strconv.ParseFloat(field("GCPause_ms"), 64)
+		r.GCPause = time.Duration(pauseMs * float64(time.Millisecond))
+		if allocated, err := strconv.ParseUint(field("BytesAllocated"), 10, 64); err == nil {
+			r.BytesAllocated = allocated
+		} else {
+			bytesPerFile, _ := strconv.ParseFloat(field("BytesPerFile"), 64)
+			r.BytesAllocated = uint64(bytesPerFile * float64(r.FilesScanned))
+		}
+		r.UserCPU, r.SystemCPU = -1, -1
+		if userMs, err := strconv.ParseFloat(field("UserCPU_ms"), 64); err == nil {
+			systemMs, _ := strconv.ParseFloat(field("SystemCPU_ms"), 64)
+			r.UserCPU = time.Duration(userMs * float64(time.Millisecond))
+			r.SystemCPU = time.Duration(systemMs * float64(time.Millisecond))
+		}
+		r.MaxRSS = -1
+		if maxRSS, err := strconv.ParseInt(field("MaxRSSBytes"), 10, 64); err == nil {
+			r.MaxRSS = maxRSS
+		}
+
+		r.PeakFDs = -1
+		if peakFDs, err := strconv.Atoi(field("PeakFDs")); err == nil {
+			r.PeakFDs = peakFDs
+		}
+		r.PeakThreads = -1
+		if peakThreads, err := strconv.Atoi(field("PeakThreads")); err == nil {
+			r.PeakThreads = peakThreads
+		}
+		r.CPUPeak = -1
+		if cpuPeak, err := strconv.ParseFloat(field("CPUPeak"), 64); err == nil {
+			r.CPUPeak = cpuPeak
+		}
+		r.HostCPU, r.OtherCPU, r.LoadAvg = -1, -1, -1
+		if hostCPU, err := strconv.ParseFloat(field("HostCPU"), 64); err == nil {
+			r.HostCPU = hostCPU
+			r.OtherCPU, _ = strconv.ParseFloat(field("OtherCPU"), 64)
+			r.Noisy, _ = strconv.ParseBool(field("Noisy"))
+		}
+		if load, err := strconv.ParseFloat(field("LoadAvg1"), 64); err == nil {
+			r.LoadAvg = load
+		}
+		r.CPUFreqMHz, r.CPUFreqMinMHz, r.ThrottleEvents = -1, -1, -1
+		if mhz, err := strconv.ParseFloat(field("CPUFreq_MHz"), 64); err == nil {
+			r.CPUFreqMHz = mhz
+			r.CPUFreqMinMHz, _ = strconv.ParseFloat(field("CPUFreqMin_MHz"), 64)
+		}
+		if throttles, err := strconv.ParseInt(field("ThrottleEvents"), 10, 64); err == nil {
+			r.ThrottleEvents = throttles
+		}
+		r.Throttled, _ = strconv.ParseBool(field("Throttled"))
+		r.Outliers, _ = strconv.Atoi(field("Outliers"))
+		r.TrimmedRuns, _ = strconv.Atoi(field("TrimmedRuns"))
+		r.DurationCI = -1
+		if ci, err := strconv.ParseFloat(field("DurationCI95_ms"), 64); err == nil {
+			r.DurationCI = time.Duration(ci * float64(time.Millisecond))
+		}
+		r.EnergyJoules = -1
+		if energy, err := strconv.ParseFloat(field("Energy_J"), 64); err == nil {
+			r.EnergyJoules = energy
+		}
+		r.UniqueFiles = -1
+		if uniqueFiles, err := strconv.Atoi(field("UniqueFiles")); err == nil {
+			r.UniqueFiles = uniqueFiles
+		}
+		if calls, err := strconv.ParseInt(field("ReadDirCalls"), 10, 64); err == nil {
+			micros := func(name string) time.Duration {
+				us, _ := strconv.ParseFloat(field(name), 64)
+				return time.Duration(us * float64(time.Microsecond))
+			}
+			r.ReadDirLatency = &LatencySummary{
+				Count: calls,
+				P50:   micros("ReadDirP50_us"),
+				P95:   micros("ReadDirP95_us"),
+				P99:   micros("ReadDirP99_us"),
+				Max:   micros("ReadDirMax_us"),
+			}
+		}
+		r.Straggler = -1
+		if ms, err := strconv.ParseFloat(field("Straggler_ms"), 64); err == nil {
+			r.Straggler = time.Duration(ms * float64(time.Millisecond))
+		}
+		for _, name := range []string{"Files50_ms", "Files90_ms", "Files99_ms", "Files100_ms"} {
+			ms, err := strconv.ParseFloat(field(name), 64)
+			if err != nil {
+				r.FileProgress = nil
+				break
+			}
+			r.FileProgress = append(r.FileProgress, time.Duration(ms*float64(time.Millisecond)))
+		}
+		r.PeakHeap = -1
+		if peakHeap, err := strconv.ParseInt(field("PeakHeapBytes"), 10, 64); err == nil {
+			r.PeakHeap = peakHeap
+		}
+
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// resultsJSONSchema is the version of the JSON results layout
+const resultsJSONSchema = 1
+
+// SessionMetadata describes the machine and invocation that produced results
+type SessionMetadata struct {
+	// Session is the start time of the export, YYYYMMDD_HHMMSS
+	Session   string
+	Host      string
+	OS        string
+	Arch      string
+	CPUs      int
+	GoVersion string
+	// Mode is dev or prod
+	Mode string
+	// Size is the fixture size preset, with "+custom" when dimensions were overridden
+	Size string `json:",omitempty"`
+	// Args are the command line arguments of the benchmark
+	Args []string
+	// ShuffleSeed is the seed of the -shuffle order, 0 when not shuffled
+	ShuffleSeed int64 `json:",omitempty"`
+	// SchemaVersion is the resultsSchemaVersion of the results, 0 for
+	// sessions written before it was recorded
+	SchemaVersion int `json:",omitempty"`
+}
+
+// key identifies a session across merged files
+func (m SessionMetadata) key() string {
+	return m.Host + "/" + m.Session
+}
+
+// CellRecord is a benchmark cell with its individual runs
+type CellRecord struct {
+	BenchmarkResult
+	Runs []BenchmarkResult
+}
+
+// ResultsSession holds the results of one invocation
+type ResultsSession struct {
+	Metadata SessionMetadata
+	Results  []CellRecord
+}
+
+// ResultsFile is the JSON results file: a list of sessions, so that results
+// of several invocations and machines can be kept in one dataset
+type ResultsFile struct {
+	Schema   int
+	Sessions []ResultsSession
+}
+
+// newSessionMetadata describes the current process
+func newSessionMetadata(session, size string, isDev bool) SessionMetadata {
+	host, _ := os.Hostname()
+	return SessionMetadata{
+		Session:   session,
+		Host:      host,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		Mode:      map[bool]string{true: "dev", false: "prod"}[isDev],
+		Size:      size,
+		Args:      os.Args[1:],
+
+		SchemaVersion: resultsSchemaVersion,
+	}
+}
+
+// newResultsSession pairs results with their metadata
+func newResultsSession(metadata SessionMetadata, results []BenchmarkResult) ResultsSession {
+	session := ResultsSession{Metadata: metadata, Results: []CellRecord{}}
+	for _, r := range results {
+		session.Results = append(session.Results, CellRecord{BenchmarkResult: r, Runs: cellRuns(r)})
+	}
+	return session
+}
+
+// results returns the cells of the session with their runs restored
+func (s ResultsSession) results() []BenchmarkResult {
+	results := []BenchmarkResult{}
+	for _, cell := range s.Results {
+		r := cell.BenchmarkResult
+		r.runs = cell.Runs
+		results = append(results, r)
+	}
+	return results
+}
+
+// exportResultsToJSON writes a results file holding one session
+func exportResultsToJSON(session ResultsSession, filename string) error {
+	return writeResultsJSON(&ResultsFile{Schema: resultsJSONSchema, Sessions: []ResultsSession{session}}, filename)
+}
+
+// writeResultsJSON writes file through a temporary file so that an
+// interrupted write does not destroy accumulated results
+func writeResultsJSON(file *ResultsFile, filename string) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// loadResultsJSON reads a results file written by exportResultsToJSON and
+// fills the fields the sessions of older schema versions lack
+func loadResultsJSON(filename string) (*ResultsFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file ResultsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if file.Schema < 1 || file.Schema > resultsJSONSchema {
+		return nil, fmt.Errorf("%s: unsupported schema %d", filename, file.Schema)
+	}
+	for i := range file.Sessions {
+		warnNewerSchema(filename, file.Sessions[i].Metadata.SchemaVersion)
+		file.Sessions[i].upgrade()
+	}
+	return &file, nil
+}
+
+// appendResults adds a session to an accumulated results file, creating it
+// when missing. Files ending in .json keep the metadata and runs of every
+// session; other files are CSV files of aggregate rows.
+func appendResults(filename string, session ResultsSession) error {
+	if !strings.EqualFold(filepath.Ext(filename), ".json") {
+		return appendResultsCSV(filename, session)
+	}
+	file, err := loadResultsJSON(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = &ResultsFile{Schema: resultsJSONSchema}, nil
+	}
+	if err != nil {
+		return err
+	}
+	file.Schema = resultsJSONSchema
+	file.Sessions = append(file.Sessions, session)
+	return writeResultsJSON(file, filename)
+}
+
+// appendResultsCSV appends the aggregate rows of a session to a CSV file.
+// The file must have been written with the current schema, as rows with a
+// different column set cannot share its header; report convert rewrites
+// older files.
+func appendResultsCSV(filename string, session ResultsSession) error {
+	rows := sessionCSVRows(session)
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return writeResultsCSV(filename, "aggregate", rows)
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(f)
+	lines := []string{}
+	for len(lines) < 2 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(lines) < 2 || lines[0] != csvSchemaComment("aggregate") || lines[1] != strings.Join(resultsCSVHeader, ",") {
+		return fmt.Errorf("%s: not an aggregate results file of schema %d (older files can be rewritten with report convert)", filename, resultsSchemaVersion)
+	}
+
+	out, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeCSVRows(out, rows)
+}
+
+// sessionCSVRows formats the aggregate rows of a session
+func sessionCSVRows(session ResultsSession) [][]string {
+	rows := [][]string{}
+	for _, r := range session.results() {
+		rows = append(rows, resultCSVRow(r, session.Metadata, 0, len(r.runs)-r.TrimmedRuns))
+	}
+	return rows
+}
+
+// mergeResultsFiles combines the sessions of several JSON results files.
+// Sessions are keyed by host and session time; a session found in more than
+// one file is kept once and reported in skipped.
+func mergeResultsFiles(filenames []string) (merged *ResultsFile, skipped []string, err error) {
+	merged = &ResultsFile{Schema: resultsJSONSchema}
+	seen := map[string]bool{}
+	for _, filename := range filenames {
+		file, err := loadResultsJSON(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, session := range file.Sessions {
+			key := session.Metadata.key()
+			if seen[key] {
+				skipped = append(skipped, key)
+				continue
+			}
+			seen[key] = true
+			merged.Sessions = append(merged.Sessions, session)
+		}
+	}
+	return merged, skipped, nil
+}
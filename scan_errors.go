@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync/atomic"
+)
+
+// Scan error categories
+const (
+	ScanErrorPermission = "permission"
+	ScanErrorNotFound   = "not-found"
+	ScanErrorIO         = "io"
+)
+
+// scanErrorCategory classifies a failure to read an entry
+func scanErrorCategory(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return ScanErrorPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ScanErrorNotFound
+	default:
+		return ScanErrorIO
+	}
+}
+
+// addError records a failure to read an entry. It is safe for concurrent use.
+// Directories skipped after the scan was cancelled are not read failures:
+// the cancellation is recorded once and not counted.
+func (r *ScanResult) addError(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		r.errMu.Lock()
+		if !r.cancelled {
+			r.cancelled = true
+			r.errs = append(r.errs, err)
+		}
+		r.errMu.Unlock()
+		return
+	}
+	atomic.AddInt64(&r.Errors, 1)
+	switch scanErrorCategory(err) {
+	case ScanErrorPermission:
+		atomic.AddInt64(&r.PermissionErrors, 1)
+	case ScanErrorNotFound:
+		atomic.AddInt64(&r.NotFoundErrors, 1)
+	default:
+		atomic.AddInt64(&r.IOErrors, 1)
+	}
+	r.errMu.Lock()
+	r.errs = append(r.errs, err)
+	r.errMu.Unlock()
+}
+
+// add merges the counts and failures of a partial result. It is safe for
+// concurrent use on r.
+func (r *ScanResult) add(other *ScanResult) {
+	atomic.AddInt64(&r.Files, other.Files)
+	atomic.AddInt64(&r.Dirs, other.Dirs)
+	atomic.AddInt64(&r.Errors, other.Errors)
+	atomic.AddInt64(&r.PermissionErrors, other.PermissionErrors)
+	atomic.AddInt64(&r.NotFoundErrors, other.NotFoundErrors)
+	atomic.AddInt64(&r.IOErrors, other.IOErrors)
+	r.errMu.Lock()
+	for _, err := range other.errs {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			if r.cancelled {
+				continue
+			}
+			r.cancelled = true
+		}
+		r.errs = append(r.errs, err)
+	}
+	r.errMu.Unlock()
+}
+
+// Cancelled reports whether part of the tree was skipped because the scan
+// was cancelled
+func (r *ScanResult) Cancelled() bool {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.cancelled
+}
+
+// Err returns all failures of the scan joined into one error, or nil
+func (r *ScanResult) Err() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return errors.Join(r.errs...)
+}
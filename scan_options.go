@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultChannelCapacity is the task channel capacity of the original implementation
+const defaultChannelCapacity = 1000
+
+// ScanOptions holds per-strategy scanner options
+type ScanOptions struct {
+	Listing string
+	// ReadDirChunk is the number of entries read per call in chunked listing mode
+	ReadDirChunk int
+	// ChannelCapacity is the task channel capacity of the recursive-task strategies
+	ChannelCapacity int
+	// GoroutineCap limits directories read concurrently by the unbounded strategy (0 = no limit)
+	GoroutineCap int
+	// BatchSize is the number of entries read per call by the pooled
+	// strategy and of subdirectories opened per io_uring submission
+	// (0 = strategy default)
+	BatchSize int
+	// Fallback is what a task channel strategy does with a subdirectory
+	// when the channel is full: FallbackInline or FallbackRequeue
+	Fallback string
+	// CutoffDepth scans subdirectories deeper than this below the root on
+	// the worker that found them instead of queueing them (0 = no cutoff)
+	CutoffDepth int
+	// TaskOrder is the order in which the task channel strategies take
+	// pending directories: TaskOrderFIFO or TaskOrderLIFO
+	TaskOrder string
+	// Counters is how the directory-based and recursive-task strategies
+	// accumulate their counts: CountersShared or CountersPerWorker
+	Counters string
+	// TrackFDs enables sampling of the peak number of open file descriptors
+	TrackFDs bool
+	// TrackHeap enables sampling of the peak heap size
+	TrackHeap bool
+	// MemLimit is the Go soft memory limit set for the benchmark in bytes
+	// (0 = none); the peak runtime memory is compared with it
+	MemLimit int64
+	// TrackThreads enables sampling of the peak number of OS threads
+	TrackThreads bool
+	// TrackStragglers enables sampling of the scan progress to measure the
+	// time spent on the last directories
+	TrackStragglers bool
+	// VerifyVisits records the identity of every listed directory and
+	// compares them with a serial reference walk after each scan
+	VerifyVisits bool
+	// WorkerCPU attributes CPU time to workers by pinning them to their OS
+	// threads while busy; it implies Instrument
+	WorkerCPU bool
+	// CPUSampleInterval samples the process CPU utilization at this interval
+	// during each scan; 0 disables sampling
+	CPUSampleInterval time.Duration
+	// HostCPU measures the CPU use of the whole host during each scan
+	HostCPU bool
+	// NoisyThreshold is the share of all CPUs in percent that other processes
+	// may use before a result is marked noisy
+	NoisyThreshold float64
+	// Energy reads the RAPL energy counters of the CPU packages around each scan
+	Energy bool
+	// TrackFreq samples the CPU clock and counts thermal throttling during each scan
+	TrackFreq bool
+	// OutlierK is the number of median absolute deviations beyond which a
+	// run is an outlier; TrimOutliers excludes such runs from the averages
+	OutlierK     float64
+	TrimOutliers bool
+	// MinTime and CITarget calibrate the number of runs of a cell: it is
+	// repeated until its runs add up to MinTime and the 95% confidence
+	// interval is within CITarget of the mean duration, at most MaxRuns times
+	MinTime  time.Duration
+	CITarget float64
+	MaxRuns  int
+	// ReadDirLatency enables recording of per-call directory listing latency
+	ReadDirLatency bool
+	// DirTimes enables recording of the listing time spent in every directory
+	DirTimes bool
+	// Subtrees records the counts and duration of every top-level directory
+	// scanned by the directory-based strategy
+	Subtrees bool
+	// Hardlinks selects how (dev, inode) pairs are tracked to count hardlinked files once
+	Hardlinks string
+	// Symlinks selects how symlinks to directories are counted: as files,
+	// as directories or followed
+	Symlinks string
+	// ChurnRate is the number of create/delete/rename operations per second
+	// applied to the tree while it is scanned (0 = static tree)
+	ChurnRate int
+	// MaxReadDirPerSec limits listing calls per second across all workers (0 = unlimited)
+	MaxReadDirPerSec int
+	// ReadDirDelay is added to every listing call to simulate the round trip
+	// of a FUSE or network filesystem (0 = none)
+	ReadDirDelay time.Duration
+	// StaleRetries is how often a listing failing with ESTALE is retried
+	StaleRetries int
+	// MaxInflightIO limits the listing calls in flight across all workers,
+	// and the subdirectory opens of openat, independently of their number
+	// (0 = unlimited)
+	MaxInflightIO int
+	// CacheMode is the page cache mode of -cache-mode; cold drops the caches
+	// before every run
+	CacheMode string
+	// Activity receives live per-worker state for the dashboard; nil disables it
+	Activity *ActivityMonitor
+	// Instrument enables queue depth and worker busy time recording
+	Instrument bool
+	// ScanTimeout cancels a scan that runs longer (0 = no limit)
+	ScanTimeout time.Duration
+	// CellTimeout stops the remaining runs of a benchmark cell once exceeded (0 = no limit)
+	CellTimeout time.Duration
+	// StallTimeout cancels a scan that finds no directory or file for this
+	// long, after dumping the goroutine stacks (0 = off)
+	StallTimeout time.Duration
+	// Workload is applied to the entries found by the scan
+	Workload string
+	// StatCall is how the stat workload reads the entries: lstat or statx
+	StatCall string
+	// CopyDest is the directory the copy workload mirrors the tree into
+	CopyDest string
+	// CopyWorkers is the size of a separate pool copying the files found by
+	// the scan workers (0 = scan workers copy themselves)
+	CopyWorkers int
+	// Prepare restores the tree before every run of a destructive workload;
+	// it is not timed
+	Prepare func() error
+	// Roots are scanned together in every scan instead of the scanned
+	// path, which is then only their label (-combine-paths)
+	Roots []string
+	// Snapshots receives the intermediate counts of each scan every
+	// SnapshotInterval and every SnapshotFiles files found (0 = not on
+	// that trigger); nil disables them
+	Snapshots        func(ScanSnapshot)
+	SnapshotInterval time.Duration
+	SnapshotFiles    int64
+
+	// instrumentation is the per-scan recorder set up by runBenchmark
+	instrumentation *ScanInstrumentation
+	// links is the per-scan hardlink tracker set up by runBenchmark
+	links *linkTracker
+	// readDirLatency is the per-scan listing latency histogram set up by runBenchmark
+	readDirLatency *latencyHistogram
+	// dirTimes is the per-scan directory timer set up by runBenchmark
+	dirTimes *dirTimer
+	// limiter is the per-scan listing rate limiter set up by runBenchmark
+	limiter *rateLimiter
+	// stale retries stale listings, set up by runBenchmark with StaleRetries
+	stale *staleRetry
+	// inflight is the per-scan semaphore of MaxInflightIO set up by runBenchmark
+	inflight *ioSemaphore
+	// workload is the per-scan workload set up by runBenchmark, nil for plain scans
+	workload *workloadRun
+	// dtype counts the d_type fallbacks of the dtype listing mode, set up by runBenchmark
+	dtype *dtypeCounter
+	// progress is the per-scan progress tracker set up by runBenchmark
+	progress *progressTracker
+	// visits records the directories listed by the scan for VerifyVisits
+	visits *visitSet
+	// symlinks applies a Symlinks mode other than file, set up by newScanner
+	symlinks *symlinkResolver
+	// subtrees records the top-level directories of a directory-based scan
+	// for Subtrees
+	subtrees *subtreeRecorder
+	// files receives every file found, on the worker that found it, for
+	// subcommands built on a scan such as dupes
+	files func(dir string, entry fs.DirEntry)
+	// hints are the fan-out hints of the priority task order, shared by the
+	// runs of a cell and set up by newBenchmarkCell
+	hints *fanOutHints
+	// ctx cancels the scan; runBenchmarkCell sets the cell's context and
+	// runBenchmark narrows it to the scan
+	ctx context.Context
+}
+
+// batchSize returns the batch size of a strategy, its default when unset
+func (o ScanOptions) batchSize(strategy string) int {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return defaultBatchSize(strategy)
+}
+
+// queuesDepth reports whether a subdirectory at depth below the root may be
+// handed to the task channel
+func (o ScanOptions) queuesDepth(depth int) bool {
+	return o.CutoffDepth == 0 || depth <= o.CutoffDepth
+}
+
+// requeues reports whether a subdirectory that did not fit into the task
+// channel offers its own subdirectories to the channel again
+func (o ScanOptions) requeues() bool {
+	return o.Fallback == FallbackRequeue
+}
+
+// pathDepth returns the number of levels path lies below root
+func pathDepth(root, path string) int {
+	rel := strings.TrimPrefix(path[len(root):], string(filepath.Separator))
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// ctxErr returns the cancellation error of the scan, or nil while it may go on
+func (o ScanOptions) ctxErr() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// timesListings reports whether directory listing calls are timed
+func (o ScanOptions) timesListings() bool {
+	return o.readDirLatency != nil || o.dirTimes != nil
+}
+
+// walksExplicitly reports whether serial scans must list directories
+// themselves: filepath.WalkDir hides its directory reads, so they can neither be
+// timed, throttled, counted for progress, verified nor handed to a workload
+// or the files hook, and it never counts symlinks as directories
+func (o ScanOptions) walksExplicitly() bool {
+	return o.Listing != defaultListing || o.timesListings() || o.limiter != nil || o.workload != nil || o.progress != nil || o.visits != nil ||
+		o.files != nil || o.symlinks != nil || o.ReadDirDelay > 0 || o.stale != nil || o.inflight != nil
+}
+
+// throttle waits until the rate limit allows another listing call and a
+// slot of MaxInflightIO is free, then for the simulated delay of the call,
+// which holds the slot like a real round trip. Every call that returns nil
+// must be followed by releaseIO once the listing call is done.
+func (o ScanOptions) throttle() error {
+	if err := o.limiter.Wait(o.ctx); err != nil {
+		return err
+	}
+	if err := o.inflight.acquire(o.ctx); err != nil {
+		return err
+	}
+	if o.ReadDirDelay > 0 {
+		if err := sleepContext(o.ctx, o.ReadDirDelay); err != nil {
+			o.inflight.release()
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireIO waits for a slot of MaxInflightIO for a call other than a
+// listing, which the rate limit and the simulated delay do not apply to.
+// Every call that returns nil must be followed by releaseIO.
+func (o ScanOptions) acquireIO() error {
+	return o.inflight.acquire(o.ctx)
+}
+
+// releaseIO frees the slot of MaxInflightIO taken by throttle or acquireIO
+func (o ScanOptions) releaseIO() {
+	o.inflight.release()
+}
+
+// startListing returns the start time of a listing call, or the zero time
+// when listings are not timed so that the clock is not read needlessly
+func (o ScanOptions) startListing() time.Time {
+	if !o.timesListings() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// endListing records a listing call of dir that began at start
+func (o ScanOptions) endListing(dir string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	d := time.Since(start)
+	o.readDirLatency.Record(d)
+	o.dirTimes.Add(dir, d)
+}
+
+// defaultScanOptions returns the options matching the original implementation
+func defaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Listing:         defaultListing,
+		ReadDirChunk:    defaultReadDirChunk,
+		Hardlinks:       HardlinksOff,
+		Symlinks:        SymlinksFile,
+		ChannelCapacity: defaultChannelCapacity,
+		GoroutineCap:    defaultGoroutineCap,
+		Fallback:        FallbackInline,
+		TaskOrder:       TaskOrderFIFO,
+		Counters:        CountersShared,
+		Workload:        WorkloadScan,
+		StatCall:        StatCallLstat,
+	}
+}
+
+// strategyWorkerCounts returns the worker counts to run for a strategy.
+// Strategies without a worker pool run once with a worker count of 0.
+func strategyWorkerCounts(strategy string, workerCounts []int) []int {
+	if strategy == StrategyUnbounded || strategy == StrategyRemoveAll {
+		return []int{0}
+	}
+	// The file records of a volume are read by one goroutine
+	if strategy == StrategyMFT {
+		return []int{1}
+	}
+	return workerCounts
+}
+
+// defaultWorkerMultipliers are the worker counts per CPU run by default
+const defaultWorkerMultipliers = "0.5,1,2,4"
+
+// parseWorkerMultipliers parses a comma separated list of positive worker
+// counts per CPU; a trailing x is allowed, as in 0.5x
+func parseWorkerMultipliers(value string) ([]float64, error) {
+	multipliers := []float64{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSuffix(strings.TrimSpace(field), "x")
+		m, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		if m <= 0 || math.IsInf(m, 0) {
+			return nil, fmt.Errorf("multiplier must be positive: %s", field)
+		}
+		multipliers = append(multipliers, m)
+	}
+	return multipliers, nil
+}
+
+// multipliedWorkerCounts returns the worker counts of the multipliers on cpus
+// CPUs, in ascending order and always including the serial baseline of 1
+func multipliedWorkerCounts(multipliers []float64, cpus int) []int {
+	seen := map[int]bool{1: true}
+	counts := []int{1}
+	for _, m := range multipliers {
+		n := max(1, int(math.Round(m*float64(cpus))))
+		if !seen[n] {
+			seen[n] = true
+			counts = append(counts, n)
+		}
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// joinInts formats a list of integers as "1, 2, 4"
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// workersPerCPU returns a worker count relative to the CPUs of this machine,
+// -1 for strategies without a worker count
+func workersPerCPU(workers int) float64 {
+	if workers <= 0 {
+		return -1
+	}
+	return float64(workers) / float64(runtime.NumCPU())
+}
+
+// usesChannelCapacity reports whether the strategy distributes work through a task channel
+func usesChannelCapacity(strategy string) bool {
+	return strategy == StrategyRecursiveTask || strategy == StrategyRecursiveTaskPooled || strategy == StrategyOpenat || strategy == StrategyUring ||
+		strategy == StrategyBulkAttr || strategy == StrategyFindFile
+}
+
+// SweepAxes holds the option values swept for every strategy they apply to
+type SweepAxes struct {
+	Listings   []string
+	Capacities []int
+	// TaskOrders are the task orders of the task channel strategies
+	TaskOrders []string
+	// Counters are the counter modes of the directory-based and
+	// recursive-task strategies
+	Counters   []string
+	Chunks     []int
+	Hardlinks  []string
+	ChurnRates []int
+	// ReadDirRates are listing call limits per second
+	ReadDirRates []int
+	// InflightLimits are limits of listing calls in flight
+	InflightLimits []int
+	// CopyWorkers are copier pool sizes of the copy workload
+	CopyWorkers []int
+	// Workloads are the workloads that only read the tree: scan, stat, xattr
+	// and age
+	Workloads []string
+	// StatCalls are the calls of the stat workload
+	StatCalls []string
+}
+
+// scanVariants expands the swept option dimensions that apply to a strategy
+func scanVariants(strategy string, base ScanOptions, axes SweepAxes) []ScanOptions {
+	// os.RemoveAll lists directories itself, so no scanner option applies
+	if strategy == StrategyRemoveAll {
+		return []ScanOptions{base}
+	}
+	capacities, orders := axes.Capacities, axes.TaskOrders
+	if !usesChannelCapacity(strategy) {
+		capacities, orders = []int{base.ChannelCapacity}, nil
+	}
+
+	// openat reads directories with getdents itself, and mft reads no
+	// directories; both count no hardlinks and run no workload
+	listings, hardlinks, workloads := axes.Listings, axes.Hardlinks, axes.Workloads
+	if strategy == StrategyOpenat || strategy == StrategyUring || strategy == StrategyMFT {
+		listings, hardlinks = nil, nil
+		if len(workloads) > 0 {
+			workloads = []string{WorkloadScan}
+		}
+	}
+	// getattrlistbulk and FindFirstFileEx read directories themselves and run
+	// only the stat workload, with the sizes from the listing
+	if strategy == StrategyBulkAttr || strategy == StrategyFindFile {
+		listings, hardlinks = nil, nil
+		workloads = slices.DeleteFunc(slices.Clone(workloads), func(w string) bool { return w != WorkloadScan && w != WorkloadStat })
+	}
+
+	variants := []ScanOptions{base}
+	variants = expandVariants(variants, func(ScanOptions) int { return len(listings) },
+		func(o *ScanOptions, i int) { o.Listing = listings[i] })
+	variants = expandVariants(variants, func(o ScanOptions) int {
+		if o.Listing != ListingChunked {
+			return 1
+		}
+		return len(axes.Chunks)
+	}, func(o *ScanOptions, i int) {
+		if o.Listing == ListingChunked {
+			o.ReadDirChunk = axes.Chunks[i]
+		}
+	})
+	variants = expandVariants(variants, func(ScanOptions) int { return len(capacities) },
+		func(o *ScanOptions, i int) { o.ChannelCapacity = capacities[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(orders) },
+		func(o *ScanOptions, i int) { o.TaskOrder = orders[i] })
+	counters := axes.Counters
+	if !usesCounters(strategy) {
+		counters = nil
+	}
+	variants = expandVariants(variants, func(ScanOptions) int { return len(counters) },
+		func(o *ScanOptions, i int) { o.Counters = counters[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(hardlinks) },
+		func(o *ScanOptions, i int) { o.Hardlinks = hardlinks[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(workloads) },
+		func(o *ScanOptions, i int) { o.Workload = workloads[i] })
+	variants = expandVariants(variants, func(o ScanOptions) int {
+		if o.Workload != WorkloadStat {
+			return 0
+		}
+		return len(axes.StatCalls)
+	}, func(o *ScanOptions, i int) { o.StatCall = axes.StatCalls[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(axes.ChurnRates) },
+		func(o *ScanOptions, i int) { o.ChurnRate = axes.ChurnRates[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(axes.ReadDirRates) },
+		func(o *ScanOptions, i int) { o.MaxReadDirPerSec = axes.ReadDirRates[i] })
+	variants = expandVariants(variants, func(ScanOptions) int { return len(axes.InflightLimits) },
+		func(o *ScanOptions, i int) { o.MaxInflightIO = axes.InflightLimits[i] })
+	variants = expandVariants(variants, func(o ScanOptions) int {
+		if o.Workload != WorkloadCopy {
+			return 1
+		}
+		return len(axes.CopyWorkers)
+	}, func(o *ScanOptions, i int) {
+		if o.Workload == WorkloadCopy {
+			o.CopyWorkers = axes.CopyWorkers[i]
+		}
+	})
+	return variants
+}
+
+// expandVariants replaces every variant with one copy per value of an axis.
+// count returns the number of values applying to a variant and set applies
+// the i-th value; an axis without values leaves the variants unchanged.
+func expandVariants(variants []ScanOptions, count func(ScanOptions) int, set func(*ScanOptions, int)) []ScanOptions {
+	expanded := []ScanOptions{}
+	for _, variant := range variants {
+		n := count(variant)
+		if n == 0 {
+			expanded = append(expanded, variant)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			options := variant
+			set(&options, i)
+			expanded = append(expanded, options)
+		}
+	}
+	return expanded
+}
+
+// optionsLabel describes the options of a strategy's variant that differ
+// from the defaults
+func optionsLabel(strategy string, options ScanOptions) string {
+	capacity := 0
+	if usesChannelCapacity(strategy) {
+		capacity = options.ChannelCapacity
+	}
+	chunk := 0
+	if options.Listing == ListingChunked {
+		chunk = options.ReadDirChunk
+	}
+	batch, fallback, order, cutoff := 0, "", "", 0
+	if usesBatchSize(strategy) {
+		batch = options.batchSize(strategy)
+	}
+	if usesChannelCapacity(strategy) {
+		fallback, order, cutoff = options.Fallback, options.TaskOrder, options.CutoffDepth
+	}
+	counters := ""
+	if usesCounters(strategy) {
+		counters = options.Counters
+	}
+	return joinLabels(variantLabel(options.Listing, capacity, chunk, options.Hardlinks, options.ChurnRate, options.MaxReadDirPerSec, options.MaxInflightIO, options.CopyWorkers),
+		paramsLabel(strategy, batch, fallback, order, cutoff, options.GoroutineCap, counters), workloadVariantLabel(options.Workload, options.StatCall),
+		symlinksLabel(options.Symlinks))
+}
+
+// joinLabels joins the non-empty labels with commas
+func joinLabels(labels ...string) string {
+	parts := []string{}
+	for _, label := range labels {
+		if label != "" {
+			parts = append(parts, label)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// variantLabel describes the options of a variant that differ from the defaults
+func variantLabel(listing string, capacity, chunk int, hardlinks string, churnRate, readDirRate, inflight, copyWorkers int) string {
+	parts := []string{}
+	if listing != "" && listing != defaultListing {
+		parts = append(parts, "listing="+listing)
+	}
+	if chunk != 0 && chunk != defaultReadDirChunk {
+		parts = append(parts, fmt.Sprintf("chunk=%d", chunk))
+	}
+	if capacity != 0 && capacity != defaultChannelCapacity {
+		parts = append(parts, fmt.Sprintf("cap=%d", capacity))
+	}
+	if hardlinks != "" && hardlinks != HardlinksOff {
+		parts = append(parts, "links="+hardlinks)
+	}
+	if churnRate > 0 {
+		parts = append(parts, fmt.Sprintf("churn=%d/s", churnRate))
+	}
+	if readDirRate > 0 {
+		parts = append(parts, fmt.Sprintf("readdir<=%d/s", readDirRate))
+	}
+	if inflight > 0 {
+		parts = append(parts, fmt.Sprintf("io<=%d", inflight))
+	}
+	if copyWorkers > 0 {
+		parts = append(parts, fmt.Sprintf("copiers=%d", copyWorkers))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIntList parses a comma separated list of positive integers
+func parseIntList(value string) ([]int, error) {
+	values := []int{}
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("value must be positive: %d", n)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
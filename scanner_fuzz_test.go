@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// maxFuzzEntries bounds the trees of the fuzz targets, so that every input
+// is quick to materialize
+const maxFuzzEntries = 256
+
+// fuzzTree decodes a tree manifest from data, one entry per byte: the high
+// five bits pick the parent among the directories created so far and the
+// low three bits the kind of the entry. Symlinks alternate between a loop to
+// the parent and a dangling target.
+func fuzzTree(data []byte) fstest.MapFS {
+	if len(data) > maxFuzzEntries {
+		data = data[:maxFuzzEntries]
+	}
+	fsys := fstest.MapFS{}
+	dirs := []string{"."}
+	for i, b := range data {
+		parent := dirs[int(b>>3)%len(dirs)]
+		name := path.Join(parent, fmt.Sprintf("e%d", i))
+		switch b & 7 {
+		case 0, 1, 2:
+			fsys[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+			dirs = append(dirs, name)
+		case 3, 4, 5:
+			fsys[name] = &fstest.MapFile{Data: []byte(name), Mode: 0644}
+		case 6:
+			fsys[name] = &fstest.MapFile{Data: []byte(".."), Mode: fs.ModeSymlink | 0777}
+		case 7:
+			fsys[name] = &fstest.MapFile{Data: []byte(danglingSymlinkTarget), Mode: fs.ModeSymlink | 0777}
+		}
+	}
+	return fsys
+}
+
+// fuzzRoot spells root in one of the ways a user may pass it
+func fuzzRoot(root string, style uint8) string {
+	switch style % 3 {
+	case 1:
+		return root + string(filepath.Separator)
+	case 2:
+		return filepath.Join(root, "sub", "..") + string(filepath.Separator) + "."
+	}
+	return root
+}
+
+// FuzzScannersMatchReferenceWalk materializes random trees and checks that
+// every strategy finds the files and directories of the reference walk,
+// with random worker counts, task channel capacities and spellings of the
+// root. Run it with go test -fuzz FuzzScannersMatchReferenceWalk.
+func FuzzScannersMatchReferenceWalk(f *testing.F) {
+	f.Add([]byte{}, uint8(1), uint8(0), uint8(0))
+	f.Add([]byte{3, 4, 5}, uint8(4), uint8(1), uint8(1))
+	f.Add([]byte{0, 8, 16, 24, 3, 11, 19, 27}, uint8(2), uint8(0), uint8(2))
+	f.Add([]byte{0, 0, 0, 0, 9, 17, 25, 33, 6, 14, 22, 7, 15, 3, 11, 19, 27, 35}, uint8(16), uint8(1), uint8(0))
+	f.Add([]byte("a deeper tree, with files and symlinks spread over it"), uint8(3), uint8(8), uint8(1))
+
+	strategies := testStrategies()
+	f.Fuzz(func(t *testing.T, data []byte, workers, capacity, rootStyle uint8) {
+		fsys := fuzzTree(data)
+		// The sub/.. spelling of fuzzRoot needs a directory named sub
+		fsys["sub"] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+		root := writeTree(t, fsys)
+		wantFiles, wantDirs := referenceCounts(t, fsys)
+
+		options := defaultScanOptions()
+		options.ChannelCapacity = 1 + int(capacity)%8
+		numWorkers := 1 + int(workers)%16
+		for _, strategy := range strategies {
+			for _, n := range strategyWorkerCounts(strategy, []int{numWorkers}) {
+				result, err := scanWith(t, strategy, n, options, fuzzRoot(root, rootStyle))
+				if err != nil {
+					t.Errorf("%s with %d workers: %v", strategy, n, err)
+				}
+				if result.Files != wantFiles || result.Dirs != wantDirs {
+					t.Errorf("%s with %d workers, channel capacity %d found %d files and %d dirs, want %d and %d",
+						strategy, n, options.ChannelCapacity, result.Files, result.Dirs, wantFiles, wantDirs)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// testStrategies returns the strategies that walk a tree and run on this
+// machine; io_uring only when rings can be created
+func testStrategies() []string {
+	strategies := []string{StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled, StrategyUnbounded}
+	if openatSupported {
+		strategies = append(strategies, StrategyOpenat)
+	}
+	if ring, err := newUring(uringEntries); err == nil {
+		ring.Close()
+		strategies = append(strategies, StrategyUring)
+	}
+	if bulkAttrSupported {
+		strategies = append(strategies, StrategyBulkAttr)
+	}
+	if findFileSupported {
+		strategies = append(strategies, StrategyFindFile)
+	}
+	return strategies
+}
+
+// testWorkerCounts are the worker counts the scanners are tested with; more
+// workers than directories leaves workers idle
+var testWorkerCounts = []int{1, 2, 8}
+
+// writeTree creates the files, directories and symlinks of fsys in a new
+// temporary directory and returns its path. Symlinks point to their Data.
+func writeTree(t testing.TB, fsys fstest.MapFS) string {
+	t.Helper()
+	root := t.TempDir()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		switch {
+		case d.IsDir():
+			return os.Mkdir(path, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			return os.Symlink(string(fsys[name].Data), path)
+		default:
+			return os.WriteFile(path, fsys[name].Data, 0644)
+		}
+	})
+	if err != nil {
+		t.Fatalf("writing tree: %v", err)
+	}
+	return root
+}
+
+// referenceCounts counts the entries of fsys the way the scanners do: the
+// root and every directory below it are directories, anything else is a file
+func referenceCounts(t testing.TB, fsys fstest.MapFS) (files, dirs int64) {
+	t.Helper()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking reference tree: %v", err)
+	}
+	return files, dirs
+}
+
+// scanWith runs a scan of root and fails the test on a nil result
+func scanWith(t testing.TB, strategy string, workers int, options ScanOptions, root string) (*ScanResult, error) {
+	t.Helper()
+	scanner, err := newScanner(strategy, workers, options)
+	if err != nil {
+		t.Fatalf("%s: %v", strategy, err)
+	}
+	result, err := scanner.Scan(root)
+	if result == nil {
+		t.Fatalf("%s with %d workers returned no result (error: %v)", strategy, workers, err)
+	}
+	return result, err
+}
+
+// dirs returns a tree of empty directories
+func dirs(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+	}
+	return fsys
+}
+
+// withFiles adds files with their names as content to fsys
+func withFiles(fsys fstest.MapFS, names ...string) fstest.MapFS {
+	for _, name := range names {
+		fsys[name] = &fstest.MapFile{Data: []byte(name), Mode: 0644}
+	}
+	return fsys
+}
+
+var scannerTrees = []struct {
+	name string
+	fsys fstest.MapFS
+}{
+	{"empty root", fstest.MapFS{}},
+	{"single file", withFiles(fstest.MapFS{}, "a.txt")},
+	{"flat", withFiles(fstest.MapFS{}, "a", "b", "c", "d", "e", "f", "g", "h")},
+	{"empty directories", dirs("a", "b", "c", "a/x", "a/y", "a/x/1")},
+	{"nested", withFiles(dirs("a", "a/b", "a/b/c", "a/b/c/d", "e"), "root.txt", "a/1", "a/b/2", "a/b/c/3", "a/b/c/d/4", "a/b/c/d/5", "e/6")},
+	{"wide", func() fstest.MapFS {
+		fsys := fstest.MapFS{}
+		for _, top := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+			for _, sub := range []string{"0", "1", "2", "3"} {
+				withFiles(fsys, top+"/"+sub+"/file1", top+"/"+sub+"/file2")
+			}
+			withFiles(fsys, top+"/top")
+		}
+		return fsys
+	}()},
+	{"dot and space names", withFiles(dirs(".hidden", "with space"), ".hidden/.file", "with space/file name.txt", "-dash")},
+}
+
+func TestScannersMatchReferenceWalk(t *testing.T) {
+	for _, tree := range scannerTrees {
+		root := writeTree(t, tree.fsys)
+		wantFiles, wantDirs := referenceCounts(t, tree.fsys)
+		for _, strategy := range testStrategies() {
+			for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+				result, err := scanWith(t, strategy, workers, defaultScanOptions(), root)
+				if err != nil {
+					t.Errorf("%s: %s with %d workers: %v", tree.name, strategy, workers, err)
+				}
+				if result.Files != wantFiles || result.Dirs != wantDirs {
+					t.Errorf("%s: %s with %d workers found %d files and %d dirs, want %d and %d",
+						tree.name, strategy, workers, result.Files, result.Dirs, wantFiles, wantDirs)
+				}
+			}
+		}
+	}
+}
+
+func TestScannersDoNotFollowSymlinks(t *testing.T) {
+	fsys := withFiles(dirs("real", "real/sub"), "real/a", "real/sub/b")
+	fsys["link_to_dir"] = &fstest.MapFile{Data: []byte("real"), Mode: fs.ModeSymlink | 0777}
+	fsys["real/sub/loop"] = &fstest.MapFile{Data: []byte(".."), Mode: fs.ModeSymlink | 0777}
+	fsys["dangling"] = &fstest.MapFile{Data: []byte(danglingSymlinkTarget), Mode: fs.ModeSymlink | 0777}
+	if err := os.Symlink("target", filepath.Join(t.TempDir(), "probe")); err != nil {
+		t.Skipf("symlinks are not available: %v", err)
+	}
+	root := writeTree(t, fsys)
+
+	// Symlinks count as files, whatever they point to
+	wantFiles, wantDirs := int64(5), int64(3)
+	for _, strategy := range testStrategies() {
+		for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+			for _, listing := range []string{ListingReadDir, ListingSorted, ListingNames, ListingDType} {
+				if listing == ListingDType && !dtypeSupported {
+					continue
+				}
+				options := defaultScanOptions()
+				options.Listing = listing
+				result, err := scanWith(t, strategy, workers, options, root)
+				if err != nil {
+					t.Errorf("%s with %d workers, %s: %v", strategy, workers, listing, err)
+				}
+				if result.Files != wantFiles || result.Dirs != wantDirs {
+					t.Errorf("%s with %d workers, %s found %d files and %d dirs, want %d and %d",
+						strategy, workers, listing, result.Files, result.Dirs, wantFiles, wantDirs)
+				}
+			}
+		}
+	}
+}
+
+func TestScannersSymlinkModes(t *testing.T) {
+	if err := os.Symlink("target", filepath.Join(t.TempDir(), "probe")); err != nil {
+		t.Skipf("symlinks are not available: %v", err)
+	}
+	fsys := withFiles(dirs("real", "real/sub"), "real/a", "real/sub/b")
+	fsys["link_to_dir"] = &fstest.MapFile{Data: []byte("real"), Mode: fs.ModeSymlink | 0777}
+	fsys["link_to_file"] = &fstest.MapFile{Data: []byte("real/a"), Mode: fs.ModeSymlink | 0777}
+	fsys["real/sub/loop"] = &fstest.MapFile{Data: []byte(".."), Mode: fs.ModeSymlink | 0777}
+	fsys["dangling"] = &fstest.MapFile{Data: []byte(danglingSymlinkTarget), Mode: fs.ModeSymlink | 0777}
+	// Sibling directories linking to each other loop without either being
+	// the ancestor of the symlink
+	mutual := withFiles(dirs("a", "b"), "a/x", "b/y")
+	mutual["a/to_b"] = &fstest.MapFile{Data: []byte("../b"), Mode: fs.ModeSymlink | 0777}
+	mutual["b/to_a"] = &fstest.MapFile{Data: []byte("../a"), Mode: fs.ModeSymlink | 0777}
+
+	tests := []struct {
+		name        string
+		fsys        fstest.MapFS
+		mode        string
+		files, dirs int64
+	}{
+		{"file", fsys, SymlinksFile, 6, 3},
+		// link_to_dir and loop count as directories
+		{"dir", fsys, SymlinksDir, 4, 5},
+		// link_to_dir is listed; both loops are counted but not listed
+		{"follow", fsys, SymlinksFollow, 6, 7},
+		{"follow mutual", mutual, SymlinksFollow, 4, 7},
+	}
+	listings := []string{ListingReadDir, ListingSorted, ListingNames, ListingChunked}
+	if dtypeSupported {
+		listings = append(listings, ListingDType, ListingInode)
+	}
+	for _, tt := range tests {
+		root := writeTree(t, tt.fsys)
+		for _, strategy := range testStrategies() {
+			for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+				for _, listing := range listings {
+					options := defaultScanOptions()
+					options.Listing = listing
+					options.Symlinks = tt.mode
+					result, err := scanWith(t, strategy, workers, options, root)
+					if err != nil {
+						t.Errorf("%s: %s with %d workers, %s: %v", tt.name, strategy, workers, listing, err)
+					}
+					if result.Files != tt.files || result.Dirs != tt.dirs {
+						t.Errorf("%s: %s with %d workers, %s found %d files and %d dirs, want %d and %d",
+							tt.name, strategy, workers, listing, result.Files, result.Dirs, tt.files, tt.dirs)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScannersMissingRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "missing")
+	for _, strategy := range testStrategies() {
+		for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+			result, err := scanWith(t, strategy, workers, defaultScanOptions(), root)
+			if err == nil {
+				t.Errorf("%s with %d workers: no error for a missing root", strategy, workers)
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s with %d workers: error %v is not fs.ErrNotExist", strategy, workers, err)
+			}
+			if result.Errors != 1 || result.NotFoundErrors != 1 {
+				t.Errorf("%s with %d workers: Errors = %d, NotFoundErrors = %d, want 1 and 1",
+					strategy, workers, result.Errors, result.NotFoundErrors)
+			}
+			if result.Files != 0 {
+				t.Errorf("%s with %d workers: Files = %d, want 0", strategy, workers, result.Files)
+			}
+		}
+	}
+}
+
+func TestScannersSkipUnreadableDirectories(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	fsys := withFiles(dirs("open", "locked", "locked/inner"), "open/a", "open/b", "locked/c", "locked/inner/d")
+	root := writeTree(t, fsys)
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	// The locked directory itself is found, its entries are not; only the
+	// directories read are counted
+	for _, strategy := range testStrategies() {
+		for _, workers := range strategyWorkerCounts(strategy, testWorkerCounts) {
+			result, err := scanWith(t, strategy, workers, defaultScanOptions(), root)
+			if !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("%s with %d workers: error %v is not fs.ErrPermission", strategy, workers, err)
+			}
+			if result.PermissionErrors != 1 || result.Errors != 1 {
+				t.Errorf("%s with %d workers: Errors = %d, PermissionErrors = %d, want 1 and 1",
+					strategy, workers, result.Errors, result.PermissionErrors)
+			}
+			if result.Files != 2 || result.Dirs != 2 {
+				t.Errorf("%s with %d workers: Files = %d, Dirs = %d, want 2 and 2", strategy, workers, result.Files, result.Dirs)
+			}
+		}
+	}
+}
+
+// wideTree returns a tree with enough directories that every worker of a
+// pool gets work and full task channels fall back
+func wideTree() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 40; i++ {
+		top := string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+		for j := 0; j < 5; j++ {
+			sub := top + "/" + string(rune('0'+j))
+			withFiles(fsys, sub+"/f1", sub+"/f2", sub+"/f3")
+			fsys[sub+"/deeper/leaf"] = &fstest.MapFile{Data: []byte("leaf")}
+		}
+	}
+	return fsys
+}
+
+// The worker pools share queues, counters and instrumentation between
+// goroutines; run with go test -race to check them.
+func TestWorkerPoolOptions(t *testing.T) {
+	fsys := wideTree()
+	root := writeTree(t, fsys)
+	wantFiles, wantDirs := referenceCounts(t, fsys)
+
+	variants := []struct {
+		name   string
+		modify func(o *ScanOptions, workers int)
+	}{
+		{"defaults", func(*ScanOptions, int) {}},
+		{"channel capacity 1", func(o *ScanOptions, _ int) { o.ChannelCapacity = 1 }},
+		{"requeue fallback", func(o *ScanOptions, _ int) { o.ChannelCapacity = 1; o.Fallback = FallbackRequeue }},
+		{"lifo", func(o *ScanOptions, _ int) { o.TaskOrder = TaskOrderLIFO }},
+		{"priority", func(o *ScanOptions, _ int) { o.TaskOrder = TaskOrderPriority; o.hints = newFanOutHints() }},
+		{"cutoff depth", func(o *ScanOptions, _ int) { o.CutoffDepth = 1 }},
+		{"per-worker counters", func(o *ScanOptions, _ int) { o.Counters = CountersPerWorker }},
+		{"chunked listing", func(o *ScanOptions, _ int) { o.Listing = ListingChunked; o.ReadDirChunk = 2 }},
+		{"goroutine cap", func(o *ScanOptions, _ int) { o.GoroutineCap = 2 }},
+		// A single call in flight must not deadlock workers that hold it
+		{"inflight io 1", func(o *ScanOptions, _ int) { o.inflight = newIOSemaphore(1) }},
+		{"inflight io 1 chunked", func(o *ScanOptions, _ int) {
+			o.inflight = newIOSemaphore(1)
+			o.Listing = ListingChunked
+			o.ReadDirChunk = 2
+		}},
+		{"instrumented", func(o *ScanOptions, workers int) { o.instrumentation = newScanInstrumentation(workers) }},
+	}
+	for _, v := range variants {
+		for _, strategy := range testStrategies() {
+			for _, workers := range strategyWorkerCounts(strategy, []int{4, 16}) {
+				options := defaultScanOptions()
+				v.modify(&options, workers)
+				// Priority hints learn across scans, so scan twice
+				for run := 0; run < 2; run++ {
+					result, err := scanWith(t, strategy, workers, options, root)
+					if err != nil {
+						t.Errorf("%s: %s with %d workers: %v", v.name, strategy, workers, err)
+					}
+					if result.Files != wantFiles || result.Dirs != wantDirs {
+						t.Errorf("%s: %s with %d workers found %d files and %d dirs, want %d and %d",
+							v.name, strategy, workers, result.Files, result.Dirs, wantFiles, wantDirs)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConcurrentScans(t *testing.T) {
+	fsys := wideTree()
+	root := writeTree(t, fsys)
+	wantFiles, wantDirs := referenceCounts(t, fsys)
+
+	// Several scans of one tree at once, as the stress mode runs them
+	for _, strategy := range testStrategies() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				scanner, err := newScanner(strategy, 4, defaultScanOptions())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				result, err := scanner.Scan(root)
+				if err != nil || result.Files != wantFiles || result.Dirs != wantDirs {
+					t.Errorf("%s: found %d files and %d dirs (error: %v), want %d and %d",
+						strategy, result.Files, result.Dirs, err, wantFiles, wantDirs)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// BenchmarkPooledScanner reports the allocations of the allocation-optimized
+// strategy against the plain recursive-task strategy, serially so that the
+// numbers do not depend on the scheduling of the workers
+func BenchmarkPooledScanner(b *testing.B) {
+	root := writeTree(b, wideTree())
+	for _, strategy := range []string{StrategyRecursiveTask, StrategyRecursiveTaskPooled} {
+		b.Run(strategy, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scanWith(b, strategy, 1, defaultScanOptions(), root)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// schemaUpgrade fills a column of rows written before the column existed,
+// with the value the current writer records for the behavior of that time
+type schemaUpgrade struct {
+	// version is the first schema version with the column
+	version int
+	column  string
+	value   func(strategy, workload string) string
+}
+
+// schemaUpgrades are applied in order, so that later upgrades see the
+// columns filled by earlier ones. Columns of measurements that older
+// versions did not take stay empty, i.e. not measured.
+var schemaUpgrades = []schemaUpgrade{
+	// Every scan was a plain scan before the workloads
+	{4, "Workload", func(string, string) string { return WorkloadScan }},
+	// A full task channel was always processed inline
+	{15, "Fallback", func(strategy, _ string) string {
+		if usesChannelCapacity(strategy) {
+			return FallbackInline
+		}
+		return ""
+	}},
+	// The task channel was always FIFO
+	{17, "TaskOrder", func(strategy, _ string) string {
+		if usesChannelCapacity(strategy) {
+			return TaskOrderFIFO
+		}
+		return ""
+	}},
+	// The counts were always shared
+	{20, "Counters", func(strategy, _ string) string {
+		if usesCounters(strategy) {
+			return CountersShared
+		}
+		return ""
+	}},
+	// The stat workload always called lstat
+	{22, "StatCall", func(_, workload string) string {
+		if workload == WorkloadStat {
+			return StatCallLstat
+		}
+		return ""
+	}},
+	// Scans listed directories with readdir before the Listing column and
+	// before sorted became the default
+	{27, "Listing", func(strategy, _ string) string {
+		if strings.HasPrefix(strategy, externalStrategyPrefix) {
+			return ""
+		}
+		return ListingReadDir
+	}},
+	// Symlinks always counted as files
+	{28, "Symlinks", func(strategy, _ string) string {
+		if strings.HasPrefix(strategy, externalStrategyPrefix) {
+			return ""
+		}
+		return SymlinksFile
+	}},
+	// Every target was scanned with the defaults
+	{30, "TargetProfile", func(string, string) string { return TargetProfileLocal }},
+	// Runs never dropped the caches
+	{31, "CacheMode", func(string, string) string { return CacheModeWarm }},
+}
+
+// upgradeCSVRow fills the columns a CSV row of an older schema version lacks
+func upgradeCSVRow(row map[string]string, version int) {
+	for _, u := range schemaUpgrades {
+		if version < u.version && row[u.column] == "" {
+			row[u.column] = u.value(row["Strategy"], row["Workload"])
+		}
+	}
+}
+
+// upgradeResult fills the fields a result of an older schema version lacks
+func upgradeResult(r *BenchmarkResult, version int) {
+	fields := map[string]*string{
+		"Workload":      &r.Workload,
+		"Fallback":      &r.Fallback,
+		"TaskOrder":     &r.TaskOrder,
+		"Counters":      &r.Counters,
+		"StatCall":      &r.StatCall,
+		"Listing":       &r.Listing,
+		"Symlinks":      &r.Symlinks,
+		"TargetProfile": &r.TargetProfile,
+		"CacheMode":     &r.CacheMode,
+	}
+	for _, u := range schemaUpgrades {
+		if field := fields[u.column]; version < u.version && *field == "" {
+			*field = u.value(r.Strategy, r.Workload)
+		}
+	}
+}
+
+// unmeasuredResult returns a result whose optional measurements are all
+// marked as not taken
+func unmeasuredResult() BenchmarkResult {
+	return BenchmarkResult{
+		DurationCI:     -1,
+		WorkersPerCPU:  -1,
+		PeakFDs:        -1,
+		PeakHeap:       -1,
+		PeakMemory:     -1,
+		Straggler:      -1,
+		PeakThreads:    -1,
+		CPUPeak:        -1,
+		HostCPU:        -1,
+		OtherCPU:       -1,
+		LoadAvg:        -1,
+		EnergyJoules:   -1,
+		CPUFreqMHz:     -1,
+		CPUFreqMinMHz:  -1,
+		ThrottleEvents: -1,
+		UniqueFiles:    -1,
+		GoroutineCap:   -1,
+		UserCPU:        -1,
+		SystemCPU:      -1,
+		MaxRSS:         -1,
+		DTypeEntries:   -1,
+		DTypeFallbacks: -1,
+	}
+}
+
+// UnmarshalJSON reads a result, keeping the measurements missing from
+// files of older versions as not taken instead of zero
+func (r *BenchmarkResult) UnmarshalJSON(data []byte) error {
+	type plain BenchmarkResult
+	p := plain(unmeasuredResult())
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = BenchmarkResult(p)
+	return nil
+}
+
+// UnmarshalJSON reads a cell; without it the embedded result would read
+// the whole object and drop the runs
+func (c *CellRecord) UnmarshalJSON(data []byte) error {
+	var runs struct{ Runs []BenchmarkResult }
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return err
+	}
+	c.Runs = runs.Runs
+	return json.Unmarshal(data, &c.BenchmarkResult)
+}
+
+// upgrade fills the fields the results of a session of an older schema
+// version lack; sessions written before versioning have version 0
+func (s *ResultsSession) upgrade() {
+	for i := range s.Results {
+		upgradeResult(&s.Results[i].BenchmarkResult, s.Metadata.SchemaVersion)
+		for j := range s.Results[i].Runs {
+			upgradeResult(&s.Results[i].Runs[j], s.Metadata.SchemaVersion)
+		}
+	}
+}
+
+// parseCSVSchemaComment parses the first line of a results CSV file
+func parseCSVSchemaComment(line string) (version int, kind string, ok bool) {
+	rest, found := strings.CutPrefix(line, "# go-parallel-dir-scan-benchmark ")
+	if !found {
+		return 0, "", false
+	}
+	for _, field := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "schema":
+			version, _ = strconv.Atoi(value)
+		case "rows":
+			kind = value
+		}
+	}
+	return version, kind, version > 0
+}
+
+// csvResultsFile is the content of a results CSV file of any schema version
+type csvResultsFile struct {
+	// version is the schema version, 1 for files written before versioning
+	version int
+	// kind is aggregate or run
+	kind   string
+	header []string
+	rows   []map[string]string
+}
+
+// readResultsCSVFile reads a results CSV file into rows keyed by column and
+// fills the columns an older schema version lacks. Columns of a newer
+// version are kept, so that readers ignore them.
+func readResultsCSVFile(filename string) (*csvResultsFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	c := &csvResultsFile{version: 1, kind: "aggregate"}
+	if first, _ := buffered.Peek(1); len(first) == 1 && first[0] == '#' {
+		line, err := buffered.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%s: empty results file", filename)
+		}
+		version, kind, ok := parseCSVSchemaComment(strings.TrimSpace(line))
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown schema comment: %s", filename, strings.TrimSpace(line))
+		}
+		c.version, c.kind = version, kind
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: empty results file", filename)
+	}
+	c.header = records[0]
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, name := range c.header {
+			if i < len(record) {
+				row[name] = record[i]
+			}
+		}
+		upgradeCSVRow(row, c.version)
+		c.rows = append(c.rows, row)
+	}
+	return c, nil
+}
+
+// warnNewerSchema warns that a file was written by a newer version, whose
+// additional columns are ignored
+func warnNewerSchema(filename string, version int) {
+	if version > resultsSchemaVersion {
+		fmt.Printf("警告: %s はこのバージョンより新しいスキーマ %d で書かれています (対応: %d)。新しい列は読み込みません\n",
+			filename, version, resultsSchemaVersion)
+	}
+}
+
+// runReportConvert rewrites results CSV files of older schema versions with
+// the columns of the current version
+func runReportConvert(args []string) error {
+	fs := flag.NewFlagSet("report convert", flag.ContinueOnError)
+	out := fs.String("out", "", "output file (default: the input file name with _schema<version> appended; only with one input)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || (*out != "" && fs.NArg() > 1) {
+		return fmt.Errorf("使い方: report convert [-out file] <results.csv>...")
+	}
+	for _, filename := range fs.Args() {
+		c, err := readResultsCSVFile(filename)
+		if err != nil {
+			return err
+		}
+		if c.version > resultsSchemaVersion {
+			return fmt.Errorf("%s: schema %d is newer than this version (%d) and cannot be converted", filename, c.version, resultsSchemaVersion)
+		}
+		target := *out
+		if target == "" {
+			target = fmt.Sprintf("%s_schema%d.csv", strings.TrimSuffix(filename, ".csv"), resultsSchemaVersion)
+		}
+		for _, name := range c.header {
+			if !slices.Contains(resultsCSVHeader, name) {
+				fmt.Printf("警告: %s: 現在のスキーマにない列 %s は出力しません\n", filename, name)
+			}
+		}
+		rows := make([][]string, len(c.rows))
+		for i, row := range c.rows {
+			rows[i] = make([]string, len(resultsCSVHeader))
+			for j, name := range resultsCSVHeader {
+				rows[i][j] = row[name]
+			}
+		}
+		if err := writeResultsCSV(target, c.kind, rows); err != nil {
+			return err
+		}
+		fmt.Printf("スキーマ %d を %d に変換しました: %s (%d 行)\n", c.version, resultsSchemaVersion, target, len(rows))
+	}
+	return nil
+}
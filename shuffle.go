@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// cellKey identifies a benchmark cell of one invocation
+type cellKey struct {
+	dirPath, strategy, variant string
+	workers                    int
+}
+
+// cellSchedule runs all cells ahead of the report, one round per run with
+// the cells in a new random order each round. Running 1 to 8 workers in
+// order lets cache warming and thermal drift favour the later cells;
+// shuffling and interleaving the repetitions spreads that bias evenly.
+type cellSchedule struct {
+	rng   *rand.Rand
+	cells map[cellKey]*benchmarkCell
+	order []*benchmarkCell
+}
+
+// newCellSchedule returns an empty schedule shuffled with the given seed
+func newCellSchedule(seed int64) *cellSchedule {
+	return &cellSchedule{
+		rng:   rand.New(rand.NewSource(seed)),
+		cells: map[cellKey]*benchmarkCell{},
+	}
+}
+
+// add schedules a cell
+func (s *cellSchedule) add(cell *benchmarkCell) {
+	key := cellKey{cell.dirPath, cell.strategy, optionsLabel(cell.strategy, cell.options), cell.numWorkers}
+	s.cells[key] = cell
+	s.order = append(s.order, cell)
+}
+
+// run runs every cell numRuns times, or as often as -min-time and
+// -ci-target demand, interleaved
+func (s *cellSchedule) run(numRuns int) {
+	for round := 1; ; round++ {
+		pending := []*benchmarkCell{}
+		for _, cell := range s.order {
+			if cell.pending() && !cell.enough(numRuns) {
+				pending = append(pending, cell)
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+		s.rng.Shuffle(len(pending), func(i, j int) { pending[i], pending[j] = pending[j], pending[i] })
+		if round <= numRuns {
+			fmt.Printf("  ラウンド %d/%d: %dセルをランダムな順序で実行中...", round, numRuns, len(pending))
+		} else {
+			fmt.Printf("  ラウンド %d: 目標に達していない %dセルをランダムな順序で実行中...", round, len(pending))
+		}
+		for _, cell := range pending {
+			cell.runOnce()
+		}
+		fmt.Println(" 完了")
+	}
+}
+
+// lookup returns the scheduled cell, nil when the schedule is nil or the
+// cell was not scheduled
+func (s *cellSchedule) lookup(dirPath, strategy string, workers int, options ScanOptions) *benchmarkCell {
+	if s == nil {
+		return nil
+	}
+	return s.cells[cellKey{dirPath, strategy, optionsLabel(strategy, options), workers}]
+}
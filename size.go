@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fixture size presets
+const (
+	SizeDev    = "dev"
+	SizeSmall  = "small"
+	SizeMedium = "medium"
+	SizeLarge  = "large"
+	SizeXLarge = "xlarge"
+)
+
+// defaultSize is the preset of real measurements, the former production mode
+const defaultSize = SizeLarge
+
+// sizeNames lists the presets from the smallest to the largest
+var sizeNames = []string{SizeDev, SizeSmall, SizeMedium, SizeLarge, SizeXLarge}
+
+// sizePresets are the fixture dimensions of every size preset
+var sizePresets = map[string]Config{
+	SizeDev: {
+		IsDevelopment:    true,
+		ShallowDirs:      4,
+		ShallowFiles:     4,
+		DeepLevels:       4,
+		DeepDirsPerLevel: 2,
+		MaildirBoxes:     4,
+		MaildirMessages:  2,
+		LogDays:          40,
+		FlatFiles:        1000,
+	},
+	SizeSmall: {
+		ShallowDirs:      20,
+		ShallowFiles:     50,
+		DeepLevels:       4,
+		DeepDirsPerLevel: 4,
+		MaildirBoxes:     200,
+		MaildirMessages:  2,
+		LogDays:          365,
+		FlatFiles:        10000,
+	},
+	SizeMedium: {
+		ShallowDirs:      50,
+		ShallowFiles:     100,
+		DeepLevels:       4,
+		DeepDirsPerLevel: 6,
+		MaildirBoxes:     1000,
+		MaildirMessages:  2,
+		LogDays:          1000,
+		FlatFiles:        100000,
+	},
+	SizeLarge: {
+		ShallowDirs:      100,
+		ShallowFiles:     100,
+		DeepLevels:       4,
+		DeepDirsPerLevel: 10,
+		MaildirBoxes:     5000,
+		MaildirMessages:  2,
+		LogDays:          3650,
+		FlatFiles:        1000000,
+	},
+	SizeXLarge: {
+		ShallowDirs:      300,
+		ShallowFiles:     300,
+		DeepLevels:       5,
+		DeepDirsPerLevel: 10,
+		MaildirBoxes:     20000,
+		MaildirMessages:  4,
+		LogDays:          7300,
+		FlatFiles:        2000000,
+	},
+}
+
+// sizeConfig returns the fixture configuration of a size preset
+func sizeConfig(name string) (Config, error) {
+	config, ok := sizePresets[name]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown size: %s (%s)", name, strings.Join(sizeNames, ", "))
+	}
+	return config, nil
+}
+
+// SizeOverrides replace single dimensions of a size preset; 0 keeps the preset
+type SizeOverrides struct {
+	ShallowDirs      int
+	ShallowFiles     int
+	DeepLevels       int
+	DeepDirsPerLevel int
+}
+
+// apply overrides the dimensions of config that were given and reports
+// whether any was
+func (o SizeOverrides) apply(config *Config) (bool, error) {
+	fields := []struct {
+		name  string
+		value int
+		dst   *int
+	}{
+		{"-shallow-dirs", o.ShallowDirs, &config.ShallowDirs},
+		{"-shallow-files", o.ShallowFiles, &config.ShallowFiles},
+		{"-deep-levels", o.DeepLevels, &config.DeepLevels},
+		{"-deep-dirs", o.DeepDirsPerLevel, &config.DeepDirsPerLevel},
+	}
+	changed := false
+	for _, f := range fields {
+		if f.value < 0 {
+			return false, fmt.Errorf("%s must not be negative: %d", f.name, f.value)
+		}
+		if f.value > 0 {
+			*f.dst = f.value
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// sizeLabel names the fixture size of a run: the preset, marked custom when
+// single dimensions were overridden
+func sizeLabel(name string, custom bool) string {
+	if custom {
+		return name + "+custom"
+	}
+	return name
+}
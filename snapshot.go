@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotHeader starts the first line of a snapshot file
+const snapshotHeader = "# go-parallel-dir-scan-benchmark snapshot v1"
+
+// snapshotEntry is one file or directory of a snapshot
+type snapshotEntry struct {
+	// Path is relative to the scanned root and slash separated
+	Path  string
+	Dir   bool
+	Size  int64
+	MTime int64
+}
+
+// Capture levels of a snapshot scan, from cheapest to most complete
+const (
+	// captureCount only counts entries, like the benchmark scanners
+	captureCount = iota
+	// capturePaths records the path and type of every entry
+	capturePaths
+	// captureStat also records size and mtime, which needs a stat per entry
+	captureStat
+)
+
+// snapshotScan is the outcome of a snapshot scan
+type snapshotScan struct {
+	Entries     []snapshotEntry
+	Files, Dirs int64
+	Duration    time.Duration
+}
+
+// scanSnapshot walks root with numWorkers workers, the traversal of the
+// recursive-task strategy, and records entries up to level. Every worker
+// collects into its own slice so that recording adds no contention.
+func scanSnapshot(root string, numWorkers, level int) (*snapshotScan, error) {
+	result := &snapshotScan{}
+	type task struct{ dir, rel string }
+	tasks := make(chan task, defaultChannelCapacity)
+	var pending sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	buffers := make([][]snapshotEntry, numWorkers+1)
+
+	var visit func(t task, buf *[]snapshotEntry)
+	visit = func(t task, buf *[]snapshotEntry) {
+		entries, err := os.ReadDir(t.dir)
+		if err != nil {
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+			return
+		}
+		atomic.AddInt64(&result.Dirs, 1)
+		var files int64
+		for _, entry := range entries {
+			rel := path.Join(t.rel, entry.Name())
+			if level >= capturePaths {
+				e := snapshotEntry{Path: rel, Dir: entry.IsDir()}
+				if level >= captureStat {
+					if info, err := entry.Info(); err == nil {
+						e.MTime = info.ModTime().UnixNano()
+						if !e.Dir {
+							e.Size = info.Size()
+						}
+					}
+				}
+				*buf = append(*buf, e)
+			}
+			if !entry.IsDir() {
+				files++
+				continue
+			}
+			sub := task{filepath.Join(t.dir, entry.Name()), rel}
+			pending.Add(1)
+			select {
+			case tasks <- sub:
+			default:
+				// Channel full, process inline
+				visit(sub, buf)
+				pending.Done()
+			}
+		}
+		atomic.AddInt64(&result.Files, files)
+	}
+
+	start := time.Now()
+	var workers sync.WaitGroup
+	workers.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		buf := &buffers[i]
+		go func() {
+			defer workers.Done()
+			for t := range tasks {
+				visit(t, buf)
+				pending.Done()
+			}
+		}()
+	}
+	pending.Add(1)
+	tasks <- task{dir: root, rel: ""}
+	pending.Wait()
+	close(tasks)
+	workers.Wait()
+	for _, buf := range buffers {
+		result.Entries = append(result.Entries, buf...)
+	}
+	result.Duration = time.Since(start)
+	return result, firstErr
+}
+
+// writeSnapshot writes entries sorted by path as gzip compressed lines
+func writeSnapshot(filename, root string, entries []snapshotEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriter(zw)
+	fmt.Fprintf(w, "%s root=%s\n", snapshotHeader, strconv.Quote(root))
+	for _, e := range entries {
+		kind := "f"
+		if e.Dir {
+			kind = "d"
+		}
+		// Quoted so that names with tabs or newlines stay on one line
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", kind, e.Size, e.MTime, strconv.Quote(e.Path))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readSnapshot reads a snapshot written by writeSnapshot
+func readSnapshot(filename string) ([]snapshotEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), snapshotHeader) {
+		return nil, fmt.Errorf("%s: not a snapshot file", filename)
+	}
+
+	entries := []snapshotEntry{}
+	line := 1
+	for scanner.Scan() {
+		line++
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s:%d: malformed entry", filename, line)
+		}
+		e := snapshotEntry{Dir: fields[0] == "d"}
+		var err error
+		if e.Size, err = strconv.ParseInt(fields[1], 10, 64); err == nil {
+			if e.MTime, err = strconv.ParseInt(fields[2], 10, 64); err == nil {
+				e.Path, err = strconv.Unquote(fields[3])
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// snapshotDiff lists the paths that differ between two snapshots
+type snapshotDiff struct {
+	Added, Removed, Changed []string
+}
+
+// diffSnapshots compares two snapshots sorted by path. An entry is changed
+// when its type, size or mtime differs.
+func diffSnapshots(before, after []snapshotEntry) snapshotDiff {
+	diff := snapshotDiff{}
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i].Path < after[j].Path):
+			diff.Removed = append(diff.Removed, before[i].Path)
+			i++
+		case i == len(before) || after[j].Path < before[i].Path:
+			diff.Added = append(diff.Added, after[j].Path)
+			j++
+		default:
+			if before[i] != after[j] {
+				diff.Changed = append(diff.Changed, after[j].Path)
+			}
+			i++
+			j++
+		}
+	}
+	return diff
+}
+
+// runSnapshot scans a tree at every capture level, writes the complete
+// snapshot and reports what capturing costs compared with counting only
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan workers")
+	out := fs.String("out", "", "snapshot file (default benchmark/snapshot_<timestamp>.snap.gz)")
+	runs := fs.Int("runs", 3, "runs per capture level; durations are averaged")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *workers < 1 || *runs < 1 {
+		fmt.Println("使い方: snapshot [-workers N] [-runs N] [-out file.snap.gz] <ディレクトリ>")
+		return 2
+	}
+	root := fs.Arg(0)
+	filename := *out
+	if filename == "" {
+		if err := os.MkdirAll("benchmark", 0755); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+		filename = fmt.Sprintf("benchmark/snapshot_%s.snap.gz", time.Now().Format("20060102_150405"))
+	}
+
+	fmt.Printf("スナップショット: %s (ワーカー数 %d, 各 %d 回)\n", root, *workers, *runs)
+	table := &textTable{
+		header: []string{"Capture", "Duration", "Files", "Dirs", "Entries", "Overhead"},
+		right:  []bool{false, true, true, true, true, true},
+	}
+	// Warm-up scan, so that the first level is not the only one read cold
+	if _, err := scanSnapshot(root, *workers, captureCount); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	var countDuration time.Duration
+	var last *snapshotScan
+	for level, name := range []string{"count", "paths", "paths+stat"} {
+		var total time.Duration
+		for i := 0; i < *runs; i++ {
+			scan, err := scanSnapshot(root, *workers, level)
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				return 1
+			}
+			total += scan.Duration
+			last = scan
+		}
+		avg := total / time.Duration(*runs)
+		if level == captureCount {
+			countDuration = avg
+		}
+		table.add(name, avg.Round(time.Microsecond).String(),
+			fmt.Sprintf("%d", last.Files), fmt.Sprintf("%d", last.Dirs), fmt.Sprintf("%d", len(last.Entries)),
+			fmt.Sprintf("%+.1f%%", (float64(avg)/float64(countDuration)-1)*100))
+	}
+	fmt.Println()
+	table.render(os.Stdout, false)
+
+	start := time.Now()
+	if err := writeSnapshot(filename, root, last.Entries); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	size := int64(0)
+	if info, err := os.Stat(filename); err == nil {
+		size = info.Size()
+	}
+	fmt.Printf("\nスナップショットを出力しました: %s (%d エントリ, %s, 整列と圧縮 %v)\n",
+		filename, len(last.Entries), formatBytes(size), time.Since(start).Round(time.Microsecond))
+	return 0
+}
+
+// runDiff compares two snapshots and lists added, removed and changed entries
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	limit := fs.Int("max", 20, "maximum number of paths listed per kind (0 = counts only, -1 = all)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Println("使い方: diff [-max N] <before.snap.gz> <after.snap.gz>")
+		return 2
+	}
+
+	start := time.Now()
+	before, err := readSnapshot(fs.Arg(0))
+	if err == nil {
+		var after []snapshotEntry
+		if after, err = readSnapshot(fs.Arg(1)); err == nil {
+			diff := diffSnapshots(before, after)
+			fmt.Printf("比較: %d → %d エントリ (%v)\n", len(before), len(after), time.Since(start).Round(time.Microsecond))
+			for _, kind := range []struct {
+				mark, name string
+				paths      []string
+			}{{"+", "追加", diff.Added}, {"-", "削除", diff.Removed}, {"~", "変更", diff.Changed}} {
+				fmt.Printf("%s: %d\n", kind.name, len(kind.paths))
+				for i, p := range kind.paths {
+					if *limit >= 0 && i >= *limit {
+						fmt.Printf("  ... (他 %d 件)\n", len(kind.paths)-i)
+						break
+					}
+					fmt.Printf("  %s %s\n", kind.mark, p)
+				}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// Special file kinds sprinkled into fixtures
+const (
+	SpecialFIFO    = "fifo"
+	SpecialSocket  = "socket"
+	SpecialSymlink = "symlink"
+)
+
+// danglingSymlinkTarget is the target of the generated symlinks; it never exists
+const danglingSymlinkTarget = "nonexistent_target"
+
+// createSpecialFiles spreads config.SpecialFiles entries of every supported
+// special kind over the directories of a generated fixture.
+//
+// All strategies classify special entries the same way: anything that is
+// not a directory counts as a file, and symlinks are never followed, so a
+// dangling symlink is neither skipped nor an error. The regular file count
+// check verifies this contract for every strategy.
+func createSpecialFiles(rootPath string, config Config) error {
+	if config.SpecialFiles == 0 {
+		return nil
+	}
+
+	dirs := []string{}
+	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < config.SpecialFiles; i++ {
+		dir := dirs[i%len(dirs)]
+		for _, kind := range specialFileKinds {
+			path := filepath.Join(dir, fmt.Sprintf("special_%s_%d", kind, i))
+			if err := createSpecialFile(kind, path); err != nil {
+				return fmt.Errorf("%s %s: %v", kind, path, err)
+			}
+		}
+	}
+	return nil
+}
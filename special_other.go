@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// specialFileKinds are the special kinds supported on this platform.
+// FIFOs and unix sockets cannot be created portably outside Unix.
+var specialFileKinds = []string{SpecialSymlink}
+
+// createSpecialFile creates a special file of the given kind at path
+func createSpecialFile(kind, path string) error {
+	if kind == SpecialSymlink {
+		return os.Symlink(danglingSymlinkTarget, path)
+	}
+	return fmt.Errorf("unknown special file kind: %s", kind)
+}
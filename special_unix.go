@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// specialFileKinds are the special kinds supported on this platform
+var specialFileKinds = []string{SpecialFIFO, SpecialSocket, SpecialSymlink}
+
+// createSpecialFile creates a special file of the given kind at path
+func createSpecialFile(kind, path string) error {
+	switch kind {
+	case SpecialFIFO:
+		return syscall.Mkfifo(path, 0644)
+	case SpecialSocket:
+		listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		if err != nil {
+			return err
+		}
+		// Keep the socket file after the listener is closed
+		listener.SetUnlinkOnClose(false)
+		return listener.Close()
+	case SpecialSymlink:
+		return os.Symlink(danglingSymlinkTarget, path)
+	}
+	return fmt.Errorf("unknown special file kind: %s", kind)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A minimal SQLite writer: every table is written once as a complete table
+// b-tree of 64 KiB pages, without indexes, free pages or overflow pages, and
+// the schema table fits into page 1. See https://www.sqlite.org/fileformat.html.
+
+// sqlitePageSize is the page size; the header stores 65536 as 1
+const sqlitePageSize = 65536
+
+// sqliteMaxLocal is the largest payload a table leaf cell holds without
+// overflow pages
+const sqliteMaxLocal = sqlitePageSize - 35
+
+// Table b-tree page types
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// sqliteTable is a table with its rows; values are nil, int64, float64 or string
+type sqliteTable struct {
+	name    string
+	columns []string
+	rows    [][]any
+}
+
+// sqliteVarint encodes v as a big-endian variable-length integer
+func sqliteVarint(v uint64) []byte {
+	if v > 1<<56-1 {
+		b := make([]byte, 9)
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return b
+	}
+	b := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+// sqliteRecord encodes values in the record format
+func sqliteRecord(values []any) []byte {
+	types, body := []byte{}, []byte{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			types = append(types, 6)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		case float64:
+			types = append(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = append(types, sqliteVarint(uint64(len(v))*2+13)...)
+			body = append(body, v...)
+		}
+	}
+	// The header size counts its own varint
+	size := len(types) + 1
+	for len(sqliteVarint(uint64(size)))+len(types) != size {
+		size++
+	}
+	return append(append(sqliteVarint(uint64(size)), types...), body...)
+}
+
+// sqliteWriter collects the pages of a database; page n is pages[n-1]
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+// page builds a b-tree page from its cells and returns its page number.
+// Page 1 starts after the 100-byte file header.
+func (w *sqliteWriter) page(number int, kind byte, cells [][]byte, rightmost uint32) int {
+	page := make([]byte, sqlitePageSize)
+	offset := 0
+	if number == 1 {
+		offset = 100
+	}
+	header := 8
+	if kind == sqliteInteriorTable {
+		header = 12
+		binary.BigEndian.PutUint32(page[offset+8:], rightmost)
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+header+2*i:], uint16(content))
+	}
+	// A content area starting at 65536 is stored as 0
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content%sqlitePageSize))
+	if number == 0 {
+		w.pages = append(w.pages, page)
+		return len(w.pages)
+	}
+	w.pages[number-1] = page
+	return number
+}
+
+// fits reports whether cells of the given total size fit on a page with a
+// header of the given size
+func sqliteFits(header, cells, size int) bool {
+	return header+2*cells+size <= sqlitePageSize
+}
+
+// table writes the rows of a table as a b-tree and returns its root page
+func (w *sqliteWriter) table(rows [][]any) (int, error) {
+	type child struct {
+		page   int
+		maxKey int64
+	}
+	level := []child{}
+	cells, size := [][]byte{}, 0
+	flush := func(maxKey int64) {
+		level = append(level, child{w.page(0, sqliteLeafTable, cells, 0), maxKey})
+		cells, size = nil, 0
+	}
+	for i, row := range rows {
+		payload := sqliteRecord(row)
+		if len(payload) > sqliteMaxLocal {
+			return 0, fmt.Errorf("row %d is too large (%d bytes)", i+1, len(payload))
+		}
+		rowid := int64(i + 1)
+		cell := append(append(sqliteVarint(uint64(len(payload))), sqliteVarint(uint64(rowid))...), payload...)
+		if !sqliteFits(8, len(cells)+1, size+len(cell)) {
+			flush(rowid - 1)
+		}
+		cells, size = append(cells, cell), size+len(cell)
+	}
+	if len(cells) > 0 || len(level) == 0 {
+		flush(int64(len(rows)))
+	}
+
+	// Interior pages point to their children by the largest rowid of each,
+	// the last child going into the right-most pointer
+	for len(level) > 1 {
+		parents := []child{}
+		cells, size = nil, 0
+		for i, c := range level {
+			last := i == len(level)-1
+			cell := append(binary.BigEndian.AppendUint32(nil, uint32(c.page)), sqliteVarint(uint64(c.maxKey))...)
+			if last || !sqliteFits(12, len(cells)+2, size+len(cell)+13) {
+				parents = append(parents, child{w.page(0, sqliteInteriorTable, cells, uint32(c.page)), c.maxKey})
+				cells, size = nil, 0
+				continue
+			}
+			cells, size = append(cells, cell), size+len(cell)
+		}
+		level = parents
+	}
+	return level[0].page, nil
+}
+
+// writeSQLite writes the tables to a new database file with userVersion as
+// the user_version of the header
+func writeSQLite(filename string, tables []sqliteTable, userVersion int) error {
+	w := &sqliteWriter{pages: [][]byte{nil}}
+	schema := [][]any{}
+	for _, t := range tables {
+		root, err := w.table(t.rows)
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.name, err)
+		}
+		columns := make([]string, len(t.columns))
+		for i, c := range t.columns {
+			columns[i] = strconv.Quote(c)
+		}
+		sql := fmt.Sprintf("CREATE TABLE %s(%s)", t.name, strings.Join(columns, ", "))
+		schema = append(schema, []any{"table", t.name, t.name, int64(root), sql})
+	}
+
+	cells, size := [][]byte{}, 0
+	for i, row := range schema {
+		payload := sqliteRecord(row)
+		cell := append(append(sqliteVarint(uint64(len(payload))), sqliteVarint(uint64(i+1))...), payload...)
+		cells, size = append(cells, cell), size+len(cell)
+	}
+	if !sqliteFits(108, len(cells), size) {
+		return fmt.Errorf("schema does not fit into the first page")
+	}
+	w.page(1, sqliteLeafTable, cells, 0)
+
+	header := w.pages[0][:100]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], 1)
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], 1)
+	binary.BigEndian.PutUint32(header[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(header[40:], 1)
+	binary.BigEndian.PutUint32(header[44:], 4)
+	binary.BigEndian.PutUint32(header[56:], 1)
+	binary.BigEndian.PutUint32(header[60:], uint32(userVersion))
+	binary.BigEndian.PutUint32(header[92:], 1)
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	for _, page := range w.pages {
+		if _, err := file.Write(page); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// sqliteTextColumns are the results columns holding text, flags and lists;
+// every other column holds numbers
+var sqliteTextColumns = map[string]bool{
+	"Structure": true, "Strategy": true, "Listing": true, "WorkerBusyRatios": true, "Target": true, "Hardlinks": true,
+	"TimedOut": true, "Priority": true, "Host": true, "Session": true, "Workload": true, "WorkerCPU_ms": true,
+	"Noisy": true, "Throttled": true, "Fallback": true, "TaskOrder": true, "Counters": true, "StatCall": true,
+	"GCLimited": true, "Stalled": true, "Symlinks": true, "Filesystem": true, "TargetProfile": true,
+	"StorageProfile": true, "CacheMode": true,
+}
+
+// sqliteDecimal matches the plain decimal numbers of the CSV files, without
+// the sign, digit separators, bases and special values strconv accepts
+var sqliteDecimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// sqliteValue types a CSV value of a column: empty is NULL, the values of
+// text columns and anything but a plain decimal are text
+func sqliteValue(column, s string) any {
+	if s == "" {
+		return nil
+	}
+	if sqliteTextColumns[column] || !sqliteDecimal.MatchString(s) {
+		return s
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) {
+		return f
+	}
+	return s
+}
+
+// sqliteRows types the values of CSV rows with the given columns
+func sqliteRows(columns []string, rows [][]string) [][]any {
+	typed := make([][]any, len(rows))
+	for i, row := range rows {
+		typed[i] = make([]any, len(row))
+		for j, value := range row {
+			typed[i][j] = sqliteValue(columns[j], value)
+		}
+	}
+	return typed
+}
+
+// sqliteOutput writes the aggregate and the per-run rows with the columns of
+// the CSV files as the tables cells and runs of a database, whose
+// user_version is the schema version
+type sqliteOutput struct{}
+
+func (sqliteOutput) Write(session ResultsSession, base string) ([]outputFile, error) {
+	filename := base + ".sqlite"
+	results := session.results()
+	tables := []sqliteTable{
+		{"cells", resultsCSVHeader, sqliteRows(resultsCSVHeader, sessionCSVRows(session))},
+		{"runs", resultsCSVHeader, sqliteRows(resultsCSVHeader, runCSVRows(results, session.Metadata))},
+	}
+	if err := writeSQLite(filename, tables, resultsSchemaVersion); err != nil {
+		return nil, err
+	}
+	return []outputFile{{filename, "結果をSQLiteデータベースに出力しました"}}, nil
+}
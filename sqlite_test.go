@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestSQLiteValue(t *testing.T) {
+	tests := []struct {
+		column, value string
+		want          any
+	}{
+		{"Files", "", nil},
+		{"Files", "1234", int64(1234)},
+		{"Duration_ms", "12.50", 12.5},
+		{"Speedup", "-0.25", -0.25},
+		// Session ids look like numbers with a digit separator
+		{"Session", "20261016_170348", "20261016_170348"},
+		{"Structure", "42", "42"},
+		{"Files", "1_000", "1_000"},
+		{"Files", "0x1f", "0x1f"},
+		{"Files", "+5", "+5"},
+		{"Files", "inf", "inf"},
+		{"Files", "NaN", "NaN"},
+	}
+	for _, tt := range tests {
+		if got := sqliteValue(tt.column, tt.value); got != tt.want {
+			t.Errorf("sqliteValue(%s, %q) = %#v, want %#v", tt.column, tt.value, got, tt.want)
+		}
+	}
+	for column := range sqliteTextColumns {
+		found := false
+		for _, c := range resultsCSVHeader {
+			found = found || c == column
+		}
+		if !found {
+			t.Errorf("text column %s is not a results column", column)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// staleRetryBackoff is the wait before the first retry of a stale listing,
+// doubled for every further retry
+const staleRetryBackoff = 10 * time.Millisecond
+
+// staleRetry retries listings that fail with ESTALE, which NFS and FUSE
+// filesystems return when a cached handle went away, e.g. after the daemon
+// reconnected. A nil staleRetry does not retry.
+type staleRetry struct {
+	attempts int
+	retries  int64
+}
+
+// newStaleRetry returns a retry of up to attempts, or nil for 0
+func newStaleRetry(attempts int) *staleRetry {
+	if attempts <= 0 {
+		return nil
+	}
+	return &staleRetry{attempts: attempts}
+}
+
+// do calls fn until it does not fail with ESTALE or the attempts are used
+// up, and returns its last error. fn must not have passed on entries when it
+// fails, so that a retry does not count them twice.
+func (r *staleRetry) do(ctx context.Context, fn func() error) error {
+	err := fn()
+	if r == nil {
+		return err
+	}
+	backoff := staleRetryBackoff
+	for i := 0; i < r.attempts && errors.Is(err, syscall.ESTALE); i++ {
+		atomic.AddInt64(&r.retries, 1)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		err = fn()
+	}
+	return err
+}
+
+// Retries returns the number of retried listings
+func (r *staleRetry) Retries() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.retries)
+}
+
+// sleepContext waits for d or until ctx is cancelled; a nil ctx is never
+// cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-done:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestStaleRetry(t *testing.T) {
+	stale := &os.PathError{Op: "open", Path: "/mnt/fuse/dir", Err: syscall.ESTALE}
+	// failing returns a listing that fails with err the first n calls
+	failing := func(n int, err error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+
+	r := newStaleRetry(3)
+	fn, calls := failing(2, stale)
+	if err := r.do(context.Background(), fn); err != nil || *calls != 3 || r.Retries() != 2 {
+		t.Errorf("two stale failures: err %v after %d calls and %d retries, want nil after 3 and 2", err, *calls, r.Retries())
+	}
+	fn, calls = failing(10, stale)
+	if err := r.do(context.Background(), fn); !errors.Is(err, syscall.ESTALE) || *calls != 4 {
+		t.Errorf("persistent stale failure: err %v after %d calls, want ESTALE after 4", err, *calls)
+	}
+	// Other errors are not retried
+	fn, calls = failing(1, os.ErrPermission)
+	if err := r.do(context.Background(), fn); !errors.Is(err, os.ErrPermission) || *calls != 1 {
+		t.Errorf("permission error: err %v after %d calls, want it after 1", err, *calls)
+	}
+	// Without retries the listing runs once
+	fn, calls = failing(1, stale)
+	if err := newStaleRetry(0).do(context.Background(), fn); err == nil || *calls != 1 {
+		t.Errorf("no retries: err %v after %d calls", err, *calls)
+	}
+	// A cancelled scan stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fn, _ = failing(1, stale)
+	if err := newStaleRetry(3).do(ctx, fn); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled retry returned %v", err)
+	}
+}
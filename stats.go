@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// significanceLevel is the p-value below which a difference is significant
+const significanceLevel = 0.05
+
+// runSeconds returns the durations of the runs of a cell in seconds
+func runSeconds(r BenchmarkResult) []float64 {
+	samples := make([]float64, 0, len(r.runs))
+	for _, run := range keptRuns(r) {
+		samples = append(samples, run.Duration.Seconds())
+	}
+	return samples
+}
+
+// meanVariance returns the mean and the sample variance of xs
+func meanVariance(xs []float64) (mean, variance float64) {
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(xs)-1)
+}
+
+// welchTTest returns the two-sided p-value of Welch's t-test for equal means.
+// ok is false with fewer than two samples on either side.
+func welchTTest(a, b []float64) (p float64, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, false
+	}
+	meanA, varA := meanVariance(a)
+	meanB, varB := meanVariance(b)
+	seA, seB := varA/float64(len(a)), varB/float64(len(b))
+	if seA+seB == 0 {
+		// Identical runs on both sides: any difference is exact
+		if meanA == meanB {
+			return 1, true
+		}
+		return 0, true
+	}
+	t := (meanA - meanB) / math.Sqrt(seA+seB)
+	df := (seA + seB) * (seA + seB) / (seA*seA/float64(len(a)-1) + seB*seB/float64(len(b)-1))
+	return studentTwoSided(t, df), true
+}
+
+// studentTwoSided returns P(|T| >= |t|) for Student's t distribution with df
+// degrees of freedom
+func studentTwoSided(t, df float64) float64 {
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedBeta returns the regularized incomplete beta function I_x(a, b)
+func regularizedBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly below the mean
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(x, a, b) / a
+	}
+	return 1 - front*betaFraction(1-x, b, a)/b
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta
+// function with the modified Lentz method
+func betaFraction(x, a, b float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		for _, aa := range []float64{
+			m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m)),
+			-(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1)),
+		} {
+			d = 1 + aa*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + aa/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test. The
+// exact distribution is used for small samples without ties, otherwise the
+// normal approximation with tie correction.
+func mannWhitneyU(a, b []float64) (p float64, ok bool) {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 0, false
+	}
+	type sample struct {
+		value float64
+		first bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, x := range a {
+		all = append(all, sample{x, true})
+	}
+	for _, x := range b {
+		all = append(all, sample{x, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Ranks, averaged over ties
+	var rankSum, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSum += rank
+			}
+		}
+		if ties := float64(j - i); ties > 1 {
+			tieTerm += ties*ties*ties - ties
+		}
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+	u = math.Min(u, float64(n1*n2)-u)
+
+	if tieTerm == 0 && n1+n2 <= 40 {
+		return math.Min(1, 2*exactUDistribution(n1, n2, int(u))), true
+	}
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	sd := math.Sqrt(float64(n1*n2) / 12 * (n + 1 - tieTerm/(n*(n-1))))
+	if sd == 0 {
+		return 1, true
+	}
+	z := (math.Abs(u-mean) - 0.5) / sd
+	return math.Min(1, math.Erfc(math.Max(z, 0)/math.Sqrt2)), true
+}
+
+// exactUDistribution returns P(U <= u) for samples of sizes n1 and n2 without
+// ties, counting the orderings with f(m, n, k) = f(m-1, n, k-n) + f(m, n-1, k)
+func exactUDistribution(n1, n2, u int) float64 {
+	// counts[m][n] holds the number of orderings per value of U
+	counts := make([][][]float64, n1+1)
+	for m := range counts {
+		counts[m] = make([][]float64, n2+1)
+		for n := range counts[m] {
+			counts[m][n] = make([]float64, m*n+1)
+			if m == 0 || n == 0 {
+				counts[m][n][0] = 1
+				continue
+			}
+			for k := range counts[m][n] {
+				if k >= n && k-n < len(counts[m-1][n]) {
+					counts[m][n][k] += counts[m-1][n][k-n]
+				}
+				if k < len(counts[m][n-1]) {
+					counts[m][n][k] += counts[m][n-1][k]
+				}
+			}
+		}
+	}
+	var below, total float64
+	for k, c := range counts[n1][n2] {
+		total += c
+		if k <= u {
+			below += c
+		}
+	}
+	return below / total
+}
+
+// significanceGroup identifies cells that are compared with each other: the
+// same tree scanned with the same number of workers
+type significanceGroup struct {
+	target, structure string
+	workers           int
+}
+
+// printSignificanceSummary compares every cell with the fastest cell of the
+// same tree and worker count on their run durations and reports whether the
+// difference is significant at 95%
+func printSignificanceSummary(results []BenchmarkResult) {
+	groups := map[significanceGroup][]BenchmarkResult{}
+	order := []significanceGroup{}
+	for _, r := range results {
+		if r.TimedOut || len(r.runs) < 2 {
+			continue
+		}
+		key := significanceGroup{r.Target, r.Structure, r.Workers}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+
+	table := &textTable{
+		header: []string{"Structure", "Workers", "Fastest", "Strategy", "Slower", "p(t)", "p(U)", "Significant"},
+		right:  []bool{false, true, false, false, true, true, true, false},
+	}
+	for _, key := range order {
+		cells := groups[key]
+		if len(cells) < 2 {
+			continue
+		}
+		fastest := cells[0]
+		for _, r := range cells[1:] {
+			if r.Duration < fastest.Duration {
+				fastest = r
+			}
+		}
+		base := runSeconds(fastest)
+		for _, r := range cells {
+			if r.Label() == fastest.Label() {
+				continue
+			}
+			samples := runSeconds(r)
+			pt, _ := welchTTest(base, samples)
+			pu, _ := mannWhitneyU(base, samples)
+			significant := "no"
+			if pt < significanceLevel {
+				significant = "yes"
+			}
+			slower := float64(r.Duration-fastest.Duration) / float64(fastest.Duration) * 100
+			table.add(key.structure, fmt.Sprintf("%d", key.workers), fastest.Label(), r.Label(),
+				fmt.Sprintf("%+.1f%%", slower), fmt.Sprintf("%.3f", pt), fmt.Sprintf("%.3f", pu), significant)
+		}
+	}
+	if len(table.rows) == 0 {
+		return
+	}
+	fmt.Println("\n===== 戦略間の差の有意性 (各構造・ワーカー数で最速のセルと比較、有意水準5%) =====")
+	table.render(os.Stdout, false)
+	fmt.Println("Significant はWelchのt検定による判定です。Mann-WhitneyのU検定は外れ値に強い一方、各3回の実行では最小のp値が0.10で有意にはなりません")
+}
+
+// tQuantile975 returns the 97.5th percentile of Student's t distribution with
+// df degrees of freedom, the factor of a two-sided 95% confidence interval
+func tQuantile975(df float64) float64 {
+	// studentTwoSided decreases in t; bisect for a tail probability of 5%
+	lo, hi := 0.0, 1000.0
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTwoSided(mid, df) > 1-0.95 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// durationCI returns the half width of the 95% confidence interval of the
+// mean duration of runs, -1 with fewer than two runs
+func durationCI(runs []BenchmarkResult) time.Duration {
+	if len(runs) < 2 {
+		return -1
+	}
+	samples := make([]float64, len(runs))
+	for i, r := range runs {
+		samples[i] = float64(r.Duration)
+	}
+	_, variance := meanVariance(samples)
+	n := float64(len(samples))
+	return time.Duration(tQuantile975(n-1) * math.Sqrt(variance/n))
+}
+
+// formatCI formats the half width of a confidence interval, "-" when unknown
+func formatCI(ci time.Duration) string {
+	if ci < 0 {
+		return "-"
+	}
+	if ci >= time.Second {
+		return "±" + ci.Round(time.Millisecond).String()
+	}
+	return "±" + ci.Round(10*time.Microsecond).String()
+}
+
+// defaultOutlierK is the default number of median absolute deviations a run
+// may deviate from the median duration of its cell before it is an outlier;
+// 3.5 is the usual cut-off of the modified z-score
+const defaultOutlierK = 3.5
+
+// madScale makes the median absolute deviation estimate the standard
+// deviation of normally distributed samples
+const madScale = 1.4826
+
+// minOutlierDeviation is the relative deviation from the median below which
+// a run is never an outlier: with few runs the MAD can be tiny, and a few
+// percent of jitter is not worth flagging
+const minOutlierDeviation = 0.05
+
+// markOutliers flags the runs whose duration deviates more than k scaled
+// median absolute deviations (and more than minOutlierDeviation) from the
+// median and returns their number. At least three runs are needed.
+func markOutliers(runs []BenchmarkResult, k float64) int {
+	if len(runs) < 3 || k <= 0 {
+		return 0
+	}
+	durations := make([]float64, len(runs))
+	for i, r := range runs {
+		durations[i] = float64(r.Duration)
+	}
+	median := medianOf(durations)
+	deviations := make([]float64, len(runs))
+	for i, d := range durations {
+		deviations[i] = math.Abs(d - median)
+	}
+	limit := math.Max(k*madScale*medianOf(deviations), minOutlierDeviation*median)
+	outliers := 0
+	for i := range runs {
+		runs[i].Outlier = deviations[i] > limit
+		if runs[i].Outlier {
+			outliers++
+		}
+	}
+	return outliers
+}
+
+// medianOf returns the median of xs without reordering it
+func medianOf(xs []float64) float64 {
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// keptRuns returns the runs of a cell that enter its averages: all runs,
+// or those that are not outliers when outliers were trimmed
+func keptRuns(r BenchmarkResult) []BenchmarkResult {
+	if r.TrimmedRuns == 0 {
+		return r.runs
+	}
+	kept := []BenchmarkResult{}
+	for _, run := range r.runs {
+		if !run.Outlier {
+			kept = append(kept, run)
+		}
+	}
+	return kept
+}
+
+// printOutlierSummary lists the cells with outlier runs, marking the
+// outlier durations with *
+func printOutlierSummary(results []BenchmarkResult, trimmed bool) {
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "Runs_ms", "Outliers"},
+		right:  []bool{false, false, true, false, true},
+	}
+	total := 0
+	for _, r := range results {
+		if r.Outliers == 0 {
+			continue
+		}
+		total += r.Outliers
+		durations := []string{}
+		for _, run := range r.runs {
+			d := fmt.Sprintf("%.2f", run.Duration.Seconds()*1000)
+			if run.Outlier {
+				d += "*"
+			}
+			durations = append(durations, d)
+		}
+		table.add(r.Structure, r.Label(), fmt.Sprintf("%d", r.Workers), strings.Join(durations, " "), fmt.Sprintf("%d", r.Outliers))
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Println("\n===== 外れ値の実行 (*: 中央値から -outlier-k × MAD を超えて外れた実行) =====")
+	table.render(os.Stdout, false)
+	if trimmed {
+		fmt.Printf("外れ値として平均から除外した実行: %d\n", total)
+	} else {
+		fmt.Printf("外れ値の実行: %d (平均に含まれています。-trim-outliers で除外できます)\n", total)
+	}
+}
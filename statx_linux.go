@@ -0,0 +1,74 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// statxSupported reports whether the statx call of the stat workload is
+// built in
+const statxSupported = true
+
+// statx ABI, see include/uapi/linux/stat.h
+const (
+	statxType = 0x1
+	statxSize = 0x200
+
+	atFDCWD           = -100
+	atSymlinkNoFollow = 0x100
+	statxModeTypeMask = 0xf000
+	statxModeRegular  = 0x8000
+)
+
+// sysStatx is the statx system call number; arm64 uses the generic table
+var sysStatx = map[string]uintptr{"amd64": 332, "arm64": 291}[runtime.GOARCH]
+
+// statxMissing is set once statx failed with ENOSYS, on kernels before 4.11
+// or under seccomp filters that reject it, so that later entries go straight
+// to lstat
+var statxMissing atomic.Bool
+
+// statxBuf mirrors struct statx up to stx_size; the rest is reserved space
+type statxBuf struct {
+	mask       uint32
+	blksize    uint32
+	attributes uint64
+	nlink      uint32
+	uid        uint32
+	gid        uint32
+	mode       uint16
+	_          uint16
+	ino        uint64
+	size       uint64
+	rest       [208]byte
+}
+
+// statxMinimal asks only for the type and size of an entry without following
+// symlinks. ok is false when statx is not available and the caller must fall
+// back to lstat.
+func statxMinimal(path string) (size int64, regular, ok bool, err error) {
+	if statxMissing.Load() {
+		return 0, false, false, nil
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, false, true, err
+	}
+	var buf statxBuf
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(sysStatx, uintptr(dirfd), uintptr(unsafe.Pointer(p)), atSymlinkNoFollow,
+		statxType|statxSize, uintptr(unsafe.Pointer(&buf)), 0)
+	if errno == syscall.ENOSYS {
+		statxMissing.Store(true)
+		return 0, false, false, nil
+	}
+	if errno != 0 {
+		return 0, false, true, &os.PathError{Op: "statx", Path: path, Err: errno}
+	}
+	return int64(buf.size), buf.mode&statxModeTypeMask == statxModeRegular, true, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux || (!amd64 && !arm64)
+
+package main
+
+// statxSupported reports whether the statx call of the stat workload is
+// built in
+const statxSupported = false
+
+func statxMinimal(path string) (size int64, regular, ok bool, err error) {
+	return 0, false, false, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ScanSnapshot is the intermediate count of a running scan
+type ScanSnapshot struct {
+	// Elapsed is the time since the start of the scan
+	Elapsed time.Duration
+	// Files and Dirs are the files found and directories listed so far
+	Files int64
+	Dirs  int64
+}
+
+// FilesPerSecond returns the average rate of the scan so far
+func (s ScanSnapshot) FilesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Files) / s.Elapsed.Seconds()
+}
+
+// String describes the snapshot for a progress line
+func (s ScanSnapshot) String() string {
+	return fmt.Sprintf("経過 %v: ファイル %d, ディレクトリ %d (%.0f ファイル/s)",
+		s.Elapsed.Round(time.Millisecond), s.Files, s.Dirs, s.FilesPerSecond())
+}
+
+// snapshot passes the current counts to the snapshot receiver. Receivers
+// are called one at a time, on a scan worker or the ticker, and never after
+// Stop.
+func (t *progressTracker) snapshot() {
+	t.snapshotMu.Lock()
+	defer t.snapshotMu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.snapshots(ScanSnapshot{
+		Elapsed: time.Since(t.start),
+		Files:   atomic.LoadInt64(&t.files),
+		Dirs:    atomic.LoadInt64(&t.dirs),
+	})
+}
+
+// streamingScanner reports the snapshots of every scan of a strategy when
+// the scanner is not run by runBenchmark, which tracks the progress itself
+type streamingScanner struct {
+	strategy   string
+	numWorkers int
+	options    ScanOptions
+}
+
+func newStreamingScanner(strategy string, numWorkers int, options ScanOptions) (strategyScanner, error) {
+	plain := options
+	plain.Snapshots = nil
+	if _, err := newScanner(strategy, numWorkers, plain); err != nil {
+		return nil, err
+	}
+	return &streamingScanner{strategy: strategy, numWorkers: numWorkers, options: options}, nil
+}
+
+func (s *streamingScanner) Scan(rootPath string) (*ScanResult, error) {
+	options := s.options
+	options.progress = startProgressTracker(options)
+	defer options.progress.Stop()
+	scanner, err := newScanner(s.strategy, s.numWorkers, options)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.Scan(rootPath)
+}
+
+// printSnapshot prints a snapshot as an indented progress line
+func printSnapshot(s ScanSnapshot) {
+	fmt.Printf("    %s\n", s)
+}
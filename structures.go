@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Structure orders of -structure-order
+const (
+	// StructureOrderGiven runs the structures in the order of -structures or -paths
+	StructureOrderGiven   = "given"
+	StructureOrderName    = "name"
+	StructureOrderReverse = "reverse"
+	StructureOrderRandom  = "random"
+)
+
+// defaultStructures are the fixtures generated when -structures is not given
+var defaultStructures = []string{StructureShallow, StructureDeep}
+
+// maildirSubdirs are the directories of every maildir mailbox
+var maildirSubdirs = []string{"cur", "new", "tmp"}
+
+// logDirsStart is the first day of the per-day log tree
+var logDirsStart = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parseStructures parses a comma separated list of structure names
+func parseStructures(value string) ([]string, error) {
+	structures := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		switch name {
+		case StructureShallow, StructureDeep, StructureMaildir, StructureLogDirs, StructureFlat:
+		default:
+			return nil, fmt.Errorf("unknown structure: %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			structures = append(structures, name)
+		}
+	}
+	if len(structures) == 0 {
+		return nil, fmt.Errorf("no structure given")
+	}
+	return structures, nil
+}
+
+// orderStructures returns the structures in the run order selected by
+// order; rng shuffles them for the random order
+func orderStructures(structures []string, order string, rng *rand.Rand) ([]string, error) {
+	ordered := append([]string{}, structures...)
+	switch order {
+	case StructureOrderGiven:
+	case StructureOrderName:
+		sort.Strings(ordered)
+	case StructureOrderReverse:
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	case StructureOrderRandom:
+		rng.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	default:
+		return nil, fmt.Errorf("unknown structure order: %s", order)
+	}
+	return ordered, nil
+}
+
+// createMaildirStructure creates a maildir-style tree: many mailboxes, each
+// with cur/new/tmp directories where only cur holds a few messages
+func createMaildirStructure(rootPath string, config Config) error {
+	for i := 0; i < config.MaildirBoxes; i++ {
+		boxPath := filepath.Join(rootPath, fmt.Sprintf("user%05d", i))
+		if err := os.Mkdir(boxPath, 0755); err != nil {
+			return err
+		}
+		for _, sub := range maildirSubdirs {
+			if err := os.Mkdir(filepath.Join(boxPath, sub), 0755); err != nil {
+				return err
+			}
+		}
+		for j := 0; j < config.MaildirMessages; j++ {
+			filePath := filepath.Join(boxPath, "cur", fmt.Sprintf("%d.M%dP%d.host!2,S", 1600000000+j, j, i))
+			content := []byte(fmt.Sprintf("Message %d in mailbox %d", j, i))
+			if err := os.WriteFile(filePath, content, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createLogDirsStructure creates a YYYY/MM/DD tree with one directory per day
+// holding a single log file
+func createLogDirsStructure(rootPath string, config Config) error {
+	for i := 0; i < config.LogDays; i++ {
+		day := logDirsStart.AddDate(0, 0, i)
+		dirPath := filepath.Join(rootPath, day.Format("2006"), day.Format("01"), day.Format("02"))
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			return err
+		}
+		filePath := filepath.Join(dirPath, "app.log")
+		content := []byte(fmt.Sprintf("Log of %s", day.Format("2006-01-02")))
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFlatStructure creates a single directory holding every file
+func createFlatStructure(rootPath string, config Config) error {
+	for i := 0; i < config.FlatFiles; i++ {
+		filePath := filepath.Join(rootPath, fixtureFileName(config, fmt.Sprintf("file_%07d", i), ".txt", i))
+		content := []byte(fmt.Sprintf("File %d", i))
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maildirCounts returns the number of files and directories of the maildir structure
+func maildirCounts(config Config) (files, dirs int) {
+	return config.MaildirBoxes * config.MaildirMessages, 1 + config.MaildirBoxes*(1+len(maildirSubdirs))
+}
+
+// logDirsCounts returns the number of files and directories of the per-day log structure
+func logDirsCounts(config Config) (files, dirs int) {
+	years := map[int]bool{}
+	months := map[string]bool{}
+	for i := 0; i < config.LogDays; i++ {
+		day := logDirsStart.AddDate(0, 0, i)
+		years[day.Year()] = true
+		months[day.Format("2006-01")] = true
+	}
+	return config.LogDays, 1 + len(years) + len(months) + config.LogDays
+}
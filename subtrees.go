@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Orders of the -subtrees report
+const (
+	SubtreeSortTime  = "time"
+	SubtreeSortFiles = "files"
+)
+
+// subtreeReportRows is the number of subtrees printed per report
+const subtreeReportRows = 10
+
+// SubtreeResult is the part of a directory-based scan below one top-level
+// directory of the root. The entry whose Path is the root itself holds the
+// files directly in the root and the time to list it.
+type SubtreeResult struct {
+	Path     string
+	Files    int64
+	Dirs     int64
+	Errors   int64
+	Duration time.Duration
+}
+
+// subtreeRecorder collects the top-level directories of a directory-based
+// scan. All methods are no-ops on a nil receiver.
+type subtreeRecorder struct {
+	mu       sync.Mutex
+	subtrees []SubtreeResult
+}
+
+// record adds the result of a top-level directory scanned in d
+func (r *subtreeRecorder) record(path string, result *ScanResult, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.subtrees = append(r.subtrees, SubtreeResult{Path: path, Files: result.Files, Dirs: result.Dirs, Errors: result.Errors, Duration: d})
+	r.mu.Unlock()
+}
+
+// results returns the recorded subtrees in path order
+func (r *subtreeRecorder) results() []SubtreeResult {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subtrees := append([]SubtreeResult(nil), r.subtrees...)
+	sort.Slice(subtrees, func(i, j int) bool { return subtrees[i].Path < subtrees[j].Path })
+	return subtrees
+}
+
+// averageSubtrees returns the subtrees of the last run with the durations
+// averaged over the runs that recorded each path
+func averageSubtrees(runs []BenchmarkResult) []SubtreeResult {
+	if len(runs) == 0 || runs[len(runs)-1].Subtrees == nil {
+		return nil
+	}
+	total := map[string]time.Duration{}
+	count := map[string]int{}
+	for _, r := range runs {
+		for _, s := range r.Subtrees {
+			total[s.Path] += s.Duration
+			count[s.Path]++
+		}
+	}
+	subtrees := append([]SubtreeResult(nil), runs[len(runs)-1].Subtrees...)
+	for i := range subtrees {
+		subtrees[i].Duration = total[subtrees[i].Path] / time.Duration(count[subtrees[i].Path])
+	}
+	return subtrees
+}
+
+// sortSubtrees orders subtrees by duration or by file count, largest first
+func sortSubtrees(subtrees []SubtreeResult, by string) {
+	sort.SliceStable(subtrees, func(i, j int) bool {
+		if by == SubtreeSortFiles {
+			return subtrees[i].Files > subtrees[j].Files
+		}
+		return subtrees[i].Duration > subtrees[j].Duration
+	})
+}
+
+// printSubtreeReport prints the largest top-level directories of the
+// directory-based cell with the most workers of every structure and target
+func printSubtreeReport(results []BenchmarkResult, by string) {
+	type cellKey struct{ structure, target string }
+	best := map[cellKey]BenchmarkResult{}
+	order := []cellKey{}
+	for _, r := range results {
+		if r.Subtrees == nil {
+			continue
+		}
+		key := cellKey{r.Structure, r.Target}
+		b, ok := best[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || r.Workers > b.Workers {
+			best[key] = r
+		}
+	}
+	for _, key := range order {
+		r := best[key]
+		subtrees := append([]SubtreeResult(nil), r.Subtrees...)
+		sortSubtrees(subtrees, by)
+		var total time.Duration
+		for _, s := range subtrees {
+			total += s.Duration
+		}
+		fmt.Printf("\n===== トップレベルのディレクトリ別 (%s, %s, ワーカー数 %d, %s順) =====\n", r.Structure, r.Label(), r.Workers, map[string]string{SubtreeSortTime: "時間", SubtreeSortFiles: "ファイル数"}[by])
+		table := &textTable{
+			header: []string{"Path", "Files", "Dirs", "Errors", "Duration", "Share"},
+			right:  []bool{false, true, true, true, true, true},
+		}
+		for i, s := range subtrees {
+			if i == subtreeReportRows {
+				table.add(fmt.Sprintf("... 他 %d", len(subtrees)-i), "", "", "", "", "")
+				break
+			}
+			share := "-"
+			if total > 0 {
+				share = fmt.Sprintf("%.1f%%", float64(s.Duration)/float64(total)*100)
+			}
+			table.add(s.Path, strconv.FormatInt(s.Files, 10), strconv.FormatInt(s.Dirs, 10), strconv.FormatInt(s.Errors, 10), formatDuration(s.Duration), share)
+		}
+		table.render(os.Stdout, false)
+	}
+}
+
+// exportSubtreesToCSV exports every top-level directory of every result
+func exportSubtreesToCSV(results []BenchmarkResult, by, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"Structure", "Strategy", "Workers", "Target", "Rank", "Path", "Files", "Dirs", "Errors", "Duration_ms"})
+	for _, r := range results {
+		subtrees := append([]SubtreeResult(nil), r.Subtrees...)
+		sortSubtrees(subtrees, by)
+		for i, s := range subtrees {
+			writer.Write([]string{
+				r.Structure,
+				r.Label(),
+				strconv.Itoa(r.Workers),
+				r.Target,
+				strconv.Itoa(i + 1),
+				s.Path,
+				strconv.FormatInt(s.Files, 10),
+				strconv.FormatInt(s.Dirs, 10),
+				strconv.FormatInt(s.Errors, 10),
+				fmt.Sprintf("%.3f", s.Duration.Seconds()*1000),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Modes of counting symlinks to directories
+const (
+	// SymlinksFile counts every symlink as a file, as lstat sees it
+	SymlinksFile = "file"
+	// SymlinksDir counts symlinks to directories as directories without
+	// listing them
+	SymlinksDir = "dir"
+	// SymlinksFollow lists symlinked directories like real ones. A symlink
+	// to the directory holding it or to one of its ancestors is counted as a
+	// directory but not listed, so that loops end.
+	SymlinksFollow = "follow"
+)
+
+// parseSymlinkMode checks a mode of counting symlinks to directories
+func parseSymlinkMode(value string) (string, error) {
+	switch value {
+	case SymlinksFile, SymlinksDir, SymlinksFollow:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown symlink mode: %s (%s, %s, %s)", value, SymlinksFile, SymlinksDir, SymlinksFollow)
+}
+
+// symlinksLabel describes a non-default symlink mode in result labels
+func symlinksLabel(mode string) string {
+	if mode == "" || mode == SymlinksFile {
+		return ""
+	}
+	return "symlinks=" + mode
+}
+
+// symlinkResolver applies a symlink mode other than file to the entries of
+// a scan. Listings pass their entries through entry, which turns symlinks to
+// directories into directory entries; listing a directory counted but not
+// listed is then skipped by leaf. A nil resolver keeps every entry as is.
+type symlinkResolver struct {
+	mode string
+	// leaves holds the cleaned paths of the symlinks that are counted as
+	// directories without being listed
+	leaves sync.Map
+}
+
+// newSymlinkResolver returns the resolver of a scan, nil for the file mode
+func newSymlinkResolver(mode string) *symlinkResolver {
+	if mode == "" || mode == SymlinksFile {
+		return nil
+	}
+	return &symlinkResolver{mode: mode}
+}
+
+// resolve reports whether the symlink name in dir points to a directory and
+// whether the scan lists it. Dangling symlinks count as files.
+func (r *symlinkResolver) resolve(dir, name string) (isDir, list bool) {
+	target, err := os.Stat(filepath.Join(dir, name))
+	if err != nil || !target.IsDir() {
+		return false, false
+	}
+	return true, r.mode == SymlinksFollow && !isAncestor(dir, target)
+}
+
+// isAncestor reports whether target is dir or one of its ancestors, through
+// the symlinks followed to reach dir
+func isAncestor(dir string, target fs.FileInfo) bool {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return true
+	}
+	for {
+		if info, err := os.Stat(path); err == nil && os.SameFile(info, target) {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// entry returns entry of the directory dir as the scan counts it
+func (r *symlinkResolver) entry(dir string, entry fs.DirEntry) fs.DirEntry {
+	if r == nil || entry.Type()&fs.ModeSymlink == 0 {
+		return entry
+	}
+	isDir, list := r.resolve(dir, entry.Name())
+	if !isDir {
+		return entry
+	}
+	path := filepath.Join(dir, entry.Name())
+	if !list {
+		r.leaves.Store(path, struct{}{})
+	}
+	return symlinkDirEntry{DirEntry: entry, path: path}
+}
+
+// leaf reports whether path is a symlink counted as a directory that must
+// not be listed
+func (r *symlinkResolver) leaf(path string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.leaves.Load(filepath.Clean(path))
+	return ok
+}
+
+// symlinkDirEntry is a symlink counted as a directory
+type symlinkDirEntry struct {
+	fs.DirEntry
+	path string
+}
+
+func (e symlinkDirEntry) IsDir() bool                { return true }
+func (e symlinkDirEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e symlinkDirEntry) Info() (fs.FileInfo, error) { return os.Stat(e.path) }
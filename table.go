@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Sort orders of the summary table
+const (
+	SortNone     = ""
+	SortDuration = "duration"
+	SortSpeedup  = "speedup"
+)
+
+// parseSortOrder validates a -sort value
+func parseSortOrder(value string) (string, error) {
+	switch value {
+	case SortNone, SortDuration, SortSpeedup:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown sort order: %s (duration or speedup)", value)
+}
+
+// ANSI escape sequences of the summary table
+const (
+	ansiBest  = "\033[1;32m"
+	ansiReset = "\033[0m"
+)
+
+// colorEnabled reports whether the summary table may be colored: not with
+// -no-color, not when NO_COLOR is set and only when stdout is a terminal
+func colorEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tableCell is one cell of a textTable; highlighted cells are colored
+type tableCell struct {
+	text      string
+	highlight bool
+}
+
+// textTable renders rows with columns sized to their widest cell
+type textTable struct {
+	header []string
+	// right aligns the column, e.g. for numbers
+	right []bool
+	rows  [][]tableCell
+}
+
+// add appends a row of plain cells
+func (t *textTable) add(cells ...string) {
+	row := make([]tableCell, len(cells))
+	for i, text := range cells {
+		row[i] = tableCell{text: text}
+	}
+	t.rows = append(t.rows, row)
+}
+
+// render writes the table; color wraps highlighted cells in escape sequences
+// after padding so that the escapes do not disturb the alignment
+func (t *textTable) render(w io.Writer, color bool) {
+	widths := make([]int, len(t.header))
+	for i, name := range t.header {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range t.rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	pad := func(i int, text string) string {
+		gap := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(text))
+		if t.right[i] {
+			return gap + text
+		}
+		return text + gap
+	}
+	line := func(cells []tableCell) {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			parts[i] = pad(i, cell.text)
+			if color && cell.highlight {
+				parts[i] = ansiBest + parts[i] + ansiReset
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(parts, "  "), " "))
+	}
+
+	header := make([]tableCell, len(t.header))
+	total := 2 * (len(t.header) - 1)
+	for i, name := range t.header {
+		header[i] = tableCell{text: name}
+		total += widths[i]
+	}
+	line(header)
+	fmt.Fprintln(w, strings.Repeat("-", total))
+	for _, row := range t.rows {
+		line(row)
+	}
+}
+
+// summaryGroup is the key of the results that share a speedup baseline
+func summaryGroup(r BenchmarkResult) string {
+	return r.Target + "\x00" + r.Structure
+}
+
+// sortSummary orders the results within each group by duration (ascending)
+// or speedup (descending); groups keep the order in which they ran
+func sortSummary(results []BenchmarkResult, order string) []BenchmarkResult {
+	sorted := append([]BenchmarkResult{}, results...)
+	if order == SortNone {
+		return sorted
+	}
+	groupIndex := map[string]int{}
+	for _, r := range sorted {
+		if _, ok := groupIndex[summaryGroup(r)]; !ok {
+			groupIndex[summaryGroup(r)] = len(groupIndex)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		gi, gj := groupIndex[summaryGroup(sorted[i])], groupIndex[summaryGroup(sorted[j])]
+		if gi != gj {
+			return gi < gj
+		}
+		if order == SortSpeedup {
+			return sorted[i].Speedup > sorted[j].Speedup
+		}
+		return sorted[i].Duration < sorted[j].Duration
+	})
+	return sorted
+}
+
+// bestInGroups returns, per group, the index of the fastest result that did
+// not time out
+func bestInGroups(results []BenchmarkResult) map[string]int {
+	best := map[string]int{}
+	for i, r := range results {
+		if r.TimedOut {
+			continue
+		}
+		key := summaryGroup(r)
+		if j, ok := best[key]; !ok || r.Duration < results[j].Duration {
+			best[key] = i
+		}
+	}
+	return best
+}
+
+// formatWorkersPerCPU formats a relative worker count to three decimals, "-"
+// when there is none
+func formatWorkersPerCPU(perCPU float64) string {
+	if perCPU < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(math.Round(perCPU*1000)/1000, 'f', -1, 64) + "x"
+}
+
+// formatCount formats a file or directory count, "n/a" when unknown
+func formatCount(n int) string {
+	if n < 0 {
+		return "n/a"
+	}
+	return strconv.Itoa(n)
+}
+
+// optionalCount formats a count for CSV, empty when unknown
+func optionalCount(n int) string {
+	if n < 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// printSummary prints the results table; the fastest cell of every structure
+// is highlighted when color is enabled
+func printSummary(w io.Writer, results []BenchmarkResult, order string, color bool) {
+	results = sortSummary(results, order)
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "xCPU", "Duration", "95%CI", "Files", "Dirs", "Speedup", "Allocs/op", "GC", "B/file"},
+		right:  []bool{false, false, true, true, true, true, true, true, true, true, true, true},
+	}
+	best := bestInGroups(results)
+	for i, r := range results {
+		table.add(
+			r.Structure,
+			r.Label(),
+			fmt.Sprintf("%d", r.Workers),
+			formatWorkersPerCPU(r.WorkersPerCPU),
+			r.Duration.Round(time.Millisecond).String(),
+			formatCI(r.DurationCI),
+			formatCount(r.FilesScanned),
+			formatCount(r.DirsScanned),
+			fmt.Sprintf("%.2fx", r.Speedup),
+			fmt.Sprintf("%d", r.Allocs),
+			fmt.Sprintf("%d", r.NumGC),
+			fmt.Sprintf("%.1f", r.BytesPerFile()))
+		if j, ok := best[summaryGroup(r)]; ok && j == i {
+			row := table.rows[len(table.rows)-1]
+			row[4].highlight = true
+			row[8].highlight = true
+		}
+	}
+	table.render(w, color)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// parseFixtureDirs parses a comma separated list of fixture directories.
+// Each directory is a separate target holding its own copy of the fixtures.
+func parseFixtureDirs(value string) ([]string, error) {
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, dir := range strings.Split(value, ",") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			return nil, fmt.Errorf("duplicate fixture directory: %s", dir)
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no fixture directory given")
+	}
+	return dirs, nil
+}
+
+// testDir is the root of the tree scanned as a structure
+type testDir struct {
+	Structure string
+	Path      string
+}
+
+// fixtureTestDirs returns the fixture root of each structure under dir, in
+// the order of structures
+func fixtureTestDirs(dir string, structures []string) []testDir {
+	testDirs := []testDir{}
+	for _, structure := range structures {
+		testDirs = append(testDirs, testDir{structure, filepath.Join(dir, fixturePrefix+structure)})
+	}
+	return testDirs
+}
+
+// testDirPath returns the root of a structure, or "" when it is not scanned
+func testDirPath(testDirs []testDir, structure string) string {
+	for _, d := range testDirs {
+		if d.Structure == structure {
+			return d.Path
+		}
+	}
+	return ""
+}
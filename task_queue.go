@@ -0,0 +1,222 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Task orders of the task channel strategies: which pending directory a free
+// worker takes next
+const (
+	// TaskOrderFIFO takes the oldest directory first (breadth-first), the
+	// order of the original buffered channel; more parallelism sooner
+	TaskOrderFIFO = "fifo"
+	// TaskOrderLIFO takes the newest directory first (depth-first); the queue
+	// stays smaller and workers stay near the directories they just read
+	TaskOrderLIFO = "lifo"
+	// TaskOrderPriority takes the directory with the most subdirectories
+	// first, judged by fan-out hints, so that big subtrees start early
+	// instead of becoming stragglers at the end of the scan
+	TaskOrderPriority = "priority"
+)
+
+// parseTaskOrders parses a comma separated list of task orders
+func parseTaskOrders(value string) ([]string, error) {
+	orders := []string{}
+	for _, order := range strings.Split(value, ",") {
+		order = strings.TrimSpace(order)
+		if !validTaskOrder(order) {
+			return nil, fmt.Errorf("unknown task order: %s (%s, %s, %s)", order, TaskOrderFIFO, TaskOrderLIFO, TaskOrderPriority)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// validTaskOrder reports whether order is a known task order
+func validTaskOrder(order string) bool {
+	return order == TaskOrderFIFO || order == TaskOrderLIFO || order == TaskOrderPriority
+}
+
+// taskQueue holds the pending directories of a scan, bounded by the channel
+// capacity
+type taskQueue[T any] interface {
+	// offer adds a task unless the queue is full
+	offer(task T) bool
+	// take waits for a task; it returns false once the queue is closed
+	take() (T, bool)
+	close()
+	depth() int
+}
+
+// newTaskQueue returns a queue of the given capacity and task order;
+// priority ranks the tasks of TaskOrderPriority, higher first
+func newTaskQueue[T any](capacity int, order string, priority func(T) int) taskQueue[T] {
+	switch order {
+	case TaskOrderLIFO:
+		q := &stackQueue[T]{capacity: capacity}
+		q.cond = sync.NewCond(&q.mu)
+		return q
+	case TaskOrderPriority:
+		q := &priorityQueue[T]{capacity: capacity, priority: priority}
+		q.cond = sync.NewCond(&q.mu)
+		return q
+	}
+	return chanQueue[T](make(chan T, capacity))
+}
+
+// chanQueue is the FIFO queue: a buffered channel
+type chanQueue[T any] chan T
+
+func (q chanQueue[T]) offer(task T) bool {
+	select {
+	case q <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q chanQueue[T]) take() (T, bool) {
+	task, ok := <-q
+	return task, ok
+}
+
+func (q chanQueue[T]) close()     { close(q) }
+func (q chanQueue[T]) depth() int { return len(q) }
+
+// stackQueue is the LIFO queue: a stack guarded by a mutex
+type stackQueue[T any] struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	tasks    []T
+	capacity int
+	closed   bool
+}
+
+func (q *stackQueue[T]) offer(task T) bool {
+	q.mu.Lock()
+	if len(q.tasks) >= q.capacity {
+		q.mu.Unlock()
+		return false
+	}
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+	q.cond.Signal()
+	return true
+}
+
+func (q *stackQueue[T]) take() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		var zero T
+		return zero, false
+	}
+	task := q.tasks[len(q.tasks)-1]
+	q.tasks = q.tasks[:len(q.tasks)-1]
+	return task, true
+}
+
+func (q *stackQueue[T]) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+func (q *stackQueue[T]) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// priorityQueue is the priority queue: a heap guarded by a mutex. The
+// priority of a task is computed once when it is offered, outside the lock;
+// tasks of equal priority are taken in FIFO order.
+type priorityQueue[T any] struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	tasks    taskHeap[T]
+	seq      int
+	capacity int
+	closed   bool
+	priority func(T) int
+}
+
+func (q *priorityQueue[T]) offer(task T) bool {
+	q.mu.Lock()
+	full := len(q.tasks) >= q.capacity
+	q.mu.Unlock()
+	if full {
+		return false
+	}
+	p := q.priority(task)
+	q.mu.Lock()
+	if len(q.tasks) >= q.capacity {
+		q.mu.Unlock()
+		return false
+	}
+	q.seq++
+	heap.Push(&q.tasks, prioritizedTask[T]{task: task, priority: p, seq: q.seq})
+	q.mu.Unlock()
+	q.cond.Signal()
+	return true
+}
+
+func (q *priorityQueue[T]) take() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(&q.tasks).(prioritizedTask[T]).task, true
+}
+
+func (q *priorityQueue[T]) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue[T]) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// prioritizedTask is a task with its priority and arrival order
+type prioritizedTask[T any] struct {
+	task     T
+	priority int
+	seq      int
+}
+
+// taskHeap is a max-heap of tasks by priority, then by arrival
+type taskHeap[T any] []prioritizedTask[T]
+
+func (h taskHeap[T]) Len() int { return len(h) }
+func (h taskHeap[T]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h taskHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap[T]) Push(x any)   { *h = append(*h, x.(prioritizedTask[T])) }
+func (h *taskHeap[T]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
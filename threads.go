@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// threadSampleInterval is the sampling interval of the OS thread count
+const threadSampleInterval = time.Millisecond
+
+// threadTracker samples the number of OS threads of the process and keeps the
+// peak. Workers blocked in directory reads hold their threads, so the runtime
+// starts new ones to keep GOMAXPROCS goroutines running.
+type threadTracker struct {
+	peak     int
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// startThreadTracker starts sampling the OS thread count in the background
+func startThreadTracker() *threadTracker {
+	t := &threadTracker{
+		peak:     osThreadCount(),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(t.finished)
+		ticker := time.NewTicker(threadSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := osThreadCount(); n > t.peak {
+					t.peak = n
+				}
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Stop stops sampling and returns the peak number of OS threads
+func (t *threadTracker) Stop() int {
+	close(t.stop)
+	<-t.finished
+	return t.peak
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// osThreadCount returns the number of threads of this process from
+// /proc/self/status, or -1 if it cannot be read
+func osThreadCount() int {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return -1
+	}
+	for _, line := range bytes.Split(status, []byte("\n")) {
+		if value, ok := bytes.CutPrefix(line, []byte("Threads:")); ok {
+			n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+			if err != nil {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "runtime/pprof"
+
+// osThreadCount returns the number of OS threads the runtime has created.
+// Without /proc the live count is not available; the runtime rarely exits
+// threads, so this is close to it but never decreases.
+func osThreadCount() int {
+	return pprof.Lookup("threadcreate").Count()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"container/heap"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// topEntry is a file or directory with its size
+type topEntry struct {
+	path  string
+	bytes int64
+	files int64
+}
+
+// topHeap is a min-heap of the largest files seen so far
+type topHeap []topEntry
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].bytes < h[j].bytes }
+func (h topHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any)        { *h = append(*h, x.(topEntry)) }
+func (h *topHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topCollector adds up the sizes of the files found by a scan per directory
+// and keeps the n largest files. Further links to a file already seen are
+// counted once, as du does.
+type topCollector struct {
+	n       int
+	mu      sync.Mutex
+	dirs    map[string]*topEntry
+	largest topHeap
+	seen    map[fileKey]bool
+	errors  int64
+	links   int64
+}
+
+func newTopCollector(n int) *topCollector {
+	return &topCollector{n: n, dirs: map[string]*topEntry{}, seen: map[fileKey]bool{}}
+}
+
+// add records a file found by a scan worker; the size is read on that worker
+func (c *topCollector) add(dir string, entry fs.DirEntry) {
+	info, err := entry.Info()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.errors++
+		return
+	}
+	if key, ok := fileIdentity(info); ok && info.Mode().IsRegular() {
+		if c.seen[key] {
+			c.links++
+			return
+		}
+		c.seen[key] = true
+	}
+	d := c.dirs[dir]
+	if d == nil {
+		d = &topEntry{path: dir}
+		c.dirs[dir] = d
+	}
+	d.bytes += info.Size()
+	d.files++
+	if !info.Mode().IsRegular() {
+		return
+	}
+	if len(c.largest) < c.n {
+		heap.Push(&c.largest, topEntry{path: filepath.Join(dir, entry.Name()), bytes: info.Size()})
+	} else if info.Size() > c.largest[0].bytes {
+		c.largest[0] = topEntry{path: filepath.Join(dir, entry.Name()), bytes: info.Size()}
+		heap.Fix(&c.largest, 0)
+	}
+}
+
+// subtrees adds the size of every directory to its ancestors up to root and
+// returns the totals of all directories below root, largest first, with the
+// total of root itself
+func (c *topCollector) subtrees(root string) ([]topEntry, topEntry) {
+	root = filepath.Clean(root)
+	totals := map[string]*topEntry{root: {path: root}}
+	for dir, d := range c.dirs {
+		for p := filepath.Clean(dir); ; p = filepath.Dir(p) {
+			t := totals[p]
+			if t == nil {
+				t = &topEntry{path: p}
+				totals[p] = t
+			}
+			t.bytes += d.bytes
+			t.files += d.files
+			if p == root || p == filepath.Dir(p) {
+				break
+			}
+		}
+	}
+	entries := []topEntry{}
+	for p, t := range totals {
+		if p != root {
+			entries = append(entries, *t)
+		}
+	}
+	sortTopEntries(entries)
+	return entries, *totals[root]
+}
+
+// largestFiles returns the n largest files, largest first
+func (c *topCollector) largestFiles() []topEntry {
+	files := slices.Clone(c.largest)
+	sortTopEntries(files)
+	return files
+}
+
+// sortTopEntries orders entries by size, largest first, then by path
+func sortTopEntries(entries []topEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].bytes != entries[j].bytes {
+			return entries[i].bytes > entries[j].bytes
+		}
+		return entries[i].path < entries[j].path
+	})
+}
+
+// runTop reports the largest files and the heaviest directory subtrees of a
+// tree, measured with a parallel scan
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	strategy := fs.String("strategy", StrategyRecursiveTask, "scan strategy: "+strings.Join(fileHookStrategies(), ", "))
+	workers := fs.Int("workers", runtime.NumCPU(), "number of scan workers")
+	n := fs.Int("n", 10, "number of files and directories listed")
+	depth := fs.Int("depth", 0, "deepest level below the root of the directories listed (0 = any)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *workers < 1 || *n < 1 || *depth < 0 || !slices.Contains(fileHookStrategies(), *strategy) {
+		fmt.Println("使い方: top [-strategy recursive-task] [-workers N] [-n 10] [-depth 0] <ディレクトリ>")
+		return 2
+	}
+	root := fs.Arg(0)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	}
+
+	collector := newTopCollector(*n)
+	options := defaultScanOptions()
+	options.files = collector.add
+	scanner, err := newScanner(*strategy, *workers, options)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	fmt.Printf("サイズの集計: %s (%s, ワーカー数 %d)\n", root, *strategy, *workers)
+	start := time.Now()
+	result, err := scanner.Scan(root)
+	elapsed := time.Since(start)
+	if result == nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	collector.errors += result.Errors
+
+	dirs, total := collector.subtrees(root)
+	fmt.Printf("合計: %s (ファイル: %d, ディレクトリ: %d, 同じファイルへの追加のリンク: %d, 読み取りエラー: %d), スキャン: %s (%.0f ファイル/s)\n",
+		formatBytes(total.bytes), result.Files, result.Dirs, collector.links, collector.errors,
+		formatDuration(elapsed), float64(result.Files)/elapsed.Seconds())
+
+	share := func(bytes int64) string {
+		if total.bytes == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", float64(bytes)/float64(total.bytes)*100)
+	}
+	fmt.Printf("\n===== 大きいファイル (上位 %d) =====\n", *n)
+	files := &textTable{
+		header: []string{"Size", "Share", "Path"},
+		right:  []bool{true, true, false},
+	}
+	for _, f := range collector.largestFiles() {
+		files.add(formatBytes(f.bytes), share(f.bytes), f.path)
+	}
+	files.render(os.Stdout, false)
+
+	fmt.Printf("\n===== 大きいディレクトリ (配下の合計、上位 %d) =====\n", *n)
+	table := &textTable{
+		header: []string{"Size", "Share", "Files", "Path"},
+		right:  []bool{true, true, true, false},
+	}
+	rows := 0
+	for _, d := range dirs {
+		if rel, err := filepath.Rel(root, d.path); err == nil && *depth > 0 && strings.Count(rel, string(filepath.Separator))+1 > *depth {
+			continue
+		}
+		table.add(formatBytes(d.bytes), share(d.bytes), strconv.FormatInt(d.files, 10), d.path)
+		if rows++; rows == *n {
+			break
+		}
+	}
+	table.render(os.Stdout, false)
+	return 0
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dashboardInterval is the redraw interval of the TUI dashboard
+const dashboardInterval = 200 * time.Millisecond
+
+// dashboardHistory is the number of throughput samples kept for the graph
+const dashboardHistory = 60
+
+// sparkBlocks are the glyphs used for the throughput graph
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// WorkerActivity holds the live state of one worker. All methods are no-ops
+// on a nil receiver so scanners can report unconditionally.
+type WorkerActivity struct {
+	mu      sync.Mutex
+	current string
+	files   int64
+	dirs    int64
+}
+
+// Enter records the directory the worker is currently processing
+func (w *WorkerActivity) Enter(path string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.current = path
+	w.mu.Unlock()
+	atomic.AddInt64(&w.dirs, 1)
+}
+
+// AddFiles adds processed files to the worker's counter
+func (w *WorkerActivity) AddFiles(n int64) {
+	if w == nil {
+		return
+	}
+	atomic.AddInt64(&w.files, n)
+}
+
+// Idle clears the worker's current directory
+func (w *WorkerActivity) Idle() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.current = ""
+	w.mu.Unlock()
+}
+
+func (w *WorkerActivity) snapshot() (string, int64, int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current, atomic.LoadInt64(&w.files), atomic.LoadInt64(&w.dirs)
+}
+
+// ActivityMonitor renders a live terminal dashboard of per-worker activity,
+// queue depth and throughput while a scan runs
+type ActivityMonitor struct {
+	out io.Writer
+
+	mu         sync.Mutex
+	label      string
+	start      time.Time
+	workers    []*WorkerActivity
+	queueDepth func() int
+	history    []float64
+	lastFiles  int64
+	lastTime   time.Time
+	done       chan struct{}
+	finished   chan struct{}
+}
+
+// NewActivityMonitor creates a dashboard writing to stdout
+func NewActivityMonitor() *ActivityMonitor {
+	return &ActivityMonitor{out: os.Stdout}
+}
+
+// Worker returns the activity slot of a worker, or nil when monitoring is disabled
+func (m *ActivityMonitor) Worker(id int) *WorkerActivity {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 0 || id >= len(m.workers) {
+		return nil
+	}
+	return m.workers[id]
+}
+
+// SetQueue registers a function reporting the current task queue depth
+func (m *ActivityMonitor) SetQueue(depth func() int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.queueDepth = depth
+	m.mu.Unlock()
+}
+
+// Begin starts rendering the dashboard for a new scan
+func (m *ActivityMonitor) Begin(label string, numWorkers int) {
+	m.mu.Lock()
+	m.label = label
+	m.start = time.Now()
+	m.lastTime = m.start
+	m.lastFiles = 0
+	m.history = m.history[:0]
+	m.queueDepth = nil
+	m.workers = make([]*WorkerActivity, numWorkers)
+	for i := range m.workers {
+		m.workers[i] = &WorkerActivity{}
+	}
+	m.done = make(chan struct{})
+	m.finished = make(chan struct{})
+	m.mu.Unlock()
+
+	go func() {
+		defer close(m.finished)
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.render()
+			case <-m.done:
+				m.render()
+				return
+			}
+		}
+	}()
+}
+
+// End stops rendering and leaves the final frame on screen
+func (m *ActivityMonitor) End() {
+	close(m.done)
+	<-m.finished
+}
+
+func (m *ActivityMonitor) render() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var totalFiles, totalDirs int64
+	lines := []string{}
+	for i, w := range m.workers {
+		current, files, dirs := w.snapshot()
+		totalFiles += files
+		totalDirs += dirs
+		state := current
+		if state == "" {
+			state = "(idle)"
+		}
+		lines = append(lines, fmt.Sprintf(" W%-3d files %-10d dirs %-8d %s", i, files, dirs, truncatePath(state, 60)))
+	}
+
+	if elapsed := now.Sub(m.lastTime).Seconds(); elapsed > 0 {
+		m.history = append(m.history, float64(totalFiles-m.lastFiles)/elapsed)
+		if len(m.history) > dashboardHistory {
+			m.history = m.history[len(m.history)-dashboardHistory:]
+		}
+	}
+	m.lastFiles = totalFiles
+	m.lastTime = now
+
+	queue := "-"
+	if m.queueDepth != nil {
+		queue = fmt.Sprintf("%d", m.queueDepth())
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "%s   経過: %.2fs\n", m.label, now.Sub(m.start).Seconds())
+	fmt.Fprintf(&b, "キュー深さ: %s   ファイル: %d   ディレクトリ: %d\n\n", queue, totalFiles, totalDirs)
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	current := 0.0
+	if len(m.history) > 0 {
+		current = m.history[len(m.history)-1]
+	}
+	fmt.Fprintf(&b, "\nスループット: %s %.0f files/s\n", sparkline(m.history), current)
+	fmt.Fprint(m.out, b.String())
+}
+
+// sparkline renders values as a bar graph of block glyphs
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if max > 0 {
+			level = int(v / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
+
+// truncatePath shortens a path to at most n bytes keeping its tail
+func truncatePath(path string, n int) string {
+	if len(path) <= n {
+		return path
+	}
+	return "..." + path[len(path)-n+3:]
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tuneCell is one measured point of the tune grid
+type tuneCell struct {
+	strategy string
+	options  ScanOptions
+	workers  int
+	result   *BenchmarkResult
+}
+
+// label describes the strategy with its non-default parameters
+func (c tuneCell) label() string {
+	if variant := optionsLabel(c.strategy, c.options); variant != "" {
+		return fmt.Sprintf("%s [%s]", c.strategy, variant)
+	}
+	return c.strategy
+}
+
+// tuneStrategies returns the strategies tune may grid-search
+func tuneStrategies() []string {
+	strategies := []string{StrategyDirectoryBased, StrategyRecursiveTask, StrategyRecursiveTaskPooled}
+	if openatSupported {
+		strategies = append(strategies, StrategyOpenat)
+	}
+	if uringSupported {
+		strategies = append(strategies, StrategyUring)
+	}
+	if bulkAttrSupported {
+		strategies = append(strategies, StrategyBulkAttr)
+	}
+	if findFileSupported {
+		strategies = append(strategies, StrategyFindFile)
+	}
+	return strategies
+}
+
+// tuneGrid returns the parameter combinations of a strategy: every channel
+// capacity, task order and batch size that applies to it
+func tuneGrid(strategy string, capacities []int, orders []string, batchSizes []int) []ScanOptions {
+	grid := []ScanOptions{defaultScanOptions()}
+	if usesChannelCapacity(strategy) {
+		grid = expandVariants(grid, func(ScanOptions) int { return len(capacities) },
+			func(o *ScanOptions, i int) { o.ChannelCapacity = capacities[i] })
+		grid = expandVariants(grid, func(ScanOptions) int { return len(orders) },
+			func(o *ScanOptions, i int) { o.TaskOrder = orders[i] })
+	}
+	if usesBatchSize(strategy) {
+		grid = expandVariants(grid, func(ScanOptions) int { return len(batchSizes) },
+			func(o *ScanOptions, i int) { o.BatchSize = batchSizes[i] })
+	}
+	return grid
+}
+
+// runTune grid-searches worker counts and strategy parameters on one tree
+// and reports the fastest configuration with its scaling curve
+func runTune(args []string) int {
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	strategyList := fs.String("strategies", strings.Join([]string{StrategyRecursiveTask, StrategyRecursiveTaskPooled}, ","), "comma separated strategies to tune: "+strings.Join(tuneStrategies(), ", "))
+	workerList := fs.String("workers", "1,2,4,8,16,32", "comma separated worker counts")
+	capacityList := fs.String("channel-capacity", "10,100,1000,10000", "comma separated task channel capacities")
+	orderList := fs.String("task-order", TaskOrderFIFO, "comma separated task orders: fifo, lifo, priority")
+	batchList := fs.String("batch-size", "64,256,1024", "comma separated batch sizes of recursive-task-pooled and io_uring")
+	runs := fs.Int("runs", 3, "runs per grid point; durations are averaged")
+	structure := fs.String("structure", StructureDeep, "structure of the generated fixture when no directory is given")
+	size := fs.String("size", SizeMedium, "size preset of the generated fixture: "+strings.Join(sizeNames, ", "))
+	online := fs.Bool("online", false, "instead of the grid, adjust the worker count during a single scan of the directory by hill climbing on its throughput")
+	interval := fs.Duration("interval", 500*time.Millisecond, "measurement interval of -online")
+	startWorkers := fs.Int("start-workers", runtime.NumCPU(), "initial worker count of -online")
+	maxWorkers := fs.Int("max-workers", 8*runtime.NumCPU(), "largest worker count tried by -online")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	usage := "使い方: tune [-strategies recursive-task,...] [-workers 1,2,4,...] [-channel-capacity 10,100,...] [-task-order fifo,lifo,priority] [-batch-size 64,256,...] [-runs 3] [-structure deep] [-size medium] [ディレクトリ]\n" +
+		"        tune -online [-interval 500ms] [-start-workers N] [-max-workers N] <ディレクトリ>"
+	if fs.NArg() > 1 || *runs < 1 {
+		fmt.Println(usage)
+		return 2
+	}
+	if *online {
+		if fs.NArg() != 1 || *interval <= 0 || *startWorkers < 1 || *maxWorkers < *startWorkers {
+			fmt.Println(usage)
+			return 2
+		}
+		if info, err := os.Stat(fs.Arg(0)); err != nil || !info.IsDir() {
+			fmt.Printf("エラー: ディレクトリではありません: %s\n", fs.Arg(0))
+			return 1
+		}
+		return runOnlineTune(fs.Arg(0), *startWorkers, *maxWorkers, *interval)
+	}
+	strategies, err := filterStrategies(*strategyList, tuneStrategies())
+	if err != nil {
+		fmt.Printf("エラー: -strategies: %v\n", err)
+		return 2
+	}
+	workerCounts, err := parseIntList(*workerList)
+	if err != nil {
+		fmt.Printf("エラー: -workers: %v\n", err)
+		return 2
+	}
+	capacities, err := parseIntList(*capacityList)
+	if err != nil {
+		fmt.Printf("エラー: -channel-capacity: %v\n", err)
+		return 2
+	}
+	orders, err := parseTaskOrders(*orderList)
+	if err != nil {
+		fmt.Printf("エラー: -task-order: %v\n", err)
+		return 2
+	}
+	batchSizes, err := parseIntList(*batchList)
+	if err != nil {
+		fmt.Printf("エラー: -batch-size: %v\n", err)
+		return 2
+	}
+	for _, batch := range batchSizes {
+		if batch > maxUringBatch && slices.Contains(strategies, StrategyUring) {
+			fmt.Printf("エラー: -batch-size: io_uring の上限は %d です\n", maxUringBatch)
+			return 2
+		}
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		if _, err := parseStructures(*structure); err != nil || strings.Contains(*structure, ",") {
+			fmt.Printf("エラー: -structure: %s\n", *structure)
+			return 2
+		}
+		config, err := sizeConfig(*size)
+		if err != nil {
+			fmt.Printf("エラー: -size: %v\n", err)
+			return 2
+		}
+		root = fixturePrefix + "tune"
+		fmt.Printf("%s構造のテストデータを作成中 (%s, %s)...\n", *structure, root, *size)
+		err = generateFixture(root, *structure, config)
+		defer os.RemoveAll(root)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	} else if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	}
+	label := root
+	if fs.Arg(0) == "" {
+		label = *structure
+	}
+
+	points := 0
+	for _, strategy := range strategies {
+		points += len(tuneGrid(strategy, capacities, orders, batchSizes)) * len(workerCounts)
+	}
+	fmt.Printf("チューニング: %s (%d 点 × %d 回)\n", root, points, *runs)
+
+	cells := []tuneCell{}
+	for _, strategy := range strategies {
+		for _, options := range tuneGrid(strategy, capacities, orders, batchSizes) {
+			for _, workers := range workerCounts {
+				cell := tuneCell{strategy: strategy, options: options, workers: workers}
+				fmt.Printf("  %s ワーカー数 %d ...", cell.label(), workers)
+				result, err := runBenchmarkCell(root, []string{root}, label, strategy, workers, options, *runs)
+				if err != nil {
+					fmt.Printf(" エラー: %v\n", err)
+					continue
+				}
+				if result.TimedOut {
+					fmt.Println(" タイムアウト")
+					continue
+				}
+				fmt.Printf(" %s %s\n", formatDuration(result.Duration), formatCI(result.DurationCI))
+				cell.result = result
+				cells = append(cells, cell)
+			}
+		}
+	}
+	if len(cells) == 0 {
+		fmt.Println("エラー: 計測できた構成がありません")
+		return 1
+	}
+	printTuneSummary(cells)
+	return 0
+}
+
+// printTuneSummary prints the fastest configuration of every strategy and
+// the scaling curve of the overall fastest parameter set
+func printTuneSummary(cells []tuneCell) {
+	best := map[string]tuneCell{}
+	order := []string{}
+	for _, c := range cells {
+		b, ok := best[c.strategy]
+		if !ok {
+			order = append(order, c.strategy)
+		}
+		if !ok || c.result.Duration < b.result.Duration {
+			best[c.strategy] = c
+		}
+	}
+
+	fmt.Println("\n===== 戦略ごとの最良の構成 =====")
+	table := &textTable{
+		header: []string{"Strategy", "Workers", "Duration", "95%CI", "Files/s"},
+		right:  []bool{false, true, true, true, true},
+	}
+	overall := best[order[0]]
+	for _, strategy := range order {
+		c := best[strategy]
+		if c.result.Duration < overall.result.Duration {
+			overall = c
+		}
+		table.add(c.label(), fmt.Sprintf("%d", c.workers), formatDuration(c.result.Duration),
+			formatCI(c.result.DurationCI), fmt.Sprintf("%.0f", float64(c.result.FilesScanned)/c.result.Duration.Seconds()))
+	}
+	table.render(os.Stdout, false)
+
+	fmt.Printf("\n最良の構成: %s, ワーカー数 %d (%s)\n", overall.label(), overall.workers, formatDuration(overall.result.Duration))
+
+	// The curve holds every worker count measured with the winning parameters
+	fmt.Printf("\n===== スケーリング曲線: %s =====\n", overall.label())
+	curve := &textTable{
+		header: []string{"Workers", "Duration", "95%CI", "Speedup", "Efficiency"},
+		right:  []bool{true, true, true, true, true},
+	}
+	var serial time.Duration
+	for _, c := range cells {
+		if c.label() == overall.label() && c.workers == 1 {
+			serial = c.result.Duration
+		}
+	}
+	for _, c := range cells {
+		if c.label() != overall.label() {
+			continue
+		}
+		speedup, efficiency := "-", "-"
+		if serial > 0 {
+			s := float64(serial) / float64(c.result.Duration)
+			speedup = fmt.Sprintf("%.2fx", s)
+			efficiency = fmt.Sprintf("%.0f%%", s/float64(c.workers)*100)
+		}
+		curve.add(fmt.Sprintf("%d", c.workers), formatDuration(c.result.Duration), formatCI(c.result.DurationCI), speedup, efficiency)
+	}
+	curve.render(os.Stdout, false)
+}
+
+// formatDuration rounds a duration to microseconds, as tune grids are often
+// run on small trees
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
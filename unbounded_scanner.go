@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultGoroutineCap is the default limit of concurrently open directories
+// for the unbounded strategy
+const defaultGoroutineCap = 4096
+
+// UnboundedScanner spawns one goroutine per directory with no worker pool.
+// Only the number of directories being read at the same time is limited by
+// the optional safety cap, to avoid running out of file descriptors.
+type UnboundedScanner struct {
+	options ScanOptions
+}
+
+func (s *UnboundedScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+
+	var sem chan struct{}
+	if s.options.GoroutineCap > 0 {
+		sem = make(chan struct{}, s.options.GoroutineCap)
+	}
+
+	var wg sync.WaitGroup
+	var scan func(path string)
+	scan = func(path string) {
+		defer wg.Done()
+
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		var files int64
+		err := eachDirEntry(path, s.options, func(entry fs.DirEntry) {
+			if entry.IsDir() {
+				wg.Add(1)
+				go scan(filepath.Join(path, entry.Name()))
+			} else {
+				files++
+				s.options.links.AddEntry(entry)
+			}
+		})
+		if sem != nil {
+			<-sem
+		}
+		if err != nil {
+			result.addError(err)
+			return
+		}
+
+		atomic.AddInt64(&result.Dirs, 1)
+		atomic.AddInt64(&result.Files, files)
+	}
+
+	wg.Add(1)
+	go scan(rootPath)
+	wg.Wait()
+
+	return result, result.Err()
+}
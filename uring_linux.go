@@ -0,0 +1,167 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// uringSupported reports whether the io_uring strategy is built in
+const uringSupported = true
+
+// uringEntries is the submission queue size of each worker's ring and the
+// number of subdirectories opened per batch
+const uringEntries = 64
+
+// io_uring ABI, see include/uapi/linux/io_uring.h
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringEnterGetEvents = 1 << 0
+	uringOpOpenat       = 18
+
+	uringSQESize = 64
+	uringCQESize = 16
+)
+
+// uringParams mirrors struct io_uring_params
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uringSQOffsets mirrors struct io_sqring_offsets
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringCQOffsets mirrors struct io_cqring_offsets
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uring is a minimal io_uring instance used by one goroutine at a time. Only
+// IORING_OP_OPENAT is submitted: mainline kernels have no getdents opcode,
+// so directories are still listed with blocking getdents calls.
+type uring struct {
+	fd     int
+	sqRing []byte
+	cqRing []byte
+	sqes   []byte
+	params uringParams
+}
+
+// newUring sets up a ring with the given number of submission entries
+func newUring(entries int) (*uring, error) {
+	r := &uring{}
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uintptr(entries), uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r.fd = int(fd)
+
+	var err error
+	p := &r.params
+	r.sqRing, err = syscall.Mmap(r.fd, uringOffSQRing, int(p.sqOff.array+p.sqEntries*4), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	if err == nil {
+		r.cqRing, err = syscall.Mmap(r.fd, uringOffCQRing, int(p.cqOff.cqes+p.cqEntries*uringCQESize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	}
+	if err == nil {
+		r.sqes, err = syscall.Mmap(r.fd, uringOffSQEs, int(p.sqEntries*uringSQESize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	}
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("io_uring mmap: %w", err)
+	}
+	return r, nil
+}
+
+// Close unmaps the rings and closes the instance
+func (r *uring) Close() {
+	for _, m := range [][]byte{r.sqRing, r.cqRing, r.sqes} {
+		if m != nil {
+			syscall.Munmap(m)
+		}
+	}
+	syscall.Close(r.fd)
+}
+
+// uringField returns the ring variable at offset of a mapped ring
+func uringField(ring []byte, offset uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[offset]))
+}
+
+// openat opens every name relative to dirfd with a single submission and
+// waits for all completions, storing the descriptors in fds and the errors
+// in errs. len(names) must not exceed the ring size.
+func (r *uring) openat(dirfd int, names []string, flags int, fds []int, errs []error) {
+	paths := make([][]byte, len(names))
+	sqMask := *uringField(r.sqRing, r.params.sqOff.ringMask)
+	tail := atomic.LoadUint32(uringField(r.sqRing, r.params.sqOff.tail))
+	for i, name := range names {
+		paths[i] = append([]byte(name), 0)
+		index := (tail + uint32(i)) & sqMask
+		sqe := r.sqes[index*uringSQESize : (index+1)*uringSQESize]
+		clear(sqe)
+		sqe[0] = uringOpOpenat
+		*(*int32)(unsafe.Pointer(&sqe[4])) = int32(dirfd)
+		*(*uint64)(unsafe.Pointer(&sqe[16])) = uint64(uintptr(unsafe.Pointer(&paths[i][0])))
+		*(*uint32)(unsafe.Pointer(&sqe[28])) = uint32(flags)
+		*(*uint64)(unsafe.Pointer(&sqe[32])) = uint64(i)
+		*uringField(r.sqRing, r.params.sqOff.array+index*4) = index
+	}
+	atomic.StoreUint32(uringField(r.sqRing, r.params.sqOff.tail), tail+uint32(len(names)))
+
+	cqMask := *uringField(r.cqRing, r.params.cqOff.ringMask)
+	toSubmit, pending := len(names), len(names)
+	for pending > 0 {
+		n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(toSubmit), uintptr(pending), uringEnterGetEvents, 0, 0)
+		if errno != 0 && errno != syscall.EINTR {
+			// Withdraw the entries the kernel did not take
+			atomic.StoreUint32(uringField(r.sqRing, r.params.sqOff.tail), tail+uint32(len(names)-toSubmit))
+			for i := len(names) - toSubmit; i < len(names); i++ {
+				fds[i], errs[i] = -1, errno
+			}
+			pending -= toSubmit
+			toSubmit = 0
+		} else if errno == 0 {
+			toSubmit -= int(n)
+		}
+
+		head := atomic.LoadUint32(uringField(r.cqRing, r.params.cqOff.head))
+		cqTail := atomic.LoadUint32(uringField(r.cqRing, r.params.cqOff.tail))
+		for ; head != cqTail; head++ {
+			cqe := r.cqRing[r.params.cqOff.cqes+(head&cqMask)*uringCQESize:]
+			i := *(*uint64)(unsafe.Pointer(&cqe[0]))
+			res := *(*int32)(unsafe.Pointer(&cqe[8]))
+			if res < 0 {
+				fds[i], errs[i] = -1, syscall.Errno(-res)
+			} else {
+				fds[i], errs[i] = int(res), nil
+			}
+			pending--
+		}
+		atomic.StoreUint32(uringField(r.cqRing, r.params.cqOff.head), head)
+	}
+	// The kernel read the paths while the entries were in flight
+	runtime.KeepAlive(paths)
+}
@@ -0,0 +1,22 @@
+//go:build !linux || (!amd64 && !arm64)
+
+package main
+
+import "errors"
+
+// uringSupported reports whether the io_uring strategy is built in
+const uringSupported = false
+
+// uringEntries is the number of subdirectories opened per batch
+const uringEntries = 1
+
+// uring is only implemented on linux/amd64 and linux/arm64
+type uring struct{}
+
+func newUring(entries int) (*uring, error) {
+	return nil, errors.New("the io_uring strategy is only supported on linux/amd64 and linux/arm64")
+}
+
+func (r *uring) Close() {}
+
+func (r *uring) openat(dirfd int, names []string, flags int, fds []int, errs []error) {}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// visitShards is the number of shards of a visit set
+const visitShards = 64
+
+// visitSet records the identity (dev, inode) of every directory a scan
+// lists and how often it was listed, for -verify-visits
+type visitSet struct {
+	shards [visitShards]struct {
+		mu     sync.Mutex
+		visits map[fileKey]visitRecord
+	}
+}
+
+// visitRecord is a listed directory: the first path it was listed by and
+// the number of listings
+type visitRecord struct {
+	path  string
+	count int
+}
+
+func newVisitSet() *visitSet {
+	v := &visitSet{}
+	for i := range v.shards {
+		v.shards[i].visits = map[fileKey]visitRecord{}
+	}
+	return v
+}
+
+// visit records a listing of the directory at path; directories whose
+// identity cannot be read are recorded as misses by compare
+func (v *visitSet) visit(path string) {
+	if v == nil {
+		return
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+	if key, ok := fileIdentity(info); ok {
+		v.add(key, path)
+	}
+}
+
+// add records a listing of the directory identified by key
+func (v *visitSet) add(key fileKey, path string) {
+	if v == nil {
+		return
+	}
+	shard := &v.shards[(key.ino^key.dev)%visitShards]
+	shard.mu.Lock()
+	r := shard.visits[key]
+	if r.count == 0 {
+		r.path = path
+	}
+	r.count++
+	shard.visits[key] = r
+	shard.mu.Unlock()
+}
+
+// visitReport compares the directories a scan listed with a reference walk
+type visitReport struct {
+	// Duplicates counts directories listed more than once, Misses those of
+	// the reference that were never listed and Extras listed directories
+	// the reference did not see, such as the targets of followed symlinks
+	Duplicates, Misses, Extras int
+	// Example is the path of the first difference in path order
+	Example string
+}
+
+// referenceVisits walks root serially without following symlinks and
+// returns the identity of every directory in it
+func referenceVisits(root string) map[fileKey]string {
+	reference := map[fileKey]string{}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if d == nil || !d.IsDir() {
+			return nil
+		}
+		if info, err := os.Lstat(path); err == nil {
+			if key, ok := fileIdentity(info); ok {
+				reference[key] = path
+			}
+		}
+		return nil
+	})
+	return reference
+}
+
+// compare returns the differences between the recorded listings and the
+// directories of the reference walk
+func (v *visitSet) compare(reference map[fileKey]string) visitReport {
+	report := visitReport{}
+	examples := []string{}
+	seen := map[fileKey]bool{}
+	for i := range v.shards {
+		for key, r := range v.shards[i].visits {
+			seen[key] = true
+			if r.count > 1 {
+				report.Duplicates++
+				examples = append(examples, fmt.Sprintf("%s を %d 回", r.path, r.count))
+			}
+			if _, ok := reference[key]; !ok {
+				report.Extras++
+				examples = append(examples, r.path+" (基準の走査にない)")
+			}
+		}
+	}
+	for key, path := range reference {
+		if !seen[key] {
+			report.Misses++
+			examples = append(examples, path+" (未読)")
+		}
+	}
+	if len(examples) > 0 {
+		sort.Strings(examples)
+		report.Example = examples[0]
+	}
+	return report
+}
+
+// add adds the differences of another scan, keeping the first example
+func (r *visitReport) add(other *visitReport) {
+	if other == nil {
+		return
+	}
+	r.Duplicates += other.Duplicates
+	r.Misses += other.Misses
+	r.Extras += other.Extras
+	if r.Example == "" {
+		r.Example = other.Example
+	}
+}
+
+// String describes the differences, empty when there are none
+func (r visitReport) String() string {
+	if r.Duplicates == 0 && r.Misses == 0 && r.Extras == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ディレクトリの読み取りが基準と異なります (重複: %d, 未読: %d, 基準外: %d, 例: %s)", r.Duplicates, r.Misses, r.Extras, r.Example)
+}
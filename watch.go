@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fsOp is the kind of a change reported by a dirWatcher
+type fsOp int
+
+const (
+	// fsCreate reports an entry created in or moved into a watched directory
+	fsCreate fsOp = iota
+	// fsRemove reports an entry deleted from or moved out of a watched directory
+	fsRemove
+	// fsOverflow reports lost events; the tracked counts must be rebuilt
+	fsOverflow
+)
+
+// fsEvent is one change of a watched directory
+type fsEvent struct {
+	Op    fsOp
+	Path  string
+	IsDir bool
+}
+
+// dirWatcher reports changes of individually watched directories
+type dirWatcher interface {
+	Add(dir string) error
+	// Events delivers the changes in batches and is closed by Close
+	Events() <-chan []fsEvent
+	Close() error
+}
+
+// watchedDir holds the entry names of a directory
+type watchedDir struct {
+	files   map[string]struct{}
+	subdirs map[string]struct{}
+}
+
+// watchTree keeps the file and directory counts of a tree up to date from
+// watcher events. Entries are tracked by name so that an entry seen both by
+// a listing and by an event is counted once.
+type watchTree struct {
+	root    string
+	watcher dirWatcher
+	mu      sync.Mutex
+	dirs    map[string]*watchedDir
+}
+
+// newWatchTree returns an empty tracker of root
+func newWatchTree(root string, watcher dirWatcher) *watchTree {
+	return &watchTree{root: root, watcher: watcher, dirs: map[string]*watchedDir{}}
+}
+
+// addTree watches and lists every directory below path with numWorkers
+// concurrent listings. A directory is watched before it is listed, so that
+// no entry created in between is missed.
+func (t *watchTree) addTree(path string, numWorkers int) error {
+	tokens := make(chan struct{}, numWorkers)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+
+	var add func(dir string)
+	add = func(dir string) {
+		defer wg.Done()
+		tokens <- struct{}{}
+		subdirs, err := t.addDir(dir)
+		<-tokens
+		if err != nil {
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+			return
+		}
+		wg.Add(len(subdirs))
+		for _, subdir := range subdirs {
+			go add(subdir)
+		}
+	}
+	wg.Add(1)
+	add(path)
+	wg.Wait()
+	return firstErr
+}
+
+// addDir watches and lists one directory and returns its subdirectories.
+// A directory removed in the meantime is skipped.
+func (t *watchTree) addDir(dir string) ([]string, error) {
+	if err := t.watcher.Add(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.dir(dir)
+	subdirs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			d.subdirs[entry.Name()] = struct{}{}
+			subdirs = append(subdirs, filepath.Join(dir, entry.Name()))
+		} else {
+			d.files[entry.Name()] = struct{}{}
+		}
+	}
+	return subdirs, nil
+}
+
+// dir returns the entry of a directory, creating it; t.mu must be held
+func (t *watchTree) dir(path string) *watchedDir {
+	d, ok := t.dirs[path]
+	if !ok {
+		d = &watchedDir{files: map[string]struct{}{}, subdirs: map[string]struct{}{}}
+		t.dirs[path] = d
+	}
+	return d
+}
+
+// removeTree forgets a directory and everything below it; t.mu must be held
+func (t *watchTree) removeTree(path string) {
+	d, ok := t.dirs[path]
+	if !ok {
+		return
+	}
+	for name := range d.subdirs {
+		t.removeTree(filepath.Join(path, name))
+	}
+	delete(t.dirs, path)
+}
+
+// apply updates the counts from a batch of events and reports whether the
+// events overflowed
+func (t *watchTree) apply(batch []fsEvent) (overflow bool) {
+	for _, event := range batch {
+		if event.Op == fsOverflow {
+			overflow = true
+			continue
+		}
+		parent, name := filepath.Dir(event.Path), filepath.Base(event.Path)
+		t.mu.Lock()
+		d, tracked := t.dirs[parent]
+		if !tracked {
+			t.mu.Unlock()
+			continue
+		}
+		switch {
+		case event.Op == fsCreate && event.IsDir:
+			d.subdirs[name] = struct{}{}
+			t.mu.Unlock()
+			// A new or moved-in directory may already hold entries
+			t.addTree(event.Path, 1)
+			continue
+		case event.Op == fsCreate:
+			d.files[name] = struct{}{}
+		case event.IsDir:
+			delete(d.subdirs, name)
+			t.removeTree(event.Path)
+		default:
+			delete(d.files, name)
+		}
+		t.mu.Unlock()
+	}
+	return overflow
+}
+
+// resync rebuilds the counts after lost events
+func (t *watchTree) resync(numWorkers int) error {
+	t.mu.Lock()
+	t.dirs = map[string]*watchedDir{}
+	t.mu.Unlock()
+	return t.addTree(t.root, numWorkers)
+}
+
+// counts returns the tracked numbers of files and directories, including the root
+func (t *watchTree) counts() (files, dirs int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range t.dirs {
+		files += int64(len(d.files))
+	}
+	return files, int64(len(t.dirs))
+}
+
+// watchStats accumulates the event processing of a watch run
+type watchStats struct {
+	events     int64
+	batches    int64
+	maxBatch   int
+	processing time.Duration
+	overflows  int
+}
+
+// process applies a batch and records how long it took
+func (s *watchStats) process(tree *watchTree, batch []fsEvent, numWorkers int) error {
+	start := time.Now()
+	overflow := tree.apply(batch)
+	if overflow {
+		s.overflows++
+		if err := tree.resync(numWorkers); err != nil {
+			return err
+		}
+	}
+	s.processing += time.Since(start)
+	s.events += int64(len(batch))
+	s.batches++
+	if len(batch) > s.maxBatch {
+		s.maxBatch = len(batch)
+	}
+	return nil
+}
+
+// throughput returns the events processed per second of processing time
+func (s *watchStats) throughput() float64 {
+	if s.processing <= 0 {
+		return 0
+	}
+	return float64(s.events) / s.processing.Seconds()
+}
+
+// watchSettle is how long the final comparison waits for trailing events
+const watchSettle = 200 * time.Millisecond
+
+// runWatch scans a tree once, keeps its counts up to date from inotify
+// events and compares them with periodic full rescans
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of workers of the initial scan and the rescans")
+	duration := fs.Duration("duration", 30*time.Second, "how long to watch")
+	rescan := fs.Duration("rescan", 5*time.Second, "interval of the full rescans compared with the watched counts")
+	churnRate := fs.Int("churn", 0, "create/delete/rename operations per second applied to the tree (generated fixtures only)")
+	structure := fs.String("structure", StructureDeep, "structure of the generated fixture when no directory is given")
+	size := fs.String("size", defaultSize, "size preset of the generated fixture: "+strings.Join(sizeNames, ", "))
+	dev := fs.Bool("dev", false, "shorthand for -size dev")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 || *workers < 1 || *duration <= 0 || *rescan <= 0 || *churnRate < 0 {
+		fmt.Println("使い方: watch [-workers N] [-duration 30s] [-rescan 5s] [-churn N] [-structure deep] [-size large] [ディレクトリ]")
+		return 2
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		root = fixturePrefix + "watch"
+		if *dev {
+			*size = SizeDev
+		}
+		config, err := sizeConfig(*size)
+		if err != nil {
+			fmt.Printf("エラー: -size: %v\n", err)
+			return 2
+		}
+		fmt.Printf("%s構造のテストデータを作成中 (%s)...\n", *structure, root)
+		err = generateFixture(root, *structure, config)
+		defer os.RemoveAll(root)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	} else if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Printf("エラー: ディレクトリではありません: %s\n", root)
+		return 1
+	} else if *churnRate > 0 {
+		// Trees that were not generated by the benchmark are never changed
+		if _, err := readFixtureMarker(root); err != nil {
+			fmt.Println("エラー: -churn は生成したテストデータ（ディレクトリ省略時）にだけ使えます")
+			return 1
+		}
+	}
+
+	watcher, err := newDirWatcher()
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	defer watcher.Close()
+
+	tree := newWatchTree(root, watcher)
+	start := time.Now()
+	if err := tree.addTree(root, *workers); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+	files, dirs := tree.counts()
+	fmt.Printf("初期スキャン: %v (ファイル: %d, ディレクトリ: %d, ワーカー数 %d)\n",
+		time.Since(start).Round(time.Microsecond), files, dirs, *workers)
+
+	var churn *churner
+	if *churnRate > 0 {
+		if churn, err = startChurner(root, *churnRate); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	}
+
+	stats := &watchStats{}
+	var rescans int
+	var rescanTotal time.Duration
+	// compare rescans the tree and prints how far the watched counts drifted
+	compare := func(label string) error {
+		r, err := runBenchmark(root, "watch", StrategyRecursiveTask, *workers, defaultScanOptions())
+		if err != nil {
+			return err
+		}
+		rescans++
+		rescanTotal += r.Duration
+		files, dirs := tree.counts()
+		fmt.Printf("%s: イベント %d (処理 %.0f 件/s) 追跡 %d/%d 再スキャン %d/%d (%v) 差分 ファイル %+d ディレクトリ %+d\n",
+			label, stats.events, stats.throughput(), files, dirs,
+			r.FilesScanned, r.DirsScanned, r.Duration.Round(time.Microsecond),
+			files-int64(r.FilesScanned), dirs-int64(r.DirsScanned))
+		return nil
+	}
+
+	deadline := time.After(*duration)
+	ticker := time.NewTicker(*rescan)
+	defer ticker.Stop()
+	watchStart := time.Now()
+	running := true
+	for running {
+		select {
+		case batch := <-watcher.Events():
+			err = stats.process(tree, batch, *workers)
+		case <-ticker.C:
+			err = compare(fmt.Sprintf("%6.1fs", time.Since(watchStart).Seconds()))
+		case <-deadline:
+			running = false
+		}
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	}
+
+	if churn != nil {
+		fmt.Printf("変更操作: %d\n", churn.Stop())
+	}
+	// Apply the trailing events, including the cleanup of the churner
+	for settled := false; !settled; {
+		select {
+		case batch := <-watcher.Events():
+			err = stats.process(tree, batch, *workers)
+		case <-time.After(watchSettle):
+			settled = true
+		}
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return 1
+		}
+	}
+	if err := compare("最終"); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("\n===== watch の結果 =====")
+	fmt.Printf("イベント: %d (バッチ %d, 最大バッチ %d, オーバーフロー %d)\n", stats.events, stats.batches, stats.maxBatch, stats.overflows)
+	fmt.Printf("イベント処理時間: %v (%.0f 件/s)\n", stats.processing.Round(time.Microsecond), stats.throughput())
+	if rescans > 0 {
+		fmt.Printf("再スキャン: %d 回, 平均 %v, 合計 %v\n", rescans, (rescanTotal / time.Duration(rescans)).Round(time.Microsecond), rescanTotal.Round(time.Microsecond))
+	}
+	return 0
+}
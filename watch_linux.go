@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events that change the counts of a directory
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// inotifyWatcher reports changes of watched directories with inotify
+type inotifyWatcher struct {
+	file   *os.File
+	fd     int
+	mu     sync.Mutex
+	paths  map[int32]string
+	events chan []fsEvent
+}
+
+// newDirWatcher starts an inotify instance. The descriptor is non-blocking,
+// so reads park in the runtime poller and Close ends them.
+func newDirWatcher() (dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		paths:  map[int32]string{},
+		events: make(chan []fsEvent, 1024),
+	}
+	go w.read()
+	return w, nil
+}
+
+// Add watches dir. A directory that is already watched, e.g. after a
+// rename, keeps its descriptor and is mapped to its new path.
+func (w *inotifyWatcher) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.mu.Lock()
+	w.paths[int32(wd)] = dir
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan []fsEvent {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+// read decodes inotify records into one batch per read until the watcher is closed
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		batch := []fsEvent{}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				batch = append(batch, fsEvent{Op: fsOverflow})
+				continue
+			}
+			w.mu.Lock()
+			dir, ok := w.paths[raw.Wd]
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.paths, raw.Wd)
+			}
+			w.mu.Unlock()
+			if !ok || raw.Len == 0 {
+				continue
+			}
+			// The name is padded with NUL bytes
+			name := string(nameBytes)
+			for i := 0; i < len(name); i++ {
+				if name[i] == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			event := fsEvent{Path: filepath.Join(dir, name), IsDir: raw.Mask&syscall.IN_ISDIR != 0}
+			switch {
+			case raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+				event.Op = fsCreate
+			case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				event.Op = fsRemove
+			default:
+				continue
+			}
+			batch = append(batch, event)
+		}
+		if len(batch) > 0 {
+			w.events <- batch
+		}
+	}
+}
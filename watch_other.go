@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newDirWatcher is only implemented with inotify on Linux
+func newDirWatcher() (dirWatcher, error) {
+	return nil, errors.New("watch is only supported on Linux (inotify)")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// stallDumpDir is where the goroutine stacks of stalled scans are written
+const stallDumpDir = "benchmark"
+
+// stallWatchdog cancels a scan whose progress counts stop changing for the
+// stall timeout, after writing the stacks of all goroutines to a file. A
+// deadlocked worker pool then costs one cell instead of the whole session.
+type stallWatchdog struct {
+	progress *progressTracker
+	timeout  time.Duration
+	cancel   func()
+	// label describes the cell in the dump, written to dir
+	label    string
+	dir      string
+	stop     chan struct{}
+	finished chan struct{}
+	// stalled and dump are written before finished is closed
+	stalled bool
+	dump    string
+	err     error
+}
+
+// startStallWatchdog watches the counts of progress; cancel stops the scan
+func startStallWatchdog(progress *progressTracker, timeout time.Duration, cancel func(), label, dir string) *stallWatchdog {
+	w := &stallWatchdog{
+		progress: progress,
+		timeout:  timeout,
+		cancel:   cancel,
+		label:    label,
+		dir:      dir,
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// count is the number of directories done and files found so far
+func (w *stallWatchdog) count() int64 {
+	return atomic.LoadInt64(&w.progress.dirs) + atomic.LoadInt64(&w.progress.files)
+}
+
+func (w *stallWatchdog) run() {
+	defer close(w.finished)
+	ticker := time.NewTicker(max(w.timeout/10, time.Millisecond))
+	defer ticker.Stop()
+	last, changed := w.count(), time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			if count := w.count(); count != last {
+				last, changed = count, now
+				continue
+			}
+			if idle := now.Sub(changed); idle >= w.timeout {
+				w.stalled = true
+				w.dump, w.err = writeStallDump(w.dir, w.label, idle, last)
+				w.cancel()
+				return
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop stops watching and reports whether the scan stalled, with the file
+// holding the goroutine stacks or the error writing it. A nil watchdog
+// reports no stall.
+func (w *stallWatchdog) Stop() (stalled bool, dump string, err error) {
+	if w == nil {
+		return false, "", nil
+	}
+	close(w.stop)
+	<-w.finished
+	return w.stalled, w.dump, w.err
+}
+
+// writeStallDump writes the stacks of all goroutines, in the format of an
+// unrecovered panic, to a new file in dir and returns its path
+func writeStallDump(dir, label string, idle time.Duration, count int64) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, "stall_"+time.Now().Format("20060102_150405")+"_*.txt")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(file, "%s: no progress for %s after %d directories and files\n\n", label, idle.Round(time.Millisecond), count)
+	if err := pprof.Lookup("goroutine").WriteTo(file, 2); err != nil {
+		file.Close()
+		return "", err
+	}
+	return filepath.Clean(file.Name()), file.Close()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStallWatchdogCancelsStalledScan(t *testing.T) {
+	dir := t.TempDir()
+	progress := startProgressTracker(ScanOptions{})
+	defer progress.Stop()
+	progress.dirDone()
+
+	var cancelled atomic.Bool
+	w := startStallWatchdog(progress, 20*time.Millisecond, func() { cancelled.Store(true) }, "stuck cell", dir)
+	deadline := time.Now().Add(5 * time.Second)
+	for !cancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stalled, dump, err := w.Stop()
+	if !stalled || !cancelled.Load() {
+		t.Fatalf("stalled = %v, cancelled = %v, want both", stalled, cancelled.Load())
+	}
+	if err != nil {
+		t.Fatalf("writing the dump: %v", err)
+	}
+	data, err := os.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "stuck cell: no progress") || !strings.Contains(string(data), ".TestStallWatchdogCancelsStalledScan(") {
+		t.Errorf("dump does not describe the cell and hold the stacks of all goroutines:\n%s", data)
+	}
+}
+
+func TestStallWatchdogKeepsProgressingScan(t *testing.T) {
+	progress := startProgressTracker(ScanOptions{})
+	defer progress.Stop()
+	w := startStallWatchdog(progress, 50*time.Millisecond, func() { t.Error("cancelled a progressing scan") }, "busy cell", t.TempDir())
+	for i := 0; i < 40; i++ {
+		progress.filesFound(1)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stalled, _, _ := w.Stop(); stalled {
+		t.Error("stalled = true for a scan finding a file every 5ms")
+	}
+	var none *stallWatchdog
+	if stalled, dump, err := none.Stop(); stalled || dump != "" || err != nil {
+		t.Errorf("nil watchdog Stop() = %v, %q, %v", stalled, dump, err)
+	}
+}
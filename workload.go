@@ -0,0 +1,606 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Workloads applied to the entries found by the scanners
+const (
+	// WorkloadScan only counts entries
+	WorkloadScan = "scan"
+	// WorkloadDelete removes every file as it is found and the emptied
+	// directories afterwards, deepest first
+	WorkloadDelete = "delete"
+	// WorkloadCopy mirrors the tree below a destination directory: directories
+	// are created as they are listed and files copied as they are found
+	WorkloadCopy = "copy"
+	// WorkloadStat lstats every entry as it is found, by the worker that
+	// found it, as consumers needing the size or mtime of each entry do
+	WorkloadStat = "stat"
+	// WorkloadXattr lists and reads the extended attributes (and so the
+	// POSIX ACLs) of every regular file as it is found (Linux)
+	WorkloadXattr = "xattr"
+	// WorkloadAge buckets every file by the age of its mtime, as retention
+	// policy tools do
+	WorkloadAge = "age"
+)
+
+// ageBucketCount is the number of buckets of the age workload
+const ageBucketCount = 5
+
+// ageBucketLimits are the upper bounds of the age buckets but the last
+var ageBucketLimits = [ageBucketCount - 1]time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour, 365 * 24 * time.Hour}
+
+// ageBucketNames name the age buckets: up to a day, week, month (30 days),
+// year (365 days) and older
+var ageBucketNames = [ageBucketCount]string{"1d", "1w", "1m", "1y", "older"}
+
+// ageBucket returns the bucket of a file modified age ago; files from the
+// future count as new
+func ageBucket(age time.Duration) int {
+	for i, limit := range ageBucketLimits {
+		if age <= limit {
+			return i
+		}
+	}
+	return ageBucketCount - 1
+}
+
+// Calls the stat workload reads the entries with
+const (
+	// StatCallLstat reads every field of the entry with lstat
+	StatCallLstat = "lstat"
+	// StatCallStatx asks statx for only the type and size (Linux); kernels
+	// without statx fall back to lstat
+	StatCallStatx = "statx"
+)
+
+// copyQueueCapacity is the number of files waiting for a separate copier pool
+const copyQueueCapacity = 1024
+
+// StrategyRemoveAll deletes a tree with os.RemoveAll, the reference of the
+// delete workload
+const StrategyRemoveAll = "os.RemoveAll"
+
+// parseWorkloads validates a comma separated -workload value. The workloads
+// that only read the tree, scan, stat, xattr and age, can be swept together;
+// delete and copy change the disk and run alone.
+func parseWorkloads(value string) ([]string, error) {
+	workloads := []string{}
+	for _, workload := range strings.Split(value, ",") {
+		workload = strings.TrimSpace(workload)
+		switch workload {
+		case WorkloadScan, WorkloadStat, WorkloadAge, WorkloadDelete, WorkloadCopy:
+			workloads = append(workloads, workload)
+		case WorkloadXattr:
+			if !xattrSupported {
+				return nil, fmt.Errorf("xattr is only available on Linux")
+			}
+			workloads = append(workloads, workload)
+		default:
+			return nil, fmt.Errorf("unknown workload: %s", workload)
+		}
+		if workloadWrites(workload) && strings.Contains(value, ",") {
+			return nil, fmt.Errorf("%s cannot be combined with other workloads", workload)
+		}
+	}
+	return workloads, nil
+}
+
+// workloadWrites reports whether a workload changes the disk, so that every
+// run must be prepared and nothing else may use the tree meanwhile
+func workloadWrites(workload string) bool {
+	return workload == WorkloadDelete || workload == WorkloadCopy
+}
+
+// workloadLabel returns the Workload of a result: empty for a plain scan
+func workloadLabel(workload string) string {
+	if workload == WorkloadScan {
+		return ""
+	}
+	return workload
+}
+
+// parseStatCalls parses a comma separated -stat-call value
+func parseStatCalls(value string) ([]string, error) {
+	calls := []string{}
+	for _, call := range strings.Split(value, ",") {
+		call = strings.TrimSpace(call)
+		switch call {
+		case StatCallLstat:
+		case StatCallStatx:
+			if !statxSupported {
+				return nil, fmt.Errorf("statx is only available on Linux amd64/arm64")
+			}
+		default:
+			return nil, fmt.Errorf("unknown stat call: %s (%s, %s)", call, StatCallLstat, StatCallStatx)
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// workloadVariantLabel describes a workload swept with -workload scan,stat
+// in the label of a result, with the call of the stat workload
+func workloadVariantLabel(workload, statCall string) string {
+	switch {
+	case workload == WorkloadXattr, workload == WorkloadAge:
+		return workload
+	case workload != WorkloadStat:
+		return ""
+	case statCall == StatCallStatx:
+		return "stat=statx"
+	}
+	return WorkloadStat
+}
+
+// parseCopyWorkers parses a comma separated list of copier pool sizes
+func parseCopyWorkers(value string) ([]int, error) {
+	counts := []int{}
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("copier pool size must not be negative: %d", n)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+// copyMirror returns the directory a copy of root is written to
+func copyMirror(dest, root string) string {
+	return filepath.Join(dest, filepath.Base(filepath.Clean(root)))
+}
+
+// checkCopyDest returns an error when the copies of roots below dest would
+// be written into a copied tree or overwrite an existing directory
+func checkCopyDest(dest string, roots []string) error {
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	mirrors := map[string]string{}
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		if absDest == absRoot || strings.HasPrefix(absDest, absRoot+string(os.PathSeparator)) {
+			return fmt.Errorf("destination %s is inside the copied tree %s", dest, root)
+		}
+		mirror := copyMirror(dest, root)
+		if other, ok := mirrors[mirror]; ok {
+			return fmt.Errorf("%s and %s would both be copied to %s", other, root, mirror)
+		}
+		mirrors[mirror] = root
+		if _, err := os.Lstat(mirror); err == nil {
+			return fmt.Errorf("%s already exists; copies are only written to new directories", mirror)
+		}
+	}
+	return nil
+}
+
+// workloadRun applies a workload to the entries of one scan. The scanners
+// call Dir before listing a directory and File for every non-directory entry,
+// from their worker goroutines. A nil *workloadRun does nothing.
+type workloadRun struct {
+	kind string
+	root string
+	// mirror is the root of the copy
+	mirror string
+
+	mu   sync.Mutex
+	dirs []string
+	// failures records the operations that failed, merged into the scan result
+	failures ScanResult
+
+	// copies feeds the separate copier pool, nil when scan workers copy
+	copies  chan copyJob
+	copiers sync.WaitGroup
+	// copierCount is the number of copiers start starts
+	copierCount int
+	// copiedFiles, copiedBytes and skipped count the copied entries and the
+	// special files that cannot be copied
+	copiedFiles int64
+	copiedBytes int64
+	skipped     int64
+	// statCalls and statBytes count the entries lstat'ed by the stat
+	// workload and the sizes of the regular files among them
+	statCalls int64
+	statBytes int64
+	// statx asks for the type and size only; statFallbacks counts the
+	// entries read with lstat as statx was not available
+	statx         bool
+	statFallbacks int64
+	// xattrFiles counts the files with extended attributes, xattrCalls the
+	// listxattr and getxattr calls and xattrBytes the size of the values
+	xattrFiles int64
+	xattrCalls int64
+	xattrBytes int64
+	// now is the start of the age workload's scan, which ages are relative
+	// to, and ages the files per age bucket
+	now  time.Time
+	ages [ageBucketCount]int64
+}
+
+// copyJob is a file waiting for a copier
+type copyJob struct {
+	src, dst string
+	entry    fs.DirEntry
+}
+
+// newWorkloadRun prepares the workload of options on the tree at root; the
+// copiers of the copy workload wait for start. Destructive workloads only
+// run on fixtures generated by this process.
+func newWorkloadRun(options ScanOptions, root string) (*workloadRun, error) {
+	switch options.Workload {
+	case "", WorkloadScan:
+		return nil, nil
+	case WorkloadDelete:
+		if err := checkOwnFixture(root); err != nil {
+			return nil, err
+		}
+		return &workloadRun{kind: WorkloadDelete, root: root}, nil
+	case WorkloadStat:
+		return &workloadRun{kind: WorkloadStat, root: root, statx: options.StatCall == StatCallStatx}, nil
+	case WorkloadXattr:
+		return &workloadRun{kind: WorkloadXattr, root: root}, nil
+	case WorkloadAge:
+		return &workloadRun{kind: WorkloadAge, root: root, now: time.Now()}, nil
+	}
+
+	w := &workloadRun{kind: WorkloadCopy, root: root, mirror: copyMirror(options.CopyDest, root)}
+	if options.CopyWorkers > 0 {
+		w.copies = make(chan copyJob, copyQueueCapacity)
+		w.copierCount = options.CopyWorkers
+	}
+	return w, nil
+}
+
+// start starts the copiers of the copy workload
+func (w *workloadRun) start() {
+	if w == nil || w.copies == nil {
+		return
+	}
+	w.copiers.Add(w.copierCount)
+	for i := 0; i < w.copierCount; i++ {
+		go func() {
+			defer w.copiers.Done()
+			for job := range w.copies {
+				w.copy(job)
+			}
+		}()
+	}
+}
+
+// checkOwnFixture returns an error unless root is a generated fixture whose
+// marker was written by the current process
+func checkOwnFixture(root string) error {
+	if !strings.HasPrefix(filepath.Base(root), fixturePrefix) {
+		return fmt.Errorf("refusing to modify %s: not a generated fixture", root)
+	}
+	marker, err := readFixtureMarker(root)
+	if err != nil {
+		return fmt.Errorf("refusing to modify %s: no fixture marker: %v", root, err)
+	}
+	if marker.PID != os.Getpid() {
+		return fmt.Errorf("refusing to modify %s: generated by another process (pid %d)", root, marker.PID)
+	}
+	return nil
+}
+
+// Dir is called before the directory at path is listed
+func (w *workloadRun) Dir(path string) {
+	if w == nil {
+		return
+	}
+	if w.kind == WorkloadStat {
+		w.stat(path)
+		return
+	}
+	if w.kind == WorkloadXattr || w.kind == WorkloadAge {
+		return
+	}
+	if w.kind == WorkloadCopy {
+		// The parent was created before the directory was found in its listing
+		w.fail(os.Mkdir(w.target(path), 0755))
+		return
+	}
+	w.mu.Lock()
+	w.dirs = append(w.dirs, path)
+	w.mu.Unlock()
+}
+
+// File is called for every non-directory entry of dir
+func (w *workloadRun) File(dir string, entry fs.DirEntry) {
+	if w == nil {
+		return
+	}
+	src := filepath.Join(dir, entry.Name())
+	if w.kind == WorkloadStat {
+		w.stat(src)
+		return
+	}
+	if w.kind == WorkloadXattr {
+		if entry.Type().IsRegular() {
+			w.xattrs(src)
+		}
+		return
+	}
+	if w.kind == WorkloadAge {
+		w.age(entry)
+		return
+	}
+	if w.kind != WorkloadCopy {
+		w.fail(os.Remove(src))
+		return
+	}
+	job := copyJob{src: src, dst: w.target(src), entry: entry}
+	if w.copies != nil {
+		w.copies <- job
+	} else {
+		w.copy(job)
+	}
+}
+
+// stat lstats an entry of the stat workload, or reads only its type and
+// size with statx
+func (w *workloadRun) stat(path string) {
+	if w.statx {
+		size, regular, ok, err := statxMinimal(path)
+		if ok {
+			if err != nil {
+				w.fail(err)
+				return
+			}
+			atomic.AddInt64(&w.statCalls, 1)
+			if regular {
+				atomic.AddInt64(&w.statBytes, size)
+			}
+			return
+		}
+		atomic.AddInt64(&w.statFallbacks, 1)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	atomic.AddInt64(&w.statCalls, 1)
+	if info.Mode().IsRegular() {
+		atomic.AddInt64(&w.statBytes, info.Size())
+	}
+}
+
+// statListed records an entry of the stat workload whose type and size came
+// with the listing of its directory, so that it needs no call of its own
+func (w *workloadRun) statListed(regular bool, size int64) {
+	if w == nil || w.kind != WorkloadStat {
+		return
+	}
+	atomic.AddInt64(&w.statCalls, 1)
+	if regular {
+		atomic.AddInt64(&w.statBytes, size)
+	}
+}
+
+// xattrs reads the extended attributes of a file of the xattr workload
+func (w *workloadRun) xattrs(path string) {
+	calls, attrs, size, err := readXattrs(path)
+	atomic.AddInt64(&w.xattrCalls, int64(calls))
+	if attrs > 0 {
+		atomic.AddInt64(&w.xattrFiles, 1)
+		atomic.AddInt64(&w.xattrBytes, size)
+	}
+	w.fail(err)
+}
+
+// age counts a file of the age workload in the bucket of its mtime; the
+// entry's lstat is made on the worker that found it
+func (w *workloadRun) age(entry fs.DirEntry) {
+	info, err := entry.Info()
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	atomic.AddInt64(&w.ages[ageBucket(w.now.Sub(info.ModTime()))], 1)
+}
+
+// target returns the path in the copy of a path below the root
+func (w *workloadRun) target(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.Join(w.mirror, rel)
+}
+
+// copy copies a regular file or recreates a symlink. FIFOs, sockets and
+// devices are skipped: opening a FIFO would block.
+func (w *workloadRun) copy(job copyJob) {
+	switch job.entry.Type() {
+	case 0:
+		n, err := copyFile(job.src, job.dst)
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		atomic.AddInt64(&w.copiedFiles, 1)
+		atomic.AddInt64(&w.copiedBytes, n)
+	case fs.ModeSymlink:
+		target, err := os.Readlink(job.src)
+		if err == nil {
+			err = os.Symlink(target, job.dst)
+		}
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		atomic.AddInt64(&w.copiedFiles, 1)
+	default:
+		atomic.AddInt64(&w.skipped, 1)
+	}
+}
+
+// copyFile copies the content and permissions of a regular file to a new
+// file and returns the number of bytes copied
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	// *os.File to *os.File lets the runtime use copy_file_range or sendfile
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// fail records a failed operation; nil errors are ignored
+func (w *workloadRun) fail(err error) {
+	if err != nil {
+		w.failures.addError(err)
+	}
+}
+
+// finish completes the workload after the scan: the copier pool drains its
+// queue, and the directories emptied by the delete workload are removed
+// level by level, deepest first, with numWorkers goroutines per level (all
+// CPUs when 0). Failed operations are added to the errors of result.
+func (w *workloadRun) finish(numWorkers int, result *ScanResult) {
+	if w == nil {
+		return
+	}
+	if w.copies != nil {
+		close(w.copies)
+		w.copiers.Wait()
+	}
+	if numWorkers < 1 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	levels := map[int][]string{}
+	depths := []int{}
+	for _, dir := range w.dirs {
+		depth := strings.Count(filepath.Clean(dir), string(os.PathSeparator))
+		if _, ok := levels[depth]; !ok {
+			depths = append(depths, depth)
+		}
+		levels[depth] = append(levels[depth], dir)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+
+	for _, depth := range depths {
+		dirs := make(chan string, len(levels[depth]))
+		for _, dir := range levels[depth] {
+			dirs <- dir
+		}
+		close(dirs)
+		var wg sync.WaitGroup
+		wg.Add(numWorkers)
+		for i := 0; i < numWorkers; i++ {
+			go func() {
+				defer wg.Done()
+				for dir := range dirs {
+					err := os.Remove(dir)
+					if errors.Is(err, fs.ErrNotExist) {
+						err = nil
+					}
+					w.fail(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	result.add(&w.failures)
+}
+
+// removeAllScanner deletes the whole tree with a single os.RemoveAll call.
+// It does not count entries.
+type removeAllScanner struct{}
+
+func (removeAllScanner) Scan(rootPath string) (*ScanResult, error) {
+	result := &ScanResult{}
+	if err := os.RemoveAll(rootPath); err != nil {
+		result.addError(err)
+	}
+	return result, result.Err()
+}
+
+// printWorkloadOverhead compares every cell of the stat, xattr and age
+// workloads with the scan of the same configuration, for -workload scan,stat
+func printWorkloadOverhead(results []BenchmarkResult) {
+	type cellKey struct {
+		structure, label string
+		workers          int
+	}
+	scans := map[cellKey]BenchmarkResult{}
+	for _, r := range results {
+		if r.Workload == "" && !r.TimedOut {
+			scans[cellKey{r.Structure, r.Label(), r.Workers}] = r
+		}
+	}
+	table := &textTable{
+		header: []string{"Structure", "Strategy", "Workers", "Scan", "Scan+workload", "Overhead", "Calls/s"},
+		right:  []bool{false, false, true, true, true, true, true},
+	}
+	rows := 0
+	for _, r := range results {
+		var calls int64
+		switch r.Workload {
+		case WorkloadStat:
+			calls = r.StatCalls
+		case WorkloadXattr:
+			calls = r.XattrCalls
+		case WorkloadAge:
+			for _, n := range r.AgeHistogram {
+				calls += n
+			}
+		default:
+			continue
+		}
+		if r.TimedOut {
+			continue
+		}
+		plain := r
+		plain.Workload, plain.StatCall = "", ""
+		scan, ok := scans[cellKey{r.Structure, plain.Label(), r.Workers}]
+		if !ok {
+			continue
+		}
+		table.add(r.Structure, r.Label(), strconv.Itoa(r.Workers), formatDuration(scan.Duration), formatDuration(r.Duration),
+			fmt.Sprintf("%+.1f%%", (float64(r.Duration)/float64(scan.Duration)-1)*100),
+			fmt.Sprintf("%.0f", float64(calls)/r.Duration.Seconds()))
+		rows++
+	}
+	if rows == 0 {
+		return
+	}
+	fmt.Println("\n===== ワークロードのオーバーヘッド (一覧のみ と 一覧+stat / xattr / age) =====")
+	table.render(os.Stdout, false)
+}
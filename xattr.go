@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// fixtureXattrName is the extended attribute set on fixture files by
+// -xattr-fraction; user attributes need no privileges
+const fixtureXattrName = "user.benchmark"
+
+// createXattrs sets fixtureXattrName on an evenly spread fraction of the
+// regular files of a fixture
+func createXattrs(rootPath string, config Config) error {
+	if config.XattrFraction <= 0 {
+		return nil
+	}
+	value := []byte("go-parallel-dir-scan-benchmark")
+	i := 0
+	return filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || d.Name() == fixtureMarkerName {
+			return err
+		}
+		// The file is chosen when the running count of chosen files grows
+		chosen := int(float64(i+1)*config.XattrFraction) > int(float64(i)*config.XattrFraction)
+		i++
+		if !chosen {
+			return nil
+		}
+		return setXattr(path, fixtureXattrName, value)
+	})
+}
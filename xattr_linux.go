@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+// xattrSupported reports whether extended attributes can be read and set
+const xattrSupported = true
+
+// xattrListSize is the initial buffer for the attribute names of a file
+const xattrListSize = 1024
+
+// readXattrs lists the extended attributes of a file and reads every value,
+// as security scanners and backup tools do. POSIX ACLs are among them as
+// system.posix_acl_*. Filesystems without xattrs count as files without
+// attributes.
+func readXattrs(path string) (calls, attrs int, size int64, err error) {
+	names := make([]byte, xattrListSize)
+	n, err := syscall.Listxattr(path, names)
+	calls++
+	if err == syscall.ERANGE {
+		// Too many names for the buffer: ask for the size and retry
+		if n, err = syscall.Listxattr(path, nil); err == nil {
+			names = make([]byte, n)
+			n, err = syscall.Listxattr(path, names)
+		}
+		calls += 2
+	}
+	if err == syscall.ENOTSUP {
+		return calls, 0, 0, nil
+	}
+	if err != nil {
+		return calls, 0, 0, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	value := make([]byte, 256)
+	for _, name := range bytes.Split(names[:n], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attrs++
+		v, err := syscall.Getxattr(path, string(name), value)
+		calls++
+		if err == syscall.ERANGE {
+			if v, err = syscall.Getxattr(path, string(name), nil); err == nil {
+				value = make([]byte, v)
+				v, err = syscall.Getxattr(path, string(name), value)
+			}
+			calls += 2
+		}
+		if err != nil {
+			return calls, attrs, size, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		size += int64(v)
+	}
+	return calls, attrs, size, nil
+}
+
+// setXattr sets a user attribute on a fixture file
+func setXattr(path, name string, value []byte) error {
+	if err := syscall.Setxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
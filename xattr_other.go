@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// xattrSupported reports whether extended attributes can be read and set
+const xattrSupported = false
+
+var errXattrUnsupported = errors.New("extended attributes are only supported on Linux")
+
+func readXattrs(path string) (calls, attrs int, size int64, err error) {
+	return 0, 0, 0, errXattrUnsupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXH64 primes
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 is a streaming XXH64 with seed 0, the fast non-cryptographic
+// hash the dupes subcommand offers besides MD5. It implements hash.Hash64.
+type xxhash64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+func newXXHash64() *xxhash64 {
+	h := &xxhash64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxhash64) Reset() {
+	// The seeds wrap around, which constant arithmetic does not allow
+	p1, p2 := xxPrime1, xxPrime2
+	h.v1 = p1 + p2
+	h.v2 = p2
+	h.v3 = 0
+	h.v4 = -p1
+	h.total, h.n = 0, 0
+}
+
+func (h *xxhash64) Size() int      { return 8 }
+func (h *xxhash64) BlockSize() int { return 32 }
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+// stripes consumes whole 32 byte stripes of b
+func (h *xxhash64) stripes(b []byte) {
+	for ; len(b) >= 32; b = b[32:] {
+		h.v1 = xxRound(h.v1, binary.LittleEndian.Uint64(b[0:]))
+		h.v2 = xxRound(h.v2, binary.LittleEndian.Uint64(b[8:]))
+		h.v3 = xxRound(h.v3, binary.LittleEndian.Uint64(b[16:]))
+		h.v4 = xxRound(h.v4, binary.LittleEndian.Uint64(b[24:]))
+	}
+}
+
+func (h *xxhash64) Write(b []byte) (int, error) {
+	written := len(b)
+	h.total += uint64(written)
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], b)
+		h.n += c
+		b = b[c:]
+		if h.n < 32 {
+			return written, nil
+		}
+		h.stripes(h.buf[:])
+		h.n = 0
+	}
+	whole := len(b) &^ 31
+	h.stripes(b[:whole])
+	h.n = copy(h.buf[:], b[whole:])
+	return written, nil
+}
+
+func (h *xxhash64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v1, 1) + bits.RotateLeft64(h.v2, 7) + bits.RotateLeft64(h.v3, 12) + bits.RotateLeft64(h.v4, 18)
+		acc = xxMergeRound(acc, h.v1)
+		acc = xxMergeRound(acc, h.v2)
+		acc = xxMergeRound(acc, h.v3)
+		acc = xxMergeRound(acc, h.v4)
+	} else {
+		acc = h.v3 + xxPrime5
+	}
+	acc += h.total
+
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		acc ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		acc = bits.RotateLeft64(acc, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		acc ^= uint64(c) * xxPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxPrime2
+	acc ^= acc >> 29
+	acc *= xxPrime3
+	acc ^= acc >> 32
+	return acc
+}
+
+func (h *xxhash64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}